@@ -0,0 +1,405 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/piske-alex/go-sse/pkg/client"
+)
+
+// config holds the options of a run
+type config struct {
+	server         string
+	token          string
+	clients        int
+	filters        []string // Filters of the clients, assigned in turn
+	path           string
+	rate           float64
+	payload        int
+	writers        int
+	duration       time.Duration
+	interval       time.Duration
+	connectTimeout time.Duration
+	drain          time.Duration
+}
+
+// subscriber is one SSE connection
+type subscriber struct {
+	sub        *client.Subscription
+	connected  atomic.Bool
+	matching   atomic.Bool  // Received the probe write
+	received   atomic.Int64 // Events received for the measured writes
+	reconnects atomic.Int64
+}
+
+// benchmark runs the connections and the write traffic of a run
+type benchmark struct {
+	cfg        config
+	client     *client.Client
+	httpClient *http.Client
+	start      time.Time
+	padding    string
+
+	subscribers []*subscriber
+	measuring   atomic.Bool // Set once the probe is over and the measured writes start
+
+	acked   atomic.Int64
+	failed  atomic.Int64
+	skipped atomic.Int64
+
+	writeLatency *histogram
+	eventLatency *histogram
+	window       atomic.Pointer[histogram] // Event latencies since the last sample
+}
+
+// run connects the clients, drives the writes and returns the report
+func run(ctx context.Context, cfg config) (*Report, error) {
+	// Every connection needs its own TCP connection, writes share a few kept alive
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = cfg.writers
+	httpClient := &http.Client{Transport: transport}
+
+	options := []client.Option{client.WithHTTPClient(httpClient)}
+	if cfg.token != "" {
+		options = append(options, client.WithHeader("Authorization", "Bearer "+cfg.token))
+	}
+	c, err := client.New(cfg.server, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	// The value of a write is {"seq", "sent_us", "pad"}, padded to the payload size
+	padding := ""
+	if cfg.payload > 48 {
+		padding = strings.Repeat("x", cfg.payload-48)
+	}
+
+	b := &benchmark{
+		cfg:          cfg,
+		client:       c,
+		httpClient:   httpClient,
+		start:        time.Now(),
+		padding:      padding,
+		writeLatency: &histogram{},
+		eventLatency: &histogram{},
+	}
+	b.window.Store(&histogram{})
+	defer b.close()
+
+	report := &Report{
+		Server:  cfg.server,
+		Started: b.start,
+		Settings: Settings{
+			Clients:         cfg.clients,
+			Filters:         cfg.filters,
+			Path:            cfg.path,
+			Rate:            cfg.rate,
+			PayloadBytes:    cfg.payload,
+			Writers:         cfg.writers,
+			DurationSeconds: cfg.duration.Seconds(),
+		},
+	}
+
+	connectTime, err := b.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report.Clients.ConnectMS = milliseconds(connectTime)
+
+	if err := b.probe(ctx); err != nil {
+		return nil, err
+	}
+	for _, s := range b.subscribers {
+		if s.connected.Load() {
+			report.Clients.Connected++
+		}
+		if s.matching.Load() {
+			report.Clients.Matching++
+		}
+	}
+	report.Clients.Requested = cfg.clients
+
+	b.measuring.Store(true)
+	writeStart := time.Now()
+	report.Samples = b.drive(ctx)
+	writeTime := time.Since(writeStart)
+	b.waitForEvents(ctx)
+	report.Samples = append(report.Samples, b.sample(ctx))
+
+	report.Writes = WriteCounts{
+		Acked:        b.acked.Load(),
+		Failed:       b.failed.Load(),
+		Skipped:      b.skipped.Load(),
+		AchievedRate: float64(b.acked.Load()) / writeTime.Seconds(),
+		Latency:      b.writeLatency.summary(),
+	}
+	report.Events.Latency = b.eventLatency.summary()
+	for _, s := range b.subscribers {
+		report.Clients.Reconnects += s.reconnects.Load()
+		select {
+		case <-s.sub.Done():
+			report.Clients.Stopped++
+		default:
+		}
+		if !s.matching.Load() {
+			continue
+		}
+		received := s.received.Load()
+		report.Events.Expected += report.Writes.Acked
+		report.Events.Received += received
+		if received < report.Writes.Acked {
+			report.Events.Dropped += report.Writes.Acked - received
+		}
+	}
+	report.Growth = growth(report.Samples)
+	return report, nil
+}
+
+// connect opens the connections and waits until they are all established or the
+// connect timeout passes
+func (b *benchmark) connect(ctx context.Context) (time.Duration, error) {
+	started := time.Now()
+	for i := 0; i < b.cfg.clients; i++ {
+		s := &subscriber{}
+		s.sub = b.client.Subscribe(ctx, client.SubscribeOptions{
+			Filters: []string{b.cfg.filters[i%len(b.cfg.filters)]},
+			OnEvent: func(event client.Event) { b.onEvent(s, event) },
+			OnError: func(error) {
+				s.connected.Store(false)
+				s.reconnects.Add(1)
+			},
+		})
+		b.subscribers = append(b.subscribers, s)
+	}
+
+	deadline := time.After(b.cfg.connectTimeout)
+wait:
+	for _, s := range b.subscribers {
+		select {
+		case <-s.sub.Connected():
+		case <-s.sub.Done():
+		case <-deadline:
+			break wait
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+	elapsed := time.Since(started)
+
+	// Runs where only some clients connect are reported; runs where none did are not
+	var refused error
+	for _, s := range b.subscribers {
+		select {
+		case <-s.sub.Connected():
+			return elapsed, nil
+		case <-s.sub.Done():
+			refused = s.sub.Err()
+		default:
+		}
+	}
+	if refused != nil {
+		return 0, fmt.Errorf("no client connected: %w", refused)
+	}
+	return 0, fmt.Errorf("no client connected within %s", b.cfg.connectTimeout)
+}
+
+// probe writes once and waits for the events, to learn which clients' filters match
+// the write path. Only their events are expected during the run.
+func (b *benchmark) probe(ctx context.Context) error {
+	if err := b.client.Set(ctx, b.cfg.path, b.value(0)); err != nil {
+		return fmt.Errorf("failed to write to %s: %w", b.cfg.path, err)
+	}
+
+	// Wait until every connected client has the event, or no more arrive for a while
+	// because some filters do not match
+	deadline := time.Now().Add(5 * time.Second)
+	lastMatching, settled := 0, time.Now()
+	for time.Now().Before(deadline) && ctx.Err() == nil {
+		matching, connected := 0, 0
+		for _, s := range b.subscribers {
+			if s.connected.Load() {
+				connected++
+			}
+			if s.matching.Load() {
+				matching++
+			}
+		}
+		if matching != lastMatching {
+			lastMatching, settled = matching, time.Now()
+		}
+		if matching > 0 && (matching == connected || time.Since(settled) > 500*time.Millisecond) {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if lastMatching == 0 {
+		return errors.New("no client received the probe write; check that the filters match the write path")
+	}
+	return nil
+}
+
+// onEvent records the events of the writes
+func (b *benchmark) onEvent(s *subscriber, event client.Event) {
+	switch event.Type {
+	case "connected":
+		s.connected.Store(true)
+		return
+	case "update":
+	default:
+		return
+	}
+
+	if !b.measuring.Load() {
+		s.matching.Store(true)
+		return
+	}
+	s.received.Add(1)
+
+	// Values reshaped by the client's filters carry no timestamp and count without a latency
+	value, ok := event.Value.(map[string]interface{})
+	if !ok {
+		return
+	}
+	sent, ok := value["sent_us"].(float64)
+	if !ok {
+		return
+	}
+	latency := time.Since(b.start) - time.Duration(sent)*time.Microsecond
+	b.eventLatency.record(latency)
+	b.window.Load().record(latency)
+}
+
+// value returns the value of write seq
+func (b *benchmark) value(seq int64) map[string]interface{} {
+	return map[string]interface{}{
+		"seq":     seq,
+		"sent_us": time.Since(b.start).Microseconds(),
+		"pad":     b.padding,
+	}
+}
+
+// drive sends writes at the configured rate for the configured duration, sampling
+// the run at every interval
+func (b *benchmark) drive(ctx context.Context) []Sample {
+	// Samples are taken with ctx so that one taken as the writes end still reads the server
+	writeCtx, cancel := context.WithTimeout(ctx, b.cfg.duration)
+	defer cancel()
+
+	jobs := make(chan int64, b.cfg.writers)
+	var wg sync.WaitGroup
+	for i := 0; i < b.cfg.writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for seq := range jobs {
+				b.write(writeCtx, seq)
+			}
+		}()
+	}
+
+	samples := []Sample{b.sample(ctx)}
+	sampler := time.NewTicker(b.cfg.interval)
+	defer sampler.Stop()
+
+	// Writes due since the start are issued at every tick, so rates above the tick rate work
+	tick := time.Duration(float64(time.Second) / b.cfg.rate)
+	if tick > 10*time.Millisecond {
+		tick = 10 * time.Millisecond
+	}
+	if tick < time.Millisecond {
+		tick = time.Millisecond
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	started := time.Now()
+	var issued int64
+loop:
+	for {
+		select {
+		case <-writeCtx.Done():
+			break loop
+		case <-sampler.C:
+			samples = append(samples, b.sample(ctx))
+		case now := <-ticker.C:
+			due := int64(now.Sub(started).Seconds() * b.cfg.rate)
+			for ; issued < due; issued++ {
+				select {
+				case jobs <- issued + 1:
+				default:
+					b.skipped.Add(1)
+				}
+			}
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+	return samples
+}
+
+// write sends one write and records its outcome
+func (b *benchmark) write(ctx context.Context, seq int64) {
+	started := time.Now()
+	err := b.client.Set(ctx, b.cfg.path, b.value(seq))
+	if err != nil {
+		// Writes cut short by the end of the run are not failures
+		if ctx.Err() == nil {
+			b.failed.Add(1)
+		}
+		return
+	}
+	b.writeLatency.record(time.Since(started))
+	b.acked.Add(1)
+}
+
+// waitForEvents waits until the matching clients have received the events of every
+// acked write, or the drain timeout passes
+func (b *benchmark) waitForEvents(ctx context.Context) {
+	deadline := time.Now().Add(b.cfg.drain)
+	for time.Now().Before(deadline) && ctx.Err() == nil {
+		done := true
+		for _, s := range b.subscribers {
+			if s.matching.Load() && s.received.Load() < b.acked.Load() {
+				done = false
+				break
+			}
+		}
+		if done {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// sample records the state of the run
+func (b *benchmark) sample(ctx context.Context) Sample {
+	sample := Sample{
+		ElapsedSeconds: time.Since(b.start).Seconds(),
+		WritesAcked:    b.acked.Load(),
+		EventLatency:   b.window.Swap(&histogram{}).summary(),
+		Server:         serverRuntime(ctx, b.httpClient, b.cfg.server, b.cfg.token),
+		Bench:          benchRuntime(),
+	}
+	for _, s := range b.subscribers {
+		if s.connected.Load() {
+			sample.Connected++
+		}
+		sample.EventsReceived += s.received.Load()
+	}
+	return sample
+}
+
+// close closes the connections
+func (b *benchmark) close() {
+	for _, s := range b.subscribers {
+		s.sub.Close()
+	}
+}
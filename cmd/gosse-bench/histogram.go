@@ -0,0 +1,103 @@
+package main
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// histogramGrowth is the ratio between the bounds of consecutive buckets, so that
+// percentiles are accurate to about 2%
+const histogramGrowth = 1.02
+
+// histogramBuckets covers latencies up to about ten minutes in microseconds
+const histogramBuckets = 1200
+
+// histogram counts latencies in logarithmic buckets. It records from many goroutines
+// without locking and keeps a constant size however many latencies it records.
+type histogram struct {
+	buckets [histogramBuckets]atomic.Uint64
+	count   atomic.Uint64
+	sum     atomic.Int64
+	max     atomic.Int64
+}
+
+// record adds a latency
+func (h *histogram) record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	h.buckets[bucketOf(d)].Add(1)
+	h.count.Add(1)
+	h.sum.Add(int64(d))
+	for {
+		current := h.max.Load()
+		if int64(d) <= current || h.max.CompareAndSwap(current, int64(d)) {
+			return
+		}
+	}
+}
+
+// bucketOf returns the bucket counting d
+func bucketOf(d time.Duration) int {
+	micros := float64(d) / float64(time.Microsecond)
+	if micros < 1 {
+		return 0
+	}
+	bucket := int(math.Log(micros)/math.Log(histogramGrowth)) + 1
+	if bucket >= histogramBuckets {
+		bucket = histogramBuckets - 1
+	}
+	return bucket
+}
+
+// upperBound returns the largest latency counted by bucket
+func upperBound(bucket int) time.Duration {
+	return time.Duration(math.Pow(histogramGrowth, float64(bucket)) * float64(time.Microsecond))
+}
+
+// quantile returns the latency below which the fraction q of the recorded latencies fall
+func (h *histogram) quantile(q float64) time.Duration {
+	count := h.count.Load()
+	if count == 0 {
+		return 0
+	}
+	target := uint64(math.Ceil(q * float64(count)))
+	if target == 0 {
+		target = 1
+	}
+
+	max := time.Duration(h.max.Load())
+	var seen uint64
+	for bucket := range h.buckets {
+		seen += h.buckets[bucket].Load()
+		if seen >= target {
+			if bound := upperBound(bucket); bound < max {
+				return bound
+			}
+			return max
+		}
+	}
+	return max
+}
+
+// summary returns the percentiles of the recorded latencies
+func (h *histogram) summary() LatencySummary {
+	count := h.count.Load()
+	summary := LatencySummary{Count: count}
+	if count == 0 {
+		return summary
+	}
+	summary.Mean = milliseconds(time.Duration(h.sum.Load() / int64(count)))
+	summary.P50 = milliseconds(h.quantile(0.50))
+	summary.P90 = milliseconds(h.quantile(0.90))
+	summary.P99 = milliseconds(h.quantile(0.99))
+	summary.P999 = milliseconds(h.quantile(0.999))
+	summary.Max = milliseconds(time.Duration(h.max.Load()))
+	return summary
+}
+
+// milliseconds converts d to fractional milliseconds
+func milliseconds(d time.Duration) float64 {
+	return math.Round(float64(d)/float64(time.Millisecond)*1000) / 1000
+}
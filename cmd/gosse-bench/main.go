@@ -0,0 +1,177 @@
+// Command gosse-bench measures a go-sse server under load. It opens real SSE
+// connections, writes to the store at a fixed rate and reports how long the events
+// take to arrive, how many are dropped, and how the server's goroutines and memory grow.
+//
+//	gosse-bench -server http://localhost:8080 -clients 1000 -rate 200 -duration 1m -o run.json
+//
+// The report is JSON so that runs against different versions can be compared.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/piske-alex/go-sse/internal/logging"
+	"github.com/piske-alex/go-sse/internal/sse"
+	"github.com/piske-alex/go-sse/pkg/gosse"
+)
+
+// filterList collects the repeated -filter flag
+type filterList []string
+
+func (f *filterList) String() string {
+	return strings.Join(*f, " ")
+}
+
+func (f *filterList) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := runMain(ctx, os.Args[1:], os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+// runMain runs the benchmark described by the command line and returns the exit status
+func runMain(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("gosse-bench", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	cfg := config{}
+	var filters filterList
+	flags.StringVar(&cfg.server, "server", "", "Server URL; an embedded server is started when empty")
+	flags.StringVar(&cfg.token, "token", os.Getenv("GOSSE_TOKEN"), "Bearer token sent in the Authorization header")
+	flags.IntVar(&cfg.clients, "clients", 100, "Number of SSE connections")
+	flags.Var(&filters, "filter", "Filter of a client, repeated to give the clients different filters in turn (default .bench)")
+	flags.StringVar(&cfg.path, "path", ".bench.value", "Store path to write to")
+	flags.Float64Var(&cfg.rate, "rate", 100, "Writes per second")
+	flags.IntVar(&cfg.payload, "payload", 256, "Approximate size of each written value in bytes")
+	flags.IntVar(&cfg.writers, "writers", 8, "Number of concurrent writers")
+	flags.DurationVar(&cfg.duration, "duration", 30*time.Second, "How long to write for")
+	flags.DurationVar(&cfg.interval, "interval", 5*time.Second, "How often to sample latency, goroutines and memory")
+	flags.DurationVar(&cfg.connectTimeout, "connect-timeout", 30*time.Second, "How long to wait for the clients to connect")
+	flags.DurationVar(&cfg.drain, "drain", 5*time.Second, "How long to wait for outstanding events after the last write")
+	output := flags.String("o", "", "File to write the JSON report to instead of standard output")
+	logLevel := flags.String("log-level", "warn", "Log level of the embedded server")
+	quiet := flags.Bool("q", false, "Do not print the summary to standard error")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg.filters = filters
+	if len(cfg.filters) == 0 {
+		cfg.filters = []string{".bench"}
+	}
+	if err := cfg.validate(); err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	if cfg.server == "" {
+		if err := logging.SetLevel(*logLevel); err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			return 2
+		}
+		url, shutdown, err := startEmbedded(cfg.clients)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: failed to start the embedded server: %v\n", err)
+			return 1
+		}
+		defer shutdown()
+		cfg.server = url
+	}
+
+	report, err := run(ctx, cfg)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+	if !*quiet {
+		printSummary(stderr, report)
+	}
+
+	out := stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			return 1
+		}
+		defer file.Close()
+		out = file
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		fmt.Fprintf(stderr, "Error: failed to write the report: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// validate checks the options of a run
+func (c config) validate() error {
+	switch {
+	case c.clients <= 0:
+		return errors.New("-clients must be positive")
+	case c.rate <= 0:
+		return errors.New("-rate must be positive")
+	case c.payload < 0:
+		return errors.New("-payload must not be negative")
+	case c.writers <= 0:
+		return errors.New("-writers must be positive")
+	case c.duration <= 0 || c.interval <= 0 || c.connectTimeout <= 0:
+		return errors.New("-duration, -interval and -connect-timeout must be positive")
+	case c.drain < 0:
+		return errors.New("-drain must not be negative")
+	case !strings.HasPrefix(c.path, "."):
+		return fmt.Errorf("-path %q must start with a dot", c.path)
+	}
+	return nil
+}
+
+// startEmbedded serves an embedded server on a local port, configured from the
+// environment like the standalone server
+func startEmbedded(clients int) (string, func(), error) {
+	// Request logs go to standard output by default, where the report is written
+	middleware.DefaultLogger = middleware.RequestLogger(&middleware.DefaultLogFormatter{Logger: log.Default(), NoColor: true})
+
+	var options []gosse.Option
+	if sse.LimitsFromEnv().MaxClients < clients {
+		options = append(options, gosse.WithMaxClients(clients))
+	}
+	server, err := gosse.New(options...)
+	if err != nil {
+		return "", nil, err
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		server.Close()
+		return "", nil, err
+	}
+	httpServer := &http.Server{Handler: server.Handler()}
+	go httpServer.Serve(listener)
+
+	shutdown := func() {
+		server.Close()
+		httpServer.Close()
+	}
+	return "http://" + listener.Addr().String(), shutdown, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestHistogram(t *testing.T) {
+	h := &histogram{}
+	for i := 1; i <= 1000; i++ {
+		h.record(time.Duration(i) * time.Millisecond)
+	}
+
+	// Percentiles are accurate to the bucket width
+	for _, tt := range []struct {
+		q    float64
+		want time.Duration
+	}{
+		{0.5, 500 * time.Millisecond},
+		{0.99, 990 * time.Millisecond},
+		{1, time.Second},
+	} {
+		got := h.quantile(tt.q)
+		if got < tt.want*97/100 || got > tt.want*103/100 {
+			t.Errorf("Expected quantile %v to be about %v, got %v", tt.q, tt.want, got)
+		}
+	}
+
+	summary := h.summary()
+	if summary.Count != 1000 || summary.Max != 1000 || summary.Mean != 500.5 {
+		t.Errorf("Unexpected summary %+v", summary)
+	}
+	if empty := (&histogram{}).summary(); empty.P99 != 0 {
+		t.Errorf("Expected an empty summary, got %+v", empty)
+	}
+}
+
+func TestRunMain_Embedded(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := runMain(context.Background(), []string{
+		"-clients", "6",
+		"-filter", ".bench",
+		"-filter", ".elsewhere",
+		"-rate", "50",
+		"-duration", "600ms",
+		"-interval", "200ms",
+		"-payload", "1024",
+		"-q",
+	}, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("Exited with %d: %s", code, stderr.String())
+	}
+
+	var report Report
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to decode report: %v\n%s", err, stdout.String())
+	}
+
+	// Only the clients whose filter matches the write path expect events
+	if report.Clients.Connected != 6 || report.Clients.Matching != 3 {
+		t.Errorf("Unexpected clients %+v", report.Clients)
+	}
+	if report.Writes.Acked == 0 || report.Writes.Failed != 0 {
+		t.Errorf("Unexpected writes %+v", report.Writes)
+	}
+	if report.Events.Expected != 3*report.Writes.Acked || report.Events.Received != report.Events.Expected || report.Events.Dropped != 0 {
+		t.Errorf("Unexpected events %+v", report.Events)
+	}
+	if report.Events.Latency.Count != uint64(report.Events.Received) || report.Events.Latency.P50 <= 0 {
+		t.Errorf("Unexpected event latency %+v", report.Events.Latency)
+	}
+
+	// The embedded server reports its runtime in every sample
+	if len(report.Samples) < 3 {
+		t.Fatalf("Expected a sample per interval, got %d", len(report.Samples))
+	}
+	for _, sample := range report.Samples {
+		if sample.Server == nil || sample.Server.Goroutines == 0 {
+			t.Errorf("Expected server runtime stats, got %+v", sample)
+		}
+	}
+	if report.Growth.ServerGoroutines == nil {
+		t.Error("Expected the server's growth to be reported")
+	}
+
+	if code := runMain(context.Background(), []string{"-rate", "0"}, &stdout, &stderr); code != 2 {
+		t.Errorf("Expected a usage error for a zero rate, got %d", code)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"time"
+)
+
+// Report is the result of a run, written as JSON so that runs against different
+// versions can be compared
+type Report struct {
+	Server   string        `json:"server"`
+	Started  time.Time     `json:"started"`
+	Settings Settings      `json:"settings"`
+	Clients  ClientCounts  `json:"clients"`
+	Writes   WriteCounts   `json:"writes"`
+	Events   EventCounts   `json:"events"`
+	Samples  []Sample      `json:"samples"`
+	Growth   RuntimeGrowth `json:"growth"`
+}
+
+// Settings echoes the options of the run
+type Settings struct {
+	Clients         int      `json:"clients"`
+	Filters         []string `json:"filters"`
+	Path            string   `json:"path"`
+	Rate            float64  `json:"rate"`
+	PayloadBytes    int      `json:"payload_bytes"`
+	Writers         int      `json:"writers"`
+	DurationSeconds float64  `json:"duration_seconds"`
+}
+
+// ClientCounts describes the SSE connections
+type ClientCounts struct {
+	Requested  int     `json:"requested"`
+	Connected  int     `json:"connected"`  // Connected before the writes started
+	Matching   int     `json:"matching"`   // Connected clients whose filters match the written path
+	Reconnects int64   `json:"reconnects"` // Connections lost and retried during the run
+	Stopped    int     `json:"stopped"`    // Subscriptions the server refused or ended for good
+	ConnectMS  float64 `json:"connect_ms"` // Time to connect all the clients
+}
+
+// WriteCounts describes the write traffic
+type WriteCounts struct {
+	Acked        int64          `json:"acked"`
+	Failed       int64          `json:"failed"`
+	Skipped      int64          `json:"skipped"` // Writes not sent because every writer was busy
+	AchievedRate float64        `json:"achieved_rate"`
+	Latency      LatencySummary `json:"latency_ms"`
+}
+
+// EventCounts compares the events received with the events expected from the acked writes
+type EventCounts struct {
+	Expected int64          `json:"expected"`
+	Received int64          `json:"received"`
+	Dropped  int64          `json:"dropped"`
+	Latency  LatencySummary `json:"latency_ms"` // From sending the write to receiving the event
+}
+
+// LatencySummary holds latency percentiles in milliseconds
+type LatencySummary struct {
+	Count uint64  `json:"count"`
+	Mean  float64 `json:"mean"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P99   float64 `json:"p99"`
+	P999  float64 `json:"p999"`
+	Max   float64 `json:"max"`
+}
+
+// Sample is the state of the run at one point in time
+type Sample struct {
+	ElapsedSeconds float64        `json:"elapsed_seconds"`
+	Connected      int64          `json:"connected"`
+	WritesAcked    int64          `json:"writes_acked"`
+	EventsReceived int64          `json:"events_received"`
+	EventLatency   LatencySummary `json:"event_latency_ms"` // Events received since the previous sample
+	Server         *RuntimeStats  `json:"server,omitempty"` // Missing when the server does not report it
+	Bench          RuntimeStats   `json:"bench"`
+}
+
+// RuntimeStats is the goroutine count and memory use of a process
+type RuntimeStats struct {
+	Goroutines     int    `json:"goroutines"`
+	HeapAllocBytes uint64 `json:"heap_alloc_bytes"`
+	HeapInuseBytes uint64 `json:"heap_inuse_bytes"`
+	SysBytes       uint64 `json:"sys_bytes"`
+	NumGC          uint32 `json:"num_gc"`
+}
+
+// RuntimeGrowth is the change between the first and the last sample
+type RuntimeGrowth struct {
+	ServerGoroutines     *int   `json:"server_goroutines,omitempty"`
+	ServerHeapAllocBytes *int64 `json:"server_heap_alloc_bytes,omitempty"`
+	BenchGoroutines      int    `json:"bench_goroutines"`
+	BenchHeapAllocBytes  int64  `json:"bench_heap_alloc_bytes"`
+}
+
+// benchRuntime returns the runtime stats of this process
+func benchRuntime() RuntimeStats {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	return RuntimeStats{
+		Goroutines:     runtime.NumGoroutine(),
+		HeapAllocBytes: memStats.HeapAlloc,
+		HeapInuseBytes: memStats.HeapInuse,
+		SysBytes:       memStats.Sys,
+		NumGC:          memStats.NumGC,
+	}
+}
+
+// serverRuntime reads the runtime stats the server reports in /metrics, or nil when
+// it does not report them
+func serverRuntime(ctx context.Context, httpClient *http.Client, server, token string) *RuntimeStats {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server+"/metrics", nil)
+	if err != nil {
+		return nil
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+
+	var body struct {
+		Data struct {
+			Runtime *RuntimeStats `json:"runtime"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil
+	}
+	return body.Data.Runtime
+}
+
+// growth compares the first and the last sample
+func growth(samples []Sample) RuntimeGrowth {
+	var g RuntimeGrowth
+	if len(samples) < 2 {
+		return g
+	}
+	first, last := samples[0], samples[len(samples)-1]
+	g.BenchGoroutines = last.Bench.Goroutines - first.Bench.Goroutines
+	g.BenchHeapAllocBytes = int64(last.Bench.HeapAllocBytes) - int64(first.Bench.HeapAllocBytes)
+	if first.Server != nil && last.Server != nil {
+		goroutines := last.Server.Goroutines - first.Server.Goroutines
+		heap := int64(last.Server.HeapAllocBytes) - int64(first.Server.HeapAllocBytes)
+		g.ServerGoroutines = &goroutines
+		g.ServerHeapAllocBytes = &heap
+	}
+	return g
+}
+
+// printSummary writes a human readable summary of the report
+func printSummary(w io.Writer, r *Report) {
+	fmt.Fprintf(w, "Clients:  %d connected of %d in %.0fms, %d matching the write path, %d reconnects, %d stopped\n",
+		r.Clients.Connected, r.Clients.Requested, r.Clients.ConnectMS, r.Clients.Matching, r.Clients.Reconnects, r.Clients.Stopped)
+	fmt.Fprintf(w, "Writes:   %d acked at %.1f/s, %d failed, %d skipped; latency p50 %.2fms p99 %.2fms\n",
+		r.Writes.Acked, r.Writes.AchievedRate, r.Writes.Failed, r.Writes.Skipped, r.Writes.Latency.P50, r.Writes.Latency.P99)
+	fmt.Fprintf(w, "Events:   %d received of %d expected, %d dropped\n", r.Events.Received, r.Events.Expected, r.Events.Dropped)
+	l := r.Events.Latency
+	fmt.Fprintf(w, "Latency:  p50 %.2fms p90 %.2fms p99 %.2fms p99.9 %.2fms max %.2fms\n", l.P50, l.P90, l.P99, l.P999, l.Max)
+	if r.Growth.ServerGoroutines != nil {
+		fmt.Fprintf(w, "Server:   %+d goroutines, %+.1f MiB heap\n", *r.Growth.ServerGoroutines, float64(*r.Growth.ServerHeapAllocBytes)/(1<<20))
+	}
+	fmt.Fprintf(w, "Bench:    %+d goroutines, %+.1f MiB heap\n", r.Growth.BenchGoroutines, float64(r.Growth.BenchHeapAllocBytes)/(1<<20))
+}
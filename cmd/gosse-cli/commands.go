@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/piske-alex/go-sse/pkg/client"
+)
+
+// newFlags creates the flag set of a subcommand
+func newFlags(e *env, name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(e.stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(e.stderr, "Usage: gosse-cli %s\n", e.usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parseArgs parses the flags of a subcommand and checks the number of arguments that follow
+func parseArgs(flags *flag.FlagSet, args []string, min, max int) error {
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if flags.NArg() < min || (max >= 0 && flags.NArg() > max) {
+		flags.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+// addOutputFlags registers the flags that control how values are printed
+func addOutputFlags(flags *flag.FlagSet, p *printer) {
+	flags.BoolVar(&p.raw, "r", false, "Print strings without quotes")
+	flags.BoolVar(&p.compact, "c", false, "Print JSON on one line")
+	flags.StringVar(&p.jq, "jq", "", "Print only the parts selected by a path such as .items[*].id")
+}
+
+func runGet(ctx context.Context, e *env, args []string) error {
+	flags := newFlags(e, "get")
+	p := &printer{out: e.stdout}
+	addOutputFlags(flags, p)
+	if err := parseArgs(flags, args, 1, 1); err != nil {
+		return err
+	}
+
+	var value interface{}
+	if err := e.client.Get(ctx, flags.Arg(0), &value); err != nil {
+		return err
+	}
+	return p.print(value)
+}
+
+func runSet(ctx context.Context, e *env, args []string) error {
+	flags := newFlags(e, "set")
+	ttl := flags.Duration("ttl", 0, "Delete the value after this long, such as 30s")
+	if err := parseArgs(flags, args, 2, 2); err != nil {
+		return err
+	}
+
+	value, err := readValue(e, flags.Arg(1))
+	if err != nil {
+		return err
+	}
+	return e.client.SetWithTTL(ctx, flags.Arg(0), value, *ttl)
+}
+
+func runDelete(ctx context.Context, e *env, args []string) error {
+	flags := newFlags(e, "delete")
+	if err := parseArgs(flags, args, 1, 1); err != nil {
+		return err
+	}
+	return e.client.Delete(ctx, flags.Arg(0))
+}
+
+func runMatch(ctx context.Context, e *env, args []string) error {
+	flags := newFlags(e, "match")
+	p := &printer{out: e.stdout}
+	flags.BoolVar(&p.compact, "c", false, "Print JSON on one line")
+	if err := parseArgs(flags, args, 1, 1); err != nil {
+		return err
+	}
+
+	matches, err := e.client.FindMatches(ctx, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if matches == nil {
+		matches = []client.Match{}
+	}
+	return p.print(matches)
+}
+
+func runInit(ctx context.Context, e *env, args []string) error {
+	flags := newFlags(e, "init")
+	if err := parseArgs(flags, args, 1, 1); err != nil {
+		return err
+	}
+
+	data, err := readValue(e, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	return e.client.Initialize(ctx, data)
+}
+
+func runWatch(ctx context.Context, e *env, args []string) error {
+	flags := newFlags(e, "watch")
+	p := &printer{out: e.stdout, compact: true}
+	asJSON := flags.Bool("json", false, "Print each event as a JSON object")
+	flags.BoolVar(&p.raw, "r", false, "Print strings selected with -jq without quotes")
+	flags.StringVar(&p.jq, "jq", "", "Print only the parts of each event selected by a path such as .value.status")
+	count := flags.Int("n", 0, "Exit after this many events, 0 to watch until interrupted")
+	if err := parseArgs(flags, args, 0, -1); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		received int
+		printErr error
+	)
+	sub := e.client.Subscribe(ctx, client.SubscribeOptions{
+		Filters: flags.Args(),
+		OnEvent: func(event client.Event) {
+			if event.Type == "connected" {
+				fmt.Fprintln(e.stderr, "Connected")
+				return
+			}
+			if printErr != nil {
+				return
+			}
+
+			if *asJSON || p.jq != "" {
+				printErr = p.print(eventObject(event))
+			} else {
+				printErr = printEvent(e.stdout, event)
+			}
+
+			received++
+			if printErr != nil || (*count > 0 && received >= *count) {
+				cancel()
+			}
+		},
+		OnError: func(err error) {
+			fmt.Fprintf(e.stderr, "Connection lost: %v, reconnecting\n", err)
+		},
+	})
+	if err := sub.Err(); err != nil {
+		return err
+	}
+	return printErr
+}
+
+func runExport(ctx context.Context, e *env, args []string) error {
+	flags := newFlags(e, "export")
+	leaf := flags.Bool("leaf", false, "Write one line per leaf value instead of per top-level key")
+	output := flags.String("o", "", "File to write instead of standard output")
+	if err := parseArgs(flags, args, 0, 0); err != nil {
+		return err
+	}
+
+	granularity := "key"
+	if *leaf {
+		granularity = "leaf"
+	}
+	if *output == "" {
+		return e.client.Export(ctx, e.stdout, granularity)
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := e.client.Export(ctx, file, granularity); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func runImport(ctx context.Context, e *env, args []string) error {
+	flags := newFlags(e, "import")
+	replace := flags.Bool("replace", false, "Empty the store before importing")
+	if err := parseArgs(flags, args, 1, 1); err != nil {
+		return err
+	}
+
+	input := e.stdin
+	if name := flags.Arg(0); name != "-" {
+		file, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		input = file
+	}
+
+	lines, err := e.client.Import(ctx, input, *replace)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "Imported %d lines\n", lines)
+	return nil
+}
+
+// readValue reads a JSON value given inline, as @file, or as @- for standard input
+func readValue(e *env, arg string) (json.RawMessage, error) {
+	data := []byte(arg)
+	if name, ok := strings.CutPrefix(arg, "@"); ok {
+		var err error
+		if name == "-" {
+			data, err = io.ReadAll(e.stdin)
+		} else {
+			data, err = os.ReadFile(name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !json.Valid(data) {
+		if !strings.HasPrefix(arg, "@") {
+			return nil, errors.New("value is not valid JSON; strings need quotes, as in '\"away\"'")
+		}
+		return nil, fmt.Errorf("%s does not contain valid JSON", arg[1:])
+	}
+	return json.RawMessage(data), nil
+}
+
+// eventObject returns the fields of an event as printed by -json and selected by -jq
+func eventObject(event client.Event) map[string]interface{} {
+	object := map[string]interface{}{
+		"type":  event.Type,
+		"path":  event.Path,
+		"value": event.Value,
+	}
+	if event.ID != "" {
+		object["id"] = event.ID
+	}
+	if !event.Time.IsZero() {
+		object["time"] = event.Time.Format(time.RFC3339Nano)
+	}
+	return object
+}
+
+// printEvent prints an event on one line with its time, type, path and value
+func printEvent(out io.Writer, event client.Event) error {
+	at := event.Time
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	line := fmt.Sprintf("%s %-12s %s", at.Format("15:04:05.000"), event.Type, event.Path)
+	if event.Value != nil {
+		value, err := json.Marshal(event.Value)
+		if err != nil {
+			return err
+		}
+		line += " " + string(value)
+	}
+	_, err := fmt.Fprintln(out, line)
+	return err
+}
@@ -0,0 +1,144 @@
+// Command gosse-cli reads, writes and watches a go-sse server from the shell.
+//
+//	gosse-cli get .data.users[0].status
+//	gosse-cli set .data.users[0].status '"away"'
+//	gosse-cli watch '.data.users[*].status'
+//
+// Paths are passed as arguments and escaped by the client, so they need no URL encoding.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/piske-alex/go-sse/pkg/client"
+)
+
+// command is a subcommand. run returns an error to print and exit with status 1.
+type command struct {
+	usage   string
+	summary string
+	run     func(ctx context.Context, env *env, args []string) error
+}
+
+// commands lists the subcommands in the order of the usage text
+var commands = []struct {
+	name string
+	command
+}{
+	{"get", command{"get [-r] [-c] [-jq expr] <path>", "Print the value at path", runGet}},
+	{"set", command{"set [-ttl duration] <path> <json|@file>", "Replace the value at path", runSet}},
+	{"delete", command{"delete <path>", "Delete the value at path", runDelete}},
+	{"match", command{"match [-c] <pattern>", "Print the values matching a pattern with their paths", runMatch}},
+	{"init", command{"init <json|@file>", "Replace the whole store", runInit}},
+	{"watch", command{"watch [-json] [-r] [-jq expr] [-n count] [filter...]", "Print events as they arrive", runWatch}},
+	{"export", command{"export [-leaf] [-o file]", "Write the store as NDJSON", runExport}},
+	{"import", command{"import [-replace] <file|->", "Apply an NDJSON stream to the store", runImport}},
+}
+
+// env is what the subcommands share
+type env struct {
+	client *client.Client
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	usage  string // Usage line of the running subcommand
+}
+
+// errUsage reports invalid arguments; the usage has already been printed
+var errUsage = errors.New("usage")
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+// run executes the command line and returns the exit status: 0 on success, 1 when
+// the command failed and 2 for invalid arguments
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("gosse-cli", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	server := flags.String("server", envOr("GOSSE_SERVER", "http://localhost:8080"), "Server URL")
+	namespace := flags.String("namespace", os.Getenv("GOSSE_NAMESPACE"), "Namespace to use instead of the default store")
+	token := flags.String("token", os.Getenv("GOSSE_TOKEN"), "Bearer token sent in the Authorization header")
+	timeout := flags.Duration("timeout", 30*time.Second, "Timeout of commands other than watch, 0 for none")
+	flags.Usage = func() { printUsage(flags) }
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		printUsage(flags)
+		return 2
+	}
+
+	name := flags.Arg(0)
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == name {
+			cmd = &commands[i].command
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(stderr, "Unknown command %q\n\n", name)
+		printUsage(flags)
+		return 2
+	}
+
+	var options []client.Option
+	if *namespace != "" {
+		options = append(options, client.WithNamespace(*namespace))
+	}
+	if *token != "" {
+		options = append(options, client.WithHeader("Authorization", "Bearer "+*token))
+	}
+	c, err := client.New(*server, options...)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	// Watching runs until interrupted, so the timeout only applies to the other commands
+	if name != "watch" && *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	e := &env{client: c, stdin: stdin, stdout: stdout, stderr: stderr, usage: cmd.usage}
+	if err := cmd.run(ctx, e, flags.Args()[1:]); err != nil {
+		if errors.Is(err, errUsage) {
+			return 2
+		}
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// printUsage describes the global flags and the subcommands
+func printUsage(flags *flag.FlagSet) {
+	out := flags.Output()
+	fmt.Fprintf(out, "Usage: gosse-cli [flags] <command> [arguments]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-54s %s\n", c.usage, c.summary)
+	}
+	fmt.Fprintf(out, "\nFlags:\n")
+	flags.PrintDefaults()
+}
+
+// envOr returns the environment variable key, or fallback when it is not set
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
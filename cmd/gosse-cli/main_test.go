@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/piske-alex/go-sse/internal/api"
+	"github.com/piske-alex/go-sse/internal/sse"
+	"github.com/piske-alex/go-sse/internal/store"
+)
+
+// newServer starts the real router over an in-memory store
+func newServer(t *testing.T) (*httptest.Server, *sse.Server) {
+	t.Helper()
+	kvStore := store.NewStore()
+	sseServer := sse.NewServer(kvStore)
+	handler := api.NewHandler(kvStore, sseServer, api.DefaultHandlerOptions())
+	server := httptest.NewServer(api.SetupRouter(handler))
+	t.Cleanup(server.Close)
+	t.Cleanup(handler.Webhooks.Close)
+	return server, sseServer
+}
+
+// syncBuffer is a buffer that can be read while a command writes to it
+type syncBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.String()
+}
+
+// result is the outcome of a command line
+type result struct {
+	code   int
+	stdout string
+	stderr string
+}
+
+// runCLI runs a command line against server with stdin as standard input
+func runCLI(t *testing.T, server *httptest.Server, stdin string, args ...string) result {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	args = append([]string{"-server", server.URL}, args...)
+	code := run(context.Background(), args, strings.NewReader(stdin), &stdout, &stderr)
+	return result{code, stdout.String(), stderr.String()}
+}
+
+// mustRun runs a command line and fails the test unless it succeeds
+func mustRun(t *testing.T, server *httptest.Server, args ...string) string {
+	t.Helper()
+	res := runCLI(t, server, "", args...)
+	if res.code != 0 {
+		t.Fatalf("%v exited with %d: %s", args, res.code, res.stderr)
+	}
+	return res.stdout
+}
+
+func TestRun_Store(t *testing.T) {
+	server, _ := newServer(t)
+
+	mustRun(t, server, "init", `{"users": [{"name": "Alice", "status": "online"}, {"name": "Bob", "status": "away"}]}`)
+
+	if got := mustRun(t, server, "get", "-r", ".users[0].status"); got != "online\n" {
+		t.Errorf("Expected the raw status, got %q", got)
+	}
+	if got := mustRun(t, server, "get", "-c", ".users[1]"); got != `{"name":"Bob","status":"away"}`+"\n" {
+		t.Errorf("Expected compact JSON, got %q", got)
+	}
+	if got := mustRun(t, server, "get", "-r", "-jq", ".[*].name", ".users"); got != "Alice\nBob\n" {
+		t.Errorf("Expected the selected names, got %q", got)
+	}
+
+	// Values are read from files and standard input
+	file := filepath.Join(t.TempDir(), "status.json")
+	os.WriteFile(file, []byte(`"busy"`), 0o644)
+	mustRun(t, server, "set", ".users[0].status", "@"+file)
+	if res := runCLI(t, server, `"offline"`, "set", ".users[1].status", "@-"); res.code != 0 {
+		t.Fatalf("Failed to set from stdin: %s", res.stderr)
+	}
+
+	got := mustRun(t, server, "match", "-c", ".users[*].status")
+	if got != `[{"path":".users[0].status","value":"busy"},{"path":".users[1].status","value":"offline"}]`+"\n" {
+		t.Errorf("Unexpected matches %q", got)
+	}
+
+	mustRun(t, server, "delete", ".users[1]")
+	if got := mustRun(t, server, "get", "-c", ".users"); got != `[{"name":"Alice","status":"busy"},null]`+"\n" {
+		t.Errorf("Unexpected users after delete %q", got)
+	}
+
+	// Failures exit with 1 and usage errors with 2
+	if res := runCLI(t, server, "", "get", ".missing"); res.code != 1 || !strings.Contains(res.stderr, "404") {
+		t.Errorf("Expected a not found error, got %+v", res)
+	}
+	if res := runCLI(t, server, "", "set", ".name", "away"); res.code != 1 || !strings.Contains(res.stderr, "strings need quotes") {
+		t.Errorf("Expected an invalid JSON error, got %+v", res)
+	}
+	if res := runCLI(t, server, "", "set", ".name"); res.code != 2 {
+		t.Errorf("Expected a usage error for a missing value, got %+v", res)
+	}
+	if res := runCLI(t, server, "", "frobnicate"); res.code != 2 || !strings.Contains(res.stderr, "Unknown command") {
+		t.Errorf("Expected a usage error for an unknown command, got %+v", res)
+	}
+}
+
+func TestRun_ExportImport(t *testing.T) {
+	source, _ := newServer(t)
+	target, _ := newServer(t)
+
+	mustRun(t, source, "init", `{"config": {"maxUsers": 100}, "users": ["alice"]}`)
+	mustRun(t, target, "init", `{"stale": true}`)
+
+	file := filepath.Join(t.TempDir(), "store.ndjson")
+	mustRun(t, source, "export", "-leaf", "-o", file)
+	exported, _ := os.ReadFile(file)
+	if lines := strings.Count(string(exported), "\n"); lines != 2 {
+		t.Errorf("Expected one line per leaf, got %q", exported)
+	}
+
+	if got := mustRun(t, target, "import", "-replace", file); got != "Imported 2 lines\n" {
+		t.Errorf("Unexpected import output %q", got)
+	}
+	if got := mustRun(t, target, "get", "-c", "."); got != `{"config":{"maxUsers":100},"users":["alice"]}`+"\n" {
+		t.Errorf("Expected the exported store, got %q", got)
+	}
+
+	// Exports can be piped into an import
+	stdout := mustRun(t, source, "export")
+	if res := runCLI(t, target, stdout, "import", "-"); res.code != 0 || res.stdout != "Imported 2 lines\n" {
+		t.Errorf("Failed to import from stdin: %+v", res)
+	}
+}
+
+func TestRun_Watch(t *testing.T) {
+	server, _ := newServer(t)
+	mustRun(t, server, "init", `{"users": {"alice": "online"}, "orders": {}}`)
+
+	// watch starts a watch and waits until it has printed the initial data
+	watch := func(args ...string) <-chan result {
+		var stdout, stderr syncBuffer
+		done := make(chan result, 1)
+		go func() {
+			full := append([]string{"-server", server.URL, "watch"}, args...)
+			code := run(context.Background(), full, strings.NewReader(""), &stdout, &stderr)
+			done <- result{code, stdout.String(), stderr.String()}
+		}()
+
+		deadline := time.Now().Add(5 * time.Second)
+		for !strings.Contains(stdout.String(), "initial_data") {
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for the initial data of %v", args)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return done
+	}
+	wait := func(done <-chan result) result {
+		select {
+		case res := <-done:
+			return res
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for watch to exit")
+		}
+		return result{}
+	}
+
+	// Selected fields of each event, one per line
+	selected := watch("-n", "3", "-r", "-jq", ".type", ".users")
+	// One line per event with its time, type, path and value
+	pretty := watch("-n", "2", ".users")
+
+	mustRun(t, server, "set", ".users.bob", `"away"`)
+	mustRun(t, server, "set", ".orders.a", `1`)
+	mustRun(t, server, "delete", ".users.alice")
+
+	res := wait(selected)
+	if res.code != 0 || res.stdout != "initial_data\nupdate\ndelete\n" {
+		t.Errorf("Unexpected selected events %+v", res)
+	}
+	if !strings.Contains(res.stderr, "Connected") {
+		t.Errorf("Expected the connection to be reported, got %q", res.stderr)
+	}
+
+	res = wait(pretty)
+	lines := strings.Split(strings.TrimSpace(res.stdout), "\n")
+	if res.code != 0 || len(lines) != 2 {
+		t.Fatalf("Unexpected pretty events %+v", res)
+	}
+	if fields := strings.Fields(lines[1]); len(fields) != 4 || fields[1] != "update" || fields[2] != ".users.bob" || fields[3] != `"away"` {
+		t.Errorf("Unexpected pretty event %q", lines[1])
+	}
+
+	// A refused subscription fails the command
+	if res := runCLI(t, server, "", "-namespace", "missing", "watch"); res.code != 1 {
+		t.Errorf("Expected a refused watch to fail, got %+v", res)
+	}
+}
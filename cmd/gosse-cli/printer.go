@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/piske-alex/go-sse/internal/query"
+)
+
+// printer prints values as JSON, optionally selecting parts of them with a path
+// expression in the store's query syntax, much like jq does with its filters
+type printer struct {
+	out     io.Writer
+	raw     bool   // Print strings without quotes
+	compact bool   // Print JSON on one line
+	jq      string // Path selecting what to print, the whole value when empty
+}
+
+// print prints value, or each part of it selected by the jq path. A path that
+// selects nothing prints nothing.
+func (p *printer) print(value interface{}) error {
+	if p.jq == "" {
+		return p.printValue(value)
+	}
+
+	// Round trip through JSON so that typed values can be navigated like decoded ones
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		return err
+	}
+
+	if _, err := query.NewParser().Parse(p.jq); err != nil {
+		return fmt.Errorf("invalid -jq path %q: %w", p.jq, err)
+	}
+	// Paths missing from the value select nothing
+	matches, _ := query.NewMatcher().Match(decoded, p.jq)
+	for _, match := range matches {
+		if err := p.printValue(match.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printValue prints a single value followed by a newline
+func (p *printer) printValue(value interface{}) error {
+	if s, ok := value.(string); ok && p.raw {
+		_, err := fmt.Fprintln(p.out, s)
+		return err
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if !p.compact {
+		encoder.SetIndent("", "  ")
+	}
+	if err := encoder.Encode(value); err != nil {
+		return err
+	}
+	_, err := p.out.Write(buf.Bytes())
+	return err
+}
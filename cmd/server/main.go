@@ -2,69 +2,100 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/piske-alex/go-sse/internal/api"
+	"github.com/piske-alex/go-sse/internal/config"
+	"github.com/piske-alex/go-sse/internal/logging"
 	"github.com/piske-alex/go-sse/internal/sse"
 	"github.com/piske-alex/go-sse/internal/store"
+	"github.com/piske-alex/go-sse/internal/tlsconfig"
 )
 
 func main() {
 	// Load environment variables from .env file if it exists
 	godotenv.Load()
 
-	// Get the port from the environment or use default
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "YAML or TOML configuration file")
+	flag.Parse()
 
-	// Get max request size from environment or use default (20MB)
-	maxRequestSize := os.Getenv("MAX_REQUEST_SIZE_MB")
-	maxRequestSizeMB := 20 // Default to 20MB
-	if maxRequestSize != "" {
-		if size, err := strconv.Atoi(maxRequestSize); err == nil && size > 0 {
-			maxRequestSizeMB = size
-		}
+	// Load and validate the configuration; each component is given its section below
+	loader := config.NewLoader(*configFile)
+	cfg, err := loader.Load()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if err := logging.SetLevel(cfg.Server.LogLevel); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
 	}
+	if loader.Path() != "" {
+		logging.Infof("Loaded configuration from %s", loader.Path())
+		logOverrides(loader)
+	}
+
+	var current atomic.Pointer[config.Config]
+	current.Store(&cfg)
+
+	port := strconv.Itoa(cfg.Server.Port)
+
 	// Convert to bytes
-	maxBodyBytes := int64(maxRequestSizeMB * 1024 * 1024)
-	log.Printf("Maximum request body size: %dMB", maxRequestSizeMB)
+	maxBodyBytes := int64(cfg.Server.MaxRequestSizeMB * 1024 * 1024)
+	logging.Infof("Maximum request body size: %dMB", cfg.Server.MaxRequestSizeMB)
 
-	// Get the store type from environment or use default
-	storeType := os.Getenv("STORE_TYPE")
 	var storeTypeEnum store.StoreType
-	switch storeType {
+	switch cfg.Store.Type {
 	case "mongo":
 		storeTypeEnum = store.MongoStoreType
-		log.Println("Using MongoDB store")
+		logging.Infof("Using MongoDB store")
 	default:
 		storeTypeEnum = store.MemoryStore
-		log.Println("Using in-memory store")
+		logging.Infof("Using in-memory store")
 	}
 
-	// Create the store
-	kvStore, err := store.CreateStore(storeTypeEnum)
+	// Create the store, retaining the configured history
+	kvStore, err := store.CreateStore(storeTypeEnum, mongoConfig(cfg), historyConfig(cfg))
 	if err != nil {
 		log.Fatalf("Failed to create store: %v", err)
 	}
 
 	// Display store/database information at startup
-	log.Println("Displaying initial store/database information")
+	logging.Infof("Displaying initial store/database information")
 	if err := kvStore.DisplayStoreInfo(); err != nil {
-		log.Printf("Warning: Failed to display store information: %v", err)
+		logging.Warnf("Failed to display store information: %v", err)
 	}
 
 	// Create components
 	sseServer := sse.NewServer(kvStore)
-	apiHandler := api.NewHandler(kvStore, sseServer)
+	sseServer.SetOptions(sseOptions(cfg))
+	sseServer.SetLimits(sseLimits(cfg))
+	apiHandler := api.NewHandler(kvStore, sseServer, handlerOptions(cfg))
+	showConfig := func() config.Config { return *current.Load() }
+	apiHandler.Config = showConfig
+
+	// Create the namespaces served under /ns, each with its own store
+	namespaceFactory, closeNamespaces, err := store.NewNamespaceFactory(storeTypeEnum, mongoConfig(cfg), historyConfig(cfg))
+	if err != nil {
+		log.Fatalf("Failed to create namespace factory: %v", err)
+	}
+	nsOptions := namespaceOptions(cfg)
+	nsOptions.Configure = func(handler *api.Handler) { handler.Config = showConfig }
+	namespaces, err := api.NewNamespaces(namespaceFactory, nsOptions)
+	if err != nil {
+		log.Fatalf("Failed to create namespaces: %v", err)
+	}
+	apiHandler.Namespaces = namespaces
+
 	router := api.SetupRouter(apiHandler)
 
 	// Create HTTP server with middleware for large requests
@@ -80,31 +111,141 @@ func main() {
 		IdleTimeout:  240 * time.Second, // Keep idle connections open longer
 	}
 
+	// Serve TLS with HTTP/2 when a certificate is configured
+	tlsSettings, tlsEnabled, err := tlsConfig(cfg)
+	if err != nil {
+		log.Fatalf("Invalid TLS configuration: %v", err)
+	}
+
+	var certReloader *tlsconfig.CertReloader
+	if tlsEnabled {
+		certReloader, err = tlsconfig.NewCertReloader(tlsSettings.CertFile, tlsSettings.KeyFile)
+		if err != nil {
+			log.Fatalf("Failed to load TLS certificate: %v", err)
+		}
+		srv.TLSConfig, err = tlsSettings.TLSConfig(certReloader)
+		if err != nil {
+			log.Fatalf("Invalid TLS configuration: %v", err)
+		}
+
+		// Pick up renewed certificates without a restart
+		go certReloader.Watch(context.Background(), time.Duration(cfg.TLS.ReloadInterval))
+	}
+
 	// Start server in a goroutine
 	go func() {
-		log.Printf("Server listening on :%s", port)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if tlsEnabled {
+			logging.Infof("Server listening with TLS on :%s", port)
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			logging.Infof("Server listening on :%s", port)
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Server error: %v", err)
 		}
 	}()
 
+	// Reload the configuration file and the TLS certificate on SIGHUP
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			if loader.Path() != "" {
+				reloadConfig(loader, &current, apiHandler, namespaces)
+			}
+			if certReloader != nil {
+				if err := certReloader.Reload(); err != nil {
+					logging.Errorf("Error reloading TLS certificate: %v", err)
+					continue
+				}
+				logging.Infof("Reloaded TLS certificate")
+			}
+		}
+	}()
+
 	// Set up graceful shutdown
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 	<-stop
 
-	log.Println("Shutting down server...")
+	logging.Infof("Shutting down server...")
 
-	// Shutdown HTTP server
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second) // Increased shutdown timeout
+	// Everything below must finish within the shutdown timeout
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Server.ShutdownTimeout))
 	defer cancel()
 
+	// Stop accepting SSE clients and move the connected ones to other instances.
+	// The open streams end here, so the HTTP shutdown below does not wait on them.
+	drain := drainOptions(*current.Load())
+	var drained sync.WaitGroup
+	drained.Add(2)
+	go func() {
+		defer drained.Done()
+		sseServer.Drain(ctx, drain)
+	}()
+	go func() {
+		defer drained.Done()
+		namespaces.Drain(ctx, drain)
+	}()
+	drained.Wait()
+
+	// Shutdown HTTP server
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatalf("Server shutdown error: %v", err)
 	}
 
+	// Stop webhook deliveries
+	apiHandler.Webhooks.Close()
+
 	// Shutdown SSE server
 	sseServer.Shutdown()
 
-	log.Println("Server stopped")
+	// Shutdown namespaces and their shared resources
+	namespaces.Shutdown()
+	if err := closeNamespaces(); err != nil {
+		logging.Errorf("Error closing namespace stores: %v", err)
+	}
+
+	logging.Infof("Server stopped")
+}
+
+// reloadConfig reloads the configuration file and applies the settings that can change
+// while running. An invalid file leaves the running configuration unchanged.
+func reloadConfig(loader *config.Loader, current *atomic.Pointer[config.Config], handler *api.Handler, namespaces *api.Namespaces) {
+	next, err := loader.Load()
+	if err != nil {
+		logging.Errorf("Error reloading configuration, keeping the running one: %v", err)
+		return
+	}
+
+	applied, reloaded, restart := current.Load().Reload(next)
+	if len(restart) > 0 {
+		logging.Warnf("%s changed and will apply after a restart", strings.Join(restart, ", "))
+	}
+
+	logOverrides(loader)
+	logging.SetLevel(applied.Server.LogLevel)
+	handler.SSEServer.SetOptions(sseOptions(applied))
+	handler.SSEServer.SetLimits(sseLimits(applied))
+	handler.SetLimits(limitOptions(applied))
+	if err := handler.SetCORS(corsOptions(applied)); err != nil {
+		logging.Errorf("Error applying the CORS policy, keeping the running one: %v", err)
+	}
+	namespaces.Reload(namespaceOptions(applied))
+	current.Store(&applied)
+
+	if len(reloaded) == 0 {
+		logging.Infof("Reloaded configuration, no settings changed")
+		return
+	}
+	logging.Infof("Reloaded configuration: %s", strings.Join(reloaded, ", "))
+}
+
+// logOverrides lists the environment variables that take precedence over the configuration file
+func logOverrides(loader *config.Loader) {
+	if overrides := loader.Overrides(); len(overrides) > 0 {
+		logging.Infof("Environment variables override the configuration file: %s", strings.Join(overrides, ", "))
+	}
 }
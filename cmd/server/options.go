@@ -0,0 +1,120 @@
+package main
+
+import (
+	"time"
+
+	"github.com/piske-alex/go-sse/internal/api"
+	"github.com/piske-alex/go-sse/internal/config"
+	"github.com/piske-alex/go-sse/internal/sse"
+	"github.com/piske-alex/go-sse/internal/store"
+	"github.com/piske-alex/go-sse/internal/tlsconfig"
+	"github.com/piske-alex/go-sse/internal/webhook"
+)
+
+// The functions below turn the loaded configuration into the options of each package
+
+func sseOptions(cfg config.Config) sse.Options {
+	return sse.Options{
+		Keepalive:         time.Duration(cfg.SSE.Keepalive),
+		BufferSize:        cfg.SSE.BufferSize,
+		CleanupInterval:   time.Duration(cfg.SSE.CleanupInterval),
+		InactivityTimeout: time.Duration(cfg.SSE.InactivityTimeout),
+	}
+}
+
+func sseLimits(cfg config.Config) sse.Limits {
+	return sse.Limits{
+		MaxClients:       cfg.SSE.MaxClients,
+		MaxClientsPerKey: cfg.SSE.MaxClientsPerIP,
+	}
+}
+
+func drainOptions(cfg config.Config) sse.DrainOptions {
+	return sse.DrainOptions{
+		Window:      time.Duration(cfg.Drain.Window),
+		Waves:       cfg.Drain.Waves,
+		RetryDelay:  time.Duration(cfg.Drain.RetryDelay),
+		RetryJitter: time.Duration(cfg.Drain.RetryJitter),
+	}
+}
+
+func limitOptions(cfg config.Config) api.LimitOptions {
+	return api.LimitOptions{
+		TrustProxy:      cfg.Limits.TrustProxyHeaders,
+		PrincipalHeader: cfg.Limits.PrincipalHeader,
+		WriteRate:       cfg.Limits.WriteRate,
+		WriteBurst:      cfg.Limits.WriteBurst,
+		QueryRate:       cfg.Limits.QueryRate,
+		QueryBurst:      cfg.Limits.QueryBurst,
+	}
+}
+
+func corsOptions(cfg config.Config) api.CORSOptions {
+	return api.CORSOptions{
+		AllowedOrigins:       cfg.CORS.AllowedOrigins,
+		AllowedOriginPattern: cfg.CORS.AllowedOriginPattern,
+		AllowedMethods:       cfg.CORS.AllowedMethods,
+		AllowedHeaders:       cfg.CORS.AllowedHeaders,
+		ExposedHeaders:       cfg.CORS.ExposedHeaders,
+		AllowCredentials:     cfg.CORS.AllowCredentials,
+		MaxAge:               time.Duration(cfg.CORS.MaxAge),
+	}
+}
+
+func handlerOptions(cfg config.Config) api.HandlerOptions {
+	return api.HandlerOptions{
+		AdminToken: cfg.Admin.Token,
+		Webhooks: webhook.Options{
+			MaxAttempts:         cfg.Webhooks.MaxAttempts,
+			InitialBackoff:      time.Duration(cfg.Webhooks.InitialBackoff),
+			MaxBackoff:          time.Duration(cfg.Webhooks.MaxBackoff),
+			Timeout:             time.Duration(cfg.Webhooks.Timeout),
+			AllowPrivateTargets: cfg.Webhooks.AllowPrivateTargets,
+		},
+		Limits: limitOptions(cfg),
+		CORS:   corsOptions(cfg),
+		Probes: api.ProbeOptions{
+			PingTimeout:       time.Duration(cfg.Readyz.PingTimeout),
+			MinClientHeadroom: cfg.Readyz.MinClientHeadroom,
+		},
+	}
+}
+
+func namespaceOptions(cfg config.Config) api.NamespaceOptions {
+	return api.NamespaceOptions{
+		Names:         cfg.Namespaces.Names,
+		AutoCreate:    cfg.Namespaces.AutoCreate,
+		MaxNamespaces: cfg.Namespaces.Max,
+		MaxClients:    cfg.Namespaces.MaxClients,
+		SSE:           sseOptions(cfg),
+		Limits:        sseLimits(cfg),
+		Handler:       handlerOptions(cfg),
+	}
+}
+
+func mongoConfig(cfg config.Config) store.MongoConfig {
+	mongo := cfg.Store.Mongo
+	return store.MongoConfig{
+		URI:               mongo.URI,
+		Host:              mongo.Host,
+		Port:              mongo.Port,
+		User:              mongo.User,
+		Password:          mongo.Password,
+		AuthDB:            mongo.AuthDB,
+		Database:          mongo.Database,
+		Collection:        mongo.Collection,
+		DocumentID:        mongo.DocumentID,
+		UseCollectionRoot: mongo.UseCollectionRoot,
+	}
+}
+
+func historyConfig(cfg config.Config) store.HistoryConfig {
+	return store.HistoryConfig{
+		MaxRevisions: cfg.History.MaxRevisions,
+		MaxAge:       time.Duration(cfg.History.MaxAge),
+	}
+}
+
+func tlsConfig(cfg config.Config) (tlsconfig.Config, bool, error) {
+	return tlsconfig.NewConfig(cfg.TLS.CertFile, cfg.TLS.KeyFile, cfg.TLS.ClientCAFile, cfg.TLS.MinVersion, cfg.TLS.ClientAuth)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/piske-alex/go-sse/internal/api"
+	"github.com/piske-alex/go-sse/internal/config"
+	"github.com/piske-alex/go-sse/internal/sse"
+)
+
+// The default configuration gives every package its own defaults
+func TestOptions_Defaults(t *testing.T) {
+	cfg := config.Default()
+
+	if got := sseOptions(cfg); got != sse.DefaultOptions() {
+		t.Errorf("Expected the SSE defaults, got %+v", got)
+	}
+	if got := sseLimits(cfg); got != sse.DefaultLimits() {
+		t.Errorf("Expected the SSE limit defaults, got %+v", got)
+	}
+	if got := drainOptions(cfg); got != sse.DefaultDrainOptions() {
+		t.Errorf("Expected the drain defaults, got %+v", got)
+	}
+	if got := handlerOptions(cfg); !reflect.DeepEqual(got, api.DefaultHandlerOptions()) {
+		t.Errorf("Expected the handler defaults, got %+v", got)
+	}
+	if got := historyConfig(cfg); got.Enabled() {
+		t.Errorf("Expected history to be disabled, got %+v", got)
+	}
+	if _, enabled, err := tlsConfig(cfg); enabled || err != nil {
+		t.Errorf("Expected TLS to be disabled, got %v %v", enabled, err)
+	}
+}
+
+func TestOptions_FromConfig(t *testing.T) {
+	cfg := config.Default()
+	cfg.Admin.Token = "secret"
+	cfg.Limits.TrustProxyHeaders = true
+	cfg.SSE.MaxClientsPerIP = 3
+	cfg.Namespaces.Names = []string{"orders"}
+
+	options := namespaceOptions(cfg)
+	if options.Handler.AdminToken != "secret" || !options.Handler.Limits.TrustProxy {
+		t.Errorf("Expected the handler settings of the namespaces, got %+v", options.Handler)
+	}
+	if options.Limits.MaxClientsPerKey != 3 || len(options.Names) != 1 {
+		t.Errorf("Expected the namespace settings, got %+v", options)
+	}
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// requireAdmin only passes requests that present the admin token as a bearer token.
+// The admin API is disabled when no token is configured.
+func (h *Handler) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.AdminToken == "" {
+			sendJSONError(w, http.StatusForbidden, "admin_disabled", "Set ADMIN_TOKEN to enable the admin API")
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.AdminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			sendJSONError(w, http.StatusUnauthorized, "unauthorized", "A valid admin token is required")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// HandleAdminClientList lists the connected SSE clients
+func (h *Handler) HandleAdminClientList(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET requests
+	if r.Method != http.MethodGet {
+		sendJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET requests are allowed for listing clients")
+		return
+	}
+
+	clients := h.SSEServer.Clients()
+	sendJSONSuccess(w, map[string]interface{}{
+		"clients":     clients,
+		"count":       len(clients),
+		"max_clients": h.SSEServer.MaxClients(),
+	}, "Clients retrieved successfully")
+}
+
+// HandleAdminClientGet returns a single connected SSE client
+func (h *Handler) HandleAdminClientGet(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET requests
+	if r.Method != http.MethodGet {
+		sendJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET requests are allowed for client details")
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	client, ok := h.SSEServer.Client(id)
+	if !ok {
+		sendJSONError(w, http.StatusNotFound, "client_not_found", "Client "+id+" is not connected")
+		return
+	}
+
+	sendJSONSuccess(w, client, "Client retrieved successfully")
+}
+
+// HandleAdminClientDisconnect closes a client's stream. The optional reason query
+// parameter is sent to the client in a disconnect event first.
+func (h *Handler) HandleAdminClientDisconnect(w http.ResponseWriter, r *http.Request) {
+	// Only allow DELETE requests
+	if r.Method != http.MethodDelete {
+		sendJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only DELETE requests are allowed for disconnecting clients")
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	reason := r.URL.Query().Get("reason")
+	if !h.SSEServer.DisconnectClient(id, reason) {
+		sendJSONError(w, http.StatusNotFound, "client_not_found", "Client "+id+" is not connected")
+		return
+	}
+
+	sendJSONSuccess(w, map[string]interface{}{
+		"id":     id,
+		"reason": reason,
+	}, "Client disconnected successfully")
+}
+
+// HandleAdminConfig returns the effective configuration with secrets redacted
+func (h *Handler) HandleAdminConfig(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET requests
+	if r.Method != http.MethodGet {
+		sendJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET requests are allowed for the configuration")
+		return
+	}
+
+	if h.Config == nil {
+		sendJSONError(w, http.StatusNotFound, "config_unavailable", "No configuration is available for this handler")
+		return
+	}
+
+	sendJSONSuccess(w, h.Config().Redacted(), "Configuration retrieved successfully")
+}
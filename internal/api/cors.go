@@ -0,0 +1,201 @@
+package api
+
+import (
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSOptions configures which browser origins may call the API
+type CORSOptions struct {
+	AllowedOrigins       []string      // Origins allowed exactly, "*" for any origin
+	AllowedOriginPattern string        // Regular expression for further allowed origins, empty for none
+	AllowedMethods       []string      // Methods allowed in preflight requests
+	AllowedHeaders       []string      // Request headers allowed in preflight requests, "*" for any header
+	ExposedHeaders       []string      // Response headers readable by scripts
+	AllowCredentials     bool          // Allow cookies and Authorization on cross-origin requests
+	MaxAge               time.Duration // How long browsers may cache a preflight response
+}
+
+// DefaultCORSOptions returns the policy used when nothing is configured: any origin without credentials
+func DefaultCORSOptions() CORSOptions {
+	return CORSOptions{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders: []string{"Accept", "Authorization", "Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Last-Event-ID"},
+		ExposedHeaders: []string{"ETag", "Retry-After"},
+		MaxAge:         10 * time.Minute,
+	}
+}
+
+// CORSOptionsFromEnv reads the CORS policy from the environment
+func CORSOptionsFromEnv() CORSOptions {
+	options := DefaultCORSOptions()
+
+	// A pattern alone replaces the default of any origin
+	options.AllowedOriginPattern = os.Getenv("CORS_ALLOWED_ORIGIN_PATTERN")
+	if list := splitList(os.Getenv("CORS_ALLOWED_ORIGINS")); len(list) > 0 {
+		options.AllowedOrigins = list
+	} else if options.AllowedOriginPattern != "" {
+		options.AllowedOrigins = nil
+	}
+
+	if list := splitList(os.Getenv("CORS_ALLOWED_METHODS")); len(list) > 0 {
+		options.AllowedMethods = list
+	}
+
+	if list := splitList(os.Getenv("CORS_ALLOWED_HEADERS")); len(list) > 0 {
+		options.AllowedHeaders = list
+	}
+
+	if list := splitList(os.Getenv("CORS_EXPOSED_HEADERS")); len(list) > 0 {
+		options.ExposedHeaders = list
+	}
+
+	if value := os.Getenv("CORS_ALLOW_CREDENTIALS"); value == "true" || value == "1" {
+		options.AllowCredentials = true
+	}
+
+	if value := os.Getenv("CORS_MAX_AGE"); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+			options.MaxAge = d
+		}
+	}
+
+	return options
+}
+
+// splitList splits a comma-separated environment value, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// corsPolicy is a CORS policy ready to answer requests
+type corsPolicy struct {
+	options   CORSOptions
+	anyOrigin bool
+	origins   map[string]bool
+	pattern   *regexp.Regexp
+	anyHeader bool
+	methods   string
+	headers   string
+	exposed   string
+	maxAge    string
+}
+
+// newCORSPolicy compiles the CORS options
+func newCORSPolicy(options CORSOptions) (*corsPolicy, error) {
+	policy := &corsPolicy{
+		options: options,
+		origins: make(map[string]bool),
+		methods: strings.Join(options.AllowedMethods, ", "),
+		headers: strings.Join(options.AllowedHeaders, ", "),
+		exposed: strings.Join(options.ExposedHeaders, ", "),
+		maxAge:  strconv.Itoa(int(options.MaxAge / time.Second)),
+	}
+
+	for _, origin := range options.AllowedOrigins {
+		if origin == "*" {
+			policy.anyOrigin = true
+		}
+		// Origins are compared without case, as browsers send them in lower case
+		policy.origins[strings.ToLower(origin)] = true
+	}
+	for _, header := range options.AllowedHeaders {
+		if header == "*" {
+			policy.anyHeader = true
+		}
+	}
+
+	if options.AllowedOriginPattern != "" {
+		pattern, err := regexp.Compile(options.AllowedOriginPattern)
+		if err != nil {
+			return nil, err
+		}
+		policy.pattern = pattern
+	}
+
+	return policy, nil
+}
+
+// allowed reports whether requests from origin may read responses
+func (p *corsPolicy) allowed(origin string) bool {
+	if p.anyOrigin || p.origins[strings.ToLower(origin)] {
+		return true
+	}
+	return p.pattern != nil && p.pattern.MatchString(origin)
+}
+
+// SetCORS replaces the CORS policy. An invalid origin pattern leaves the current policy in place.
+func (h *Handler) SetCORS(options CORSOptions) error {
+	policy, err := newCORSPolicy(options)
+	if err != nil {
+		return err
+	}
+	h.cors.Store(policy)
+	return nil
+}
+
+// CORSOptions returns the CORS policy
+func (h *Handler) CORSOptions() CORSOptions {
+	return h.cors.Load().options
+}
+
+// handleCORS adds the CORS headers allowed for the request's origin and answers preflight requests
+func (h *Handler) handleCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		policy := h.cors.Load()
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions
+
+		// The response depends on the origin unless every origin gets the same "*"
+		echo := !policy.anyOrigin || policy.options.AllowCredentials
+		if echo {
+			w.Header().Add("Vary", "Origin")
+		}
+		if preflight {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		if origin != "" && policy.allowed(origin) {
+			if echo {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			}
+			if policy.options.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if preflight {
+				w.Header().Set("Access-Control-Allow-Methods", policy.methods)
+				if policy.anyHeader {
+					w.Header().Set("Access-Control-Allow-Headers", r.Header.Get("Access-Control-Request-Headers"))
+				} else {
+					w.Header().Set("Access-Control-Allow-Headers", policy.headers)
+				}
+				w.Header().Set("Access-Control-Max-Age", policy.maxAge)
+			} else if policy.exposed != "" {
+				w.Header().Set("Access-Control-Expose-Headers", policy.exposed)
+			}
+		}
+
+		// Preflight requests are answered here, without the CORS headers when the origin is not allowed
+		if preflight {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -2,28 +2,54 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
+	"os"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/piske-alex/go-sse/internal/codec"
+	"github.com/piske-alex/go-sse/internal/config"
+	"github.com/piske-alex/go-sse/internal/logging"
+	"github.com/piske-alex/go-sse/internal/schema"
 	"github.com/piske-alex/go-sse/internal/sse"
 	"github.com/piske-alex/go-sse/internal/store"
+	"github.com/piske-alex/go-sse/internal/view"
+	"github.com/piske-alex/go-sse/internal/webhook"
 )
 
 // Handler manages the HTTP API handlers
 type Handler struct {
-	Store     store.Store // Use store.Store interface instead of interface{}
-	SSEServer *sse.Server
+	Store      store.Store // Use store.Store interface instead of interface{}
+	SSEServer  *sse.Server
+	Namespace  string      // Name of the namespace served by this handler, empty for the default store
+	Namespaces *Namespaces // Namespaces served under /ns, nil when disabled
+	Webhooks   *webhook.Manager
+	Probes     ProbeOptions // Thresholds of the readiness checks
+	AdminToken string       // Bearer token for the admin API, empty to disable it
+
+	// Config returns the effective configuration shown at /admin/config, nil when not available
+	Config func() config.Config
+
+	limits atomic.Pointer[limitState] // Client identification and store rate limits
+	cors   atomic.Pointer[corsPolicy] // Origins allowed to call the API from a browser
 }
 
+// unsupportedContentTypeMessage is returned when a write uses an unknown body encoding
+const unsupportedContentTypeMessage = "Content-Type must be application/json, application/msgpack or application/cbor"
+
 // ErrorResponse represents an error response
 type ErrorResponse struct {
-	Error   string `json:"error"`
-	Code    int    `json:"code"`
-	Message string `json:"message,omitempty"`
+	Error   string             `json:"error"`
+	Code    int                `json:"code"`
+	Message string             `json:"message,omitempty"`
+	Errors  []schema.Violation `json:"errors,omitempty"`
 }
 
 // SuccessResponse represents a success response
@@ -33,12 +59,57 @@ type SuccessResponse struct {
 	Message string      `json:"message,omitempty"`
 }
 
+// HandlerOptions configures a handler
+type HandlerOptions struct {
+	AdminToken string          // Bearer token for the admin routes, empty to disable them
+	Webhooks   webhook.Options // Delivery retries and allowed targets of webhooks
+	Limits     LimitOptions    // Client identification and store rate limits
+	CORS       CORSOptions     // Origins allowed to call the API from a browser
+	Probes     ProbeOptions    // Thresholds of the readiness checks
+}
+
+// DefaultHandlerOptions returns the options used when nothing is configured: no admin
+// token, no rate limits and any origin without credentials
+func DefaultHandlerOptions() HandlerOptions {
+	return HandlerOptions{
+		Webhooks: webhook.DefaultOptions(),
+		CORS:     DefaultCORSOptions(),
+		Probes:   DefaultProbeOptions(),
+	}
+}
+
+// HandlerOptionsFromEnv reads the handler options from the environment
+func HandlerOptionsFromEnv() HandlerOptions {
+	return HandlerOptions{
+		AdminToken: os.Getenv("ADMIN_TOKEN"),
+		Webhooks:   webhook.OptionsFromEnv(),
+		Limits:     LimitOptionsFromEnv(),
+		CORS:       CORSOptionsFromEnv(),
+		Probes:     ProbeOptionsFromEnv(),
+	}
+}
+
 // NewHandler creates a new API handler
-func NewHandler(dataStore store.Store, sseServer *sse.Server) *Handler {
-	return &Handler{
-		Store:     dataStore,
-		SSEServer: sseServer,
+func NewHandler(dataStore store.Store, sseServer *sse.Server, options HandlerOptions) *Handler {
+	// Deliver the events broadcast to SSE clients to webhooks as well
+	webhooks := webhook.NewManager(options.Webhooks)
+	sseServer.AddEventListener(webhooks.Notify)
+
+	h := &Handler{
+		Store:      dataStore,
+		SSEServer:  sseServer,
+		Webhooks:   webhooks,
+		Probes:     options.Probes,
+		AdminToken: options.AdminToken,
+	}
+	h.SetLimits(options.Limits)
+	cors := options.CORS
+	if err := h.SetCORS(cors); err != nil {
+		logging.Warnf("Ignoring invalid CORS origin pattern: %v", err)
+		cors.AllowedOriginPattern = ""
+		h.SetCORS(cors)
 	}
+	return h
 }
 
 // sendJSONError sends a JSON error response
@@ -55,6 +126,30 @@ func sendJSONError(w http.ResponseWriter, statusCode int, errorType string, mess
 	json.NewEncoder(w).Encode(resp)
 }
 
+// sendRetryAfter sets the Retry-After header, in whole seconds rounded up
+func sendRetryAfter(w http.ResponseWriter, d time.Duration) {
+	seconds := int((d + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+}
+
+// sendSchemaError sends a 422 response listing the locations that violate a schema
+func sendSchemaError(w http.ResponseWriter, message string, validationErr *schema.ValidationError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+
+	resp := ErrorResponse{
+		Error:   "schema_violation",
+		Code:    http.StatusUnprocessableEntity,
+		Message: fmt.Sprintf("%s: value does not match the schema registered for path '%s'", message, validationErr.SchemaPath),
+		Errors:  validationErr.Violations,
+	}
+
+	json.NewEncoder(w).Encode(resp)
+}
+
 // sendJSONSuccess sends a JSON success response
 func sendJSONSuccess(w http.ResponseWriter, data interface{}, message string) {
 	w.Header().Set("Content-Type", "application/json")
@@ -69,6 +164,31 @@ func sendJSONSuccess(w http.ResponseWriter, data interface{}, message string) {
 	json.NewEncoder(w).Encode(resp)
 }
 
+// sendSuccess sends a success response encoded with the codec negotiated from the Accept header
+func sendSuccess(w http.ResponseWriter, r *http.Request, data interface{}, message string) {
+	c := codec.Negotiate(r.Header.Get("Accept"))
+	if c == codec.JSON {
+		sendJSONSuccess(w, data, message)
+		return
+	}
+
+	body, err := c.Marshal(SuccessResponse{
+		Status:  "success",
+		Data:    data,
+		Message: message,
+	})
+	if err != nil {
+		logging.Errorf("Error encoding %s response: %v", c.Name(), err)
+		sendJSONError(w, http.StatusInternalServerError, "encoding_error", "Failed to encode response")
+		return
+	}
+
+	w.Header().Set("Content-Type", c.ContentType())
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
 // HandleEvents handles SSE connections
 func (h *Handler) HandleEvents(w http.ResponseWriter, r *http.Request) {
 	// Only allow GET requests
@@ -97,12 +217,25 @@ func (h *Handler) HandleEvents(w http.ResponseWriter, r *http.Request) {
 		
 		// Create an enhanced filter that includes key-value filtering
 		enhancedFilter := fmt.Sprintf("%s[%s=%s]", basePath, filterKey, filterValue)
-		log.Printf("Added key-value filter: %s", enhancedFilter)
+		logging.Debugf("Added key-value filter: %s", enhancedFilter)
 		
 		// Replace the first filter with the enhanced one
 		filters[0] = enhancedFilter
 	}
 
+	// Parse view parameter (optional); a view subscription replaces path filters
+	viewName := r.URL.Query().Get("view")
+	if viewName != "" {
+		if len(filters) > 0 {
+			sendJSONError(w, http.StatusBadRequest, "invalid_parameter", "The view parameter cannot be combined with filters")
+			return
+		}
+		if _, ok := h.SSEServer.Views().Get(viewName); !ok {
+			sendJSONError(w, http.StatusNotFound, "view_not_found", fmt.Sprintf("No view named '%s'", viewName))
+			return
+		}
+	}
+
 	// Parse initial_data parameter (optional, default is true)
 	sendInitialData := true
 	initialDataParam := r.URL.Query().Get("initial_data")
@@ -110,20 +243,68 @@ func (h *Handler) HandleEvents(w http.ResponseWriter, r *http.Request) {
 		sendInitialData = false
 	}
 
+	// Parse encoding parameter (optional, default is JSON)
+	encoding := codec.JSON
+	if encodingParam := r.URL.Query().Get("encoding"); encodingParam != "" {
+		c, ok := codec.ByName(encodingParam)
+		if !ok {
+			sendJSONError(w, http.StatusBadRequest, "invalid_parameter", fmt.Sprintf("Unsupported event encoding '%s'", encodingParam))
+			return
+		}
+		encoding = c
+	}
+
+	// The stream outlives the server's read and write timeouts, which bound the other requests
+	controller := http.NewResponseController(w)
+	for _, clear := range []func(time.Time) error{controller.SetReadDeadline, controller.SetWriteDeadline} {
+		if err := clear(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			logging.Warnf("failed to clear the connection deadline of an SSE client: %v", err)
+		}
+	}
+
 	// Add client to SSE server
-	client, err := h.SSEServer.AddClient(w, r, filters, sendInitialData)
+	client, err := h.SSEServer.AddClientWithOptions(w, r, filters, sse.ClientOptions{
+		SendInitialData: sendInitialData,
+		Encoding:        encoding,
+		View:            viewName,
+		RemoteIP:        h.clientIP(r),
+		LimitKey:        h.limitKey(r),
+		LastEventID:     r.Header.Get("Last-Event-ID"),
+	})
+	switch {
+	case errors.Is(err, sse.ErrDraining):
+		// Send the client to another instance
+		sendRetryAfter(w, h.SSEServer.RetryAfter())
+		sendJSONError(w, http.StatusServiceUnavailable, "server_draining", "Server is shutting down, reconnect to another instance")
+		return
+	case errors.Is(err, sse.ErrServerFull):
+		sendRetryAfter(w, connectionRetryAfter)
+		sendJSONError(w, http.StatusServiceUnavailable, "server_full", "Server has reached its maximum number of SSE connections")
+		return
+	case errors.Is(err, sse.ErrClientLimit):
+		sendRetryAfter(w, connectionRetryAfter)
+		sendJSONError(w, http.StatusTooManyRequests, "too_many_connections", "Too many SSE connections from this client")
+		return
+	}
 	if err != nil {
-		log.Printf("Error adding SSE client: %v", err)
+		logging.Errorf("Error adding SSE client: %v", err)
 		sendJSONError(w, http.StatusInternalServerError, "sse_connection_failed", fmt.Sprintf("Failed to establish SSE connection: %v", err))
 		return
 	}
 
 	// Log client connection
-	log.Printf("SSE client connected: %s with filters: %v", client.ID, filters)
+	logging.Infof("SSE client connected: %s with filters: %v", client.ID, filters)
+
+	// Keep the connection open until client disconnects or the server drains it
+	select {
+	case <-r.Context().Done():
+	case <-client.Done():
+	}
 
-	// Keep the connection open until client disconnects
-	<-r.Context().Done()
-	log.Printf("SSE client disconnected: %s", client.ID)
+	// Stop the client's writer before the response writer is released
+	h.SSEServer.RemoveClient(client.ID)
+	<-client.Done()
+	logging.Infof("SSE client disconnected: %s", client.ID)
 }
 
 // HandleStoreInitialize handles store initialization
@@ -135,45 +316,63 @@ func (h *Handler) HandleStoreInitialize(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Validate content type
-	contentType := r.Header.Get("Content-Type")
-	if !strings.Contains(contentType, "application/json") {
-		sendJSONError(w, http.StatusUnsupportedMediaType, "invalid_content_type", "Content-Type must be application/json")
+	bodyCodec, ok := codec.ForContentType(r.Header.Get("Content-Type"))
+	if !ok {
+		sendJSONError(w, http.StatusUnsupportedMediaType, "invalid_content_type", unsupportedContentTypeMessage)
 		return
 	}
 
 	// Read request body
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		log.Printf("Error reading request body: %v", err)
+		logging.Errorf("Error reading request body: %v", err)
 		sendJSONError(w, http.StatusBadRequest, "invalid_request", fmt.Sprintf("Error reading request body: %v", err))
 		return
 	}
 	defer r.Body.Close()
 
-	// Validate JSON format first
-	var jsonTest interface{}
-	if err := json.Unmarshal(body, &jsonTest); err != nil {
-		sendJSONError(w, http.StatusBadRequest, "invalid_json", fmt.Sprintf("Invalid JSON format: %v", err))
-		return
-	}
+	if bodyCodec == codec.JSON {
+		// Validate JSON format first
+		var jsonTest interface{}
+		if err := json.Unmarshal(body, &jsonTest); err != nil {
+			sendJSONError(w, http.StatusBadRequest, "invalid_json", fmt.Sprintf("Invalid JSON format: %v", err))
+			return
+		}
 
-	// Log operation
-	log.Printf("Initializing store with %d bytes of JSON data", len(body))
+		// Log operation
+		logging.Infof("Initializing store with %d bytes of JSON data", len(body))
 
-	// Use the Store interface directly, no need for type switch
-	err = h.Store.InitializeFromJSON(body)
+		// Use the Store interface directly, no need for type switch
+		err = h.Store.InitializeFromJSON(body)
+	} else {
+		// Decode binary payloads before handing them to the store
+		var data map[string]interface{}
+		if err := bodyCodec.Unmarshal(body, &data); err != nil {
+			sendJSONError(w, http.StatusBadRequest, "invalid_body", fmt.Sprintf("Invalid %s format: %v", bodyCodec.Name(), err))
+			return
+		}
 
+		logging.Infof("Initializing store with %d bytes of %s data", len(body), bodyCodec.Name())
+		err = h.Store.Initialize(data)
+	}
+
+	var validationErr *schema.ValidationError
+	if errors.As(err, &validationErr) {
+		logging.Infof("Rejected store initialization: %v", err)
+		sendSchemaError(w, "Failed to initialize store", validationErr)
+		return
+	}
 	if err != nil {
-		log.Printf("Error initializing store: %v", err)
+		logging.Errorf("Error initializing store: %v", err)
 		sendJSONError(w, http.StatusBadRequest, "initialization_failed", fmt.Sprintf("Failed to initialize store: %v", err))
 		return
 	}
 
 	// Broadcast store initialization event
-	h.SSEServer.BroadcastEvent(".", nil, "init")
+	h.SSEServer.BroadcastWrite(".", nil, "init")
 
 	// Return success response with information about the operation
-	sendJSONSuccess(w, map[string]interface{}{
+	sendSuccess(w, r, map[string]interface{}{
 		"size_bytes": len(body),
 		"timestamp":  time.Now().Unix(),
 	}, "Store initialized successfully")
@@ -188,9 +387,9 @@ func (h *Handler) HandleStoreUpdate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate content type
-	contentType := r.Header.Get("Content-Type")
-	if !strings.Contains(contentType, "application/json") {
-		sendJSONError(w, http.StatusUnsupportedMediaType, "invalid_content_type", "Content-Type must be application/json")
+	bodyCodec, ok := codec.ForContentType(r.Header.Get("Content-Type"))
+	if !ok {
+		sendJSONError(w, http.StatusUnsupportedMediaType, "invalid_content_type", unsupportedContentTypeMessage)
 		return
 	}
 
@@ -201,30 +400,67 @@ func (h *Handler) HandleStoreUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Optional time to live after which the value is deleted
+	var ttl time.Duration
+	if ttlParam := r.URL.Query().Get("ttl"); ttlParam != "" {
+		parsed, err := time.ParseDuration(ttlParam)
+		if err != nil || parsed <= 0 {
+			sendJSONError(w, http.StatusBadRequest, "invalid_parameter", "ttl must be a positive duration such as 30s or 5m")
+			return
+		}
+		ttl = parsed
+	}
+
 	// Read request body
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		log.Printf("Error reading request body: %v", err)
+		logging.Errorf("Error reading request body: %v", err)
 		sendJSONError(w, http.StatusBadRequest, "invalid_request", fmt.Sprintf("Error reading request body: %v", err))
 		return
 	}
 	defer r.Body.Close()
 
-	// Validate JSON format first
-	var jsonTest interface{}
-	if err := json.Unmarshal(body, &jsonTest); err != nil {
-		sendJSONError(w, http.StatusBadRequest, "invalid_json", fmt.Sprintf("Invalid JSON format: %v", err))
-		return
-	}
+	if bodyCodec == codec.JSON {
+		// Validate JSON format first
+		var jsonTest interface{}
+		if err := json.Unmarshal(body, &jsonTest); err != nil {
+			sendJSONError(w, http.StatusBadRequest, "invalid_json", fmt.Sprintf("Invalid JSON format: %v", err))
+			return
+		}
 
-	// Log operation
-	log.Printf("Updating store at path '%s' with %d bytes of JSON data", path, len(body))
+		// Log operation
+		logging.Infof("Updating store at path '%s' with %d bytes of JSON data", path, len(body))
+
+		// Use the Store interface directly
+		if ttl > 0 {
+			err = h.Store.SetWithTTL(path, jsonTest, ttl)
+		} else {
+			err = h.Store.SetFromJSON(path, body)
+		}
+	} else {
+		// Decode binary payloads before handing them to the store
+		var value interface{}
+		if err := bodyCodec.Unmarshal(body, &value); err != nil {
+			sendJSONError(w, http.StatusBadRequest, "invalid_body", fmt.Sprintf("Invalid %s format: %v", bodyCodec.Name(), err))
+			return
+		}
 
-	// Use the Store interface directly
-	err = h.Store.SetFromJSON(path, body)
+		logging.Infof("Updating store at path '%s' with %d bytes of %s data", path, len(body), bodyCodec.Name())
+		if ttl > 0 {
+			err = h.Store.SetWithTTL(path, value, ttl)
+		} else {
+			err = h.Store.Set(path, value)
+		}
+	}
 
+	var validationErr *schema.ValidationError
+	if errors.As(err, &validationErr) {
+		logging.Infof("Rejected store update: %v", err)
+		sendSchemaError(w, "Failed to update store", validationErr)
+		return
+	}
 	if err != nil {
-		log.Printf("Error updating store: %v", err)
+		logging.Errorf("Error updating store: %v", err)
 		sendJSONError(w, http.StatusBadRequest, "update_failed", fmt.Sprintf("Failed to update store: %v", err))
 		return
 	}
@@ -232,18 +468,119 @@ func (h *Handler) HandleStoreUpdate(w http.ResponseWriter, r *http.Request) {
 	// Get the updated value
 	value, err := h.Store.Get(path)
 	if err != nil {
-		log.Printf("Error getting updated value: %v", err)
+		logging.Errorf("Error getting updated value: %v", err)
 	} else {
 		// Broadcast update event if value was retrieved successfully
-		h.SSEServer.BroadcastEvent(path, value, "update")
+		h.SSEServer.BroadcastWrite(path, value, "update")
 	}
 
 	// Return success response
-	sendJSONSuccess(w, map[string]interface{}{
+	result := map[string]interface{}{
 		"path":       path,
 		"size_bytes": len(body),
 		"timestamp":  time.Now().Unix(),
-	}, "Store updated successfully")
+	}
+	if ttl > 0 {
+		result["expires_at"] = time.Now().Add(ttl).Unix()
+	}
+	sendSuccess(w, r, result, "Store updated successfully")
+}
+
+// HandleStoreDelete removes the value at a store path
+func (h *Handler) HandleStoreDelete(w http.ResponseWriter, r *http.Request) {
+	// Only allow DELETE requests
+	if r.Method != http.MethodDelete {
+		sendJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only DELETE requests are allowed for store deletes")
+		return
+	}
+
+	// Get path from query parameter
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		sendJSONError(w, http.StatusBadRequest, "missing_parameter", "Missing path parameter")
+		return
+	}
+
+	logging.Infof("Deleting store path '%s'", path)
+
+	if err := h.Store.Delete(path); err != nil {
+		logging.Errorf("Error deleting from store: %v", err)
+		sendJSONError(w, http.StatusNotFound, "delete_failed", fmt.Sprintf("Failed to delete store path '%s': %v", path, err))
+		return
+	}
+
+	// Broadcast delete event
+	h.SSEServer.BroadcastWrite(path, nil, "delete")
+
+	sendSuccess(w, r, map[string]interface{}{
+		"path":      path,
+		"timestamp": time.Now().Unix(),
+	}, "Store path deleted successfully")
+}
+
+// HandleStoreOperation applies an atomic operation such as append or increment to a store path
+func (h *Handler) HandleStoreOperation(w http.ResponseWriter, r *http.Request) {
+	// Only allow POST requests
+	if r.Method != http.MethodPost {
+		sendJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST requests are allowed for store operations")
+		return
+	}
+
+	// Validate content type
+	if !strings.Contains(r.Header.Get("Content-Type"), "application/json") {
+		sendJSONError(w, http.StatusUnsupportedMediaType, "invalid_content_type", "Content-Type must be application/json")
+		return
+	}
+
+	// Get path from query parameter
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		sendJSONError(w, http.StatusBadRequest, "missing_parameter", "Missing path parameter")
+		return
+	}
+
+	// Decode the operation
+	var op store.Operation
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&op); err != nil {
+		sendJSONError(w, http.StatusBadRequest, "invalid_json", fmt.Sprintf("Invalid operation: %v", err))
+		return
+	}
+	defer r.Body.Close()
+
+	logging.Infof("Applying %s operation to store at path '%s'", op.Op, path)
+
+	changes, err := h.Store.Apply(path, op)
+	var validationErr *schema.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		logging.Infof("Rejected store operation: %v", err)
+		sendSchemaError(w, "Failed to apply operation", validationErr)
+		return
+	case errors.Is(err, store.ErrInvalidOperation):
+		sendJSONError(w, http.StatusBadRequest, "invalid_operation", err.Error())
+		return
+	case err != nil:
+		logging.Errorf("Error applying store operation: %v", err)
+		sendJSONError(w, http.StatusBadRequest, "operation_failed", fmt.Sprintf("Failed to apply operation: %v", err))
+		return
+	}
+
+	// Broadcast each element change rather than the whole array
+	for _, change := range changes {
+		h.SSEServer.BroadcastWrite(change.Path, change.Value, string(change.Op))
+	}
+
+	if changes == nil {
+		changes = []store.Change{}
+	}
+	sendSuccess(w, r, map[string]interface{}{
+		"path":      path,
+		"op":        op.Op,
+		"changes":   changes,
+		"timestamp": time.Now().Unix(),
+	}, "Operation applied successfully")
 }
 
 // HandleStoreQuery handles store queries
@@ -268,8 +605,25 @@ func (h *Handler) HandleStoreQuery(w http.ResponseWriter, r *http.Request) {
 		isPattern = true
 	}
 
+	// Check if this is a time-travel query
+	atParam := r.URL.Query().Get("at")
+	var at store.PointInTime
+	if atParam != "" {
+		if isPattern {
+			sendJSONError(w, http.StatusBadRequest, "invalid_parameter", "The at parameter cannot be combined with pattern queries")
+			return
+		}
+
+		var err error
+		at, err = store.ParsePointInTime(atParam)
+		if err != nil {
+			sendJSONError(w, http.StatusBadRequest, "invalid_parameter", err.Error())
+			return
+		}
+	}
+
 	// Log operation
-	log.Printf("Querying store at path '%s' (pattern: %v)", path, isPattern)
+	logging.Infof("Querying store at path '%s' (pattern: %v, at: %q)", path, isPattern, atParam)
 
 	// Different handling for pattern matches vs direct query
 	var (
@@ -277,7 +631,14 @@ func (h *Handler) HandleStoreQuery(w http.ResponseWriter, r *http.Request) {
 		err    error
 	)
 
-	if isPattern {
+	if atParam != "" {
+		// Historical query, use GetAt
+		result, err = h.Store.GetAt(path, at)
+		if errors.Is(err, store.ErrHistoryDisabled) || errors.Is(err, store.ErrRevisionNotFound) {
+			sendHistoryError(w, err)
+			return
+		}
+	} else if isPattern {
 		// Pattern match query, use FindMatches
 		result, err = h.Store.FindMatches(path)
 	} else {
@@ -286,11 +647,26 @@ func (h *Handler) HandleStoreQuery(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err != nil {
-		log.Printf("Error querying store: %v", err)
+		logging.Errorf("Error querying store: %v", err)
 		sendJSONError(w, http.StatusNotFound, "query_failed", fmt.Sprintf("Failed to query store at path '%s': %v", path, err))
 		return
 	}
 
+	// Encode with the codec negotiated from the Accept header
+	w.Header().Add("Vary", "Accept")
+	if c := codec.Negotiate(r.Header.Get("Accept")); c != codec.JSON {
+		body, err := c.Marshal(result)
+		if err != nil {
+			logging.Errorf("Error encoding %s response: %v", c.Name(), err)
+			sendJSONError(w, http.StatusInternalServerError, "encoding_error", "Failed to encode response")
+			return
+		}
+
+		w.Header().Set("Content-Type", c.ContentType())
+		w.Write(body)
+		return
+	}
+
 	// Return result directly as JSON
 	w.Header().Set("Content-Type", "application/json")
 	
@@ -300,11 +676,160 @@ func (h *Handler) HandleStoreQuery(w http.ResponseWriter, r *http.Request) {
 	encoder.SetIndent("", "")   // No indentation for smaller payload
 	
 	if err := encoder.Encode(result); err != nil {
-		log.Printf("Error encoding JSON response: %v", err)
+		logging.Errorf("Error encoding JSON response: %v", err)
 		sendJSONError(w, http.StatusInternalServerError, "encoding_error", "Failed to encode response")
 	}
 }
 
+// HandleStoreHistory lists the recorded changes that touched a path
+func (h *Handler) HandleStoreHistory(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET requests
+	if r.Method != http.MethodGet {
+		sendJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET requests are allowed for store history")
+		return
+	}
+
+	// Get path from query parameter
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		sendJSONError(w, http.StatusBadRequest, "missing_parameter", "Missing path parameter")
+		return
+	}
+
+	// Optional limit on the number of most recent revisions
+	limit := 0
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		n, err := strconv.Atoi(limitParam)
+		if err != nil || n < 0 {
+			sendJSONError(w, http.StatusBadRequest, "invalid_parameter", "limit must be a non-negative integer")
+			return
+		}
+		limit = n
+	}
+
+	revisions, err := h.Store.History(path, limit)
+	if err != nil {
+		logging.Errorf("Error reading history: %v", err)
+		sendHistoryError(w, err)
+		return
+	}
+
+	// Always return an array, even when nothing touched the path
+	if revisions == nil {
+		revisions = []store.Revision{}
+	}
+
+	sendSuccess(w, r, map[string]interface{}{
+		"path":      path,
+		"revisions": revisions,
+	}, fmt.Sprintf("Found %d revisions for path '%s'", len(revisions), path))
+}
+
+// sendHistoryError maps history errors to HTTP responses
+func sendHistoryError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrHistoryDisabled):
+		sendJSONError(w, http.StatusNotImplemented, "history_disabled", err.Error())
+	case errors.Is(err, store.ErrRevisionNotFound):
+		sendJSONError(w, http.StatusNotFound, "revision_not_found", err.Error())
+	default:
+		sendJSONError(w, http.StatusInternalServerError, "history_error", err.Error())
+	}
+}
+
+// HandleStoreExport streams the store as NDJSON, one {path, value} line per entry
+func (h *Handler) HandleStoreExport(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET requests
+	if r.Method != http.MethodGet {
+		sendJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET requests are allowed for store export")
+		return
+	}
+
+	// NDJSON is currently the only supported export format
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "ndjson" {
+		sendJSONError(w, http.StatusBadRequest, "invalid_parameter", fmt.Sprintf("Unsupported export format '%s'", format))
+		return
+	}
+
+	// Parse granularity parameter (optional, default is one line per top-level key)
+	granularity := store.ExportByKey
+	switch r.URL.Query().Get("granularity") {
+	case "", "key":
+	case "leaf":
+		granularity = store.ExportByLeaf
+	default:
+		sendJSONError(w, http.StatusBadRequest, "invalid_parameter", "granularity must be 'key' or 'leaf'")
+		return
+	}
+
+	logging.Infof("Exporting store as NDJSON (granularity: %s)", granularity)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	// Headers are already sent, so errors can only be logged from here on
+	lines, err := store.ExportNDJSON(h.Store, w, granularity)
+	if err != nil {
+		logging.Errorf("Error exporting store after %d lines: %v", lines, err)
+		return
+	}
+
+	logging.Infof("Exported %d lines", lines)
+}
+
+// HandleStoreImport applies an NDJSON stream of {path, value} lines to the store
+func (h *Handler) HandleStoreImport(w http.ResponseWriter, r *http.Request) {
+	// Only allow POST requests
+	if r.Method != http.MethodPost {
+		sendJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST requests are allowed for store import")
+		return
+	}
+
+	// Validate content type (application/x-ndjson, application/json or similar)
+	contentType := r.Header.Get("Content-Type")
+	if !strings.Contains(contentType, "json") {
+		sendJSONError(w, http.StatusUnsupportedMediaType, "invalid_content_type", "Content-Type must be application/x-ndjson")
+		return
+	}
+	defer r.Body.Close()
+
+	// Optionally clear the store before applying the stream
+	if r.URL.Query().Get("replace") == "true" {
+		if err := h.Store.Initialize(map[string]interface{}{}); err != nil {
+			logging.Errorf("Error clearing store before import: %v", err)
+			sendJSONError(w, http.StatusInternalServerError, "import_failed", fmt.Sprintf("Failed to clear store: %v", err))
+			return
+		}
+	}
+
+	lines, err := store.ImportNDJSON(h.Store, r.Body)
+
+	// Notify clients even after a partial import since earlier lines were applied
+	if lines > 0 {
+		h.SSEServer.BroadcastWrite(".", nil, "init")
+	}
+
+	var validationErr *schema.ValidationError
+	if errors.As(err, &validationErr) {
+		logging.Infof("Import rejected after %d lines: %v", lines, err)
+		sendSchemaError(w, fmt.Sprintf("Import stopped after %d lines", lines), validationErr)
+		return
+	}
+	if err != nil {
+		logging.Errorf("Error importing store after %d lines: %v", lines, err)
+		sendJSONError(w, http.StatusBadRequest, "import_failed", fmt.Sprintf("Import stopped after %d lines: %v", lines, err))
+		return
+	}
+
+	logging.Infof("Imported %d lines into store", lines)
+
+	sendSuccess(w, r, map[string]interface{}{
+		"lines":     lines,
+		"timestamp": time.Now().Unix(),
+	}, "Store imported successfully")
+}
+
 // HandleHealth returns a simple health check response
 func (h *Handler) HandleHealth(w http.ResponseWriter, r *http.Request) {
 	// Only allow GET requests
@@ -313,11 +838,31 @@ func (h *Handler) HandleHealth(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Return success response
-	sendJSONSuccess(w, map[string]interface{}{
+	// A draining server is no longer ready for new clients
+	if h.SSEServer.Draining() {
+		sendRetryAfter(w, h.SSEServer.RetryAfter())
+		sendJSONError(w, http.StatusServiceUnavailable, "draining", "Server is shutting down")
+		return
+	}
+
+	health := map[string]interface{}{
 		"status": "ok",
 		"time":   time.Now().Unix(),
-	}, "Service is healthy")
+	}
+	message := "Service is healthy"
+
+	// Without a running change stream, writes made directly to MongoDB are not broadcast
+	if mongoStore, ok := h.Store.(*store.MongoStore); ok {
+		changeStream := mongoStore.ChangeStreamStatus()
+		health["change_stream"] = changeStream
+		if changeStream.State != store.ChangeStreamRunning {
+			health["status"] = "degraded"
+			message = "Change stream is " + changeStream.State
+		}
+	}
+
+	// Return success response
+	sendJSONSuccess(w, health, message)
 }
 
 // HandleMetrics returns server metrics
@@ -344,6 +889,363 @@ func (h *Handler) HandleMetrics(w http.ResponseWriter, r *http.Request) {
 		metrics["store_type"] = "mongodb"
 	}
 
+	// Report the limits and the requests they refused
+	metrics["limits"] = h.limitMetrics()
+
+	// Report the process's goroutines and memory so that growth under load can be tracked
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	metrics["runtime"] = map[string]interface{}{
+		"goroutines":       runtime.NumGoroutine(),
+		"heap_alloc_bytes": memStats.HeapAlloc,
+		"heap_inuse_bytes": memStats.HeapInuse,
+		"sys_bytes":        memStats.Sys,
+		"num_gc":           memStats.NumGC,
+	}
+
+	// Identify the namespace, or count the namespaces served next to the default store
+	if h.Namespace != "" {
+		metrics["namespace"] = h.Namespace
+	} else if h.Namespaces != nil {
+		metrics["namespaces"] = len(h.Namespaces.Names())
+	}
+
 	// Return metrics as JSON
 	sendJSONSuccess(w, metrics, "Server metrics")
 }
+
+// HandleSchemaRegister registers a JSON Schema (draft 2020-12) for a store path
+func (h *Handler) HandleSchemaRegister(w http.ResponseWriter, r *http.Request) {
+	// Only allow PUT requests
+	if r.Method != http.MethodPut {
+		sendJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only PUT requests are allowed for schema registration")
+		return
+	}
+
+	// Validate content type (application/json or application/schema+json)
+	if !strings.Contains(r.Header.Get("Content-Type"), "json") {
+		sendJSONError(w, http.StatusUnsupportedMediaType, "invalid_content_type", "Content-Type must be application/json or application/schema+json")
+		return
+	}
+
+	// Get path from query parameter
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		sendJSONError(w, http.StatusBadRequest, "missing_parameter", "Missing path parameter")
+		return
+	}
+
+	// Read request body
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		logging.Errorf("Error reading request body: %v", err)
+		sendJSONError(w, http.StatusBadRequest, "invalid_request", fmt.Sprintf("Error reading request body: %v", err))
+		return
+	}
+	defer r.Body.Close()
+
+	// Compile and register the schema
+	if err := h.Store.Schemas().Register(path, body); err != nil {
+		sendJSONError(w, http.StatusBadRequest, "invalid_schema", err.Error())
+		return
+	}
+
+	logging.Infof("Registered schema for path '%s'", path)
+
+	sendJSONSuccess(w, map[string]interface{}{
+		"path": path,
+	}, "Schema registered successfully")
+}
+
+// HandleSchemaQuery returns the schema registered for a path, or all schemas when no path is given
+func (h *Handler) HandleSchemaQuery(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET requests
+	if r.Method != http.MethodGet {
+		sendJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET requests are allowed for schema queries")
+		return
+	}
+
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		sendJSONSuccess(w, map[string]interface{}{
+			"schemas": h.Store.Schemas().All(),
+		}, "")
+		return
+	}
+
+	raw, ok := h.Store.Schemas().Get(path)
+	if !ok {
+		sendJSONError(w, http.StatusNotFound, "schema_not_found", fmt.Sprintf("No schema registered for path '%s'", path))
+		return
+	}
+
+	// Return the schema document as registered
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.Write(raw)
+}
+
+// HandleSchemaDelete removes the schema registered for a path
+func (h *Handler) HandleSchemaDelete(w http.ResponseWriter, r *http.Request) {
+	// Only allow DELETE requests
+	if r.Method != http.MethodDelete {
+		sendJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only DELETE requests are allowed for schema removal")
+		return
+	}
+
+	// Get path from query parameter
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		sendJSONError(w, http.StatusBadRequest, "missing_parameter", "Missing path parameter")
+		return
+	}
+
+	if !h.Store.Schemas().Remove(path) {
+		sendJSONError(w, http.StatusNotFound, "schema_not_found", fmt.Sprintf("No schema registered for path '%s'", path))
+		return
+	}
+
+	logging.Infof("Removed schema for path '%s'", path)
+
+	sendJSONSuccess(w, map[string]interface{}{
+		"path": path,
+	}, "Schema removed successfully")
+}
+
+// HandleViewRegister registers or replaces the view named in the URL
+func (h *Handler) HandleViewRegister(w http.ResponseWriter, r *http.Request) {
+	// Only allow PUT requests
+	if r.Method != http.MethodPut {
+		sendJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only PUT requests are allowed for view registration")
+		return
+	}
+
+	// Validate content type
+	if !strings.Contains(r.Header.Get("Content-Type"), "application/json") {
+		sendJSONError(w, http.StatusUnsupportedMediaType, "invalid_content_type", "Content-Type must be application/json")
+		return
+	}
+
+	// Decode the view definition
+	var definition view.Definition
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&definition); err != nil {
+		sendJSONError(w, http.StatusBadRequest, "invalid_json", fmt.Sprintf("Invalid view definition: %v", err))
+		return
+	}
+	defer r.Body.Close()
+
+	name := chi.URLParam(r, "name")
+	v, err := h.SSEServer.Views().Register(name, definition)
+	if err != nil {
+		if errors.Is(err, view.ErrInvalidName) || errors.Is(err, view.ErrInvalidDefinition) {
+			sendJSONError(w, http.StatusBadRequest, "invalid_view", err.Error())
+			return
+		}
+		logging.Errorf("Error computing view %s: %v", name, err)
+		sendJSONError(w, http.StatusInternalServerError, "view_error", fmt.Sprintf("Failed to compute view: %v", err))
+		return
+	}
+
+	logging.Infof("Registered view '%s' from '%s'", name, definition.From)
+
+	// Subscribers of a replaced view receive its new value
+	h.SSEServer.BroadcastView(v, "update")
+
+	sendJSONSuccess(w, v, "View registered successfully")
+}
+
+// HandleViewQuery returns the current value of the view named in the URL
+func (h *Handler) HandleViewQuery(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET requests
+	if r.Method != http.MethodGet {
+		sendJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET requests are allowed for view queries")
+		return
+	}
+
+	name := chi.URLParam(r, "name")
+	v, ok := h.SSEServer.Views().Get(name)
+	if !ok {
+		sendJSONError(w, http.StatusNotFound, "view_not_found", fmt.Sprintf("No view named '%s'", name))
+		return
+	}
+
+	sendSuccess(w, r, v, "")
+}
+
+// HandleViewList returns every registered view with its definition and value
+func (h *Handler) HandleViewList(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET requests
+	if r.Method != http.MethodGet {
+		sendJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET requests are allowed for view queries")
+		return
+	}
+
+	sendSuccess(w, r, map[string]interface{}{
+		"views": h.SSEServer.Views().All(),
+	}, "")
+}
+
+// HandleViewDelete removes the view named in the URL
+func (h *Handler) HandleViewDelete(w http.ResponseWriter, r *http.Request) {
+	// Only allow DELETE requests
+	if r.Method != http.MethodDelete {
+		sendJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only DELETE requests are allowed for view removal")
+		return
+	}
+
+	name := chi.URLParam(r, "name")
+	if !h.SSEServer.Views().Remove(name) {
+		sendJSONError(w, http.StatusNotFound, "view_not_found", fmt.Sprintf("No view named '%s'", name))
+		return
+	}
+
+	logging.Infof("Removed view '%s'", name)
+
+	// Tell subscribers the view is gone
+	h.SSEServer.BroadcastView(view.View{Name: name}, "delete")
+
+	sendJSONSuccess(w, map[string]interface{}{
+		"name": name,
+	}, "View removed successfully")
+}
+
+// webhookRequest is the body of a webhook registration
+type webhookRequest struct {
+	URL    string `json:"url"`
+	Filter string `json:"filter"`
+	Secret string `json:"secret"`
+}
+
+// HandleWebhookCreate registers a webhook that receives store changes matching its filter
+func (h *Handler) HandleWebhookCreate(w http.ResponseWriter, r *http.Request) {
+	// Only allow POST requests
+	if r.Method != http.MethodPost {
+		sendJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST requests are allowed for webhook registration")
+		return
+	}
+
+	// Validate content type
+	if !strings.Contains(r.Header.Get("Content-Type"), "application/json") {
+		sendJSONError(w, http.StatusUnsupportedMediaType, "invalid_content_type", "Content-Type must be application/json")
+		return
+	}
+
+	// Decode the registration
+	var req webhookRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		sendJSONError(w, http.StatusBadRequest, "invalid_json", fmt.Sprintf("Invalid webhook: %v", err))
+		return
+	}
+	defer r.Body.Close()
+
+	hook, err := h.Webhooks.Create(req.URL, req.Filter, req.Secret)
+	if err != nil {
+		sendJSONError(w, http.StatusBadRequest, "invalid_webhook", err.Error())
+		return
+	}
+
+	sendJSONSuccess(w, hook, "Webhook registered successfully")
+}
+
+// HandleWebhookList returns every registered webhook
+func (h *Handler) HandleWebhookList(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET requests
+	if r.Method != http.MethodGet {
+		sendJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET requests are allowed for webhook queries")
+		return
+	}
+
+	sendJSONSuccess(w, map[string]interface{}{
+		"webhooks": h.Webhooks.List(),
+	}, "")
+}
+
+// HandleWebhookStatus returns a webhook with its delivery status and dead-lettered deliveries
+func (h *Handler) HandleWebhookStatus(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET requests
+	if r.Method != http.MethodGet {
+		sendJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET requests are allowed for webhook queries")
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	hook, ok := h.Webhooks.Get(id)
+	if !ok {
+		sendJSONError(w, http.StatusNotFound, "webhook_not_found", fmt.Sprintf("No webhook with ID '%s'", id))
+		return
+	}
+	status, err := h.Webhooks.Status(id)
+	if err != nil {
+		sendJSONError(w, http.StatusNotFound, "webhook_not_found", fmt.Sprintf("No webhook with ID '%s'", id))
+		return
+	}
+	deadLetters, _ := h.Webhooks.DeadLetters(id)
+
+	sendJSONSuccess(w, map[string]interface{}{
+		"webhook":      hook,
+		"status":       status,
+		"dead_letters": deadLetters,
+	}, "")
+}
+
+// HandleWebhookDelete removes a webhook and drops its pending deliveries
+func (h *Handler) HandleWebhookDelete(w http.ResponseWriter, r *http.Request) {
+	// Only allow DELETE requests
+	if r.Method != http.MethodDelete {
+		sendJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only DELETE requests are allowed for webhook removal")
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	if err := h.Webhooks.Delete(id); err != nil {
+		sendJSONError(w, http.StatusNotFound, "webhook_not_found", fmt.Sprintf("No webhook with ID '%s'", id))
+		return
+	}
+
+	logging.Infof("Removed webhook %s", id)
+
+	sendJSONSuccess(w, map[string]interface{}{
+		"id": id,
+	}, "Webhook removed successfully")
+}
+
+// HandleNamespaceList lists the namespaces served under /ns
+func (h *Handler) HandleNamespaceList(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET requests
+	if r.Method != http.MethodGet {
+		sendJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET requests are allowed for namespaces")
+		return
+	}
+
+	sendSuccess(w, r, map[string]interface{}{
+		"namespaces": h.Namespaces.Names(),
+	}, "Namespaces")
+}
+
+// HandleNamespaceCreate creates the namespace named in the URL if it does not exist
+func (h *Handler) HandleNamespaceCreate(w http.ResponseWriter, r *http.Request) {
+	// Only allow PUT requests
+	if r.Method != http.MethodPut {
+		sendJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only PUT requests are allowed for namespace creation")
+		return
+	}
+
+	name := chi.URLParam(r, "name")
+	_, created, err := h.Namespaces.Create(name)
+	if err != nil {
+		sendNamespaceError(w, name, err)
+		return
+	}
+
+	message := "Namespace already exists"
+	if created {
+		message = "Namespace created"
+	}
+	sendSuccess(w, r, map[string]interface{}{
+		"namespace": name,
+		"created":   created,
+	}, message)
+}
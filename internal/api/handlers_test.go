@@ -1,22 +1,34 @@
 package api_test
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/piske-alex/go-sse/internal/api"
+	"github.com/piske-alex/go-sse/internal/codec"
+	"github.com/piske-alex/go-sse/internal/config"
 	"github.com/piske-alex/go-sse/internal/sse"
 	"github.com/piske-alex/go-sse/internal/store"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 func TestHandleStoreInitialize(t *testing.T) {
 	// Create components
 	kvStore := store.NewStore()
 	sseServer := sse.NewServer(kvStore)
-	apiHandler := api.NewHandler(kvStore, sseServer)
+	apiHandler := api.NewHandler(kvStore, sseServer, api.DefaultHandlerOptions())
 
 	// Test data
 	testData := map[string]interface{}{
@@ -85,7 +97,7 @@ func TestHandleStoreUpdate(t *testing.T) {
 	// Create components
 	kvStore := store.NewStore()
 	sseServer := sse.NewServer(kvStore)
-	apiHandler := api.NewHandler(kvStore, sseServer)
+	apiHandler := api.NewHandler(kvStore, sseServer, api.DefaultHandlerOptions())
 
 	// Initialize the store
 	kvStore.Initialize(map[string]interface{}{
@@ -139,3 +151,1398 @@ func TestHandleStoreUpdate(t *testing.T) {
 		t.Errorf("Expected status to be updated to 'away', got %v", result)
 	}
 }
+
+func TestMongoStoreUpdateBroadcastsOnce(t *testing.T) {
+	mongouri := os.Getenv("MONGO_URI")
+	if mongouri == "" {
+		mongouri = "mongodb://localhost:27017"
+	}
+
+	// Skip unless MongoDB is reachable
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongouri))
+	if err != nil {
+		t.Skip("MongoDB not available, skipping test")
+	}
+	err = client.Ping(ctx, nil)
+	client.Disconnect(ctx)
+	if err != nil {
+		t.Skip("MongoDB not available, skipping test")
+	}
+
+	mongoStore, err := store.NewMongoStore(mongouri, "gosse_test", "store_test", "broadcast_"+time.Now().Format("20060102150405"))
+	if err != nil {
+		t.Fatalf("Failed to create MongoDB store: %v", err)
+	}
+	defer mongoStore.Disconnect()
+	mongoStore.Initialize(map[string]interface{}{"data": map[string]interface{}{"status": "online"}})
+
+	// The SSE server starts the change stream, which reports the writes made through the API too
+	apiHandler := api.NewHandler(mongoStore, sse.NewServer(mongoStore), api.DefaultHandlerOptions())
+	defer apiHandler.Webhooks.Close()
+	deadline := time.Now().Add(10 * time.Second)
+	for !mongoStore.ReportsWrites() {
+		if mongoStore.ChangeStreamStatus().State == store.ChangeStreamUnsupported {
+			t.Skip("MongoDB deployment does not support change streams, skipping test")
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Change stream did not start: %+v", mongoStore.ChangeStreamStatus())
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	server := httptest.NewServer(api.SetupRouter(apiHandler))
+	defer server.Close()
+
+	stream, err := http.Get(server.URL + "/events?filter=.data.status&initial_data=false")
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer stream.Body.Close()
+	lines := make(chan string, 100)
+	go func() {
+		events := bufio.NewReader(stream.Body)
+		for {
+			line, err := events.ReadString('\n')
+			if err != nil {
+				return
+			}
+			lines <- line
+		}
+	}()
+
+	req, _ := http.NewRequest("PATCH", server.URL+"/store?path=.data.status", strings.NewReader(`"away"`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to update: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	// Count the update events until the stream has been quiet for a while
+	updates := 0
+	for {
+		select {
+		case line := <-lines:
+			if strings.HasPrefix(line, "event: update") {
+				updates++
+			}
+			continue
+		case <-time.After(2 * time.Second):
+		}
+		break
+	}
+	if updates != 1 {
+		t.Errorf("Expected exactly one update event for one PATCH, got %d", updates)
+	}
+}
+
+func TestHandleStoreExportImport(t *testing.T) {
+	// Create source components
+	srcStore := store.NewStore()
+	srcStore.Initialize(map[string]interface{}{
+		"data": map[string]interface{}{
+			"positions": []interface{}{
+				map[string]interface{}{"id": "pos1", "trader": "abc"},
+			},
+			"config": map[string]interface{}{"maxUsers": float64(100)},
+		},
+	})
+	srcRouter := api.SetupRouter(api.NewHandler(srcStore, sse.NewServer(srcStore), api.DefaultHandlerOptions()))
+
+	// Export the source store
+	req := httptest.NewRequest("GET", "/store/export?format=ndjson&granularity=leaf", nil)
+	w := httptest.NewRecorder()
+	srcRouter.ServeHTTP(w, req)
+
+	resp := w.Result()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Expected Content-Type application/x-ndjson, got %s", ct)
+	}
+
+	// Import into an empty store
+	dstStore := store.NewStore()
+	dstRouter := api.SetupRouter(api.NewHandler(dstStore, sse.NewServer(dstStore), api.DefaultHandlerOptions()))
+
+	req = httptest.NewRequest("POST", "/store/import", bytes.NewReader(w.Body.Bytes()))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set("Accept", "application/msgpack")
+	w = httptest.NewRecorder()
+	dstRouter.ServeHTTP(w, req)
+
+	if w.Result().StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Result().StatusCode, w.Body.String())
+	}
+
+	// The import result is encoded as the client asked
+	if ct := w.Result().Header.Get("Content-Type"); ct != "application/msgpack" {
+		t.Errorf("Expected Content-Type application/msgpack, got %s", ct)
+	}
+	var imported api.SuccessResponse
+	if err := codec.MsgPack.Unmarshal(w.Body.Bytes(), &imported); err != nil {
+		t.Fatalf("Failed to decode MessagePack response: %v", err)
+	}
+	if data, ok := imported.Data.(map[string]interface{}); !ok || fmt.Sprint(data["lines"]) != "2" {
+		t.Errorf("Expected 2 imported lines, got %v", imported.Data)
+	}
+
+	// Verify the imported data
+	result, err := dstStore.Get(".data.config.maxUsers")
+	if err != nil {
+		t.Fatalf("Failed to get imported value: %v", err)
+	}
+	if result != float64(100) {
+		t.Errorf("Expected maxUsers to be 100, got %v", result)
+	}
+
+	positions, err := dstStore.Get(".data.positions")
+	if err != nil {
+		t.Fatalf("Failed to get imported positions: %v", err)
+	}
+	if list, ok := positions.([]interface{}); !ok || len(list) != 1 {
+		t.Errorf("Expected 1 imported position, got %v", positions)
+	}
+
+	// Unsupported formats are rejected
+	req = httptest.NewRequest("GET", "/store/export?format=csv", nil)
+	w = httptest.NewRecorder()
+	srcRouter.ServeHTTP(w, req)
+	if w.Result().StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Result().StatusCode)
+	}
+}
+
+func TestStoreContentNegotiation(t *testing.T) {
+	// Create components
+	kvStore := store.NewStore()
+	kvStore.Initialize(map[string]interface{}{
+		"data": map[string]interface{}{"positions": []interface{}{}},
+	})
+	router := api.SetupRouter(api.NewHandler(kvStore, sse.NewServer(kvStore), api.DefaultHandlerOptions()))
+
+	// Write a MessagePack encoded value
+	body, err := codec.MsgPack.Marshal([]interface{}{
+		map[string]interface{}{"id": "pos1", "trader": "abc"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal test data: %v", err)
+	}
+
+	req := httptest.NewRequest("PATCH", "/store?path=.data.positions", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/msgpack")
+	req.Header.Set("Accept", "application/msgpack")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	resp := w.Result()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, resp.StatusCode, w.Body.String())
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/msgpack" {
+		t.Errorf("Expected Content-Type application/msgpack, got %s", ct)
+	}
+
+	// Read it back as CBOR
+	req = httptest.NewRequest("GET", "/store?path=.data.positions", nil)
+	req.Header.Set("Accept", "application/cbor")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	resp = w.Result()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/cbor" {
+		t.Fatalf("Expected Content-Type application/cbor, got %s", ct)
+	}
+
+	var positions []interface{}
+	if err := codec.CBOR.Unmarshal(w.Body.Bytes(), &positions); err != nil {
+		t.Fatalf("Failed to decode CBOR response: %v", err)
+	}
+	if len(positions) != 1 {
+		t.Fatalf("Expected 1 position, got %d", len(positions))
+	}
+	if position, ok := positions[0].(map[string]interface{}); !ok || position["trader"] != "abc" {
+		t.Errorf("Expected trader abc, got %v", positions[0])
+	}
+
+	// Unknown body encodings are rejected
+	req = httptest.NewRequest("PATCH", "/store?path=.data.positions", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "text/plain")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Result().StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected status code %d, got %d", http.StatusUnsupportedMediaType, w.Result().StatusCode)
+	}
+}
+
+func TestStoreTimeTravel(t *testing.T) {
+	// Create components with history enabled
+	kvStore := store.NewStore()
+	kvStore.EnableHistory(store.HistoryConfig{MaxRevisions: 10})
+	kvStore.Initialize(map[string]interface{}{
+		"data": map[string]interface{}{"positions": []interface{}{}},
+	})
+	kvStore.Set(".data.positions", []interface{}{
+		map[string]interface{}{"id": "pos1", "trader": "abc"},
+	})
+	router := api.SetupRouter(api.NewHandler(kvStore, sse.NewServer(kvStore), api.DefaultHandlerOptions()))
+
+	// Query the value as it was at revision 1
+	req := httptest.NewRequest("GET", "/store?path=.data.positions&at=1", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Result().StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Result().StatusCode, w.Body.String())
+	}
+
+	var positions []interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &positions); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(positions) != 0 {
+		t.Errorf("Expected no positions at revision 1, got %v", positions)
+	}
+
+	// List the changes to the path
+	req = httptest.NewRequest("GET", "/store/history?path=.data.positions", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Result().StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Result().StatusCode, w.Body.String())
+	}
+
+	var resp struct {
+		Data struct {
+			Revisions []store.Revision `json:"revisions"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Data.Revisions) != 2 {
+		t.Fatalf("Expected 2 revisions, got %d", len(resp.Data.Revisions))
+	}
+	if rev := resp.Data.Revisions[1]; rev.Revision != 2 || rev.Op != store.OpSet {
+		t.Errorf("Unexpected revision %+v", rev)
+	}
+
+	// Invalid and unavailable points in time
+	for target, status := range map[string]int{
+		"/store?path=.data.positions&at=yesterday":            http.StatusBadRequest,
+		"/store?path=.data.positions&at=1&pattern=true":       http.StatusBadRequest,
+		"/store?path=.data.positions&at=2000-01-01T00:00:00Z": http.StatusNotFound,
+	} {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		if w.Result().StatusCode != status {
+			t.Errorf("%s: expected status code %d, got %d", target, status, w.Result().StatusCode)
+		}
+	}
+}
+
+func TestSchemaValidation(t *testing.T) {
+	// Create components
+	kvStore := store.NewStore()
+	kvStore.Initialize(map[string]interface{}{
+		"data": map[string]interface{}{"positions": []interface{}{}},
+	})
+	options := api.DefaultHandlerOptions()
+	options.AdminToken = "secret"
+	router := api.SetupRouter(api.NewHandler(kvStore, sse.NewServer(kvStore), options))
+
+	// Registering a schema requires the admin token
+	schema := `{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "array",
+		"items": {"type": "object", "required": ["id"]}
+	}`
+	req := httptest.NewRequest("PUT", "/schemas?path=.data.positions", bytes.NewBufferString(schema))
+	req.Header.Set("Content-Type", "application/schema+json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Result().StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected status code %d without the admin token, got %d", http.StatusUnauthorized, w.Result().StatusCode)
+	}
+
+	// Register a schema for positions
+	req = httptest.NewRequest("PUT", "/schemas?path=.data.positions", bytes.NewBufferString(schema))
+	req.Header.Set("Content-Type", "application/schema+json")
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Result().StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Result().StatusCode, w.Body.String())
+	}
+
+	// A write that breaks the schema is rejected with the offending locations
+	req = httptest.NewRequest("PATCH", "/store?path=.data.positions", bytes.NewBufferString(`[{"id": "pos1"}, {"trader": "abc"}]`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Result().StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusUnprocessableEntity, w.Result().StatusCode, w.Body.String())
+	}
+
+	var errResp api.ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &errResp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if errResp.Error != "schema_violation" || len(errResp.Errors) != 1 || errResp.Errors[0].Path != ".data.positions[1]" {
+		t.Errorf("Unexpected error response %+v", errResp)
+	}
+
+	// A conforming write still succeeds
+	req = httptest.NewRequest("PATCH", "/store?path=.data.positions", bytes.NewBufferString(`[{"id": "pos1"}]`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Result().StatusCode != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d: %s", http.StatusOK, w.Result().StatusCode, w.Body.String())
+	}
+
+	// Invalid schemas are refused
+	req = httptest.NewRequest("PUT", "/schemas?path=.data.config", bytes.NewBufferString(`{"type": 1}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Result().StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Result().StatusCode)
+	}
+}
+
+func TestStoreOperations(t *testing.T) {
+	// Create components
+	kvStore := store.NewStore()
+	kvStore.Initialize(map[string]interface{}{
+		"data": map[string]interface{}{"positions": []interface{}{}, "count": float64(1)},
+	})
+	router := api.SetupRouter(api.NewHandler(kvStore, sse.NewServer(kvStore), api.DefaultHandlerOptions()))
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/store/ops?path="+path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Append reports the element it added
+	w := post(".data.positions", `{"op": "append", "value": {"id": "pos1"}}`)
+	if w.Result().StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Result().StatusCode, w.Body.String())
+	}
+
+	var resp struct {
+		Data struct {
+			Changes []store.Change `json:"changes"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Data.Changes) != 1 || resp.Data.Changes[0].Path != ".data.positions[0]" {
+		t.Errorf("Unexpected changes %+v", resp.Data.Changes)
+	}
+
+	// Increment updates the stored number
+	if w := post(".data.count", `{"op": "increment", "value": 4}`); w.Result().StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Result().StatusCode, w.Body.String())
+	}
+	if count, _ := kvStore.Get(".data.count"); count != float64(5) {
+		t.Errorf("Expected count 5, got %v", count)
+	}
+
+	// Malformed and mismatched operations are rejected
+	tests := []struct {
+		name string
+		path string
+		body string
+		code int
+	}{
+		{"unknown operation", ".data.positions", `{"op": "shuffle"}`, http.StatusBadRequest},
+		{"unknown field", ".data.positions", `{"op": "append", "values": [1]}`, http.StatusBadRequest},
+		{"type mismatch", ".data.count", `{"op": "append", "value": 1}`, http.StatusBadRequest},
+		{"out of range", ".data.positions", `{"op": "insert", "index": 5, "value": 1}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if w := post(tt.path, tt.body); w.Result().StatusCode != tt.code {
+			t.Errorf("%s: expected status code %d, got %d: %s", tt.name, tt.code, w.Result().StatusCode, w.Body.String())
+		}
+	}
+
+	// Operations are validated against registered schemas
+	kvStore.Schemas().Register(".data.positions", []byte(`{"type": "array", "items": {"type": "object", "required": ["id"]}}`))
+	if w := post(".data.positions", `{"op": "append", "value": {"trader": "abc"}}`); w.Result().StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status code %d, got %d: %s", http.StatusUnprocessableEntity, w.Result().StatusCode, w.Body.String())
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	// Create components
+	kvStore := store.NewStore()
+	factory, _, err := store.NewNamespaceFactory(store.MemoryStore, store.MongoConfig{}, store.HistoryConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create namespace factory: %v", err)
+	}
+	options := api.DefaultNamespaceOptions()
+	options.Names = []string{"alpha"}
+	options.MaxNamespaces = 2
+	namespaces, err := api.NewNamespaces(factory, options)
+	if err != nil {
+		t.Fatalf("Failed to create namespaces: %v", err)
+	}
+	defer namespaces.Shutdown()
+
+	apiHandler := api.NewHandler(kvStore, sse.NewServer(kvStore), api.DefaultHandlerOptions())
+	apiHandler.Namespaces = namespaces
+	apiHandler.AdminToken = "secret"
+	router := api.SetupRouter(apiHandler)
+
+	token := "secret"
+	request := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Writes to a namespace only reach its own store
+	if w := request("POST", "/ns/alpha/store", `{"owner": "alpha"}`); w.Result().StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Result().StatusCode, w.Body.String())
+	}
+	alpha, err := namespaces.Get("alpha")
+	if err != nil {
+		t.Fatalf("Failed to get namespace: %v", err)
+	}
+	if owner, _ := alpha.Store.Get(".owner"); owner != "alpha" {
+		t.Errorf("Expected the namespace store to be written, got %v", owner)
+	}
+	if _, err := kvStore.Get(".owner"); err == nil {
+		t.Error("Expected the default store to be unchanged")
+	}
+
+	// Unknown namespaces are not created on demand unless enabled
+	if w := request("GET", "/ns/beta/store", ""); w.Result().StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d: %s", http.StatusNotFound, w.Result().StatusCode, w.Body.String())
+	}
+	if w := request("GET", "/ns/not.valid/store", ""); w.Result().StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d: %s", http.StatusBadRequest, w.Result().StatusCode, w.Body.String())
+	}
+
+	// Listing and creating namespaces require the admin token
+	token = ""
+	if w := request("PUT", "/ns/beta", ""); w.Result().StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d without the admin token, got %d", http.StatusUnauthorized, w.Result().StatusCode)
+	}
+	if w := request("GET", "/ns", ""); w.Result().StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d without the admin token, got %d", http.StatusUnauthorized, w.Result().StatusCode)
+	}
+	token = "secret"
+
+	// Namespaces can be created explicitly up to the limit
+	if w := request("PUT", "/ns/beta", ""); w.Result().StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Result().StatusCode, w.Body.String())
+	}
+	if w := request("GET", "/ns/beta/health", ""); w.Result().StatusCode != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d: %s", http.StatusOK, w.Result().StatusCode, w.Body.String())
+	}
+	if w := request("PUT", "/ns/gamma", ""); w.Result().StatusCode != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d: %s", http.StatusForbidden, w.Result().StatusCode, w.Body.String())
+	}
+
+	var list struct {
+		Data struct {
+			Namespaces []string `json:"namespaces"`
+		} `json:"data"`
+	}
+	w := request("GET", "/ns", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(list.Data.Namespaces) != 2 || list.Data.Namespaces[0] != "alpha" || list.Data.Namespaces[1] != "beta" {
+		t.Errorf("Unexpected namespaces %v", list.Data.Namespaces)
+	}
+
+	// Metrics are reported per namespace
+	var metrics struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	w = request("GET", "/ns/alpha/metrics", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &metrics); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if metrics.Data["namespace"] != "alpha" {
+		t.Errorf("Expected metrics for namespace alpha, got %v", metrics.Data)
+	}
+	if runtimeMetrics, ok := metrics.Data["runtime"].(map[string]interface{}); !ok || runtimeMetrics["goroutines"].(float64) <= 0 {
+		t.Errorf("Expected runtime metrics, got %v", metrics.Data["runtime"])
+	}
+}
+
+func TestViews(t *testing.T) {
+	// Create components
+	kvStore := store.NewStore()
+	kvStore.Initialize(map[string]interface{}{
+		"data": map[string]interface{}{
+			"positions": []interface{}{map[string]interface{}{"id": "p1", "offerId": "o1"}},
+			"offers":    []interface{}{map[string]interface{}{"id": "o1", "price": 10}},
+		},
+	})
+	options := api.DefaultHandlerOptions()
+	options.AdminToken = "secret"
+	router := api.SetupRouter(api.NewHandler(kvStore, sse.NewServer(kvStore), options))
+
+	token := "secret"
+	request := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	definition := `{
+		"from": ".data.positions[*]",
+		"select": {
+			"id": ".id",
+			"price": {"from": ".data.offers[*]", "on": {"id": ".offerId"}, "select": ".price"}
+		}
+	}`
+
+	// Registering and removing views require the admin token
+	token = ""
+	if w := request("PUT", "/views/priced", definition); w.Result().StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d without the admin token, got %d", http.StatusUnauthorized, w.Result().StatusCode)
+	}
+	if w := request("DELETE", "/views/priced", ""); w.Result().StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d without the admin token, got %d", http.StatusUnauthorized, w.Result().StatusCode)
+	}
+	token = "secret"
+
+	if w := request("PUT", "/views/priced", definition); w.Result().StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Result().StatusCode, w.Body.String())
+	}
+
+	// Writes through the API update the materialized view
+	if w := request("PATCH", "/store?path=.data.offers[0].price", `12`); w.Result().StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Result().StatusCode, w.Body.String())
+	}
+
+	var resp struct {
+		Data struct {
+			Value []map[string]interface{} `json:"value"`
+		} `json:"data"`
+	}
+	w := request("GET", "/views/priced", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Data.Value) != 1 || resp.Data.Value[0]["price"] != float64(12) {
+		t.Errorf("Expected the updated price in the view, got %v", resp.Data.Value)
+	}
+
+	// Invalid definitions and unknown views are rejected
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		code   int
+	}{
+		{"invalid definition", "PUT", "/views/broken", `{"from": "data"}`, http.StatusBadRequest},
+		{"unknown field", "PUT", "/views/broken", `{"from": ".data", "filter": {}}`, http.StatusBadRequest},
+		{"unknown view", "GET", "/views/missing", "", http.StatusNotFound},
+		{"unknown view subscription", "GET", "/events?view=missing", "", http.StatusNotFound},
+		{"view with filters", "GET", "/events?view=priced&filter=.data", "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if w := request(tt.method, tt.target, tt.body); w.Result().StatusCode != tt.code {
+			t.Errorf("%s: expected status code %d, got %d: %s", tt.name, tt.code, w.Result().StatusCode, w.Body.String())
+		}
+	}
+
+	if w := request("DELETE", "/views/priced", ""); w.Result().StatusCode != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d: %s", http.StatusOK, w.Result().StatusCode, w.Body.String())
+	}
+	if w := request("GET", "/views/priced", ""); w.Result().StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d: %s", http.StatusNotFound, w.Result().StatusCode, w.Body.String())
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	// A receiver for the deliveries
+	received := make(chan map[string]interface{}, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&event)
+		received <- event
+	}))
+	defer receiver.Close()
+
+	// Create components; the receiver listens on the loopback address
+	options := api.DefaultHandlerOptions()
+	options.Webhooks.AllowPrivateTargets = true
+	kvStore := store.NewStore()
+	apiHandler := api.NewHandler(kvStore, sse.NewServer(kvStore), options)
+	defer apiHandler.Webhooks.Close()
+	router := api.SetupRouter(apiHandler)
+
+	// Webhooks are disabled without an admin token
+	req := httptest.NewRequest("GET", "/webhooks", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Result().StatusCode != http.StatusForbidden {
+		t.Errorf("Expected status code %d without an admin token, got %d", http.StatusForbidden, w.Result().StatusCode)
+	}
+	apiHandler.AdminToken = "secret"
+
+	token := "secret"
+	request := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Requests without the token are refused
+	token = "wrong"
+	if w := request("POST", "/webhooks", `{"url": "`+receiver.URL+`", "secret": "s3cret"}`); w.Result().StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d with a wrong token, got %d", http.StatusUnauthorized, w.Result().StatusCode)
+	}
+	token = "secret"
+
+	w = request("POST", "/webhooks", `{"url": "`+receiver.URL+`", "filter": ".orders", "secret": "s3cret"}`)
+	if w.Result().StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Result().StatusCode, w.Body.String())
+	}
+	var created struct {
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || created.Data.ID == "" {
+		t.Fatalf("Failed to decode webhook: %v %s", err, w.Body.String())
+	}
+
+	// Store writes matching the filter are delivered
+	request("PATCH", "/store?path=.customers.c1", `{"name": "Ann"}`)
+	request("PATCH", "/store?path=.orders.o1", `{"status": "paid"}`)
+
+	select {
+	case event := <-received:
+		if event["path"] != ".orders.o1" || event["event"] != "update" {
+			t.Errorf("Unexpected delivery %v", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for the webhook delivery")
+	}
+
+	// The status endpoint reports the delivery
+	var status struct {
+		Data struct {
+			Status struct {
+				Delivered int `json:"delivered"`
+			} `json:"status"`
+		} `json:"data"`
+	}
+	deadline := time.Now().Add(time.Second)
+	for status.Data.Status.Delivered == 0 && time.Now().Before(deadline) {
+		json.Unmarshal(request("GET", "/webhooks/"+created.Data.ID, "").Body.Bytes(), &status)
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status.Data.Status.Delivered != 1 {
+		t.Errorf("Expected one delivery in the status, got %+v", status.Data.Status)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		code   int
+	}{
+		{"missing secret", "POST", "/webhooks", `{"url": "` + receiver.URL + `"}`, http.StatusBadRequest},
+		{"invalid url", "POST", "/webhooks", `{"url": "not a url", "secret": "s"}`, http.StatusBadRequest},
+		{"unknown webhook", "GET", "/webhooks/missing", "", http.StatusNotFound},
+		{"delete", "DELETE", "/webhooks/" + created.Data.ID, "", http.StatusOK},
+		{"deleted webhook", "GET", "/webhooks/" + created.Data.ID, "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if w := request(tt.method, tt.target, tt.body); w.Result().StatusCode != tt.code {
+			t.Errorf("%s: expected status code %d, got %d: %s", tt.name, tt.code, w.Result().StatusCode, w.Body.String())
+		}
+	}
+}
+
+func TestEventsOutliveServerTimeouts(t *testing.T) {
+	kvStore := store.NewStore()
+	kvStore.Initialize(map[string]interface{}{"status": "online"})
+	apiHandler := api.NewHandler(kvStore, sse.NewServer(kvStore), api.DefaultHandlerOptions())
+	defer apiHandler.Webhooks.Close()
+
+	// The server's timeouts bound ordinary requests but not SSE connections
+	server := httptest.NewUnstartedServer(api.SetupRouter(apiHandler))
+	server.Config.ReadTimeout = 200 * time.Millisecond
+	server.Config.WriteTimeout = 200 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	stream, err := http.Get(server.URL + "/events?filter=.status&initial_data=false")
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer stream.Body.Close()
+	lines := make(chan string, 100)
+	go func() {
+		events := bufio.NewReader(stream.Body)
+		for {
+			line, err := events.ReadString('\n')
+			if err != nil {
+				close(lines)
+				return
+			}
+			lines <- line
+		}
+	}()
+
+	time.Sleep(500 * time.Millisecond)
+	req, _ := http.NewRequest("PATCH", server.URL+"/store?path=.status", strings.NewReader(`"away"`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to update: %v", err)
+	}
+	resp.Body.Close()
+
+	deadline := time.After(2 * time.Second)
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatal("The stream ended at the server's timeouts")
+			}
+			if strings.HasPrefix(line, "event: update") {
+				return
+			}
+		case <-deadline:
+			t.Fatal("Timed out waiting for the update event")
+		}
+	}
+}
+
+func TestDrain(t *testing.T) {
+	// Create components
+	kvStore := store.NewStore()
+	sseServer := sse.NewServer(kvStore)
+	apiHandler := api.NewHandler(kvStore, sseServer, api.DefaultHandlerOptions())
+	defer apiHandler.Webhooks.Close()
+	server := httptest.NewServer(api.SetupRouter(apiHandler))
+	defer server.Close()
+
+	// Connect clients and wait for their connected events
+	var streams []*bufio.Reader
+	for i := 0; i < 4; i++ {
+		resp, err := http.Get(server.URL + "/events?initial_data=false")
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		defer resp.Body.Close()
+		stream := bufio.NewReader(resp.Body)
+		if line, _ := stream.ReadString('\n'); line != "event: connected\n" {
+			t.Fatalf("Expected the connected event, got %q", line)
+		}
+		streams = append(streams, stream)
+	}
+
+	options := sse.DrainOptions{
+		Window:      200 * time.Millisecond,
+		Waves:       2,
+		RetryDelay:  time.Second,
+		RetryJitter: time.Second,
+	}
+	done := make(chan struct{})
+	start := time.Now()
+	go func() {
+		sseServer.Drain(context.Background(), options)
+		close(done)
+	}()
+
+	// Every client gets a shutdown event with a jittered retry hint, then the stream ends
+	for _, stream := range streams {
+		var retry, event string
+		for {
+			line, err := stream.ReadString('\n')
+			if err != nil {
+				break
+			}
+			if strings.HasPrefix(line, "retry: ") {
+				retry = strings.TrimSpace(strings.TrimPrefix(line, "retry: "))
+			}
+			if strings.HasPrefix(line, "event: ") {
+				event = strings.TrimSpace(strings.TrimPrefix(line, "event: "))
+			}
+		}
+		if event != "shutdown" {
+			t.Errorf("Expected the last event to be shutdown, got %q", event)
+		}
+		if len(retry) != 4 || retry < "1000" || retry >= "2000" {
+			t.Errorf("Expected a retry between 1000 and 2000 ms, got %q", retry)
+		}
+	}
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for the drain")
+	}
+	if elapsed := time.Since(start); elapsed < options.Window/2 {
+		t.Errorf("Expected the connections to close in waves, drain took %v", elapsed)
+	}
+	if count := sseServer.ClientCount(); count != 0 {
+		t.Errorf("Expected no clients after the drain, got %d", count)
+	}
+
+	// New clients and health checks are turned away while draining
+	for _, target := range []string{"/events", "/health"} {
+		resp, err := http.Get(server.URL + target)
+		if err != nil {
+			t.Fatalf("Failed to request %s: %v", target, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("%s: expected status code %d, got %d", target, http.StatusServiceUnavailable, resp.StatusCode)
+		}
+		if resp.Header.Get("Retry-After") != "2" {
+			t.Errorf("%s: expected Retry-After 2, got %q", target, resp.Header.Get("Retry-After"))
+		}
+	}
+}
+
+// unreachableStore is a store whose backend cannot be reached
+type unreachableStore struct {
+	*store.KVStore
+}
+
+func (s unreachableStore) Ping(ctx context.Context) error {
+	return errors.New("connection refused")
+}
+
+func TestProbes(t *testing.T) {
+	readyz := func(h *api.Handler) (int, api.ReadinessReport) {
+		w := httptest.NewRecorder()
+		api.SetupRouter(h).ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+		var report api.ReadinessReport
+		if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+			t.Fatalf("Failed to decode readiness report: %v %s", err, w.Body.String())
+		}
+		return w.Result().StatusCode, report
+	}
+
+	// A healthy server is alive and ready
+	kvStore := store.NewStore()
+	sseServer := sse.NewServer(kvStore)
+	apiHandler := api.NewHandler(kvStore, sseServer, api.DefaultHandlerOptions())
+	defer apiHandler.Webhooks.Close()
+
+	w := httptest.NewRecorder()
+	api.SetupRouter(apiHandler).ServeHTTP(w, httptest.NewRequest("GET", "/livez", nil))
+	if w.Result().StatusCode != http.StatusOK {
+		t.Errorf("Expected status code %d from /livez, got %d", http.StatusOK, w.Result().StatusCode)
+	}
+
+	code, report := readyz(apiHandler)
+	if code != http.StatusOK || report.Status != "ready" {
+		t.Errorf("Expected a ready server, got %d %+v", code, report)
+	}
+	if report.Checks["store"].Status != api.CheckOK || report.Checks["capacity"].Status != api.CheckOK {
+		t.Errorf("Expected the store and capacity checks to pass, got %+v", report.Checks)
+	}
+
+	// A server without free client slots is not ready
+	sseServer.SetMaxClients(1)
+	r := httptest.NewRequest("GET", "/events", nil)
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	if _, err := sseServer.AddClient(httptest.NewRecorder(), r.WithContext(ctx), nil, false); err != nil {
+		t.Fatalf("Failed to add client: %v", err)
+	}
+	code, report = readyz(apiHandler)
+	if code != http.StatusServiceUnavailable || report.Checks["capacity"].Status != api.CheckFail {
+		t.Errorf("Expected the capacity check to fail, got %d %+v", code, report.Checks["capacity"])
+	}
+
+	// An unreachable store makes the server unready but not dead
+	unreachable := unreachableStore{store.NewStore()}
+	brokenHandler := api.NewHandler(unreachable, sse.NewServer(unreachable), api.DefaultHandlerOptions())
+	defer brokenHandler.Webhooks.Close()
+
+	code, report = readyz(brokenHandler)
+	if code != http.StatusServiceUnavailable || report.Status != "not_ready" {
+		t.Errorf("Expected an unready server, got %d %+v", code, report)
+	}
+	if check := report.Checks["store"]; check.Status != api.CheckFail || check.Message != "connection refused" {
+		t.Errorf("Expected the store check to fail, got %+v", check)
+	}
+
+	w = httptest.NewRecorder()
+	api.SetupRouter(brokenHandler).ServeHTTP(w, httptest.NewRequest("GET", "/livez", nil))
+	if w.Result().StatusCode != http.StatusOK {
+		t.Errorf("Expected status code %d from /livez, got %d", http.StatusOK, w.Result().StatusCode)
+	}
+}
+
+func TestAdminClients(t *testing.T) {
+	// Create components
+	kvStore := store.NewStore()
+	apiHandler := api.NewHandler(kvStore, sse.NewServer(kvStore), api.DefaultHandlerOptions())
+	defer apiHandler.Webhooks.Close()
+	server := httptest.NewServer(api.SetupRouter(apiHandler))
+	defer server.Close()
+
+	admin := func(method, target, token string) (*http.Response, []byte) {
+		req, _ := http.NewRequest(method, server.URL+target, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to request %s: %v", target, err)
+		}
+		defer resp.Body.Close()
+		var body bytes.Buffer
+		body.ReadFrom(resp.Body)
+		return resp, body.Bytes()
+	}
+
+	// The admin API is disabled without a token
+	if resp, _ := admin("GET", "/admin/clients", "secret"); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, resp.StatusCode)
+	}
+	apiHandler.AdminToken = "secret"
+	if resp, _ := admin("GET", "/admin/clients", "wrong"); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, resp.StatusCode)
+	}
+
+	// Connect a client
+	req, _ := http.NewRequest("GET", server.URL+"/events?filter=.orders&initial_data=false", nil)
+	req.Header.Set("User-Agent", "dashboard/1.0")
+	stream, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer stream.Body.Close()
+	events := bufio.NewReader(stream.Body)
+	events.ReadString('\n')
+
+	// The client is listed with its connection details
+	resp, body := admin("GET", "/admin/clients", "secret")
+	var list struct {
+		Data struct {
+			Clients []sse.ClientInfo `json:"clients"`
+			Count   int              `json:"count"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil || resp.StatusCode != http.StatusOK || list.Data.Count != 1 {
+		t.Fatalf("Expected one client, got %d %s", resp.StatusCode, body)
+	}
+	client := list.Data.Clients[0]
+	if client.RemoteIP != "127.0.0.1" || client.UserAgent != "dashboard/1.0" || len(client.Filters) != 1 || client.Filters[0] != ".orders" {
+		t.Errorf("Unexpected client details %+v", client)
+	}
+	if client.QueueCapacity == 0 || client.ConnectedAt.IsZero() {
+		t.Errorf("Expected queue and connection stats, got %+v", client)
+	}
+
+	if resp, _ := admin("GET", "/admin/clients/"+client.ID, "secret"); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	// Disconnecting sends the reason and ends the stream
+	if resp, body := admin("DELETE", "/admin/clients/"+client.ID+"?reason=maintenance", "secret"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, resp.StatusCode, body)
+	}
+	var last string
+	for {
+		line, err := events.ReadString('\n')
+		if err != nil {
+			break
+		}
+		if strings.HasPrefix(line, "data: ") {
+			last = line
+		}
+	}
+	if !strings.Contains(last, `"reason":"maintenance"`) {
+		t.Errorf("Expected a disconnect event with the reason, got %q", last)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for apiHandler.SSEServer.ClientCount() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if resp, _ := admin("GET", "/admin/clients/"+client.ID, "secret"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, resp.StatusCode)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	options := api.DefaultHandlerOptions()
+	options.Limits = api.LimitOptions{TrustProxy: true, WriteRate: 1, WriteBurst: 2}
+
+	// Create components
+	kvStore := store.NewStore()
+	sseServer := sse.NewServer(kvStore)
+	sseServer.SetLimits(sse.Limits{MaxClients: 2, MaxClientsPerKey: 1})
+	apiHandler := api.NewHandler(kvStore, sseServer, options)
+	defer apiHandler.Webhooks.Close()
+	server := httptest.NewServer(api.SetupRouter(apiHandler))
+	// Registered first so it runs after the streams below are closed
+	t.Cleanup(server.Close)
+
+	connect := func(ip string) *http.Response {
+		req, _ := http.NewRequest("GET", server.URL+"/events?initial_data=false", nil)
+		req.Header.Set("X-Forwarded-For", ip+", 10.0.0.1")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	// One connection per IP
+	if resp := connect("192.0.2.1"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	resp := connect("192.0.2.1")
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("Expected status code %d with Retry-After, got %d %q", http.StatusTooManyRequests, resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+	if resp := connect("192.0.2.2"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	// The server is full
+	resp = connect("192.0.2.3")
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("Expected status code %d with Retry-After, got %d %q", http.StatusServiceUnavailable, resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+
+	// Writes are limited to a burst of two per client
+	write := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PATCH", "/store?path=.count", bytes.NewBufferString("1"))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", ip)
+		w := httptest.NewRecorder()
+		api.SetupRouter(apiHandler).ServeHTTP(w, req)
+		return w
+	}
+	for i := 0; i < 2; i++ {
+		if w := write("192.0.2.1"); w.Result().StatusCode != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Result().StatusCode, w.Body.String())
+		}
+	}
+	w := write("192.0.2.1")
+	if w.Result().StatusCode != http.StatusTooManyRequests || w.Result().Header.Get("Retry-After") != "1" {
+		t.Errorf("Expected status code %d with Retry-After 1, got %d %q", http.StatusTooManyRequests, w.Result().StatusCode, w.Result().Header.Get("Retry-After"))
+	}
+	if w := write("192.0.2.2"); w.Result().StatusCode != http.StatusOK {
+		t.Errorf("Expected another client to be allowed, got %d", w.Result().StatusCode)
+	}
+
+	// The refusals are counted in the metrics
+	w = httptest.NewRecorder()
+	api.SetupRouter(apiHandler).ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	var metrics struct {
+		Data struct {
+			Limits struct {
+				Connections sse.LimitStats   `json:"connections"`
+				RateLimited map[string]int64 `json:"rate_limited"`
+			} `json:"limits"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &metrics); err != nil {
+		t.Fatalf("Failed to decode metrics: %v", err)
+	}
+	limits := metrics.Data.Limits
+	if limits.Connections.RejectedPerKey != 1 || limits.Connections.RejectedFull != 1 || limits.RateLimited["writes"] != 1 {
+		t.Errorf("Unexpected limit metrics %+v", limits)
+	}
+}
+
+func TestLimitsIgnoreUntrustedHeaders(t *testing.T) {
+	// Create components
+	kvStore := store.NewStore()
+	apiHandler := api.NewHandler(kvStore, sse.NewServer(kvStore), api.DefaultHandlerOptions())
+	defer apiHandler.Webhooks.Close()
+	apiHandler.SetLimits(api.LimitOptions{PrincipalHeader: "X-User", WriteRate: 1, WriteBurst: 1})
+	router := api.SetupRouter(apiHandler)
+
+	// Without a trusted proxy, spoofed headers do not give a client a fresh bucket
+	write := func(i int) int {
+		req := httptest.NewRequest("PATCH", "/store?path=.count", bytes.NewBufferString("1"))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("198.51.100.%d", i))
+		req.Header.Set("X-Real-IP", fmt.Sprintf("198.51.100.%d", i))
+		req.Header.Set("X-User", fmt.Sprintf("user-%d", i))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Result().StatusCode
+	}
+	if code := write(1); code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, code)
+	}
+	if code := write(2); code != http.StatusTooManyRequests {
+		t.Errorf("Expected status code %d for a spoofed client, got %d", http.StatusTooManyRequests, code)
+	}
+
+	// Behind a trusted proxy the principal identifies the client
+	apiHandler.SetLimits(api.LimitOptions{TrustProxy: true, PrincipalHeader: "X-User", WriteRate: 1, WriteBurst: 1})
+	if code := write(3); code != http.StatusOK {
+		t.Errorf("Expected status code %d for a new principal, got %d", http.StatusOK, code)
+	}
+}
+
+func TestAdminConfig(t *testing.T) {
+	// Create components
+	kvStore := store.NewStore()
+	apiHandler := api.NewHandler(kvStore, sse.NewServer(kvStore), api.DefaultHandlerOptions())
+	defer apiHandler.Webhooks.Close()
+	apiHandler.AdminToken = "secret"
+	router := api.SetupRouter(apiHandler)
+
+	getConfig := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/admin/config", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Nothing to show without a configuration
+	if w := getConfig(); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	cfg := config.Default()
+	cfg.Admin.Token = "secret"
+	cfg.Store.Mongo.URI = "mongodb://user:pass@db:27017"
+	cfg.SSE.MaxClients = 250
+	apiHandler.Config = func() config.Config { return cfg }
+
+	// The effective configuration is shown with its secrets redacted
+	w := getConfig()
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	var response struct {
+		Data config.Config `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode the configuration: %v", err)
+	}
+	if response.Data.SSE.MaxClients != 250 || time.Duration(response.Data.SSE.Keepalive) != 30*time.Second {
+		t.Errorf("Unexpected configuration %+v", response.Data.SSE)
+	}
+	if strings.Contains(w.Body.String(), "pass@db") || response.Data.Admin.Token != config.Redacted {
+		t.Errorf("Expected secrets to be redacted, got %s", w.Body.String())
+	}
+}
+
+func TestSetLimits(t *testing.T) {
+	// Create components
+	kvStore := store.NewStore()
+	apiHandler := api.NewHandler(kvStore, sse.NewServer(kvStore), api.DefaultHandlerOptions())
+	defer apiHandler.Webhooks.Close()
+	router := api.SetupRouter(apiHandler)
+
+	update := func() int {
+		req := httptest.NewRequest("PATCH", "/store", strings.NewReader(`{"path":".count","value":1}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Writes are not limited by default
+	for i := 0; i < 3; i++ {
+		if code := update(); code == http.StatusTooManyRequests {
+			t.Fatalf("Expected no rate limit, got status code %d", code)
+		}
+	}
+
+	// New limits apply to the next request
+	apiHandler.SetLimits(api.LimitOptions{WriteRate: 0.001, WriteBurst: 1})
+	if code := update(); code == http.StatusTooManyRequests {
+		t.Fatalf("Expected the first write to pass, got status code %d", code)
+	}
+	if code := update(); code != http.StatusTooManyRequests {
+		t.Errorf("Expected status code %d, got %d", http.StatusTooManyRequests, code)
+	}
+
+	// Unchanged limits keep their buckets
+	apiHandler.SetLimits(api.LimitOptions{WriteRate: 0.001, WriteBurst: 1, QueryRate: 5})
+	if code := update(); code != http.StatusTooManyRequests {
+		t.Errorf("Expected status code %d, got %d", http.StatusTooManyRequests, code)
+	}
+	if limits := apiHandler.LimitOptions(); limits.QueryRate != 5 {
+		t.Errorf("Expected the new limits, got %+v", limits)
+	}
+}
+
+func TestCORS(t *testing.T) {
+	// Create components
+	kvStore := store.NewStore()
+	apiHandler := api.NewHandler(kvStore, sse.NewServer(kvStore), api.DefaultHandlerOptions())
+	defer apiHandler.Webhooks.Close()
+	router := api.SetupRouter(apiHandler)
+
+	request := func(method, target, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if method == "OPTIONS" {
+			req.Header.Set("Access-Control-Request-Method", "DELETE")
+			req.Header.Set("Access-Control-Request-Headers", "Authorization, X-Trace")
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// By default any origin may call the API, without credentials
+	w := request("GET", "/health", "https://app.example.com")
+	if w.Header().Get("Access-Control-Allow-Origin") != "*" || w.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("Expected the wildcard origin without credentials, got %v", w.Header())
+	}
+	if w.Header().Get("Access-Control-Expose-Headers") != "ETag, Retry-After" {
+		t.Errorf("Expected ETag and Retry-After to be exposed, got %q", w.Header().Get("Access-Control-Expose-Headers"))
+	}
+	w = request("OPTIONS", "/schemas", "https://app.example.com")
+	if w.Code != http.StatusNoContent || !strings.Contains(w.Header().Get("Access-Control-Allow-Methods"), "DELETE") {
+		t.Errorf("Expected a preflight allowing DELETE, got %d %v", w.Code, w.Header())
+	}
+	if w.Header().Get("Access-Control-Max-Age") != "600" {
+		t.Errorf("Expected a max age of 600, got %q", w.Header().Get("Access-Control-Max-Age"))
+	}
+
+	// Listed origins and origins matching the pattern are echoed, with credentials
+	err := apiHandler.SetCORS(api.CORSOptions{
+		AllowedOrigins:       []string{"https://app.example.com"},
+		AllowedOriginPattern: `^https://[a-z0-9]+\.preview\.example\.com$`,
+		AllowedMethods:       []string{"GET", "DELETE"},
+		AllowedHeaders:       []string{"*"},
+		AllowCredentials:     true,
+		MaxAge:               time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("Failed to set the CORS policy: %v", err)
+	}
+	for _, origin := range []string{"https://app.example.com", "https://pr42.preview.example.com"} {
+		w = request("GET", "/health", origin)
+		if w.Header().Get("Access-Control-Allow-Origin") != origin || w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+			t.Errorf("Expected %s to be echoed with credentials, got %v", origin, w.Header())
+		}
+		if !strings.Contains(strings.Join(w.Header().Values("Vary"), ","), "Origin") {
+			t.Errorf("Expected Vary: Origin, got %v", w.Header().Values("Vary"))
+		}
+	}
+	w = request("OPTIONS", "/store", "https://app.example.com")
+	if w.Header().Get("Access-Control-Allow-Headers") != "Authorization, X-Trace" {
+		t.Errorf("Expected the requested headers to be allowed, got %q", w.Header().Get("Access-Control-Allow-Headers"))
+	}
+
+	// Other origins get no CORS headers
+	for _, method := range []string{"GET", "OPTIONS"} {
+		w = request(method, "/health", "https://evil.example.net")
+		if w.Header().Get("Access-Control-Allow-Origin") != "" || w.Header().Get("Access-Control-Allow-Credentials") != "" {
+			t.Errorf("Expected no CORS headers for %s, got %v", method, w.Header())
+		}
+	}
+
+	// An invalid pattern keeps the current policy
+	if err := apiHandler.SetCORS(api.CORSOptions{AllowedOriginPattern: "("}); err == nil {
+		t.Error("Expected an error for an invalid pattern")
+	}
+	if !apiHandler.CORSOptions().AllowCredentials {
+		t.Error("Expected the previous policy to stay in place")
+	}
+
+	// The event stream uses the same policy
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	req, _ := http.NewRequest("GET", server.URL+"/events?initial_data=false", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.Header.Get("Access-Control-Allow-Origin") != "https://app.example.com" {
+		t.Errorf("Expected the stream to echo the origin, got %q", resp.Header.Get("Access-Control-Allow-Origin"))
+	}
+}
+
+func TestCompression(t *testing.T) {
+	kvStore := store.NewStore()
+	kvStore.Initialize(map[string]interface{}{"status": "online"})
+	apiHandler := api.NewHandler(kvStore, sse.NewServer(kvStore), api.DefaultHandlerOptions())
+	defer apiHandler.Webhooks.Close()
+	server := httptest.NewServer(api.SetupRouter(apiHandler))
+	defer server.Close()
+
+	get := func(target string) *http.Response {
+		req, _ := http.NewRequest("GET", server.URL+target, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to request %s: %v", target, err)
+		}
+		return resp
+	}
+
+	// JSON responses are compressed once
+	resp := get("/store?path=.status")
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected a gzip response, got %q", resp.Header.Get("Content-Encoding"))
+	}
+	reader, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read the gzip response: %v", err)
+	}
+	var status string
+	if err := json.NewDecoder(reader).Decode(&status); err != nil || status != "online" {
+		t.Errorf("Expected the value after one decompression, got %q: %v", status, err)
+	}
+
+	// The event stream is not buffered by a compressor
+	stream := get("/events?filter=.status")
+	defer stream.Body.Close()
+	if encoding := stream.Header.Get("Content-Encoding"); encoding != "" {
+		t.Errorf("Expected an uncompressed event stream, got %q", encoding)
+	}
+	line, err := bufio.NewReader(stream.Body).ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "event: ") {
+		t.Errorf("Expected an event, got %q: %v", line, err)
+	}
+}
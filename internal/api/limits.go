@@ -0,0 +1,174 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/piske-alex/go-sse/internal/ratelimit"
+)
+
+// connectionRetryAfter is the Retry-After sent to SSE clients refused by a connection limit
+const connectionRetryAfter = 5 * time.Second
+
+// LimitOptions configures how clients are identified and how fast they may use the store
+type LimitOptions struct {
+	TrustProxy      bool    // Take the client IP from X-Forwarded-For or X-Real-IP, and honour PrincipalHeader
+	PrincipalHeader string  // Header naming the authenticated principal, set by a trusted proxy
+	WriteRate       float64 // Store writes per second per client, 0 for no limit
+	WriteBurst      int     // Store writes allowed at once
+	QueryRate       float64 // Store queries per second per client, 0 for no limit
+	QueryBurst      int     // Store queries allowed at once
+}
+
+// LimitOptionsFromEnv reads the client identification and rate limits from the environment
+func LimitOptionsFromEnv() LimitOptions {
+	options := LimitOptions{
+		PrincipalHeader: os.Getenv("LIMIT_PRINCIPAL_HEADER"),
+	}
+
+	if value := os.Getenv("TRUST_PROXY_HEADERS"); value == "true" || value == "1" {
+		options.TrustProxy = true
+	}
+
+	if value := os.Getenv("RATE_LIMIT_WRITES"); value != "" {
+		if rate, err := strconv.ParseFloat(value, 64); err == nil && rate >= 0 {
+			options.WriteRate = rate
+		}
+	}
+
+	if value := os.Getenv("RATE_LIMIT_WRITE_BURST"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			options.WriteBurst = n
+		}
+	}
+
+	if value := os.Getenv("RATE_LIMIT_QUERIES"); value != "" {
+		if rate, err := strconv.ParseFloat(value, 64); err == nil && rate >= 0 {
+			options.QueryRate = rate
+		}
+	}
+
+	if value := os.Getenv("RATE_LIMIT_QUERY_BURST"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			options.QueryBurst = n
+		}
+	}
+
+	return options
+}
+
+// limitState holds the limit options of a handler with their token buckets,
+// which are nil for rates that are not limited
+type limitState struct {
+	options LimitOptions
+	writes  *ratelimit.Limiter
+	queries *ratelimit.Limiter
+}
+
+// SetLimits replaces the client identification and rate limits. Token buckets are kept
+// for rates that did not change, and start full for those that did.
+func (h *Handler) SetLimits(options LimitOptions) {
+	state := &limitState{options: options}
+	previous := h.limits.Load()
+
+	if options.WriteRate > 0 {
+		if previous != nil && previous.writes != nil && previous.options.WriteRate == options.WriteRate && previous.options.WriteBurst == options.WriteBurst {
+			state.writes = previous.writes
+		} else {
+			state.writes = ratelimit.New(options.WriteRate, options.WriteBurst)
+		}
+	}
+	if options.QueryRate > 0 {
+		if previous != nil && previous.queries != nil && previous.options.QueryRate == options.QueryRate && previous.options.QueryBurst == options.QueryBurst {
+			state.queries = previous.queries
+		} else {
+			state.queries = ratelimit.New(options.QueryRate, options.QueryBurst)
+		}
+	}
+
+	h.limits.Store(state)
+}
+
+// LimitOptions returns the client identification and rate limits
+func (h *Handler) LimitOptions() LimitOptions {
+	return h.limits.Load().options
+}
+
+// clientIP returns the IP of the client, taken from proxy headers only when they are trusted
+func (h *Handler) clientIP(r *http.Request) string {
+	if h.LimitOptions().TrustProxy {
+		// The first address is the original client
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			if ip := strings.TrimSpace(first); ip != "" {
+				return ip
+			}
+		}
+		if ip := r.Header.Get("X-Real-IP"); ip != "" {
+			return ip
+		}
+	}
+
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// limitKey identifies who a request counts against: its principal when a trusted proxy
+// names it, otherwise its IP
+func (h *Handler) limitKey(r *http.Request) string {
+	if options := h.LimitOptions(); options.TrustProxy && options.PrincipalHeader != "" {
+		if principal := r.Header.Get(options.PrincipalHeader); principal != "" {
+			return "principal:" + principal
+		}
+	}
+	return "ip:" + h.clientIP(r)
+}
+
+// limitWrites rate limits store writes
+func (h *Handler) limitWrites(next http.Handler) http.Handler {
+	return h.rateLimit(next, func(state *limitState) *ratelimit.Limiter { return state.writes })
+}
+
+// limitQueries rate limits store queries
+func (h *Handler) limitQueries(next http.Handler) http.Handler {
+	return h.rateLimit(next, func(state *limitState) *ratelimit.Limiter { return state.queries })
+}
+
+// rateLimit refuses requests with 429 once the client's bucket in the selected limiter is empty
+func (h *Handler) rateLimit(next http.Handler, limiter func(*limitState) *ratelimit.Limiter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if l := limiter(h.limits.Load()); l != nil {
+			if ok, wait := l.Allow(h.limitKey(r)); !ok {
+				sendRetryAfter(w, wait)
+				sendJSONError(w, http.StatusTooManyRequests, "rate_limited", "Too many requests, retry after the time in Retry-After")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limitMetrics reports the client limits and how many requests they refused
+func (h *Handler) limitMetrics() map[string]interface{} {
+	state := h.limits.Load()
+	rateLimited := map[string]int64{"writes": 0, "queries": 0}
+	if state.writes != nil {
+		rateLimited["writes"] = state.writes.Rejected()
+	}
+	if state.queries != nil {
+		rateLimited["queries"] = state.queries.Rejected()
+	}
+
+	return map[string]interface{}{
+		"connections":  h.SSEServer.LimitStats(),
+		"write_rate":   state.options.WriteRate,
+		"query_rate":   state.options.QueryRate,
+		"rate_limited": rateLimited,
+	}
+}
@@ -0,0 +1,316 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/piske-alex/go-sse/internal/logging"
+	"github.com/piske-alex/go-sse/internal/sse"
+	"github.com/piske-alex/go-sse/internal/store"
+)
+
+var (
+	// ErrNamespaceNotFound is returned for namespaces that do not exist and are not created on demand
+	ErrNamespaceNotFound = errors.New("namespace not found")
+
+	// ErrNamespaceLimit is returned when creating a namespace would exceed the configured maximum
+	ErrNamespaceLimit = errors.New("namespace limit reached")
+)
+
+// NamespaceOptions configures the namespaces served under /ns/{name}
+type NamespaceOptions struct {
+	Names         []string // Namespaces created at startup
+	AutoCreate    bool     // Create namespaces on their first request
+	MaxNamespaces int      // Maximum number of namespaces, 0 for no limit
+	MaxClients    int      // Maximum SSE clients per namespace, 0 for the server default
+
+	SSE     sse.Options    // Options of the SSE server of every namespace
+	Limits  sse.Limits     // Client limits of every namespace, with MaxClients applied on top
+	Handler HandlerOptions // Options of the handler of every namespace
+
+	// Configure is called with the handler of every namespace when it is created
+	Configure func(*Handler)
+}
+
+// DefaultNamespaceOptions returns the options used when nothing is configured: no
+// namespaces until they are created through the API, at most 100
+func DefaultNamespaceOptions() NamespaceOptions {
+	return NamespaceOptions{
+		MaxNamespaces: 100,
+		SSE:           sse.DefaultOptions(),
+		Limits:        sse.DefaultLimits(),
+		Handler:       DefaultHandlerOptions(),
+	}
+}
+
+// NamespaceOptionsFromEnv reads the namespace options from the environment
+func NamespaceOptionsFromEnv() NamespaceOptions {
+	options := DefaultNamespaceOptions()
+	options.SSE = sse.OptionsFromEnv()
+	options.Limits = sse.LimitsFromEnv()
+	options.Handler = HandlerOptionsFromEnv()
+
+	for _, name := range strings.Split(os.Getenv("NAMESPACES"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			options.Names = append(options.Names, name)
+		}
+	}
+
+	if value := os.Getenv("NAMESPACE_AUTO_CREATE"); value == "true" || value == "1" {
+		options.AutoCreate = true
+	}
+
+	if value := os.Getenv("NAMESPACE_MAX"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			options.MaxNamespaces = n
+		}
+	}
+
+	if value := os.Getenv("NAMESPACE_MAX_CLIENTS"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			options.MaxClients = n
+		}
+	}
+
+	return options
+}
+
+// namespace is a store with its own SSE server and routes
+type namespace struct {
+	handler *Handler
+	router  http.Handler
+}
+
+// Namespaces manages named stores, each served with the full store API under /ns/{name}
+type Namespaces struct {
+	factory    store.NamespaceFactory
+	options    NamespaceOptions
+	namespaces map[string]*namespace
+	mutex      sync.RWMutex
+}
+
+// NewNamespaces creates the namespace registry and the namespaces listed in options
+func NewNamespaces(factory store.NamespaceFactory, options NamespaceOptions) (*Namespaces, error) {
+	n := &Namespaces{
+		factory:    factory,
+		options:    options,
+		namespaces: make(map[string]*namespace),
+	}
+
+	for _, name := range options.Names {
+		if _, _, err := n.Create(name); err != nil {
+			n.Shutdown()
+			return nil, err
+		}
+	}
+
+	return n, nil
+}
+
+// Get returns the handler of a namespace, creating the namespace if auto-creation is enabled
+func (n *Namespaces) Get(name string) (*Handler, error) {
+	ns, err := n.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return ns.handler, nil
+}
+
+// lookup returns a namespace, creating it if auto-creation is enabled
+func (n *Namespaces) lookup(name string) (*namespace, error) {
+	n.mutex.RLock()
+	ns, ok := n.namespaces[name]
+	n.mutex.RUnlock()
+	if ok {
+		return ns, nil
+	}
+
+	if err := store.ValidateNamespace(name); err != nil {
+		return nil, err
+	}
+	if !n.options.AutoCreate {
+		return nil, ErrNamespaceNotFound
+	}
+
+	ns, _, err := n.create(name)
+	return ns, err
+}
+
+// Create creates a namespace and returns its handler. It reports whether the namespace
+// was created, and returns the existing handler if the namespace already exists.
+func (n *Namespaces) Create(name string) (*Handler, bool, error) {
+	ns, created, err := n.create(name)
+	if err != nil {
+		return nil, false, err
+	}
+	return ns.handler, created, nil
+}
+
+// create creates a namespace with its own store, SSE server and routes
+func (n *Namespaces) create(name string) (*namespace, bool, error) {
+	if err := store.ValidateNamespace(name); err != nil {
+		return nil, false, err
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if ns, ok := n.namespaces[name]; ok {
+		return ns, false, nil
+	}
+	if n.options.MaxNamespaces > 0 && len(n.namespaces) >= n.options.MaxNamespaces {
+		return nil, false, ErrNamespaceLimit
+	}
+
+	dataStore, err := n.factory(name)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Each namespace has its own clients and client limit
+	sseServer := sse.NewServer(dataStore)
+	sseServer.SetOptions(n.options.SSE)
+	sseServer.SetLimits(n.clientLimits())
+
+	handler := NewHandler(dataStore, sseServer, n.options.Handler)
+	handler.Namespace = name
+	if n.options.Configure != nil {
+		n.options.Configure(handler)
+	}
+
+	router := chi.NewRouter()
+	registerStoreRoutes(router, handler)
+	registerErrorRoutes(router)
+
+	ns := &namespace{handler: handler, router: router}
+	n.namespaces[name] = ns
+	logging.Infof("Created namespace %s", name)
+	return ns, true, nil
+}
+
+// clientLimits returns the SSE client limits of a namespace. The caller holds the mutex.
+func (n *Namespaces) clientLimits() sse.Limits {
+	limits := n.options.Limits
+	if n.options.MaxClients > 0 {
+		limits.MaxClients = n.options.MaxClients
+	}
+	return limits
+}
+
+// Reload applies the SSE options, client limits and rate limits of options to every
+// namespace and to those created later. The other options only apply at startup.
+func (n *Namespaces) Reload(options NamespaceOptions) {
+	n.mutex.Lock()
+	n.options.SSE = options.SSE
+	n.options.Limits = options.Limits
+	n.options.Handler.Limits = options.Handler.Limits
+	limits := n.clientLimits()
+	n.mutex.Unlock()
+
+	n.Each(func(_ string, handler *Handler) {
+		handler.SSEServer.SetOptions(options.SSE)
+		handler.SSEServer.SetLimits(limits)
+		handler.SetLimits(options.Handler.Limits)
+	})
+}
+
+// Names returns the names of all namespaces in sorted order
+func (n *Namespaces) Names() []string {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	names := make([]string, 0, len(n.namespaces))
+	for name := range n.namespaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Each calls fn with the handler of every namespace, in name order
+func (n *Namespaces) Each(fn func(name string, handler *Handler)) {
+	n.mutex.RLock()
+	handlers := make(map[string]*Handler, len(n.namespaces))
+	for name, ns := range n.namespaces {
+		handlers[name] = ns.handler
+	}
+	n.mutex.RUnlock()
+
+	names := make([]string, 0, len(handlers))
+	for name := range handlers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fn(name, handlers[name])
+	}
+}
+
+// Drain drains the SSE clients of every namespace at the same time
+func (n *Namespaces) Drain(ctx context.Context, options sse.DrainOptions) {
+	n.mutex.RLock()
+	servers := make([]*sse.Server, 0, len(n.namespaces))
+	for _, ns := range n.namespaces {
+		servers = append(servers, ns.handler.SSEServer)
+	}
+	n.mutex.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, server := range servers {
+		wg.Add(1)
+		go func(server *sse.Server) {
+			defer wg.Done()
+			server.Drain(ctx, options)
+		}(server)
+	}
+	wg.Wait()
+}
+
+// Shutdown shuts down the webhooks, SSE server and store of every namespace
+func (n *Namespaces) Shutdown() {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	for name, ns := range n.namespaces {
+		ns.handler.Webhooks.Close()
+		ns.handler.SSEServer.Shutdown()
+		delete(n.namespaces, name)
+	}
+}
+
+// ServeHTTP routes a request under /ns/{name}/ to the namespace's own routes
+func (n *Namespaces) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	ns, err := n.lookup(name)
+	if err != nil {
+		sendNamespaceError(w, name, err)
+		return
+	}
+
+	// Route the rest of the path inside the namespace, as chi does for mounted routers
+	rctx := chi.RouteContext(r.Context())
+	rctx.RoutePath = "/" + chi.URLParam(r, "*")
+	ns.router.ServeHTTP(w, r)
+}
+
+// sendNamespaceError sends the error response for a namespace that cannot be used
+func sendNamespaceError(w http.ResponseWriter, name string, err error) {
+	switch {
+	case errors.Is(err, store.ErrInvalidNamespace):
+		sendJSONError(w, http.StatusBadRequest, "invalid_namespace", err.Error())
+	case errors.Is(err, ErrNamespaceNotFound):
+		sendJSONError(w, http.StatusNotFound, "namespace_not_found", "Namespace "+name+" does not exist")
+	case errors.Is(err, ErrNamespaceLimit):
+		sendJSONError(w, http.StatusForbidden, "namespace_limit_reached", err.Error())
+	default:
+		logging.Errorf("Error creating namespace %s: %v", name, err)
+		sendJSONError(w, http.StatusInternalServerError, "namespace_error", err.Error())
+	}
+}
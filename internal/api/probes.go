@@ -0,0 +1,171 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/piske-alex/go-sse/internal/store"
+)
+
+// Readiness check results
+const (
+	CheckOK   = "ok"   // The check passed
+	CheckWarn = "warn" // The check found a problem that does not stop the server from serving
+	CheckFail = "fail" // The server should not receive traffic
+)
+
+// ProbeOptions configures the readiness checks
+type ProbeOptions struct {
+	PingTimeout       time.Duration // Time allowed for the store ping
+	MinClientHeadroom int           // Percentage of client slots that must be free
+}
+
+// DefaultProbeOptions returns the readiness options used when nothing is configured
+func DefaultProbeOptions() ProbeOptions {
+	return ProbeOptions{
+		PingTimeout:       2 * time.Second,
+		MinClientHeadroom: 5,
+	}
+}
+
+// ProbeOptionsFromEnv reads the readiness options from the environment
+func ProbeOptionsFromEnv() ProbeOptions {
+	options := DefaultProbeOptions()
+
+	if value := os.Getenv("READYZ_PING_TIMEOUT"); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			options.PingTimeout = d
+		}
+	}
+
+	if value := os.Getenv("READYZ_MIN_CLIENT_HEADROOM"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 && n <= 100 {
+			options.MinClientHeadroom = n
+		}
+	}
+
+	return options
+}
+
+// CheckResult is the outcome of one readiness check
+type CheckResult struct {
+	Status  string      `json:"status"`
+	Message string      `json:"message,omitempty"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// ReadinessReport is the response of /readyz
+type ReadinessReport struct {
+	Status string                 `json:"status"` // ready or not_ready
+	Checks map[string]CheckResult `json:"checks"`
+	Time   int64                  `json:"time"`
+}
+
+// HandleLivez reports that the process is running. It checks no dependencies, so an
+// unreachable database makes the pod unready rather than restarting it.
+func (h *Handler) HandleLivez(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET requests
+	if r.Method != http.MethodGet {
+		sendJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET requests are allowed for liveness checks")
+		return
+	}
+
+	sendJSONSuccess(w, map[string]interface{}{
+		"status": "ok",
+		"time":   time.Now().Unix(),
+	}, "Service is alive")
+}
+
+// HandleReadyz checks the store, the change stream and the client capacity, and returns
+// 503 when any check fails so load balancers stop sending traffic to this instance
+func (h *Handler) HandleReadyz(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET requests
+	if r.Method != http.MethodGet {
+		sendJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET requests are allowed for readiness checks")
+		return
+	}
+
+	report := ReadinessReport{
+		Status: "ready",
+		Checks: map[string]CheckResult{
+			"store":    h.checkStore(r.Context()),
+			"capacity": h.checkCapacity(),
+		},
+		Time: time.Now().Unix(),
+	}
+	if mongoStore, ok := h.Store.(*store.MongoStore); ok {
+		report.Checks["change_stream"] = checkChangeStream(mongoStore.ChangeStreamStatus())
+	}
+	if h.SSEServer.Draining() {
+		report.Checks["shutdown"] = CheckResult{Status: CheckFail, Message: "Server is shutting down"}
+	}
+
+	statusCode := http.StatusOK
+	for _, check := range report.Checks {
+		if check.Status == CheckFail {
+			report.Status = "not_ready"
+			statusCode = http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(report)
+}
+
+// checkStore pings the store backend
+func (h *Handler) checkStore(ctx context.Context) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, h.Probes.PingTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := h.Store.Ping(ctx)
+	details := map[string]interface{}{"latency_ms": time.Since(start).Milliseconds()}
+	if err != nil {
+		return CheckResult{Status: CheckFail, Message: err.Error(), Details: details}
+	}
+	return CheckResult{Status: CheckOK, Details: details}
+}
+
+// checkCapacity fails when fewer than MinClientHeadroom percent of the client slots are free
+func (h *Handler) checkCapacity() CheckResult {
+	clients := h.SSEServer.ClientCount()
+	maxClients := h.SSEServer.MaxClients()
+	details := map[string]interface{}{
+		"clients":     clients,
+		"max_clients": maxClients,
+	}
+
+	if maxClients <= 0 {
+		return CheckResult{Status: CheckFail, Message: "No client slots configured", Details: details}
+	}
+
+	headroom := (maxClients - clients) * 100 / maxClients
+	details["headroom_percent"] = headroom
+	if headroom < h.Probes.MinClientHeadroom {
+		return CheckResult{
+			Status:  CheckFail,
+			Message: "Only " + strconv.Itoa(headroom) + "% of client slots are free",
+			Details: details,
+		}
+	}
+	return CheckResult{Status: CheckOK, Details: details}
+}
+
+// checkChangeStream fails while the change stream is not delivering events. A deployment
+// without change streams only warns, as every instance would be equally affected.
+func checkChangeStream(status store.ChangeStreamStatus) CheckResult {
+	switch status.State {
+	case store.ChangeStreamRunning:
+		return CheckResult{Status: CheckOK, Details: status}
+	case store.ChangeStreamUnsupported:
+		return CheckResult{Status: CheckWarn, Message: "Change streams are not supported, direct MongoDB writes are not broadcast", Details: status}
+	default:
+		return CheckResult{Status: CheckFail, Message: "Change stream is " + status.State, Details: status}
+	}
+}
@@ -6,54 +6,112 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/piske-alex/go-sse/internal/logging"
 )
 
+// requestTimeout cancels the context of requests that take longer than 2 minutes, e.g. large
+// uploads. SSE connections are exempt.
+var requestTimeout = middleware.Timeout(120 * time.Second)
+
+// requestLogger logs each request at the info level
+func requestLogger(next http.Handler) http.Handler {
+	logged := middleware.Logger(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if logging.Enabled(logging.Info) {
+			logged.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 // SetupRouter configures the HTTP router
 func SetupRouter(handler *Handler) http.Handler {
 	r := chi.NewRouter()
 
 	// Standard middleware
-	r.Use(middleware.Logger)
+	r.Use(requestLogger)
 	r.Use(middleware.Recoverer)
-	r.Use(middleware.RealIP)
 	r.Use(middleware.RequestID)
 
-	// Performance middleware
-	r.Use(middleware.Compress(5)) // Compress responses with level 5 compression
-	r.Use(middleware.Timeout(120 * time.Second)) // 2 minute timeout for large requests
-
-	// CORS middleware
-	r.Use(func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PATCH, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
-			w.Header().Set("Access-Control-Allow-Credentials", "true")
-
-			if r.Method == "OPTIONS" {
-				w.WriteHeader(http.StatusOK)
-				return
-			}
-
-			next.ServeHTTP(w, r)
-		})
-	})
+	// CORS policy for every route, including /events
+	r.Use(handler.handleCORS)
 
-	// Enable gzip/deflate for large responses
+	// Enable gzip/deflate for JSON responses only, so the event stream is never buffered
 	r.Use(middleware.Compress(5, "application/json"))
 
-	// Routes for client connections
+	// Routes for the default store
+	registerStoreRoutes(r, handler)
+
+	// Routes for namespaces, each serving the routes above for its own store. Listing and
+	// creating namespaces require the admin token.
+	if handler.Namespaces != nil {
+		admin := r.With(requestTimeout, handler.requireAdmin)
+		admin.Get("/ns", handler.HandleNamespaceList)
+		admin.Put("/ns/{name}", handler.HandleNamespaceCreate)
+		r.HandleFunc("/ns/{name}/*", handler.Namespaces.ServeHTTP)
+	}
+
+	registerErrorRoutes(r)
+
+	return r
+}
+
+// registerStoreRoutes adds the routes that serve a single store
+func registerStoreRoutes(r chi.Router, handler *Handler) {
+	// Routes for client connections, which stay open as long as the client does
 	r.Get("/events", handler.HandleEvents)
 
-	// Routes for store management
-	r.Post("/store", handler.HandleStoreInitialize)
-	r.Patch("/store", handler.HandleStoreUpdate)
-	r.Get("/store", handler.HandleStoreQuery)
+	// Every other route gets a deadline
+	r = r.With(requestTimeout)
+
+	// Routes for store management, rate limited per client
+	writes := r.With(handler.limitWrites)
+	queries := r.With(handler.limitQueries)
+	writes.Post("/store", handler.HandleStoreInitialize)
+	writes.Patch("/store", handler.HandleStoreUpdate)
+	writes.Delete("/store", handler.HandleStoreDelete)
+	queries.Get("/store", handler.HandleStoreQuery)
+	writes.Post("/store/ops", handler.HandleStoreOperation)
+	queries.Get("/store/history", handler.HandleStoreHistory)
+	queries.Get("/store/export", handler.HandleStoreExport)
+	writes.Post("/store/import", handler.HandleStoreImport)
+
+	// Routes protected by the admin token
+	admin := r.With(handler.requireAdmin)
+
+	// Routes for schema registration; only reading schemas is public
+	admin.Put("/schemas", handler.HandleSchemaRegister)
+	r.Get("/schemas", handler.HandleSchemaQuery)
+	admin.Delete("/schemas", handler.HandleSchemaDelete)
+
+	// Routes for views computed from the store; only reading views is public
+	r.Get("/views", handler.HandleViewList)
+	admin.Put("/views/{name}", handler.HandleViewRegister)
+	r.Get("/views/{name}", handler.HandleViewQuery)
+	admin.Delete("/views/{name}", handler.HandleViewDelete)
+
+	// Routes for webhook subscriptions, which make the server send requests
+	admin.Post("/webhooks", handler.HandleWebhookCreate)
+	admin.Get("/webhooks", handler.HandleWebhookList)
+	admin.Get("/webhooks/{id}", handler.HandleWebhookStatus)
+	admin.Delete("/webhooks/{id}", handler.HandleWebhookDelete)
+
+	// Routes for managing connected clients
+	admin.Get("/admin/clients", handler.HandleAdminClientList)
+	admin.Get("/admin/clients/{id}", handler.HandleAdminClientGet)
+	admin.Delete("/admin/clients/{id}", handler.HandleAdminClientDisconnect)
+	admin.Get("/admin/config", handler.HandleAdminConfig)
 
 	// Server information routes
 	r.Get("/metrics", handler.HandleMetrics)
 	r.Get("/health", handler.HandleHealth) // Use our new health handler
+	r.Get("/livez", handler.HandleLivez)
+	r.Get("/readyz", handler.HandleReadyz)
+}
 
+// registerErrorRoutes adds the JSON responses for unknown routes and methods
+func registerErrorRoutes(r chi.Router) {
 	// Catch-all route for 404s
 	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
 		sendJSONError(w, http.StatusNotFound, "not_found", "Resource not found")
@@ -63,6 +121,4 @@ func SetupRouter(handler *Handler) http.Handler {
 	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
 		sendJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
 	})
-
-	return r
 }
@@ -0,0 +1,194 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec encodes and decodes values for a single media type
+type Codec interface {
+	// Name returns the short name used in query parameters (e.g. "msgpack")
+	Name() string
+
+	// ContentType returns the media type sent in Content-Type headers
+	ContentType() string
+
+	// Binary reports whether the encoded form is not valid UTF-8 text
+	Binary() bool
+
+	// Marshal encodes a value
+	Marshal(v interface{}) ([]byte, error)
+
+	// Unmarshal decodes data into v
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	// JSON encodes values as application/json
+	JSON Codec = jsonCodec{}
+	// MsgPack encodes values as application/msgpack
+	MsgPack Codec = msgpackCodec{}
+	// CBOR encodes values as application/cbor
+	CBOR Codec = newCBORCodec()
+)
+
+// codecs lists all supported codecs in order of preference
+var codecs = []Codec{JSON, MsgPack, CBOR}
+
+// contentTypeAliases maps alternative media types to their canonical form
+var contentTypeAliases = map[string]string{
+	"application/x-msgpack":   "application/msgpack",
+	"application/vnd.msgpack": "application/msgpack",
+}
+
+// ByName returns the codec with the given short name
+func ByName(name string) (Codec, bool) {
+	for _, c := range codecs {
+		if c.Name() == strings.ToLower(name) {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// ForContentType returns the codec for a Content-Type header value
+func ForContentType(contentType string) (Codec, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+
+	return forMediaType(mediaType)
+}
+
+// Negotiate picks the codec that best matches an Accept header.
+// It falls back to JSON when nothing supported is acceptable.
+func Negotiate(accept string) Codec {
+	best := JSON
+	bestQuality := -1.0
+
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(q, 64); err == nil {
+				quality = parsed
+			}
+		}
+		if quality <= 0 || quality <= bestQuality {
+			continue
+		}
+
+		// Wildcards keep the default encoding
+		if mediaType == "*/*" || mediaType == "application/*" {
+			best, bestQuality = JSON, quality
+			continue
+		}
+
+		if c, ok := forMediaType(mediaType); ok {
+			best, bestQuality = c, quality
+		}
+	}
+
+	return best
+}
+
+// forMediaType looks up a codec by a parsed media type
+func forMediaType(mediaType string) (Codec, bool) {
+	mediaType = strings.ToLower(mediaType)
+	if alias, ok := contentTypeAliases[mediaType]; ok {
+		mediaType = alias
+	}
+
+	for _, c := range codecs {
+		if c.ContentType() == mediaType {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// jsonCodec implements Codec using encoding/json
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string        { return "json" }
+func (jsonCodec) ContentType() string { return "application/json" }
+func (jsonCodec) Binary() bool        { return false }
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// msgpackCodec implements Codec using MessagePack
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string        { return "msgpack" }
+func (msgpackCodec) ContentType() string { return "application/msgpack" }
+func (msgpackCodec) Binary() bool        { return true }
+
+// Struct fields are named by their json tags, like in the JSON and CBOR encodings
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+// cborCodec implements Codec using CBOR
+type cborCodec struct {
+	enc cbor.EncMode
+	dec cbor.DecMode
+}
+
+// newCBORCodec creates a CBOR codec that decodes maps the same way encoding/json does
+func newCBORCodec() cborCodec {
+	enc, err := cbor.EncOptions{Time: cbor.TimeRFC3339Nano}.EncMode()
+	if err != nil {
+		panic(err)
+	}
+
+	dec, err := cbor.DecOptions{
+		DefaultMapType: reflect.TypeOf(map[string]interface{}(nil)),
+	}.DecMode()
+	if err != nil {
+		panic(err)
+	}
+
+	return cborCodec{enc: enc, dec: dec}
+}
+
+func (cborCodec) Name() string        { return "cbor" }
+func (cborCodec) ContentType() string { return "application/cbor" }
+func (cborCodec) Binary() bool        { return true }
+
+func (c cborCodec) Marshal(v interface{}) ([]byte, error) {
+	return c.enc.Marshal(v)
+}
+
+func (c cborCodec) Unmarshal(data []byte, v interface{}) error {
+	return c.dec.Unmarshal(data, v)
+}
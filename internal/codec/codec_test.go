@@ -0,0 +1,106 @@
+package codec_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/piske-alex/go-sse/internal/codec"
+)
+
+func TestCodec_RoundTrip(t *testing.T) {
+	value := map[string]interface{}{
+		"positions": []interface{}{
+			map[string]interface{}{"id": "pos1", "amount": 100.5},
+		},
+		"active": true,
+	}
+
+	for _, c := range []codec.Codec{codec.JSON, codec.MsgPack, codec.CBOR} {
+		t.Run(c.Name(), func(t *testing.T) {
+			data, err := c.Marshal(value)
+			if err != nil {
+				t.Fatalf("Failed to marshal: %v", err)
+			}
+
+			var decoded map[string]interface{}
+			if err := c.Unmarshal(data, &decoded); err != nil {
+				t.Fatalf("Failed to unmarshal: %v", err)
+			}
+
+			positions, ok := decoded["positions"].([]interface{})
+			if !ok || len(positions) != 1 {
+				t.Fatalf("Expected 1 position, got %v", decoded["positions"])
+			}
+
+			// Nested maps must decode with string keys for the query package
+			position, ok := positions[0].(map[string]interface{})
+			if !ok {
+				t.Fatalf("Expected map[string]interface{}, got %T", positions[0])
+			}
+			if fmt.Sprint(position["amount"]) != "100.5" {
+				t.Errorf("Expected amount 100.5, got %v", position["amount"])
+			}
+		})
+	}
+}
+
+func TestCodec_StructTags(t *testing.T) {
+	type envelope struct {
+		Status string      `json:"status"`
+		Data   interface{} `json:"data,omitempty"`
+	}
+
+	for _, c := range []codec.Codec{codec.JSON, codec.MsgPack, codec.CBOR} {
+		t.Run(c.Name(), func(t *testing.T) {
+			data, err := c.Marshal(envelope{Status: "success"})
+			if err != nil {
+				t.Fatalf("Failed to marshal: %v", err)
+			}
+
+			// Fields are named as in the JSON encoding
+			var decoded map[string]interface{}
+			if err := c.Unmarshal(data, &decoded); err != nil {
+				t.Fatalf("Failed to unmarshal: %v", err)
+			}
+			if len(decoded) != 1 || decoded["status"] != "success" {
+				t.Errorf("Expected only the status field, got %v", decoded)
+			}
+		})
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name     string
+		accept   string
+		expected codec.Codec
+	}{
+		{name: "empty", accept: "", expected: codec.JSON},
+		{name: "wildcard", accept: "*/*", expected: codec.JSON},
+		{name: "msgpack", accept: "application/msgpack", expected: codec.MsgPack},
+		{name: "msgpack alias", accept: "application/x-msgpack", expected: codec.MsgPack},
+		{name: "cbor", accept: "application/cbor", expected: codec.CBOR},
+		{name: "quality", accept: "application/json;q=0.5, application/cbor", expected: codec.CBOR},
+		{name: "unsupported", accept: "text/html", expected: codec.JSON},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := codec.Negotiate(tt.accept); got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected.Name(), got.Name())
+			}
+		})
+	}
+}
+
+func TestForContentType(t *testing.T) {
+	if c, ok := codec.ForContentType("application/json; charset=utf-8"); !ok || c != codec.JSON {
+		t.Errorf("Expected JSON codec for application/json")
+	}
+	if c, ok := codec.ForContentType("application/cbor"); !ok || c != codec.CBOR {
+		t.Errorf("Expected CBOR codec for application/cbor")
+	}
+	if _, ok := codec.ForContentType("text/plain"); ok {
+		t.Errorf("Expected text/plain to be unsupported")
+	}
+}
@@ -0,0 +1,477 @@
+// Package config loads the server configuration from a YAML or TOML file and the environment.
+//
+// Every setting has an environment variable, named by the env tag of its field. A variable
+// set when the server starts overrides the file, including when the file is reloaded.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/piske-alex/go-sse/internal/logging"
+	"gopkg.in/yaml.v3"
+)
+
+// Redacted replaces the value of secret settings in Config.Redacted
+const Redacted = "[redacted]"
+
+// Config is the server configuration
+type Config struct {
+	Server     ServerConfig     `yaml:"server" toml:"server" json:"server"`
+	Store      StoreConfig      `yaml:"store" toml:"store" json:"store"`
+	SSE        SSEConfig        `yaml:"sse" toml:"sse" json:"sse"`
+	Limits     LimitsConfig     `yaml:"limits" toml:"limits" json:"limits"`
+	CORS       CORSConfig       `yaml:"cors" toml:"cors" json:"cors"`
+	Drain      DrainConfig      `yaml:"drain" toml:"drain" json:"drain"`
+	Readyz     ReadyzConfig     `yaml:"readyz" toml:"readyz" json:"readyz"`
+	History    HistoryConfig    `yaml:"history" toml:"history" json:"history"`
+	Namespaces NamespacesConfig `yaml:"namespaces" toml:"namespaces" json:"namespaces"`
+	Webhooks   WebhooksConfig   `yaml:"webhooks" toml:"webhooks" json:"webhooks"`
+	TLS        TLSConfig        `yaml:"tls" toml:"tls" json:"tls"`
+	Admin      AdminConfig      `yaml:"admin" toml:"admin" json:"admin"`
+}
+
+// ServerConfig holds the HTTP server settings
+type ServerConfig struct {
+	Port             int      `yaml:"port" toml:"port" json:"port" env:"PORT"`
+	MaxRequestSizeMB int      `yaml:"max_request_size_mb" toml:"max_request_size_mb" json:"max_request_size_mb" env:"MAX_REQUEST_SIZE_MB"`
+	ShutdownTimeout  Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" json:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	LogLevel         string   `yaml:"log_level" toml:"log_level" json:"log_level" env:"LOG_LEVEL" reload:"true"`
+}
+
+// StoreConfig selects and connects the store
+type StoreConfig struct {
+	Type  string      `yaml:"type" toml:"type" json:"type" env:"STORE_TYPE"`
+	Mongo MongoConfig `yaml:"mongo" toml:"mongo" json:"mongo"`
+}
+
+// MongoConfig holds the MongoDB connection and document location
+type MongoConfig struct {
+	URI               string `yaml:"uri" toml:"uri" json:"uri" env:"MONGO_URI" secret:"true"`
+	Host              string `yaml:"host" toml:"host" json:"host" env:"MONGO_HOST"`
+	Port              string `yaml:"port" toml:"port" json:"port" env:"MONGO_PORT"`
+	User              string `yaml:"user" toml:"user" json:"user" env:"MONGO_USER"`
+	Password          string `yaml:"password" toml:"password" json:"password" env:"MONGO_PASSWORD" secret:"true"`
+	AuthDB            string `yaml:"auth_db" toml:"auth_db" json:"auth_db" env:"MONGO_AUTH_DB"`
+	Database          string `yaml:"database" toml:"database" json:"database" env:"MONGO_DB_NAME"`
+	Collection        string `yaml:"collection" toml:"collection" json:"collection" env:"MONGO_COLLECTION"`
+	DocumentID        string `yaml:"document_id" toml:"document_id" json:"document_id" env:"MONGO_DOCUMENT_ID"`
+	UseCollectionRoot bool   `yaml:"use_collection_root" toml:"use_collection_root" json:"use_collection_root" env:"MONGO_USE_COLLECTION_ROOT"`
+}
+
+// SSEConfig holds the SSE client limits and timings
+type SSEConfig struct {
+	MaxClients        int      `yaml:"max_clients" toml:"max_clients" json:"max_clients" env:"SSE_MAX_CLIENTS" reload:"true"`
+	MaxClientsPerIP   int      `yaml:"max_clients_per_ip" toml:"max_clients_per_ip" json:"max_clients_per_ip" env:"SSE_MAX_CLIENTS_PER_IP" reload:"true"`
+	Keepalive         Duration `yaml:"keepalive" toml:"keepalive" json:"keepalive" env:"SSE_KEEPALIVE" reload:"true"`
+	BufferSize        int      `yaml:"buffer_size" toml:"buffer_size" json:"buffer_size" env:"SSE_BUFFER_SIZE" reload:"true"`
+	CleanupInterval   Duration `yaml:"cleanup_interval" toml:"cleanup_interval" json:"cleanup_interval" env:"SSE_CLEANUP_INTERVAL" reload:"true"`
+	InactivityTimeout Duration `yaml:"inactivity_timeout" toml:"inactivity_timeout" json:"inactivity_timeout" env:"SSE_INACTIVITY_TIMEOUT" reload:"true"`
+}
+
+// LimitsConfig holds the client identification and store rate limits
+type LimitsConfig struct {
+	TrustProxyHeaders bool    `yaml:"trust_proxy_headers" toml:"trust_proxy_headers" json:"trust_proxy_headers" env:"TRUST_PROXY_HEADERS" reload:"true"`
+	PrincipalHeader   string  `yaml:"principal_header" toml:"principal_header" json:"principal_header" env:"LIMIT_PRINCIPAL_HEADER" reload:"true"`
+	WriteRate         float64 `yaml:"write_rate" toml:"write_rate" json:"write_rate" env:"RATE_LIMIT_WRITES" reload:"true"`
+	WriteBurst        int     `yaml:"write_burst" toml:"write_burst" json:"write_burst" env:"RATE_LIMIT_WRITE_BURST" reload:"true"`
+	QueryRate         float64 `yaml:"query_rate" toml:"query_rate" json:"query_rate" env:"RATE_LIMIT_QUERIES" reload:"true"`
+	QueryBurst        int     `yaml:"query_burst" toml:"query_burst" json:"query_burst" env:"RATE_LIMIT_QUERY_BURST" reload:"true"`
+}
+
+// CORSConfig holds the origins allowed to call the API from a browser
+type CORSConfig struct {
+	AllowedOrigins       []string `yaml:"allowed_origins" toml:"allowed_origins" json:"allowed_origins" env:"CORS_ALLOWED_ORIGINS" reload:"true"`
+	AllowedOriginPattern string   `yaml:"allowed_origin_pattern" toml:"allowed_origin_pattern" json:"allowed_origin_pattern" env:"CORS_ALLOWED_ORIGIN_PATTERN" reload:"true"`
+	AllowedMethods       []string `yaml:"allowed_methods" toml:"allowed_methods" json:"allowed_methods" env:"CORS_ALLOWED_METHODS" reload:"true"`
+	AllowedHeaders       []string `yaml:"allowed_headers" toml:"allowed_headers" json:"allowed_headers" env:"CORS_ALLOWED_HEADERS" reload:"true"`
+	ExposedHeaders       []string `yaml:"exposed_headers" toml:"exposed_headers" json:"exposed_headers" env:"CORS_EXPOSED_HEADERS" reload:"true"`
+	AllowCredentials     bool     `yaml:"allow_credentials" toml:"allow_credentials" json:"allow_credentials" env:"CORS_ALLOW_CREDENTIALS" reload:"true"`
+	MaxAge               Duration `yaml:"max_age" toml:"max_age" json:"max_age" env:"CORS_MAX_AGE" reload:"true"`
+}
+
+// DrainConfig holds how clients are moved off a stopping server
+type DrainConfig struct {
+	Window      Duration `yaml:"window" toml:"window" json:"window" env:"DRAIN_WINDOW" reload:"true"`
+	Waves       int      `yaml:"waves" toml:"waves" json:"waves" env:"DRAIN_WAVES" reload:"true"`
+	RetryDelay  Duration `yaml:"retry_delay" toml:"retry_delay" json:"retry_delay" env:"DRAIN_RETRY_DELAY" reload:"true"`
+	RetryJitter Duration `yaml:"retry_jitter" toml:"retry_jitter" json:"retry_jitter" env:"DRAIN_RETRY_JITTER" reload:"true"`
+}
+
+// ReadyzConfig holds the readiness check thresholds
+type ReadyzConfig struct {
+	PingTimeout       Duration `yaml:"ping_timeout" toml:"ping_timeout" json:"ping_timeout" env:"READYZ_PING_TIMEOUT"`
+	MinClientHeadroom int      `yaml:"min_client_headroom" toml:"min_client_headroom" json:"min_client_headroom" env:"READYZ_MIN_CLIENT_HEADROOM"`
+}
+
+// HistoryConfig holds the retention of store revisions, disabled unless MaxRevisions or MaxAge is set
+type HistoryConfig struct {
+	MaxRevisions int      `yaml:"max_revisions" toml:"max_revisions" json:"max_revisions" env:"HISTORY_MAX_REVISIONS"`
+	MaxAge       Duration `yaml:"max_age" toml:"max_age" json:"max_age" env:"HISTORY_MAX_AGE"`
+}
+
+// NamespacesConfig holds the namespaces served under /ns
+type NamespacesConfig struct {
+	Names      []string `yaml:"names" toml:"names" json:"names" env:"NAMESPACES"`
+	AutoCreate bool     `yaml:"auto_create" toml:"auto_create" json:"auto_create" env:"NAMESPACE_AUTO_CREATE"`
+	Max        int      `yaml:"max" toml:"max" json:"max" env:"NAMESPACE_MAX"`
+	MaxClients int      `yaml:"max_clients" toml:"max_clients" json:"max_clients" env:"NAMESPACE_MAX_CLIENTS"`
+}
+
+// WebhooksConfig holds the webhook delivery retries and the targets they may reach
+type WebhooksConfig struct {
+	MaxAttempts    int      `yaml:"max_attempts" toml:"max_attempts" json:"max_attempts" env:"WEBHOOK_MAX_ATTEMPTS"`
+	InitialBackoff Duration `yaml:"initial_backoff" toml:"initial_backoff" json:"initial_backoff" env:"WEBHOOK_INITIAL_BACKOFF"`
+	MaxBackoff     Duration `yaml:"max_backoff" toml:"max_backoff" json:"max_backoff" env:"WEBHOOK_MAX_BACKOFF"`
+	Timeout        Duration `yaml:"timeout" toml:"timeout" json:"timeout" env:"WEBHOOK_TIMEOUT"`
+	// Deliveries to loopback, private and link-local addresses are refused unless set
+	AllowPrivateTargets bool `yaml:"allow_private_targets" toml:"allow_private_targets" json:"allow_private_targets" env:"WEBHOOK_ALLOW_PRIVATE_TARGETS"`
+}
+
+// TLSConfig holds the native TLS settings
+type TLSConfig struct {
+	CertFile       string   `yaml:"cert_file" toml:"cert_file" json:"cert_file" env:"TLS_CERT_FILE"`
+	KeyFile        string   `yaml:"key_file" toml:"key_file" json:"key_file" env:"TLS_KEY_FILE"`
+	MinVersion     string   `yaml:"min_version" toml:"min_version" json:"min_version" env:"TLS_MIN_VERSION"`
+	ClientCAFile   string   `yaml:"client_ca_file" toml:"client_ca_file" json:"client_ca_file" env:"TLS_CLIENT_CA_FILE"`
+	ClientAuth     string   `yaml:"client_auth" toml:"client_auth" json:"client_auth" env:"TLS_CLIENT_AUTH"`
+	ReloadInterval Duration `yaml:"reload_interval" toml:"reload_interval" json:"reload_interval" env:"TLS_RELOAD_INTERVAL"`
+}
+
+// AdminConfig holds the admin API credential
+type AdminConfig struct {
+	Token string `yaml:"token" toml:"token" json:"token" env:"ADMIN_TOKEN" secret:"true"`
+}
+
+// Default returns the configuration used when nothing is configured
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Port:             8080,
+			MaxRequestSizeMB: 20,
+			ShutdownTimeout:  Duration(30 * time.Second),
+			LogLevel:         "info",
+		},
+		Store: StoreConfig{Type: "memory"},
+		SSE: SSEConfig{
+			MaxClients:        10000,
+			Keepalive:         Duration(30 * time.Second),
+			BufferSize:        100,
+			CleanupInterval:   Duration(5 * time.Minute),
+			InactivityTimeout: Duration(2 * time.Minute),
+		},
+		CORS: CORSConfig{
+			AllowedOrigins: []string{"*"},
+			AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+			AllowedHeaders: []string{"Accept", "Authorization", "Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Last-Event-ID"},
+			ExposedHeaders: []string{"ETag", "Retry-After"},
+			MaxAge:         Duration(10 * time.Minute),
+		},
+		Drain: DrainConfig{
+			Window:      Duration(10 * time.Second),
+			Waves:       5,
+			RetryDelay:  Duration(time.Second),
+			RetryJitter: Duration(5 * time.Second),
+		},
+		Readyz: ReadyzConfig{
+			PingTimeout:       Duration(2 * time.Second),
+			MinClientHeadroom: 5,
+		},
+		Namespaces: NamespacesConfig{Max: 100},
+		Webhooks: WebhooksConfig{
+			MaxAttempts:    5,
+			InitialBackoff: Duration(time.Second),
+			MaxBackoff:     Duration(time.Minute),
+			Timeout:        Duration(10 * time.Second),
+		},
+		TLS: TLSConfig{
+			MinVersion:     "1.2",
+			ClientAuth:     "require",
+			ReloadInterval: Duration(30 * time.Second),
+		},
+	}
+}
+
+// Loader loads the configuration from a file and the environment the server started with
+type Loader struct {
+	path string
+	env  map[string]string // Variables set when the loader was created
+}
+
+// NewLoader creates a loader for the file at path, which may be empty to use only the
+// environment. It records the environment, so later changes to it are not loaded.
+func NewLoader(path string) *Loader {
+	l := &Loader{path: path, env: make(map[string]string)}
+	forEachSetting(reflect.ValueOf(&Config{}).Elem(), "", func(field reflect.StructField, _ reflect.Value, _ string) {
+		name := field.Tag.Get("env")
+		if value, ok := os.LookupEnv(name); ok {
+			l.env[name] = value
+		}
+	})
+	return l
+}
+
+// Path returns the configuration file, empty when there is none
+func (l *Loader) Path() string {
+	return l.path
+}
+
+// Overrides returns the sorted names of the environment variables that take precedence
+// over the file
+func (l *Loader) Overrides() []string {
+	names := make([]string, 0, len(l.env))
+	for name := range l.env {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Load reads the defaults, then the file, then the environment, and validates the result
+func (l *Loader) Load() (Config, error) {
+	config := Default()
+
+	if l.path != "" {
+		if err := decodeFile(l.path, &config); err != nil {
+			return config, err
+		}
+	}
+
+	var errs []error
+	forEachSetting(reflect.ValueOf(&config).Elem(), "", func(field reflect.StructField, value reflect.Value, key string) {
+		name := field.Tag.Get("env")
+		raw, ok := l.env[name]
+		if !ok {
+			return
+		}
+		if err := setValue(value, raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	})
+	if len(errs) > 0 {
+		return config, errors.Join(errs...)
+	}
+
+	return config, config.Validate()
+}
+
+// decodeFile decodes a YAML or TOML file, chosen by its extension. Unknown keys are errors.
+func decodeFile(path string, config *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(data), config)
+		if err != nil {
+			return fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("invalid config file %s: unknown key %s", path, undecoded[0])
+		}
+	default:
+		return fmt.Errorf("config file %s must end in .yaml, .yml or .toml", path)
+	}
+	return nil
+}
+
+// Validate checks every setting and returns all problems found
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Port > 0 && c.Server.Port < 65536, "server.port must be between 1 and 65535")
+	check(c.Server.MaxRequestSizeMB > 0, "server.max_request_size_mb must be positive")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+	if _, err := logging.ParseLevel(c.Server.LogLevel); err != nil {
+		check(false, "server.log_level: %v", err)
+	}
+
+	check(c.Store.Type == "memory" || c.Store.Type == "mongo", "store.type must be memory or mongo")
+
+	check(c.SSE.MaxClients > 0, "sse.max_clients must be positive")
+	check(c.SSE.MaxClientsPerIP >= 0, "sse.max_clients_per_ip must not be negative")
+	check(c.SSE.Keepalive > 0, "sse.keepalive must be positive")
+	check(c.SSE.BufferSize > 0, "sse.buffer_size must be positive")
+	check(c.SSE.CleanupInterval > 0, "sse.cleanup_interval must be positive")
+	check(c.SSE.InactivityTimeout > c.SSE.Keepalive, "sse.inactivity_timeout must be longer than sse.keepalive")
+
+	check(c.Limits.WriteRate >= 0, "limits.write_rate must not be negative")
+	check(c.Limits.WriteBurst >= 0, "limits.write_burst must not be negative")
+	check(c.Limits.QueryRate >= 0, "limits.query_rate must not be negative")
+	check(c.Limits.QueryBurst >= 0, "limits.query_burst must not be negative")
+
+	check(len(c.CORS.AllowedOrigins) > 0 || c.CORS.AllowedOriginPattern != "", "cors.allowed_origins or cors.allowed_origin_pattern must be set")
+	if _, err := regexp.Compile(c.CORS.AllowedOriginPattern); err != nil {
+		check(false, "cors.allowed_origin_pattern: %v", err)
+	}
+	check(!c.CORS.AllowCredentials || !slices.Contains(c.CORS.AllowedOrigins, "*"), "cors.allow_credentials cannot be used with the * origin, list the allowed origins instead")
+	check(len(c.CORS.AllowedMethods) > 0, "cors.allowed_methods must not be empty")
+	check(c.CORS.MaxAge >= 0, "cors.max_age must not be negative")
+
+	check(c.Drain.Window >= 0, "drain.window must not be negative")
+	check(c.Drain.Waves > 0, "drain.waves must be positive")
+	check(c.Drain.RetryDelay >= 0, "drain.retry_delay must not be negative")
+	check(c.Drain.RetryJitter >= 0, "drain.retry_jitter must not be negative")
+
+	check(c.Readyz.PingTimeout > 0, "readyz.ping_timeout must be positive")
+	check(c.Readyz.MinClientHeadroom >= 0 && c.Readyz.MinClientHeadroom <= 100, "readyz.min_client_headroom must be between 0 and 100")
+
+	check(c.History.MaxRevisions >= 0, "history.max_revisions must not be negative")
+	check(c.History.MaxAge >= 0, "history.max_age must not be negative")
+
+	check(c.Namespaces.Max >= 0, "namespaces.max must not be negative")
+	check(c.Namespaces.MaxClients >= 0, "namespaces.max_clients must not be negative")
+
+	check(c.Webhooks.MaxAttempts > 0, "webhooks.max_attempts must be positive")
+	check(c.Webhooks.InitialBackoff > 0, "webhooks.initial_backoff must be positive")
+	check(c.Webhooks.MaxBackoff >= c.Webhooks.InitialBackoff, "webhooks.max_backoff must not be shorter than webhooks.initial_backoff")
+	check(c.Webhooks.Timeout > 0, "webhooks.timeout must be positive")
+
+	check((c.TLS.CertFile == "") == (c.TLS.KeyFile == ""), "tls.cert_file and tls.key_file must be set together")
+	check(c.TLS.MinVersion == "1.2" || c.TLS.MinVersion == "1.3", "tls.min_version must be 1.2 or 1.3")
+	check(c.TLS.ClientAuth == "require" || c.TLS.ClientAuth == "optional", "tls.client_auth must be require or optional")
+	check(c.TLS.ReloadInterval > 0, "tls.reload_interval must be positive")
+
+	return errors.Join(errs...)
+}
+
+// Redacted returns a copy of the configuration with the secret settings hidden
+func (c Config) Redacted() Config {
+	forEachSetting(reflect.ValueOf(&c).Elem(), "", func(field reflect.StructField, value reflect.Value, _ string) {
+		if field.Tag.Get("secret") == "true" && value.String() != "" {
+			value.SetString(Redacted)
+		}
+	})
+	return c
+}
+
+// Reload returns the configuration to run with after next was loaded: the reloadable
+// settings of next, and the settings of c for those that need a restart. It also lists
+// the settings that differ, split into those reloaded and those waiting for a restart.
+func (c Config) Reload(next Config) (applied Config, reloaded, restart []string) {
+	applied = next
+	appliedValue := reflect.ValueOf(&applied).Elem()
+	forEachSetting(reflect.ValueOf(&c).Elem(), "", func(field reflect.StructField, value reflect.Value, key string) {
+		nextValue := fieldByKey(appliedValue, key)
+		if reflect.DeepEqual(value.Interface(), nextValue.Interface()) {
+			return
+		}
+		if field.Tag.Get("reload") == "true" {
+			reloaded = append(reloaded, key)
+		} else {
+			restart = append(restart, key)
+			nextValue.Set(value)
+		}
+	})
+	return applied, reloaded, restart
+}
+
+// forEachSetting calls fn with every setting in v, and its dotted key such as "sse.keepalive"
+func forEachSetting(v reflect.Value, prefix string, fn func(field reflect.StructField, value reflect.Value, key string)) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		key := prefix + field.Tag.Get("yaml")
+		if field.Tag.Get("env") == "" && field.Type.Kind() == reflect.Struct {
+			forEachSetting(v.Field(i), key+".", fn)
+			continue
+		}
+		fn(field, v.Field(i), key)
+	}
+}
+
+// fieldByKey returns the setting of v with a dotted key
+func fieldByKey(v reflect.Value, key string) reflect.Value {
+	for _, name := range strings.Split(key, ".") {
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).Tag.Get("yaml") == name {
+				v = v.Field(i)
+				break
+			}
+		}
+	}
+	return v
+}
+
+// setValue parses raw into a setting
+func setValue(value reflect.Value, raw string) error {
+	if value.Type() == reflect.TypeOf(Duration(0)) {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		value.SetInt(int64(d))
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		value.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		value.SetFloat(f)
+	case reflect.Bool:
+		value.SetBool(raw == "true" || raw == "1")
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		value.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported setting type %s", value.Type())
+	}
+	return nil
+}
+
+// Duration is a time.Duration written as a string such as "30s" in files and JSON
+type Duration time.Duration
+
+// UnmarshalText parses a duration string
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalText formats the duration as a string
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
@@ -0,0 +1,175 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/piske-alex/go-sse/internal/config"
+)
+
+// writeFile writes a config file into a temporary directory
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad_YAML(t *testing.T) {
+	path := writeFile(t, "gosse.yaml", `
+server:
+  port: 9090
+  log_level: info
+sse:
+  max_clients: 500
+  keepalive: 15s
+namespaces:
+  names: [orders, chat]
+admin:
+  token: s3cret
+`)
+
+	cfg, err := config.NewLoader(path).Load()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.Server.Port != 9090 || cfg.Server.LogLevel != "info" || cfg.SSE.MaxClients != 500 {
+		t.Errorf("Unexpected config %+v", cfg)
+	}
+	if time.Duration(cfg.SSE.Keepalive) != 15*time.Second {
+		t.Errorf("Expected a keepalive of 15s, got %v", time.Duration(cfg.SSE.Keepalive))
+	}
+	if strings.Join(cfg.Namespaces.Names, ",") != "orders,chat" {
+		t.Errorf("Expected two namespaces, got %v", cfg.Namespaces.Names)
+	}
+
+	// Settings missing from the file keep their defaults
+	if cfg.SSE.BufferSize != 100 || cfg.Server.MaxRequestSizeMB != 20 {
+		t.Errorf("Expected the defaults for unset settings, got %+v", cfg.SSE)
+	}
+}
+
+func TestLoad_TOML(t *testing.T) {
+	path := writeFile(t, "gosse.toml", `
+[store]
+type = "mongo"
+
+[store.mongo]
+uri = "mongodb://user:pass@db:27017"
+
+[limits]
+write_rate = 2.5
+`)
+
+	cfg, err := config.NewLoader(path).Load()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.Store.Type != "mongo" || cfg.Store.Mongo.URI != "mongodb://user:pass@db:27017" || cfg.Limits.WriteRate != 2.5 {
+		t.Errorf("Unexpected config %+v", cfg)
+	}
+}
+
+func TestLoad_EnvOverridesFile(t *testing.T) {
+	path := writeFile(t, "gosse.yaml", "sse:\n  max_clients: 500\n  max_clients_per_ip: 5\n")
+	t.Setenv("SSE_MAX_CLIENTS", "700")
+
+	loader := config.NewLoader(path)
+	cfg, err := loader.Load()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.SSE.MaxClients != 700 || cfg.SSE.MaxClientsPerIP != 5 {
+		t.Errorf("Expected the environment to override the file, got %+v", cfg.SSE)
+	}
+
+	if overrides := loader.Overrides(); !slices.Contains(overrides, "SSE_MAX_CLIENTS") || slices.Contains(overrides, "SSE_MAX_CLIENTS_PER_IP") {
+		t.Errorf("Expected SSE_MAX_CLIENTS to be listed as an override, got %v", overrides)
+	}
+
+	// Reloads read the file again and keep the startup environment
+	t.Setenv("SSE_MAX_CLIENTS_PER_IP", "9")
+	if err := os.WriteFile(path, []byte("sse:\n  max_clients: 500\n  max_clients_per_ip: 8\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := loader.Load()
+	if err != nil {
+		t.Fatalf("Failed to reload config: %v", err)
+	}
+	if reloaded.SSE.MaxClientsPerIP != 8 || reloaded.SSE.MaxClients != 700 {
+		t.Errorf("Expected the reloaded file with the startup environment, got %+v", reloaded.SSE)
+	}
+
+	applied, changed, restart := cfg.Reload(reloaded)
+	if strings.Join(changed, ",") != "sse.max_clients_per_ip" || len(restart) != 0 {
+		t.Errorf("Unexpected changes %v %v", changed, restart)
+	}
+	if applied.SSE.MaxClientsPerIP != 8 {
+		t.Errorf("Expected the reloaded setting to apply, got %+v", applied.SSE)
+	}
+
+	// Settings that need a restart keep their running value
+	reloaded.Server.Port = 9999
+	applied, changed, restart = cfg.Reload(reloaded)
+	if strings.Join(restart, ",") != "server.port" || applied.Server.Port != cfg.Server.Port {
+		t.Errorf("Expected the port change to wait for a restart, got %v %d", restart, applied.Server.Port)
+	}
+	if strings.Join(changed, ",") != "sse.max_clients_per_ip" {
+		t.Errorf("Unexpected reloaded settings %v", changed)
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		message string
+	}{
+		{"unknown key", "gosse.yaml", "sse:\n  max_client: 5\n", "max_client"},
+		{"unknown toml key", "gosse.toml", "[sse]\nmax_client = 5\n", "sse.max_client"},
+		{"bad duration", "gosse.yaml", "sse:\n  keepalive: soon\n", "soon"},
+		{"out of range", "gosse.yaml", "server:\n  port: 70000\n", "server.port"},
+		{"inconsistent", "gosse.yaml", "sse:\n  keepalive: 5m\n", "sse.inactivity_timeout"},
+		{"log level", "gosse.yaml", "server:\n  log_level: loud\n", "server.log_level"},
+		{"cors credentials", "gosse.yaml", "cors:\n  allow_credentials: true\n", "cors.allow_credentials"},
+		{"cors pattern", "gosse.yaml", "cors:\n  allowed_origin_pattern: \"(\"\n", "cors.allowed_origin_pattern"},
+		{"extension", "gosse.json", "{}", ".yaml"},
+	}
+
+	for _, tt := range tests {
+		_, err := config.NewLoader(writeFile(t, tt.file, tt.content)).Load()
+		if err == nil || !strings.Contains(err.Error(), tt.message) {
+			t.Errorf("%s: expected an error mentioning %q, got %v", tt.name, tt.message, err)
+		}
+	}
+
+	// Invalid environment values are reported too
+	t.Setenv("SSE_BUFFER_SIZE", "lots")
+	if _, err := config.NewLoader("").Load(); err == nil || !strings.Contains(err.Error(), "SSE_BUFFER_SIZE") {
+		t.Errorf("Expected an error for SSE_BUFFER_SIZE, got %v", err)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := config.Default()
+	cfg.Admin.Token = "s3cret"
+	cfg.Store.Mongo.URI = "mongodb://user:pass@db"
+
+	redacted := cfg.Redacted()
+	if redacted.Admin.Token != config.Redacted || redacted.Store.Mongo.URI != config.Redacted {
+		t.Errorf("Expected secrets to be redacted, got %+v %+v", redacted.Admin, redacted.Store.Mongo)
+	}
+	if redacted.Store.Mongo.Password != "" {
+		t.Errorf("Expected unset secrets to stay empty, got %q", redacted.Store.Mongo.Password)
+	}
+	if cfg.Admin.Token != "s3cret" {
+		t.Error("Expected the original config to be unchanged")
+	}
+}
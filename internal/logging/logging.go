@@ -0,0 +1,92 @@
+// Package logging writes leveled messages to the standard logger. Messages below the
+// configured level are dropped before they are formatted, so debug messages on hot
+// paths cost one atomic load when the level is info or higher.
+package logging
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+// Level is a log level, from the most to the least verbose
+type Level int32
+
+const (
+	Debug Level = iota
+	Info
+	Warn
+	Error
+)
+
+// levelNames maps the configured names to levels
+var levelNames = map[string]Level{
+	"debug": Debug,
+	"info":  Info,
+	"warn":  Warn,
+	"error": Error,
+}
+
+// ParseLevel returns the level named by name
+func ParseLevel(name string) (Level, error) {
+	level, ok := levelNames[strings.ToLower(name)]
+	if !ok {
+		return Info, fmt.Errorf("unknown log level %q, use debug, info, warn or error", name)
+	}
+	return level, nil
+}
+
+// minLevel is the least severe level written, info until SetLevel is called
+var minLevel atomic.Int32
+
+func init() {
+	minLevel.Store(int32(Info))
+}
+
+// SetLevel drops messages below the named level. It can be called at any time to
+// change the level.
+func SetLevel(name string) error {
+	level, err := ParseLevel(name)
+	if err != nil {
+		return err
+	}
+	minLevel.Store(int32(level))
+	return nil
+}
+
+// Enabled reports whether messages at level are written, for callers that want to
+// skip building expensive arguments
+func Enabled(level Level) bool {
+	return level >= Level(minLevel.Load())
+}
+
+// Debugf logs a message that only helps to trace the server, prefixed with "DEBUG:"
+func Debugf(format string, args ...interface{}) {
+	output(Debug, "DEBUG: ", format, args)
+}
+
+// Infof logs a message about the normal operation of the server
+func Infof(format string, args ...interface{}) {
+	output(Info, "", format, args)
+}
+
+// Warnf logs a problem the server works around, prefixed with "Warning:"
+func Warnf(format string, args ...interface{}) {
+	output(Warn, "Warning: ", format, args)
+}
+
+// Errorf logs a failed operation. Messages say what failed themselves, such as
+// "Error reading request body: ...".
+func Errorf(format string, args ...interface{}) {
+	output(Error, "", format, args)
+}
+
+// output writes the message to the standard logger if its level is enabled
+func output(level Level, prefix, format string, args []interface{}) {
+	if !Enabled(level) {
+		return
+	}
+	// Report the caller of the leveled function to loggers with Lshortfile or Llongfile
+	log.Output(3, prefix+fmt.Sprintf(format, args...))
+}
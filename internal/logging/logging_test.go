@@ -0,0 +1,68 @@
+package logging_test
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/piske-alex/go-sse/internal/logging"
+)
+
+func TestParseLevel(t *testing.T) {
+	for name, want := range map[string]logging.Level{
+		"debug": logging.Debug,
+		"INFO":  logging.Info,
+		"warn":  logging.Warn,
+		"error": logging.Error,
+	} {
+		level, err := logging.ParseLevel(name)
+		if err != nil || level != want {
+			t.Errorf("ParseLevel(%q) = %v, %v, want %v", name, level, err, want)
+		}
+	}
+
+	if _, err := logging.ParseLevel("verbose"); err == nil {
+		t.Error("Expected an error for an unknown level")
+	}
+}
+
+func TestLeveledOutput(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(log.LstdFlags)
+		logging.SetLevel("info")
+	}()
+
+	// Info is the default level
+	logging.Debugf("hidden %d", 1)
+	logging.Infof("started on :%s", "8080")
+	if out.String() != "started on :8080\n" {
+		t.Errorf("Expected only the info message, got %q", out.String())
+	}
+
+	// Levels are chosen by the caller, whatever the message says
+	out.Reset()
+	if err := logging.SetLevel("warn"); err != nil {
+		t.Fatal(err)
+	}
+	logging.Infof("Error-looking message")
+	logging.Warnf("history disabled: %v", "no index")
+	logging.Errorf("Error saving: %v", "timeout")
+	if out.String() != "Warning: history disabled: no index\nError saving: timeout\n" {
+		t.Errorf("Unexpected output at the warn level %q", out.String())
+	}
+	if logging.Enabled(logging.Info) || !logging.Enabled(logging.Error) {
+		t.Error("Expected only warnings and errors to be enabled")
+	}
+
+	out.Reset()
+	logging.SetLevel("debug")
+	logging.Debugf("found %d clients", 3)
+	if out.String() != "DEBUG: found 3 clients\n" {
+		t.Errorf("Expected the debug message, got %q", out.String())
+	}
+}
@@ -69,6 +69,14 @@ func (f *Filter) IsMatch(path string, value interface{}) bool {
 	// If the changed path is a prefix of the filter path, or vice versa,
 	// or if they match exactly, consider it a match
 	
+	// A root filter matches every change
+	if f.Path == "." || f.Path == "" {
+		if len(f.Conditions) > 0 {
+			return f.matchesConditions(value)
+		}
+		return true
+	}
+
 	// Check for exact match first
 	if path == f.Path {
 		// If there are conditions, check them as well
@@ -223,7 +223,7 @@ func (m *Matcher) setValueBySegments(data interface{}, segments []PathSegment, i
 			return ErrPathNotFound
 		}
 
-		value, exists := mapData[segment.Value]
+		child, exists := mapData[segment.Value]
 		if !exists {
 			// Create missing intermediate objects
 			if segments[index+1].Type == Property {
@@ -233,10 +233,10 @@ func (m *Matcher) setValueBySegments(data interface{}, segments []PathSegment, i
 			} else {
 				return ErrPathNotFound
 			}
-			value = mapData[segment.Value]
+			child = mapData[segment.Value]
 		}
 
-		return m.setValueBySegments(value, segments, index+1, value)
+		return m.setValueBySegments(child, segments, index+1, value)
 
 	case Index:
 		// Handle an array index segment
@@ -152,7 +152,7 @@ func TestMatcher_Match(t *testing.T) {
 			name:          "non-existent property",
 			path:          ".missing[*]",
 			expectedCount: 0,
-			isError:       true,
+			isError:       false,
 		},
 	}
 
@@ -184,20 +184,6 @@ func TestMatcher_Match(t *testing.T) {
 func TestMatcher_Set(t *testing.T) {
 	matcher := query.NewMatcher()
 
-	// Test data
-	data := map[string]interface{}{
-		"users": []interface{}{
-			map[string]interface{}{
-				"id":     float64(1),
-				"name":   "Alice",
-				"status": "online",
-			},
-		},
-		"config": map[string]interface{}{
-			"maxUsers": float64(100),
-		},
-	}
-
 	tests := []struct {
 		name     string
 		path     string
@@ -223,9 +209,15 @@ func TestMatcher_Set(t *testing.T) {
 			isError:  false,
 		},
 		{
-			name:     "non-existent property",
+			name:     "create missing intermediate object",
 			path:     ".missing.field",
 			value:    "value",
+			isError:  false,
+		},
+		{
+			name:     "index out of bounds",
+			path:     ".users[5].status",
+			value:    "value",
 			isError:  true,
 		},
 	}
@@ -1,6 +1,7 @@
 package query
 
 import (
+	"encoding/json"
 	"errors"
 	"regexp"
 	"strconv"
@@ -32,6 +33,7 @@ const (
 type Parser struct {
 	pathRegex        *regexp.Regexp
 	propertyRegex    *regexp.Regexp
+	quotedRegex      *regexp.Regexp
 	arrayIndexRegex  *regexp.Regexp
 	arraySliceRegex  *regexp.Regexp
 	wildcardRegex    *regexp.Regexp
@@ -40,8 +42,9 @@ type Parser struct {
 // NewParser creates a new path parser instance
 func NewParser() *Parser {
 	return &Parser{
-		pathRegex:        regexp.MustCompile(`\.[^.\[\]]+|\[\d+\]|\[\*\]`),
+		pathRegex:        regexp.MustCompile(`\."(?:[^"\\]|\\.)*"|\.[^.\[\]]+|\[\d+\]|\[\*\]`),
 		propertyRegex:    regexp.MustCompile(`^\.(\w+)$`),
+		quotedRegex:      regexp.MustCompile(`^\.("(?:[^"\\]|\\.)*")$`),
 		arrayIndexRegex:  regexp.MustCompile(`^\[(\d+)\]$`),
 		wildcardRegex:    regexp.MustCompile(`^\[\*\]$`),
 	}
@@ -54,10 +57,8 @@ func (p *Parser) Parse(path string) ([]PathSegment, error) {
 		return []PathSegment{{Type: Root, Value: "", Index: -1}}, nil
 	}
 
-	// Remove leading dot if present
-	if strings.HasPrefix(path, ".") {
-		path = path[1:]
-	} else {
+	// Paths must start with a dot
+	if !strings.HasPrefix(path, ".") {
 		return nil, errors.New("path must start with a dot")
 	}
 
@@ -76,6 +77,17 @@ func (p *Parser) Parse(path string) ([]PathSegment, error) {
 				Value: submatches[1],
 				Index: -1,
 			})
+		} else if p.quotedRegex.MatchString(match) {
+			// Quoted property segment, for keys that are not plain words
+			var key string
+			if err := json.Unmarshal([]byte(match[1:]), &key); err != nil {
+				return nil, errors.New("invalid path segment: " + match)
+			}
+			segments = append(segments, PathSegment{
+				Type:  Property,
+				Value: key,
+				Index: -1,
+			})
 		} else if p.arrayIndexRegex.MatchString(match) {
 			// Array index segment
 			submatches := p.arrayIndexRegex.FindStringSubmatch(match)
@@ -99,3 +111,16 @@ func (p *Parser) Parse(path string) ([]PathSegment, error) {
 
 	return segments, nil
 }
+
+// propertyKeyRegex matches keys that can be written as a plain property segment
+var propertyKeyRegex = regexp.MustCompile(`^\w+$`)
+
+// PropertyPath returns the path segment addressing key, quoting keys that are
+// not plain words, such as "user-1" or "a.b"
+func PropertyPath(key string) string {
+	if propertyKeyRegex.MatchString(key) {
+		return "." + key
+	}
+	quoted, _ := json.Marshal(key)
+	return "." + string(quoted)
+}
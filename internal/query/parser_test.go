@@ -71,6 +71,17 @@ func TestParser_Parse(t *testing.T) {
 			},
 			isError: false,
 		},
+		{
+			name: "quoted property path",
+			path: `."user-1"."a.b"[0]`,
+			expected: []query.PathSegment{
+				{Type: query.Root, Value: "", Index: -1},
+				{Type: query.Property, Value: "user-1", Index: -1},
+				{Type: query.Property, Value: "a.b", Index: -1},
+				{Type: query.Index, Value: "", Index: 0},
+			},
+			isError: false,
+		},
 		{
 			name:     "invalid path",
 			path:     "users[0].name", // Missing leading dot
@@ -0,0 +1,93 @@
+// Package ratelimit limits how often each client may make requests using token buckets.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// pruneInterval is how often buckets that have refilled are forgotten
+const pruneInterval = time.Minute
+
+// Limiter keeps a token bucket for every key. Each request takes a token, and tokens
+// refill at a steady rate up to the burst size.
+type Limiter struct {
+	rate      float64 // Tokens added per second
+	burst     float64 // Bucket capacity
+	buckets   map[string]*bucket
+	mutex     sync.Mutex
+	lastPrune time.Time
+	rejected  atomic.Int64
+}
+
+// bucket holds the tokens of one key as of last
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// New creates a limiter allowing rate requests per second per key, with bursts of up to
+// burst requests. A burst below 1 is raised to the rate, rounded up.
+func New(rate float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = int(math.Ceil(rate))
+		if burst < 1 {
+			burst = 1
+		}
+	}
+
+	return &Limiter{
+		rate:      rate,
+		burst:     float64(burst),
+		buckets:   make(map[string]*bucket),
+		lastPrune: time.Now(),
+	}
+}
+
+// Allow takes a token from key's bucket. When the bucket is empty it returns false
+// and the time until the next token is available.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	now := time.Now()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if now.Sub(l.lastPrune) >= pruneInterval {
+		l.prune(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	} else {
+		b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+		b.last = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	l.rejected.Add(1)
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// Rejected returns the number of requests refused so far
+func (l *Limiter) Rejected() int64 {
+	return l.rejected.Load()
+}
+
+// prune forgets the buckets that are full again, which behave like new ones
+func (l *Limiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastPrune = now
+}
@@ -0,0 +1,53 @@
+package ratelimit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/piske-alex/go-sse/internal/ratelimit"
+)
+
+func TestLimiter_Burst(t *testing.T) {
+	limiter := ratelimit.New(1, 3)
+
+	// The burst is available at once
+	for i := 0; i < 3; i++ {
+		if ok, _ := limiter.Allow("a"); !ok {
+			t.Fatalf("Expected request %d to be allowed", i+1)
+		}
+	}
+
+	// Then requests wait for the next token
+	ok, wait := limiter.Allow("a")
+	if ok {
+		t.Fatal("Expected the request after the burst to be refused")
+	}
+	if wait <= 0 || wait > time.Second {
+		t.Errorf("Expected a wait of up to one second, got %v", wait)
+	}
+	if limiter.Rejected() != 1 {
+		t.Errorf("Expected 1 rejected request, got %d", limiter.Rejected())
+	}
+
+	// Other keys have their own bucket
+	if ok, _ := limiter.Allow("b"); !ok {
+		t.Error("Expected another key to be allowed")
+	}
+}
+
+func TestLimiter_Refill(t *testing.T) {
+	limiter := ratelimit.New(50, 1)
+
+	if ok, _ := limiter.Allow("a"); !ok {
+		t.Fatal("Expected the first request to be allowed")
+	}
+	if ok, _ := limiter.Allow("a"); ok {
+		t.Fatal("Expected the second request to be refused")
+	}
+
+	// A token is added every 20ms
+	time.Sleep(40 * time.Millisecond)
+	if ok, _ := limiter.Allow("a"); !ok {
+		t.Error("Expected a request to be allowed after the bucket refilled")
+	}
+}
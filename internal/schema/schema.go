@@ -0,0 +1,236 @@
+// Package schema validates store values against JSON Schemas registered for store paths.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// Violation is a single schema error at a location in the store
+type Violation struct {
+	// Path is the JQ-style path of the offending value
+	Path string `json:"path"`
+	// Keyword is the location of the failing keyword within the schema
+	Keyword string `json:"keyword"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned when a value does not match the schema registered for a path
+type ValidationError struct {
+	SchemaPath string
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Violations) == 0 {
+		return fmt.Sprintf("value does not match schema for %s", e.SchemaPath)
+	}
+	v := e.Violations[0]
+	msg := fmt.Sprintf("value does not match schema for %s: %s: %s", e.SchemaPath, v.Path, v.Message)
+	if len(e.Violations) > 1 {
+		msg += fmt.Sprintf(" (and %d more)", len(e.Violations)-1)
+	}
+	return msg
+}
+
+// entry is a registered schema
+type entry struct {
+	raw      json.RawMessage
+	compiled *jsonschema.Schema
+}
+
+// Registry holds the JSON Schemas (draft 2020-12) registered for store paths.
+// It is safe for concurrent use.
+type Registry struct {
+	mu      sync.RWMutex
+	schemas map[string]*entry
+}
+
+// NewRegistry creates an empty schema registry
+func NewRegistry() *Registry {
+	return &Registry{schemas: make(map[string]*entry)}
+}
+
+// Register compiles raw and registers it for path, replacing any previous schema
+func (r *Registry) Register(path string, raw []byte) error {
+	compiler := jsonschema.NewCompiler()
+	compiler.Draft = jsonschema.Draft2020
+	compiler.AssertFormat = true
+	// Schemas must be self-contained; never read $ref targets from disk or the network
+	compiler.LoadURL = func(url string) (io.ReadCloser, error) {
+		return nil, fmt.Errorf("external schema references are not supported: %s", url)
+	}
+
+	const url = "schema.json"
+	if err := compiler.AddResource(url, bytes.NewReader(raw)); err != nil {
+		return fmt.Errorf("invalid schema: %w", err)
+	}
+	compiled, err := compiler.Compile(url)
+	if err != nil {
+		return fmt.Errorf("invalid schema: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.schemas[path] = &entry{raw: append(json.RawMessage(nil), raw...), compiled: compiled}
+	return nil
+}
+
+// Remove unregisters the schema for path and reports whether one was registered
+func (r *Registry) Remove(path string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, ok := r.schemas[path]
+	delete(r.schemas, path)
+	return ok
+}
+
+// Get returns the schema registered for path
+func (r *Registry) Get(path string) (json.RawMessage, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	e, ok := r.schemas[path]
+	if !ok {
+		return nil, false
+	}
+	return e.raw, true
+}
+
+// All returns every registered schema by path
+func (r *Registry) All() map[string]json.RawMessage {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	all := make(map[string]json.RawMessage, len(r.schemas))
+	for path, e := range r.schemas {
+		all[path] = e.raw
+	}
+	return all
+}
+
+// Paths returns the registered paths in sorted order
+func (r *Registry) Paths() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.schemas) == 0 {
+		return nil
+	}
+
+	paths := make([]string, 0, len(r.schemas))
+	for path := range r.schemas {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Validate checks value against the schema registered for path.
+// It returns nil when no schema is registered and a *ValidationError on mismatch.
+func (r *Registry) Validate(path string, value interface{}) error {
+	r.mu.RLock()
+	e, ok := r.schemas[path]
+	r.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	// The validator only understands values as produced by encoding/json
+	instance, err := toJSONValue(value)
+	if err != nil {
+		return err
+	}
+
+	err = e.compiled.Validate(instance)
+	if err == nil {
+		return nil
+	}
+
+	validationErr, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return err
+	}
+
+	result := &ValidationError{SchemaPath: path}
+	collectViolations(validationErr, path, instance, &result.Violations)
+	return result
+}
+
+// toJSONValue converts value to the types produced by encoding/json, keeping number precision
+func toJSONValue(value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var out interface{}
+	if err := decoder.Decode(&out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// collectViolations flattens the leaf causes of a validation error
+func collectViolations(ve *jsonschema.ValidationError, base string, instance interface{}, out *[]Violation) {
+	if len(ve.Causes) == 0 {
+		*out = append(*out, Violation{
+			Path:    pointerToPath(base, ve.InstanceLocation, instance),
+			Keyword: ve.KeywordLocation,
+			Message: ve.Message,
+		})
+		return
+	}
+
+	for _, cause := range ve.Causes {
+		collectViolations(cause, base, instance, out)
+	}
+}
+
+// pointerToPath converts a JSON pointer within instance to a JQ-style path below base
+func pointerToPath(base, pointer string, instance interface{}) string {
+	var b strings.Builder
+	if base != "." {
+		b.WriteString(base)
+	}
+
+	current := instance
+	if pointer != "" {
+		for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+			token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+
+			switch node := current.(type) {
+			case []interface{}:
+				b.WriteString("[" + token + "]")
+				if i, err := strconv.Atoi(token); err == nil && i >= 0 && i < len(node) {
+					current = node[i]
+				} else {
+					current = nil
+				}
+			case map[string]interface{}:
+				b.WriteString("." + token)
+				current = node[token]
+			default:
+				b.WriteString("." + token)
+				current = nil
+			}
+		}
+	}
+
+	if b.Len() == 0 {
+		return "."
+	}
+	return b.String()
+}
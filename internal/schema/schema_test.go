@@ -0,0 +1,101 @@
+package schema_test
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/piske-alex/go-sse/internal/schema"
+)
+
+const positionsSchema = `{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"type": "array",
+	"items": {
+		"type": "object",
+		"required": ["id", "amount"],
+		"properties": {
+			"id": {"type": "string"},
+			"amount": {"type": "number", "minimum": 0}
+		}
+	}
+}`
+
+func TestRegistry_Validate(t *testing.T) {
+	registry := schema.NewRegistry()
+	if err := registry.Register(".data.positions", []byte(positionsSchema)); err != nil {
+		t.Fatalf("Failed to register schema: %v", err)
+	}
+
+	valid := []interface{}{
+		map[string]interface{}{"id": "pos1", "amount": 10},
+	}
+	if err := registry.Validate(".data.positions", valid); err != nil {
+		t.Errorf("Expected valid value, got %v", err)
+	}
+
+	invalid := []interface{}{
+		map[string]interface{}{"id": "pos1", "amount": float64(10)},
+		map[string]interface{}{"id": 2, "amount": float64(-1)},
+	}
+	err := registry.Validate(".data.positions", invalid)
+
+	var validationErr *schema.ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected a ValidationError, got %v", err)
+	}
+
+	var paths []string
+	for _, v := range validationErr.Violations {
+		paths = append(paths, v.Path)
+	}
+	sort.Strings(paths)
+	expected := []string{".data.positions[1].amount", ".data.positions[1].id"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Expected violations at %v, got %v", expected, paths)
+	}
+
+	// A string where an array is expected is reported at the schema path itself
+	err = registry.Validate(".data.positions", "oops")
+	if !errors.As(err, &validationErr) || validationErr.Violations[0].Path != ".data.positions" {
+		t.Errorf("Expected a violation at .data.positions, got %v", err)
+	}
+
+	// Paths without a schema always validate
+	if err := registry.Validate(".data.other", "anything"); err != nil {
+		t.Errorf("Expected no error for a path without a schema, got %v", err)
+	}
+}
+
+func TestRegistry_RegisterErrors(t *testing.T) {
+	registry := schema.NewRegistry()
+
+	if err := registry.Register(".a", []byte(`{"type": 5}`)); err == nil {
+		t.Error("Expected an error for an invalid schema")
+	}
+	if err := registry.Register(".a", []byte(`not json`)); err == nil {
+		t.Error("Expected an error for malformed JSON")
+	}
+	if err := registry.Register(".a", []byte(`{"$ref": "file:///etc/passwd"}`)); err == nil {
+		t.Error("Expected an error for an external reference")
+	}
+	if paths := registry.Paths(); len(paths) != 0 {
+		t.Errorf("Expected no registered schemas, got %v", paths)
+	}
+}
+
+func TestRegistry_Remove(t *testing.T) {
+	registry := schema.NewRegistry()
+	registry.Register(".a", []byte(`{"type": "string"}`))
+
+	if _, ok := registry.Get(".a"); !ok {
+		t.Fatal("Expected schema to be registered")
+	}
+	if !registry.Remove(".a") {
+		t.Error("Expected Remove to report a registered schema")
+	}
+	if registry.Remove(".a") {
+		t.Error("Expected Remove to report a missing schema")
+	}
+}
@@ -3,7 +3,11 @@ package sse_test
 import (
 	"context"
 	"fmt"
+	"io"
+	"log"
+	"net/http"
 	"net/http/httptest"
+	"os"
 	"sync"
 	"testing"
 	"time"
@@ -67,9 +71,9 @@ func benchmarkBroadcastWithClients(b *testing.B, clientCount int) {
 
 			// Add client with a filter for its own status
 			filter := fmt.Sprintf(".users[%d].status", index)
-			_, err := sseServer.AddClient(w, r, []string{filter})
+			_, err := sseServer.AddClient(w, r, []string{filter}, false)
 			if err != nil {
-				b.Fatalf("Failed to add client %d: %v", index, err)
+				b.Errorf("Failed to add client %d: %v", index, err)
 			}
 		}(i)
 	}
@@ -83,6 +87,7 @@ func benchmarkBroadcastWithClients(b *testing.B, clientCount int) {
 	}
 
 	// Reset the timer to exclude setup time
+	b.ReportAllocs()
 	b.ResetTimer()
 
 	// Run the actual benchmark
@@ -109,3 +114,76 @@ func benchmarkBroadcastWithClients(b *testing.B, clientCount int) {
 	// Shutdown the server
 	sseServer.Shutdown()
 }
+
+// discardResponseWriter is a flushable ResponseWriter that drops everything written to it,
+// so delivery does not show up in the broadcast allocation counts
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w discardResponseWriter) Header() http.Header         { return w.header }
+func (w discardResponseWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (w discardResponseWriter) WriteHeader(int)             {}
+func (w discardResponseWriter) Flush()                      {}
+
+func BenchmarkSSEServer_BroadcastSharedView(b *testing.B) {
+	// Number of concurrent clients that all subscribe to the same view
+	clientCounts := []int{10, 100, 1000}
+
+	for _, clientCount := range clientCounts {
+		b.Run(fmt.Sprintf("clients-%d", clientCount), func(b *testing.B) {
+			benchmarkBroadcastSharedView(b, clientCount)
+		})
+	}
+}
+
+func benchmarkBroadcastSharedView(b *testing.B, clientCount int) {
+	// Keep benchmark output readable
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	// Create a store and SSE server
+	kvStore := store.NewStore()
+	kvStore.Initialize(map[string]interface{}{
+		"data": map[string]interface{}{"positions": []interface{}{}},
+	})
+	sseServer := sse.NewServer(kvStore)
+	defer sseServer.Shutdown()
+
+	// Add clients that all share the same filter
+	cancels := make([]context.CancelFunc, clientCount)
+	for i := 0; i < clientCount; i++ {
+		r := httptest.NewRequest("GET", "/events", nil)
+		ctx, cancel := context.WithCancel(r.Context())
+		cancels[i] = cancel
+
+		_, err := sseServer.AddClient(discardResponseWriter{header: http.Header{}}, r.WithContext(ctx), []string{".data.positions"}, false)
+		if err != nil {
+			b.Fatalf("Failed to add client %d: %v", i, err)
+		}
+	}
+	defer func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+	}()
+
+	positions := make([]interface{}, 50)
+	for i := range positions {
+		positions[i] = map[string]interface{}{
+			"id":     fmt.Sprintf("pos%d", i),
+			"trader": "abc",
+			"amount": float64(i * 100),
+		}
+	}
+
+	// Allocations per broadcast should not grow with the number of encoded frames
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		sseServer.BroadcastEvent(".data.positions", positions, "update")
+	}
+
+	b.StopTimer()
+}
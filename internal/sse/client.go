@@ -2,16 +2,28 @@ package sse
 
 import (
 	"context"
-	"encoding/json"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"sort"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/piske-alex/go-sse/internal/codec"
 	"github.com/piske-alex/go-sse/internal/query"
 )
 
+var (
+	// errClientClosed is returned when sending to a client whose context is cancelled
+	errClientClosed = errors.New("client context cancelled")
+	// errQueueFull is returned when a client's message buffer is full and the message is dropped
+	errQueueFull = errors.New("client message queue full")
+)
+
 // Client represents a connected SSE client
 type Client struct {
 	ID           string
@@ -20,12 +32,51 @@ type Client struct {
 	Filters      []*query.Filter
 	Ctx          context.Context
 	CancelFunc   context.CancelFunc
-	LastActivity time.Time
 	MessageChan  chan []byte
+	// Encoding controls how event payloads are serialized; binary encodings are base64 encoded
+	Encoding codec.Codec
+	// View is the name of the view the client subscribes to, empty for store paths
+	View string
+	// viewKey identifies clients that receive identical frames for the same event
+	viewKey string
+	// done is closed when the client stops writing to the connection
+	done chan struct{}
+	// RemoteIP, UserAgent and ConnectedAt describe the connection for the admin API
+	RemoteIP    string
+	UserAgent   string
+	ConnectedAt time.Time
+	// lastActivity is the time of the last write in Unix nanoseconds
+	lastActivity atomic.Int64
+	// dropped counts the messages discarded because the queue was full
+	dropped atomic.Int64
+	// limitKey is the IP or principal the client counts against
+	limitKey string
+	// keepalive is the interval of keep-alive comments
+	keepalive time.Duration
+}
+
+// ClientInfo describes a connected client
+type ClientInfo struct {
+	ID            string    `json:"id"`
+	RemoteIP      string    `json:"remote_ip"`
+	UserAgent     string    `json:"user_agent"`
+	Filters       []string  `json:"filters"`
+	View          string    `json:"view,omitempty"`
+	Encoding      string    `json:"encoding"`
+	ConnectedAt   time.Time `json:"connected_at"`
+	LastActivity  time.Time `json:"last_activity"`
+	QueueDepth    int       `json:"queue_depth"`
+	QueueCapacity int       `json:"queue_capacity"`
+	Dropped       int64     `json:"dropped"`
 }
 
 // NewClient creates a new SSE client instance
 func NewClient(w http.ResponseWriter, filterExprs []string) (*Client, error) {
+	return newClient(w, filterExprs, DefaultOptions())
+}
+
+// newClient creates a client with the queue size and keep-alive interval of options
+func newClient(w http.ResponseWriter, filterExprs []string, options Options) (*Client, error) {
 	// Check if the writer supports flushing
 	f, ok := w.(http.Flusher)
 	if !ok {
@@ -39,7 +90,6 @@ func NewClient(w http.ResponseWriter, filterExprs []string) (*Client, error) {
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 
 	// Create filters from expressions
 	var filters []*query.Filter
@@ -55,29 +105,124 @@ func NewClient(w http.ResponseWriter, filterExprs []string) (*Client, error) {
 	}
 
 	client := &Client{
-		ID:           uuid.New().String(),
-		W:            w,
-		F:            &f,
-		Filters:      filters,
-		Ctx:          ctx,
-		CancelFunc:   cancel,
-		LastActivity: time.Now(),
-		MessageChan:  make(chan []byte, 100), // Buffer for 100 messages
+		ID:          uuid.New().String(),
+		W:           w,
+		F:           &f,
+		Filters:     filters,
+		Ctx:         ctx,
+		CancelFunc:  cancel,
+		MessageChan: make(chan []byte, options.BufferSize),
+		Encoding:    codec.JSON,
+		done:        make(chan struct{}),
+		ConnectedAt: time.Now(),
+		keepalive:   options.Keepalive,
 	}
+	client.lastActivity.Store(client.ConnectedAt.UnixNano())
+	client.updateViewKey()
 
 	return client, nil
 }
 
+// SetEncoding changes the event payload encoding for the client
+func (c *Client) SetEncoding(encoding codec.Codec) {
+	c.Encoding = encoding
+	c.updateViewKey()
+}
+
+// SetView subscribes the client to a registered view instead of store paths
+func (c *Client) SetView(name string) {
+	c.View = name
+	c.updateViewKey()
+}
+
+// updateViewKey recomputes the key used to share encoded frames between clients.
+// Filter order is part of the key because the first matching filter shapes the event.
+func (c *Client) updateViewKey() {
+	var b strings.Builder
+	b.WriteString(c.Encoding.Name())
+	if c.View != "" {
+		b.WriteString("|view:")
+		b.WriteString(c.View)
+	}
+	for _, filter := range c.Filters {
+		b.WriteByte('|')
+		b.WriteString(filter.Expression)
+	}
+	c.viewKey = b.String()
+}
+
+// SetRequest records the remote IP and user agent of the request that opened the stream
+func (c *Client) SetRequest(r *http.Request) {
+	c.RemoteIP = r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		c.RemoteIP = host
+	}
+	c.UserAgent = r.UserAgent()
+}
+
+// LastActivity returns the time of the last write to the client
+func (c *Client) LastActivity() time.Time {
+	return time.Unix(0, c.lastActivity.Load())
+}
+
+// Dropped returns the number of messages discarded because the client's queue was full
+func (c *Client) Dropped() int64 {
+	return c.dropped.Load()
+}
+
+// Info returns a description of the client and its queue
+func (c *Client) Info() ClientInfo {
+	filters := make([]string, 0, len(c.Filters))
+	for _, filter := range c.Filters {
+		filters = append(filters, filter.Expression)
+	}
+
+	return ClientInfo{
+		ID:            c.ID,
+		RemoteIP:      c.RemoteIP,
+		UserAgent:     c.UserAgent,
+		Filters:       filters,
+		View:          c.View,
+		Encoding:      c.Encoding.Name(),
+		ConnectedAt:   c.ConnectedAt,
+		LastActivity:  c.LastActivity(),
+		QueueDepth:    len(c.MessageChan),
+		QueueCapacity: cap(c.MessageChan),
+		Dropped:       c.Dropped(),
+	}
+}
+
+// sortClientInfos orders clients by connection time, oldest first
+func sortClientInfos(infos []ClientInfo) {
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].ConnectedAt.Equal(infos[j].ConnectedAt) {
+			return infos[i].ID < infos[j].ID
+		}
+		return infos[i].ConnectedAt.Before(infos[j].ConnectedAt)
+	})
+}
+
 // Send sends an SSE message to the client
 func (c *Client) Send(event string, data interface{}) error {
 	// Check if context is cancelled
 	select {
 	case <-c.Ctx.Done():
-		return fmt.Errorf("client context cancelled")
+		return errClientClosed
 	default:
 		// Context still valid, continue
 	}
 
+	message, err := c.encodeFrame(event, data)
+	if err != nil {
+		return err
+	}
+
+	return c.enqueue(message)
+}
+
+// encodeFrame formats an event as a complete SSE frame using the client's filters and encoding.
+// The result only depends on the client's view, so it can be shared with clients that have the same viewKey.
+func (c *Client) encodeFrame(event string, data interface{}) ([]byte, error) {
 	// Generic filtering for any path in SSE events
 	if eventData, ok := data.(map[string]interface{}); ok {
 		// Check if this is a filtered event
@@ -116,30 +261,54 @@ func (c *Client) Send(event string, data interface{}) error {
 	}
 
 	// Convert data to JSON if it's not a string
-	var dataStr string
+	var payload []byte
 	switch v := data.(type) {
 	case string:
-		dataStr = v
+		payload = []byte(v)
 	case []byte:
-		dataStr = string(v)
+		payload = v
 	default:
-		jsonData, err := json.Marshal(data)
+		encoded, err := c.Encoding.Marshal(data)
 		if err != nil {
-			return fmt.Errorf("failed to marshal data: %w", err)
+			return nil, fmt.Errorf("failed to marshal data: %w", err)
+		}
+		// SSE data lines must be text, so binary encodings are sent as base64
+		if c.Encoding.Binary() {
+			payload = []byte(base64.StdEncoding.EncodeToString(encoded))
+		} else {
+			payload = encoded
 		}
-		dataStr = string(jsonData)
 	}
 
-	// Format the SSE message
-	message := fmt.Sprintf("event: %s\ndata: %s\n\n", event, dataStr)
+	// Format the SSE message in a single allocation
+	frame := make([]byte, 0, len("event: \ndata: \n\n")+len(event)+len(payload))
+	frame = append(frame, "event: "...)
+	frame = append(frame, event...)
+	frame = append(frame, "\ndata: "...)
+	frame = append(frame, payload...)
+	frame = append(frame, "\n\n"...)
+
+	return frame, nil
+}
+
+// enqueue queues an encoded frame for delivery without blocking
+func (c *Client) enqueue(message []byte) error {
+	// Check if context is cancelled
+	select {
+	case <-c.Ctx.Done():
+		return errClientClosed
+	default:
+		// Context still valid, continue
+	}
 
 	// Send via channel
 	select {
-	case c.MessageChan <- []byte(message):
+	case c.MessageChan <- message:
 		// Message queued successfully
 	default:
 		// Channel full, drop message to avoid blocking
-		return fmt.Errorf("client message queue full")
+		c.dropped.Add(1)
+		return errQueueFull
 	}
 
 	return nil
@@ -150,7 +319,7 @@ func (c *Client) SendComment(comment string) error {
 	// Check if context is cancelled
 	select {
 	case <-c.Ctx.Done():
-		return fmt.Errorf("client context cancelled")
+		return errClientClosed
 	default:
 		// Context still valid, continue
 	}
@@ -164,16 +333,61 @@ func (c *Client) SendComment(comment string) error {
 		// Message queued successfully
 	default:
 		// Channel full, drop message to avoid blocking
-		return fmt.Errorf("client message queue full")
+		c.dropped.Add(1)
+		return errQueueFull
 	}
 
 	return nil
 }
 
-// Close closes the client connection
+// SendShutdown sends a shutdown event asking the client to reconnect after delay, and ends the
+// stream once the event is written. The retry field makes EventSource clients wait delay before
+// reconnecting; the delay is also included in the event data for other clients.
+func (c *Client) SendShutdown(delay time.Duration) error {
+	frame, err := c.encodeFrame("shutdown", map[string]interface{}{
+		"reason":          "server shutting down",
+		"reconnect_after": delay.Milliseconds(),
+		"time":            time.Now().Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	retry := fmt.Sprintf("retry: %d\n", delay.Milliseconds())
+	return c.sendFinal(append([]byte(retry), frame...))
+}
+
+// SendDisconnect sends a disconnect event with reason and ends the stream once it is written
+func (c *Client) SendDisconnect(reason string) error {
+	frame, err := c.encodeFrame("disconnect", map[string]interface{}{
+		"reason": reason,
+		"time":   time.Now().Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	return c.sendFinal(frame)
+}
+
+// sendFinal queues the last frame of the stream
+func (c *Client) sendFinal(frame []byte) error {
+	if err := c.enqueue(frame); err != nil {
+		return err
+	}
+
+	// A nil message ends the stream after the frames queued before it
+	return c.enqueue(nil)
+}
+
+// Done returns a channel closed when the client stops writing to the connection
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Close closes the client connection. MessageChan is left open: senders may still hold the
+// client after it is removed, and the cancelled context stops both them and the writer.
 func (c *Client) Close() {
 	c.CancelFunc()
-	close(c.MessageChan)
 }
 
 // ShouldNotify checks if the client should be notified of a change
@@ -182,11 +396,10 @@ func (c *Client) ShouldNotify(path string, value interface{}) bool {
 	for _, filter := range c.Filters {
 		// If the filter is more specific than the path
 		if strings.HasPrefix(filter.Path, path) {
-			// Extract the target field from the filter path
+			// Extract the target field from the filter path without allocating
 			// e.g. "positions" from ".data.positions"
-			parts := strings.Split(filter.Path, ".")
-			if len(parts) > 1 {
-				targetField := parts[len(parts)-1]
+			if lastDot := strings.LastIndex(filter.Path, "."); lastDot >= 0 {
+				targetField := filter.Path[lastDot+1:]
 				
 				// For root paths like "." or ".data", check if the value contains what client wants
 				if path == "." || path == ".data" || path == "data" {
@@ -304,8 +517,10 @@ func matchesKeyValueConditions(data interface{}, conditions []query.KeyValueCond
 // ProcessMessages starts a goroutine to process and send messages to the client
 func (c *Client) ProcessMessages() {
 	go func() {
+		defer close(c.done)
+
 		// Create a ticker for keep-alive comments
-		keepaliveTicker := time.NewTicker(30 * time.Second)
+		keepaliveTicker := time.NewTicker(c.keepalive)
 		defer keepaliveTicker.Stop()
 
 		for {
@@ -314,9 +529,10 @@ func (c *Client) ProcessMessages() {
 				// Client context cancelled, exit goroutine
 				return
 
-			case msg, ok := <-c.MessageChan:
-				if !ok {
-					// Channel closed, exit goroutine
+			case msg := <-c.MessageChan:
+				if msg == nil {
+					// End of stream requested, stop after the frames written so far
+					c.CancelFunc()
 					return
 				}
 
@@ -330,7 +546,7 @@ func (c *Client) ProcessMessages() {
 
 				// Flush to ensure the message is sent immediately
 				(*c.F).Flush()
-				c.LastActivity = time.Now()
+				c.lastActivity.Store(time.Now().UnixNano())
 
 			case <-keepaliveTicker.C:
 				// Send keep-alive comment
@@ -343,7 +559,7 @@ func (c *Client) ProcessMessages() {
 
 				// Flush to ensure the keep-alive is sent immediately
 				(*c.F).Flush()
-				c.LastActivity = time.Now()
+				c.lastActivity.Store(time.Now().UnixNano())
 			}
 		}
 	}()
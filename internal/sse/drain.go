@@ -0,0 +1,152 @@
+package sse
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/piske-alex/go-sse/internal/logging"
+)
+
+// ErrDraining is returned for clients connecting while the server is draining
+var ErrDraining = errors.New("server is draining")
+
+// DrainOptions controls how connected clients are moved off a server that is shutting down
+type DrainOptions struct {
+	Window      time.Duration // Time over which connections are closed
+	Waves       int           // Number of groups the connections are closed in
+	RetryDelay  time.Duration // Minimum reconnect delay sent to clients
+	RetryJitter time.Duration // Random delay added to RetryDelay for each client
+}
+
+// DefaultDrainOptions returns the drain options used when none are configured
+func DefaultDrainOptions() DrainOptions {
+	return DrainOptions{
+		Window:      10 * time.Second,
+		Waves:       5,
+		RetryDelay:  1 * time.Second,
+		RetryJitter: 5 * time.Second,
+	}
+}
+
+// DrainOptionsFromEnv reads the drain options from the environment
+func DrainOptionsFromEnv() DrainOptions {
+	options := DefaultDrainOptions()
+
+	if value := os.Getenv("DRAIN_WINDOW"); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+			options.Window = d
+		}
+	}
+
+	if value := os.Getenv("DRAIN_WAVES"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			options.Waves = n
+		}
+	}
+
+	if value := os.Getenv("DRAIN_RETRY_DELAY"); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+			options.RetryDelay = d
+		}
+	}
+
+	if value := os.Getenv("DRAIN_RETRY_JITTER"); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+			options.RetryJitter = d
+		}
+	}
+
+	return options
+}
+
+// Draining reports whether the server has stopped accepting clients
+func (s *Server) Draining() bool {
+	return s.draining.Load()
+}
+
+// RetryAfter returns how long rejected clients should wait before reconnecting
+func (s *Server) RetryAfter() time.Duration {
+	s.clientsMutex.RLock()
+	defer s.clientsMutex.RUnlock()
+	return s.drainOptions.RetryDelay + s.drainOptions.RetryJitter
+}
+
+// Drain stops accepting clients and moves the connected ones off the server. Every client is
+// sent a shutdown event with a jittered reconnect delay, then the connections are closed in
+// waves spread over the drain window so reconnects do not arrive at once. Drain returns when
+// every connection is closed, closing the remaining ones at once if ctx is done first.
+func (s *Server) Drain(ctx context.Context, options DrainOptions) {
+	s.clientsMutex.Lock()
+	s.draining.Store(true)
+	s.drainOptions = options
+	clients := make([]*Client, 0, len(s.clients))
+	for _, client := range s.clients {
+		clients = append(clients, client)
+	}
+	s.clientsMutex.Unlock()
+
+	if len(clients) == 0 {
+		return
+	}
+	logging.Infof("Draining %d SSE clients over %v", len(clients), options.Window)
+
+	// Keep the whole window inside the deadline
+	window := options.Window
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < window {
+		window = time.Until(deadline)
+	}
+	waves := options.Waves
+	if waves < 1 {
+		waves = 1
+	}
+	if waves > len(clients) {
+		waves = len(clients)
+	}
+	interval := window / time.Duration(waves)
+
+	for wave := 0; wave < waves; wave++ {
+		if wave > 0 {
+			select {
+			case <-ctx.Done():
+				// Out of time, close the rest together
+				s.closeDrained(clients[wave*len(clients)/waves:], options)
+				s.awaitDrained(ctx, clients)
+				return
+			case <-time.After(interval):
+			}
+		}
+		s.closeDrained(clients[wave*len(clients)/waves:(wave+1)*len(clients)/waves], options)
+	}
+
+	s.awaitDrained(ctx, clients)
+}
+
+// closeDrained sends the shutdown event to clients, which end their streams once it is written
+func (s *Server) closeDrained(clients []*Client, options DrainOptions) {
+	for _, client := range clients {
+		delay := options.RetryDelay
+		if options.RetryJitter > 0 {
+			delay += time.Duration(rand.Int63n(int64(options.RetryJitter)))
+		}
+
+		if err := client.SendShutdown(delay); err != nil {
+			// The client is gone or not reading; close it without the event
+			s.RemoveClient(client.ID)
+		}
+	}
+}
+
+// awaitDrained waits for the clients to finish writing, then removes them
+func (s *Server) awaitDrained(ctx context.Context, clients []*Client) {
+	for _, client := range clients {
+		select {
+		case <-client.Done():
+		case <-ctx.Done():
+		}
+		s.RemoveClient(client.ID)
+	}
+}
@@ -0,0 +1,33 @@
+package sse
+
+import (
+	"strconv"
+	"time"
+)
+
+// newEpoch returns an identifier for this server's event sequence, so that IDs
+// from a previous process or another instance never match the current ones
+func newEpoch() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+// nextEventID numbers a broadcast event. It must be called before the clients to
+// notify are collected, so a client that sees the current ID will receive the next event.
+func (s *Server) nextEventID() string {
+	return s.epoch + "-" + strconv.FormatUint(s.eventSeq.Add(1), 10)
+}
+
+// LastEventID returns the ID of the last event broadcast, in the form sent in the
+// id field of events. Clients that reconnect with this ID have missed nothing.
+func (s *Server) LastEventID() string {
+	return s.epoch + "-" + strconv.FormatUint(s.eventSeq.Load(), 10)
+}
+
+// withEventID prefixes an encoded frame with its id field
+func withEventID(frame []byte, id string) []byte {
+	framed := make([]byte, 0, len("id: \n")+len(id)+len(frame))
+	framed = append(framed, "id: "...)
+	framed = append(framed, id...)
+	framed = append(framed, '\n')
+	return append(framed, frame...)
+}
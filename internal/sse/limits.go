@@ -0,0 +1,86 @@
+package sse
+
+import (
+	"errors"
+	"os"
+	"strconv"
+)
+
+var (
+	// ErrServerFull is returned when the server already has its maximum number of clients
+	ErrServerFull = errors.New("server has reached its maximum number of clients")
+
+	// ErrClientLimit is returned when an IP or principal already has its maximum number of clients
+	ErrClientLimit = errors.New("too many connections from this client")
+)
+
+// Limits caps the number of connected clients
+type Limits struct {
+	MaxClients       int // Clients across the server
+	MaxClientsPerKey int // Clients sharing a limit key (an IP or principal), 0 for no limit
+}
+
+// LimitStats reports the configured limits and the connections they refused
+type LimitStats struct {
+	MaxClients       int   `json:"max_clients"`
+	MaxClientsPerKey int   `json:"max_clients_per_key"`
+	RejectedFull     int64 `json:"rejected_server_full"`
+	RejectedPerKey   int64 `json:"rejected_per_key"`
+}
+
+// DefaultLimits returns the client limits used when none are configured
+func DefaultLimits() Limits {
+	return Limits{MaxClients: 10000}
+}
+
+// LimitsFromEnv reads the client limits from the environment
+func LimitsFromEnv() Limits {
+	limits := DefaultLimits()
+
+	if value := os.Getenv("SSE_MAX_CLIENTS"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			limits.MaxClients = n
+		}
+	}
+
+	if value := os.Getenv("SSE_MAX_CLIENTS_PER_IP"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			limits.MaxClientsPerKey = n
+		}
+	}
+
+	return limits
+}
+
+// SetLimits changes the client limits. Connected clients over a new limit stay connected.
+func (s *Server) SetLimits(limits Limits) {
+	s.clientsMutex.Lock()
+	defer s.clientsMutex.Unlock()
+	s.maxClients = limits.MaxClients
+	s.maxClientsPerKey = limits.MaxClientsPerKey
+}
+
+// LimitStats returns the client limits and the number of connections they refused
+func (s *Server) LimitStats() LimitStats {
+	s.clientsMutex.RLock()
+	defer s.clientsMutex.RUnlock()
+	return LimitStats{
+		MaxClients:       s.maxClients,
+		MaxClientsPerKey: s.maxClientsPerKey,
+		RejectedFull:     s.rejectedFull.Load(),
+		RejectedPerKey:   s.rejectedPerKey.Load(),
+	}
+}
+
+// checkLimits reports whether a client with limitKey may connect. It must be called with clientsMutex held.
+func (s *Server) checkLimits(limitKey string) error {
+	if len(s.clients) >= s.maxClients {
+		s.rejectedFull.Add(1)
+		return ErrServerFull
+	}
+	if s.maxClientsPerKey > 0 && limitKey != "" && s.clientsPerKey[limitKey] >= s.maxClientsPerKey {
+		s.rejectedPerKey.Add(1)
+		return ErrClientLimit
+	}
+	return nil
+}
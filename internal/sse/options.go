@@ -0,0 +1,68 @@
+package sse
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// Options tunes the client queues, keep-alives and the removal of inactive clients
+type Options struct {
+	Keepalive         time.Duration // Interval of keep-alive comments on idle streams
+	BufferSize        int           // Events queued per client before new ones are dropped
+	CleanupInterval   time.Duration // Interval of the inactive client check
+	InactivityTimeout time.Duration // Clients without a successful write for this long are removed
+}
+
+// DefaultOptions returns the options used when none are configured
+func DefaultOptions() Options {
+	return Options{
+		Keepalive:         30 * time.Second,
+		BufferSize:        100,
+		CleanupInterval:   5 * time.Minute,
+		InactivityTimeout: 2 * time.Minute,
+	}
+}
+
+// OptionsFromEnv reads the client options from the environment
+func OptionsFromEnv() Options {
+	options := DefaultOptions()
+
+	if value := os.Getenv("SSE_KEEPALIVE"); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			options.Keepalive = d
+		}
+	}
+
+	if value := os.Getenv("SSE_BUFFER_SIZE"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			options.BufferSize = n
+		}
+	}
+
+	if value := os.Getenv("SSE_CLEANUP_INTERVAL"); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			options.CleanupInterval = d
+		}
+	}
+
+	if value := os.Getenv("SSE_INACTIVITY_TIMEOUT"); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			options.InactivityTimeout = d
+		}
+	}
+
+	return options
+}
+
+// SetOptions changes the client options. The keep-alive interval and buffer size
+// apply to clients that connect afterwards.
+func (s *Server) SetOptions(options Options) {
+	s.clientsMutex.Lock()
+	defer s.clientsMutex.Unlock()
+
+	if options.CleanupInterval != s.options.CleanupInterval {
+		s.cleanupTicker.Reset(options.CleanupInterval)
+	}
+	s.options = options
+}
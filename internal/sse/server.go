@@ -2,16 +2,19 @@ package sse
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/piske-alex/go-sse/internal/codec"
+	"github.com/piske-alex/go-sse/internal/logging"
 	"github.com/piske-alex/go-sse/internal/store"
 	"github.com/piske-alex/go-sse/internal/query"
+	"github.com/piske-alex/go-sse/internal/view"
 )
 
 // Server manages SSE client connections and broadcasting
@@ -23,20 +26,42 @@ type Server struct {
 	cleanupTicker  *time.Ticker
 	cleanupContext context.Context
 	cleanupCancel  context.CancelFunc
+	views          *view.Registry // Views computed from the store
+	listeners      []EventListener
+	listenersMutex sync.RWMutex
+	draining       atomic.Bool  // Set once Drain starts, new clients are rejected
+	drainOptions   DrainOptions // Options of the running drain
+	// Connections per limit key, capped by maxClientsPerKey
+	clientsPerKey    map[string]int
+	maxClientsPerKey int
+	rejectedFull     atomic.Int64
+	rejectedPerKey   atomic.Int64
+	options          Options // Client queue, keep-alive and cleanup settings
+	// Broadcast events are numbered within an epoch unique to this server
+	epoch    string
+	eventSeq atomic.Uint64
 }
 
+// EventListener is called with every event broadcast by the server
+type EventListener func(path string, value interface{}, eventType string)
+
 // NewServer creates a new SSE server instance
 func NewServer(dataStore store.Store) *Server {
 	cleanupCtx, cleanupCancel := context.WithCancel(context.Background())
+	options := DefaultOptions()
 
 	s := &Server{
 		store:          dataStore,
 		clients:        make(map[string]*Client),
 		clientsMutex:   sync.RWMutex{},
 		maxClients:     10000, // Maximum number of clients
-		cleanupTicker:  time.NewTicker(5 * time.Minute),
+		cleanupTicker:  time.NewTicker(options.CleanupInterval),
 		cleanupContext: cleanupCtx,
 		cleanupCancel:  cleanupCancel,
+		views:          view.NewRegistry(dataStore),
+		clientsPerKey:  make(map[string]int),
+		options:        options,
+		epoch:          newEpoch(),
 	}
 
 	// MongoDB specific operations need to be handled differently since MongoStore is custom type
@@ -54,33 +79,90 @@ func NewServer(dataStore store.Store) *Server {
 		})
 	}
 
+	// Notify subscribers when keys written with a TTL expire
+	dataStore.SetExpiryListener(func(path string, value interface{}) {
+		s.BroadcastEvent(path, value, "expire")
+	})
+
 	// Start the cleanup goroutine
 	go s.startCleanup()
 
 	return s
 }
 
+// ClientOptions holds optional per-connection settings
+type ClientOptions struct {
+	// SendInitialData sends the current store contents right after connecting
+	SendInitialData bool
+	// Encoding selects the event payload encoding; JSON is used when nil
+	Encoding codec.Codec
+	// View subscribes the client to a registered view instead of store paths
+	View string
+	// RemoteIP overrides the IP taken from the request, e.g. when behind a trusted proxy
+	RemoteIP string
+	// LimitKey identifies the IP or principal the per-key client limit applies to;
+	// the remote IP is used when empty
+	LimitKey string
+	// LastEventID is the ID of the last event a reconnecting client received. When it is
+	// the server's last event ID, nothing was missed and the initial data is not sent again.
+	LastEventID string
+}
+
 // AddClient adds a new client connection
 func (s *Server) AddClient(w http.ResponseWriter, r *http.Request, filterExprs []string, sendInitialData bool) (*Client, error) {
-	// Check if we've reached max clients
-	s.clientsMutex.RLock()
-	if len(s.clients) >= s.maxClients {
-		s.clientsMutex.RUnlock()
-		return nil, http.ErrHandlerTimeout
+	return s.AddClientWithOptions(w, r, filterExprs, ClientOptions{SendInitialData: sendInitialData})
+}
+
+// AddClientWithOptions adds a new client connection using the given options
+func (s *Server) AddClientWithOptions(w http.ResponseWriter, r *http.Request, filterExprs []string, opts ClientOptions) (*Client, error) {
+	// Reject new clients while draining
+	if s.draining.Load() {
+		return nil, ErrDraining
 	}
-	s.clientsMutex.RUnlock()
 
 	// Create a new client
-	client, err := NewClient(w, filterExprs)
+	s.clientsMutex.RLock()
+	options := s.options
+	s.clientsMutex.RUnlock()
+	client, err := newClient(w, filterExprs, options)
 	if err != nil {
 		return nil, err
 	}
+	client.SetRequest(r)
+	if opts.RemoteIP != "" {
+		client.RemoteIP = opts.RemoteIP
+	}
+	client.limitKey = opts.LimitKey
+	if client.limitKey == "" {
+		client.limitKey = client.RemoteIP
+	}
 
-	// Add client to the server
+	if opts.Encoding != nil {
+		client.SetEncoding(opts.Encoding)
+	}
+	if opts.View != "" {
+		client.SetView(opts.View)
+	}
+
+	// Add client to the server, unless a drain started since the check above or a limit is reached
 	s.clientsMutex.Lock()
+	if s.draining.Load() {
+		s.clientsMutex.Unlock()
+		client.CancelFunc()
+		return nil, ErrDraining
+	}
+	if err := s.checkLimits(client.limitKey); err != nil {
+		s.clientsMutex.Unlock()
+		client.CancelFunc()
+		return nil, err
+	}
 	s.clients[client.ID] = client
+	s.clientsPerKey[client.limitKey]++
 	s.clientsMutex.Unlock()
 
+	// Events from now on reach the client, so it missed none if it saw the last one
+	resumed := opts.LastEventID != "" && opts.LastEventID == s.LastEventID()
+
 	// Start processing client messages
 	client.ProcessMessages()
 
@@ -91,11 +173,29 @@ func (s *Server) AddClient(w http.ResponseWriter, r *http.Request, filterExprs [
 	}()
 
 	// Send initial connection event
-	client.Send("connected", map[string]string{"id": client.ID})
+	client.Send("connected", map[string]string{
+		"id":       client.ID,
+		"encoding": client.Encoding.Name(),
+		"resumed":  strconv.FormatBool(resumed),
+	})
 
 	// If sendInitialData is false, skip sending the initial data
-	if !sendInitialData {
-		log.Printf("Skipping initial data for client %s as requested", client.ID)
+	if !opts.SendInitialData {
+		logging.Debugf("Skipping initial data for client %s as requested", client.ID)
+		return client, nil
+	}
+
+	// A resumed client already has the data
+	if resumed {
+		logging.Debugf("Client %s resumed after event %s, skipping initial data", client.ID, opts.LastEventID)
+		return client, nil
+	}
+
+	// View clients receive the current value of the view
+	if client.View != "" {
+		if v, ok := s.views.Get(client.View); ok {
+			client.Send("initial_data", viewEventData(v))
+		}
 		return client, nil
 	}
 
@@ -106,27 +206,27 @@ func (s *Server) AddClient(w http.ResponseWriter, r *http.Request, filterExprs [
 	// Try to respect filters if they exist
 	if len(client.Filters) > 0 {
 		// Get the root data first
-		log.Printf("Fetching initial data with %d filters for client %s", len(client.Filters), client.ID)
+		logging.Debugf("Fetching initial data with %d filters for client %s", len(client.Filters), client.ID)
 		rootData, err := s.store.Get(".")
 		if err != nil {
-			log.Printf("Error fetching initial data for client %s: %v", client.ID, err)
+			logging.Errorf("Error fetching initial data for client %s: %v", client.ID, err)
 		} else if rootData != nil {
 			// Create a map to deduplicate filtered data
 			sent := make(map[string]bool)
 			
 			// For each filter, try to find matching data
 			for _, filter := range client.Filters {
-				log.Printf("Processing filter '%s' for client %s", filter.Expression, client.ID)
+				logging.Debugf("Processing filter '%s' for client %s", filter.Expression, client.ID)
 				
 				// Check if this filter has key-value conditions
 				hasConditions := len(filter.Conditions) > 0
 				if hasConditions {
-					log.Printf("Filter has %d key-value conditions: %+v", len(filter.Conditions), filter.Conditions)
+					logging.Debugf("Filter has %d key-value conditions: %+v", len(filter.Conditions), filter.Conditions)
 				}
 				
 				// Simple case: if filter is "." or empty, send all data
 				if filter.Path == "." || filter.Path == "" {
-					log.Printf("Filter is root path, sending all data to client %s", client.ID)
+					logging.Debugf("Filter is root path, sending all data to client %s", client.ID)
 					
 					// If we have conditions, we need to filter the root data
 					if hasConditions && rootData != nil {
@@ -138,11 +238,11 @@ func (s *Server) AddClient(w http.ResponseWriter, r *http.Request, filterExprs [
 								for field, value := range dataField {
 									// For array data, apply key-value filtering
 									if arrayData, isArray := value.([]interface{}); isArray && len(arrayData) > 0 {
-										log.Printf("Applying key-value filtering to initial data field: %s", field)
+										logging.Debugf("Applying key-value filtering to initial data field: %s", field)
 										
 										// Use the common filtering function to ensure consistent behavior
 										if filteredValue, success := applyKeyValueFilters(arrayData, filter.Conditions); success {
-											log.Printf("Key-value filtering reduced array from %d items to %d items", 
+											logging.Debugf("Key-value filtering reduced array from %d items to %d items", 
 												len(arrayData), len(filteredValue.([]interface{})))
 											
 											// If we have filtered results, send them
@@ -175,14 +275,14 @@ func (s *Server) AddClient(w http.ResponseWriter, r *http.Request, filterExprs [
 				}
 				
 				// Try to get data for the specific filter path
-				log.Printf("Attempting direct path lookup for '%s' for client %s", filter.Path, client.ID)
+				logging.Debugf("Attempting direct path lookup for '%s' for client %s", filter.Path, client.ID)
 				data, err := s.store.Get(filter.Path)
 				if err != nil {
 					// If direct path doesn't work, try pattern matching
-					log.Printf("Direct path lookup failed, trying pattern matching for '%s' for client %s", filter.Path, client.ID)
+					logging.Debugf("Direct path lookup failed, trying pattern matching for '%s' for client %s", filter.Path, client.ID)
 					matches, err := s.store.FindMatches(filter.Path) 
 					if err == nil && len(matches) > 0 {
-						log.Printf("Found %d pattern matches for '%s' for client %s", len(matches), filter.Path, client.ID)
+						logging.Debugf("Found %d pattern matches for '%s' for client %s", len(matches), filter.Path, client.ID)
 						// Send each match that hasn't been sent yet
 						for _, match := range matches {
 							if !sent[match.Path] {
@@ -191,7 +291,7 @@ func (s *Server) AddClient(w http.ResponseWriter, r *http.Request, filterExprs [
 								if hasConditions {
 									// Use the common filtering function to ensure consistent behavior
 									if filteredValue, success := applyKeyValueFilters(valueToSend, filter.Conditions); success {
-										log.Printf("Applied key-value filtering to initial data match %s", match.Path)
+										logging.Debugf("Applied key-value filtering to initial data match %s", match.Path)
 										valueToSend = filteredValue
 									}
 								}
@@ -200,7 +300,7 @@ func (s *Server) AddClient(w http.ResponseWriter, r *http.Request, filterExprs [
 								// For arrays, check if there are any items left
 								shouldSend := true
 								if array, isArray := valueToSend.([]interface{}); isArray && len(array) == 0 {
-									log.Printf("Skipping empty array result after filtering for %s", match.Path)
+									logging.Debugf("Skipping empty array result after filtering for %s", match.Path)
 									shouldSend = false
 								}
 								
@@ -215,12 +315,12 @@ func (s *Server) AddClient(w http.ResponseWriter, r *http.Request, filterExprs [
 									}
 									client.Send("initial_data", eventData)
 									sent[match.Path] = true
-									log.Printf("Sent filtered initial data for %s to client %s", match.Path, client.ID)
+									logging.Debugf("Sent filtered initial data for %s to client %s", match.Path, client.ID)
 								}
 							}
 						}
 					} else {
-						log.Printf("No pattern matches found for '%s' for client %s: %v", filter.Path, client.ID, err)
+						logging.Debugf("No pattern matches found for '%s' for client %s: %v", filter.Path, client.ID, err)
 					}
 				} else if data != nil {
 					if !sent[filter.Path] {
@@ -229,7 +329,7 @@ func (s *Server) AddClient(w http.ResponseWriter, r *http.Request, filterExprs [
 						if hasConditions {
 							// Use the common filtering function to ensure consistent behavior
 							if filteredValue, success := applyKeyValueFilters(valueToSend, filter.Conditions); success {
-								log.Printf("Applied key-value filtering to initial data for path %s", filter.Path)
+								logging.Debugf("Applied key-value filtering to initial data for path %s", filter.Path)
 								valueToSend = filteredValue
 							}
 						}
@@ -238,7 +338,7 @@ func (s *Server) AddClient(w http.ResponseWriter, r *http.Request, filterExprs [
 						// For arrays, check if there are any items left
 						shouldSend := true
 						if array, isArray := valueToSend.([]interface{}); isArray && len(array) == 0 {
-							log.Printf("Skipping empty array result after filtering for %s", filter.Path)
+							logging.Debugf("Skipping empty array result after filtering for %s", filter.Path)
 							shouldSend = false
 						}
 						
@@ -253,17 +353,17 @@ func (s *Server) AddClient(w http.ResponseWriter, r *http.Request, filterExprs [
 							}
 							client.Send("initial_data", eventData)
 							sent[filter.Path] = true
-							log.Printf("Sent filtered initial data for %s to client %s", filter.Path, client.ID)
+							logging.Debugf("Sent filtered initial data for %s to client %s", filter.Path, client.ID)
 						}
 					}
 				} else {
-					log.Printf("No data found for filter path '%s' for client %s", filter.Path, client.ID)
+					logging.Debugf("No data found for filter path '%s' for client %s", filter.Path, client.ID)
 				}
 			}
 		}
 	} else {
 		// No specific filters, just send the root data
-		log.Printf("No filters specified, sending root data to client %s", client.ID)
+		logging.Debugf("No filters specified, sending root data to client %s", client.ID)
 		initialData, err := s.store.Get(".")
 		if err == nil && initialData != nil {
 			eventData := map[string]interface{}{
@@ -272,10 +372,10 @@ func (s *Server) AddClient(w http.ResponseWriter, r *http.Request, filterExprs [
 				"time":  time.Now().UnixNano() / int64(time.Millisecond),
 			}
 			client.Send("initial_data", eventData)
-			log.Printf("Successfully sent root data to client %s", client.ID)
+			logging.Debugf("Successfully sent root data to client %s", client.ID)
 		} else {
 			// Log error but don't fail the connection
-			log.Printf("Error fetching initial data for client %s: %v", client.ID, err)
+			logging.Errorf("Error fetching initial data for client %s: %v", client.ID, err)
 		}
 	}
 
@@ -298,29 +398,48 @@ func (s *Server) RemoveClient(clientID string) {
 
 	// Remove from clients map
 	delete(s.clients, clientID)
+	if s.clientsPerKey[client.limitKey]--; s.clientsPerKey[client.limitKey] <= 0 {
+		delete(s.clientsPerKey, client.limitKey)
+	}
 }
 
-// BroadcastEvent sends an event to all matching clients
+// BroadcastEvent sends an event to all matching clients.
+// Clients that share a view (same filters and encoding) share one encoded frame,
+// so the event is marshalled once per distinct view rather than once per client.
 func (s *Server) BroadcastEvent(path string, value interface{}, eventType string) {
-	// Log the original event data
-	log.Printf("DEBUG: BroadcastEvent called with path: %s, eventType: %s", path, eventType)
-	
-	// Check if the path contains key-value conditions
-	if strings.Contains(path, "[") && strings.Contains(path, "=") && strings.Contains(path, "]") {
-		log.Printf("DEBUG: Path contains key-value conditions: %s", path)
+	// Log the original event data, checking the level first to keep this path cheap
+	if logging.Enabled(logging.Debug) {
+		logging.Debugf("BroadcastEvent called with path: %s, eventType: %s", path, eventType)
+
+		// Check if the path contains key-value conditions
+		if strings.Contains(path, "[") && strings.Contains(path, "=") && strings.Contains(path, "]") {
+			logging.Debugf("Path contains key-value conditions: %s", path)
+		}
 	}
 	
+	// Pass the event on to listeners outside the SSE connections
+	s.listenersMutex.RLock()
+	for _, listener := range s.listeners {
+		listener(path, value, eventType)
+	}
+	s.listenersMutex.RUnlock()
+
+	// Number the event before collecting the clients to notify
+	eventID := s.nextEventID()
+
 	// Create a list of clients to notify
 	s.clientsMutex.RLock()
 	var clientsToNotify []*Client
 	for _, client := range s.clients {
-		if client.ShouldNotify(path, value) {
+		if client.View == "" && client.ShouldNotify(path, value) {
 			clientsToNotify = append(clientsToNotify, client)
 		}
 	}
 	s.clientsMutex.RUnlock()
 	
-	log.Printf("DEBUG: Found %d clients to notify", len(clientsToNotify))
+	if logging.Enabled(logging.Debug) {
+		logging.Debugf("Found %d clients to notify", len(clientsToNotify))
+	}
 
 	// Create the event payload
 	eventData := map[string]interface{}{
@@ -329,174 +448,205 @@ func (s *Server) BroadcastEvent(path string, value interface{}, eventType string
 		"time":  time.Now().UnixNano() / int64(time.Millisecond),
 	}
 
-	// Send to all matching clients
+	// Encode the event once per distinct view and fan the frame out
+	frames := make(map[string][]byte)
 	for _, client := range clientsToNotify {
-		// Log filters for this client
-		filterPaths := make([]string, 0, len(client.Filters))
-		for _, f := range client.Filters {
-			filterPaths = append(filterPaths, f.Expression) // Use Expression instead of Path to include conditions
+		frame, ok := frames[client.viewKey]
+		if !ok {
+			var err error
+			frame, err = client.encodeFrame(eventType, buildViewEvent(client.Filters, path, value, eventData))
+			if err != nil {
+				logging.Errorf("Error encoding event for client %s: %v", client.ID, err)
+				continue
+			}
+			frame = withEventID(frame, eventID)
+			frames[client.viewKey] = frame
 		}
-		log.Printf("DEBUG: Client %s has filters: %v", client.ID, filterPaths)
+
+		client.enqueue(frame)
+	}
+
+	// Recompute the views that read the changed path
+	for _, v := range s.views.Refresh(path) {
+		s.BroadcastView(v, "update")
+	}
+}
+
+// BroadcastWrite sends the event of a write made through the server. Writes to a store
+// whose change stream reports them are left to the stream, so each change is sent once.
+func (s *Server) BroadcastWrite(path string, value interface{}, eventType string) {
+	if mongoStore, ok := s.store.(*store.MongoStore); ok && mongoStore.ReportsWrites() {
+		return
+	}
+	s.BroadcastEvent(path, value, eventType)
+}
+
+// BroadcastView sends the value of a view to the clients subscribed to it
+func (s *Server) BroadcastView(v view.View, eventType string) {
+	s.clientsMutex.RLock()
+	var clientsToNotify []*Client
+	for _, client := range s.clients {
+		if client.View == v.Name {
+			clientsToNotify = append(clientsToNotify, client)
+		}
+	}
+	s.clientsMutex.RUnlock()
+
+	if len(clientsToNotify) == 0 {
+		return
+	}
+
+	// Subscribers of a view only differ by encoding, so encode once per encoding
+	eventData := viewEventData(v)
+	frames := make(map[string][]byte)
+	for _, client := range clientsToNotify {
+		frame, ok := frames[client.viewKey]
+		if !ok {
+			var err error
+			frame, err = client.encodeFrame(eventType, eventData)
+			if err != nil {
+				logging.Errorf("Error encoding view event for client %s: %v", client.ID, err)
+				continue
+			}
+			frames[client.viewKey] = frame
+		}
+
+		client.enqueue(frame)
+	}
+}
+
+// viewEventData builds the event payload carrying the value of a view
+func viewEventData(v view.View) map[string]interface{} {
+	return map[string]interface{}{
+		"view":  v.Name,
+		"path":  ".",
+		"value": v.Value,
+		"time":  time.Now().UnixNano() / int64(time.Millisecond),
+	}
+}
+
+// buildViewEvent narrows the event data to what a set of filters asked for.
+// It returns eventData unchanged when there are no filters and a modified copy otherwise.
+func buildViewEvent(filters []*query.Filter, path string, value interface{}, eventData map[string]interface{}) map[string]interface{} {
+	if len(filters) == 0 {
+		return eventData
+	}
+
+
+	// Create a copy of the event data to modify for this client
+	clientEventData := make(map[string]interface{})
+	for k, v := range eventData {
+		clientEventData[k] = v
+	}
+	
+	// Check each filter to see if it's a specific field request
+	for _, filter := range filters {
+		
+		// Check if this filter has conditions (key-value filters)
+		hasConditions := len(filter.Conditions) > 0
 		
-		// For each client, check if we need to apply filter transformation
-		if len(client.Filters) > 0 {
-			// Create a copy of the event data to modify for this client
-			clientEventData := make(map[string]interface{})
-			for k, v := range eventData {
-				clientEventData[k] = v
+		// Generic filtering approach for any data path
+		// Case 1: If we're at the exact path the client is filtering for
+		if path == filter.Path {
+			// Already the exact path, no need to filter path further
+			clientEventData["filtered"] = true
+			
+			// If there are conditions, we need to filter the data by those conditions
+			if hasConditions {
+				if filteredValue, success := applyKeyValueFilters(value, filter.Conditions); success {
+					clientEventData["value"] = filteredValue
+					clientEventData["key_value_filtered"] = true
+				}
 			}
 			
-			// Check each filter to see if it's a specific field request
-			for _, filter := range client.Filters {
-				log.Printf("DEBUG: Processing filter %s against path %s", filter.Expression, path)
+			break
+		}
+		
+		// Case 2: If the client filter is more specific than our current path
+		// Example: client wants .data.offers but we're broadcasting .data
+		if strings.HasPrefix(filter.Path, path) && len(filter.Path) > len(path) {
+			// Need to extract just the part they want
+			remainingPath := filter.Path[len(path):]
+			if strings.HasPrefix(remainingPath, ".") {
+				// If our path is a prefix of the filter path, try to extract the specific data
+				// Example: extract only "offers" from "data" when filter is "data.offers"
+				extractPath := remainingPath
 				
-				// Check if this filter has conditions (key-value filters)
-				hasConditions := len(filter.Conditions) > 0
-				if hasConditions {
-					log.Printf("DEBUG: Filter has %d conditions: %+v", len(filter.Conditions), filter.Conditions)
-				}
+				// Create a matcher to extract the specific field
+				matcher := query.NewMatcher()
 				
-				// Generic filtering approach for any data path
-				// Case 1: If we're at the exact path the client is filtering for
-				if path == filter.Path {
-					// Already the exact path, no need to filter path further
+				// Try to get the specific field
+				filteredValue, err := matcher.Get(value, extractPath)
+				if err == nil {
+					// Replace the full data with just the filtered data
+					clientEventData["value"] = filteredValue
 					clientEventData["filtered"] = true
 					
-					// If there are conditions, we need to filter the data by those conditions
+					// If there are conditions, apply key-value filtering
 					if hasConditions {
-						if filteredValue, success := applyKeyValueFilters(value, filter.Conditions); success {
-							log.Printf("DEBUG: Applied key-value filtering to exact path match. Before: %T %+v, After: %T %+v", 
-								value, value, filteredValue, filteredValue)
-							clientEventData["value"] = filteredValue
+						if kv_filtered, success := applyKeyValueFilters(filteredValue, filter.Conditions); success {
+							clientEventData["value"] = kv_filtered
 							clientEventData["key_value_filtered"] = true
 						}
 					}
 					
-					log.Printf("DEBUG: Exact path match, filtering applied: %v", hasConditions)
 					break
 				}
-				
-				// Case 2: If the client filter is more specific than our current path
-				// Example: client wants .data.offers but we're broadcasting .data
-				if strings.HasPrefix(filter.Path, path) && len(filter.Path) > len(path) {
-					// Need to extract just the part they want
-					remainingPath := filter.Path[len(path):]
-					if strings.HasPrefix(remainingPath, ".") {
-						// If our path is a prefix of the filter path, try to extract the specific data
-						// Example: extract only "offers" from "data" when filter is "data.offers"
-						extractPath := remainingPath
-						log.Printf("DEBUG: Filter is more specific than broadcast path. Extracting from %s using %s", path, extractPath)
+			}
+		}
+		
+		// Case 3: If we're broadcasting a more specific path than the client filter
+		// Example: client wants .data but we're broadcasting .data.offers
+		if strings.HasPrefix(path, filter.Path) && len(path) > len(filter.Path) {
+			// This is already handled by ShouldNotify, but we mark it as filtered
+			clientEventData["filtered"] = true
+			
+			// If there are conditions, we need to apply them
+			if hasConditions {
+				// Apply key-value filtering to the data
+				if filteredValue, success := applyKeyValueFilters(value, filter.Conditions); success {
+					clientEventData["value"] = filteredValue
+					clientEventData["key_value_filtered"] = true
+				}
+			}
+			
+			break
+		}
+		
+		// Case 4: Specific handling for structured paths like .data.X
+		// This handles cases where the paths don't strictly have a prefix relationship
+		// but the value might contain the requested data
+		if strings.HasPrefix(filter.Path, ".data.") && strings.HasPrefix(path, ".data") {
+			// Extract what the client is looking for (after .data.)
+			clientTarget := strings.TrimPrefix(filter.Path, ".data.")
+			
+			// Check if value has this specific field
+			if valueMap, ok := value.(map[string]interface{}); ok {
+				if data, ok := valueMap["data"].(map[string]interface{}); ok {
+					// We have a data field in our value, check if it contains what client wants
+					if targetValue, exists := data[clientTarget]; exists {
 						
-						// Create a matcher to extract the specific field
-						matcher := query.NewMatcher()
+						// Get the target value
+						filteredValue := targetValue
 						
-						// Try to get the specific field
-						filteredValue, err := matcher.Get(value, extractPath)
-						if err == nil {
-							// Replace the full data with just the filtered data
-							clientEventData["value"] = filteredValue
-							clientEventData["filtered"] = true
-							
-							// If there are conditions, apply key-value filtering
-							if hasConditions {
-								if kv_filtered, success := applyKeyValueFilters(filteredValue, filter.Conditions); success {
-									log.Printf("DEBUG: Applied key-value filtering to extracted path. Before: %T %+v, After: %T %+v", 
-										filteredValue, filteredValue, kv_filtered, kv_filtered)
-									clientEventData["value"] = kv_filtered
-									clientEventData["key_value_filtered"] = true
-								}
+						// Apply key-value filtering if needed
+						if hasConditions {
+							if kv_filtered, success := applyKeyValueFilters(filteredValue, filter.Conditions); success {
+								filteredValue = kv_filtered
+								clientEventData["key_value_filtered"] = true
 							}
-							
-							log.Printf("DEBUG: Successfully extracted specific value for %s", filter.Path)
-							break
-						} else {
-							log.Printf("DEBUG: Failed to extract specific value: %v", err)
 						}
-					}
-				}
-				
-				// Case 3: If we're broadcasting a more specific path than the client filter
-				// Example: client wants .data but we're broadcasting .data.offers
-				if strings.HasPrefix(path, filter.Path) && len(path) > len(filter.Path) {
-					// This is already handled by ShouldNotify, but we mark it as filtered
-					clientEventData["filtered"] = true
-					
-					// If there are conditions, we need to apply them
-					if hasConditions {
-						// Extract the field we're interested in
-						fieldName := strings.TrimPrefix(path, filter.Path+".")
 						
-						// Apply key-value filtering to the data
-						if filteredValue, success := applyKeyValueFilters(value, filter.Conditions); success {
-							log.Printf("DEBUG: Applied key-value filtering to more specific path %s with field %s. Before: %T %+v, After: %T %+v", 
-								path, fieldName, value, value, filteredValue, filteredValue)
-							clientEventData["value"] = filteredValue
-							clientEventData["key_value_filtered"] = true
-						}
-					}
-					
-					log.Printf("DEBUG: Broadcast path is more specific than filter, client will receive it")
-					break
-				}
-				
-				// Case 4: Specific handling for structured paths like .data.X
-				// This handles cases where the paths don't strictly have a prefix relationship
-				// but the value might contain the requested data
-				if strings.HasPrefix(filter.Path, ".data.") && strings.HasPrefix(path, ".data") {
-					// Extract what the client is looking for (after .data.)
-					clientTarget := strings.TrimPrefix(filter.Path, ".data.")
-					
-					// Check if value has this specific field
-					if valueMap, ok := value.(map[string]interface{}); ok {
-						if data, ok := valueMap["data"].(map[string]interface{}); ok {
-							// We have a data field in our value, check if it contains what client wants
-							if targetValue, exists := data[clientTarget]; exists {
-								log.Printf("DEBUG: Found direct match for %s in data map", clientTarget)
-								
-								// Get the target value
-								filteredValue := targetValue
-								
-								// Apply key-value filtering if needed
-								if hasConditions {
-									if kv_filtered, success := applyKeyValueFilters(filteredValue, filter.Conditions); success {
-										log.Printf("DEBUG: Applied key-value filtering to data field. Before: %T %+v, After: %T %+v", 
-											filteredValue, filteredValue, kv_filtered, kv_filtered)
-										filteredValue = kv_filtered
-										clientEventData["key_value_filtered"] = true
-									}
-								}
-								
-								clientEventData["value"] = filteredValue
-								clientEventData["filtered"] = true
-								break
-							}
-						}
+						clientEventData["value"] = filteredValue
+						clientEventData["filtered"] = true
+						break
 					}
 				}
 			}
-			
-			// Log the final data structure
-			valueType := fmt.Sprintf("%T", clientEventData["value"])
-			log.Printf("DEBUG: Final event data type: %s", valueType)
-			
-			// For array values, log the length and sample
-			if array, ok := clientEventData["value"].([]interface{}); ok {
-				log.Printf("DEBUG: Final array length: %d", len(array))
-				if len(array) > 0 {
-					log.Printf("DEBUG: First item sample: %+v", array[0])
-				}
-			}
-			
-			jsonData, _ := json.Marshal(clientEventData)
-			log.Printf("DEBUG: Final event data to send: %s", string(jsonData))
-			
-			// Send the possibly modified event data
-			client.Send(eventType, clientEventData)
-		} else {
-			// No filters, send the original event data
-			client.Send(eventType, eventData)
 		}
 	}
+	
+	return clientEventData
 }
 
 // applyKeyValueFilters filters an array of items based on key-value conditions
@@ -595,6 +745,7 @@ func (s *Server) Shutdown() {
 		client.Close()
 		delete(s.clients, id)
 	}
+	s.clientsPerKey = make(map[string]int)
 
 	// MongoDB specific shutdown
 	if mongoStore, ok := s.store.(*store.MongoStore); ok {
@@ -605,6 +756,73 @@ func (s *Server) Shutdown() {
 	}
 }
 
+// AddEventListener registers a listener called with every event broadcast to clients
+func (s *Server) AddEventListener(listener EventListener) {
+	s.listenersMutex.Lock()
+	defer s.listenersMutex.Unlock()
+	s.listeners = append(s.listeners, listener)
+}
+
+// Views returns the views computed from the server's store
+func (s *Server) Views() *view.Registry {
+	return s.views
+}
+
+// SetMaxClients changes the maximum number of connected clients
+func (s *Server) SetMaxClients(maxClients int) {
+	s.clientsMutex.Lock()
+	defer s.clientsMutex.Unlock()
+	s.maxClients = maxClients
+}
+
+// Clients describes the connected clients, oldest first
+func (s *Server) Clients() []ClientInfo {
+	s.clientsMutex.RLock()
+	infos := make([]ClientInfo, 0, len(s.clients))
+	for _, client := range s.clients {
+		infos = append(infos, client.Info())
+	}
+	s.clientsMutex.RUnlock()
+
+	sortClientInfos(infos)
+	return infos
+}
+
+// Client describes a connected client
+func (s *Server) Client(clientID string) (ClientInfo, bool) {
+	s.clientsMutex.RLock()
+	defer s.clientsMutex.RUnlock()
+
+	client, exists := s.clients[clientID]
+	if !exists {
+		return ClientInfo{}, false
+	}
+	return client.Info(), true
+}
+
+// DisconnectClient closes a client's stream. With a reason, the client is sent a disconnect
+// event before the stream ends. It reports false if the client is not connected.
+func (s *Server) DisconnectClient(clientID, reason string) bool {
+	s.clientsMutex.RLock()
+	client, exists := s.clients[clientID]
+	s.clientsMutex.RUnlock()
+	if !exists {
+		return false
+	}
+
+	if reason == "" || client.SendDisconnect(reason) != nil {
+		s.RemoveClient(clientID)
+	}
+	return true
+}
+
+// MaxClients returns the maximum number of connected clients
+func (s *Server) MaxClients() int {
+	s.clientsMutex.RLock()
+	defer s.clientsMutex.RUnlock()
+	return s.maxClients
+}
+
 // ClientCount returns the number of connected clients
 func (s *Server) ClientCount() int {
 	s.clientsMutex.RLock()
@@ -626,14 +844,12 @@ func (s *Server) startCleanup() {
 
 // cleanupInactiveClients removes clients that haven't had activity in a while
 func (s *Server) cleanupInactiveClients() {
-	// Set the inactivity threshold (2 minutes)
-	inactivityThreshold := time.Now().Add(-2 * time.Minute)
-
 	// Collect inactive client IDs
 	s.clientsMutex.RLock()
+	inactivityThreshold := time.Now().Add(-s.options.InactivityTimeout)
 	var inactiveClients []string
 	for id, client := range s.clients {
-		if client.LastActivity.Before(inactivityThreshold) {
+		if client.LastActivity().Before(inactivityThreshold) {
 			inactiveClients = append(inactiveClients, id)
 		}
 	}
@@ -4,11 +4,15 @@ import (
 	"context"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/piske-alex/go-sse/internal/codec"
 	"github.com/piske-alex/go-sse/internal/sse"
 	"github.com/piske-alex/go-sse/internal/store"
+	"github.com/piske-alex/go-sse/internal/view"
 )
 
 func TestServer_ClientManagement(t *testing.T) {
@@ -35,7 +39,7 @@ func TestServer_ClientManagement(t *testing.T) {
 	r = r.WithContext(ctx)
 
 	// Add a client
-	client, err := sseServer.AddClient(w, r, []string{".users[*].status"})
+	_, err := sseServer.AddClient(w, r, []string{".users[*].status"}, true)
 	if err != nil {
 		t.Fatalf("Failed to add client: %v", err)
 	}
@@ -84,7 +88,7 @@ func TestServer_BroadcastEvent(t *testing.T) {
 	r := httptest.NewRequest("GET", "/events", nil)
 
 	// Create a client with a specific filter
-	client, err := sseServer.AddClient(w, r, []string{".users[*].status"})
+	client, err := sseServer.AddClient(w, r, []string{".users[*].status"}, true)
 	if err != nil {
 		t.Fatalf("Failed to add client: %v", err)
 	}
@@ -95,12 +99,6 @@ func TestServer_BroadcastEvent(t *testing.T) {
 	// Wait a bit for the event to be processed
 	time.Sleep(100 * time.Millisecond)
 
-	// Check the response
-	resp := w.Result()
-	if resp.Header.Get("Content-Type") != "text/event-stream" {
-		t.Errorf("Expected Content-Type to be text/event-stream, got %s", resp.Header.Get("Content-Type"))
-	}
-
 	// Clean up
 	sseServer.RemoveClient(client.ID)
 
@@ -109,4 +107,205 @@ func TestServer_BroadcastEvent(t *testing.T) {
 	if count != 0 {
 		t.Fatalf("Expected client count to be 0 after removal, got %d", count)
 	}
+
+	// The recorder is only safe to read once the client has stopped writing to it
+	select {
+	case <-client.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for the client to stop writing")
+	}
+
+	// Check the response
+	resp := w.Result()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Errorf("Expected Content-Type to be text/event-stream, got %s", resp.Header.Get("Content-Type"))
+	}
+	if !strings.Contains(w.Body.String(), "event: update\n") {
+		t.Errorf("Expected the update event, got %q", w.Body.String())
+	}
+}
+
+// lockedResponseWriter is a flushable ResponseWriter that records writes safely across goroutines
+type lockedResponseWriter struct {
+	mu     sync.Mutex
+	header http.Header
+	body   strings.Builder
+}
+
+func (w *lockedResponseWriter) Header() http.Header { return w.header }
+func (w *lockedResponseWriter) WriteHeader(int)     {}
+func (w *lockedResponseWriter) Flush()              {}
+
+func (w *lockedResponseWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.body.Write(p)
+}
+
+func (w *lockedResponseWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.body.String()
+}
+
+func TestServer_BroadcastSharedView(t *testing.T) {
+	kvStore := store.NewStore()
+	sseServer := sse.NewServer(kvStore)
+	defer sseServer.Shutdown()
+
+	// Two clients share a view, a third asks for a different encoding
+	writers := []*lockedResponseWriter{
+		{header: http.Header{}},
+		{header: http.Header{}},
+		{header: http.Header{}},
+	}
+	encodings := []codec.Codec{codec.JSON, codec.JSON, codec.MsgPack}
+
+	for i, w := range writers {
+		r := httptest.NewRequest("GET", "/events", nil)
+		_, err := sseServer.AddClientWithOptions(w, r, []string{".users"}, sse.ClientOptions{Encoding: encodings[i]})
+		if err != nil {
+			t.Fatalf("Failed to add client %d: %v", i, err)
+		}
+	}
+
+	sseServer.BroadcastEvent(".users[0].status", "away", "update")
+
+	// Wait a bit for the events to be written
+	time.Sleep(100 * time.Millisecond)
+
+	frameOf := func(w *lockedResponseWriter) string {
+		body := w.String()
+		idx := strings.Index(body, "event: update\n")
+		if idx < 0 {
+			t.Fatalf("Expected an update event, got %q", body)
+		}
+		return body[idx:]
+	}
+
+	if frameOf(writers[0]) != frameOf(writers[1]) {
+		t.Errorf("Expected clients sharing a view to receive identical frames")
+	}
+	if !strings.Contains(frameOf(writers[0]), `"value":"away"`) {
+		t.Errorf("Expected JSON payload, got %q", frameOf(writers[0]))
+	}
+	if frameOf(writers[2]) == frameOf(writers[0]) {
+		t.Errorf("Expected a different frame for the msgpack client")
+	}
+}
+
+func TestServer_ExpireEvent(t *testing.T) {
+	kvStore := store.NewStore()
+	sseServer := sse.NewServer(kvStore)
+	defer sseServer.Shutdown()
+
+	w := &lockedResponseWriter{header: http.Header{}}
+	r := httptest.NewRequest("GET", "/events", nil)
+	if _, err := sseServer.AddClientWithOptions(w, r, []string{".presence"}, sse.ClientOptions{}); err != nil {
+		t.Fatalf("Failed to add client: %v", err)
+	}
+
+	if err := kvStore.SetWithTTL(".presence.alice", "online", 20*time.Millisecond); err != nil {
+		t.Fatalf("Failed to set value with TTL: %v", err)
+	}
+
+	// Wait for the key to expire and the event to be written
+	time.Sleep(150 * time.Millisecond)
+
+	body := w.String()
+	if !strings.Contains(body, "event: expire\n") {
+		t.Fatalf("Expected an expire event, got %q", body)
+	}
+	if !strings.Contains(body, `"path":".presence.alice"`) || !strings.Contains(body, `"value":"online"`) {
+		t.Errorf("Expected the expired path and value in the event, got %q", body)
+	}
+}
+
+func TestServer_ViewSubscription(t *testing.T) {
+	kvStore := store.NewStore()
+	kvStore.Initialize(map[string]interface{}{
+		"positions": []interface{}{map[string]interface{}{"id": "p1", "qty": 1}},
+	})
+	sseServer := sse.NewServer(kvStore)
+	defer sseServer.Shutdown()
+
+	_, err := sseServer.Views().Register("quantities", view.Definition{
+		From:   ".positions[*]",
+		Select: map[string]view.Field{"qty": {Path: ".qty"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to register view: %v", err)
+	}
+
+	w := &lockedResponseWriter{header: http.Header{}}
+	r := httptest.NewRequest("GET", "/events", nil)
+	if _, err := sseServer.AddClientWithOptions(w, r, nil, sse.ClientOptions{SendInitialData: true, View: "quantities"}); err != nil {
+		t.Fatalf("Failed to add client: %v", err)
+	}
+
+	// Store changes reach view subscribers as the recomputed view only
+	kvStore.Set(".positions[0].qty", 3)
+	sseServer.BroadcastEvent(".positions[0].qty", 3, "update")
+	kvStore.Set(".other", "x")
+	sseServer.BroadcastEvent(".other", "x", "update")
+
+	// Wait a bit for the events to be written
+	time.Sleep(100 * time.Millisecond)
+
+	body := w.String()
+	if !strings.Contains(body, "event: initial_data\n") || !strings.Contains(body, `"value":[{"qty":1}]`) {
+		t.Errorf("Expected the view's initial value, got %q", body)
+	}
+	if !strings.Contains(body, "event: update\n") || !strings.Contains(body, `"value":[{"qty":3}]`) {
+		t.Errorf("Expected the recomputed view, got %q", body)
+	}
+	if strings.Count(body, "event: update\n") != 1 || strings.Contains(body, `"path":".other"`) {
+		t.Errorf("Expected only view events, got %q", body)
+	}
+}
+
+func TestServer_BroadcastDuringDisconnect(t *testing.T) {
+	kvStore := store.NewStore()
+	sseServer := sse.NewServer(kvStore)
+	defer sseServer.Shutdown()
+
+	// Broadcast continuously while clients connect and disconnect
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					sseServer.BroadcastEvent(".status", "online", "update")
+				}
+			}
+		}()
+	}
+
+	for round := 0; round < 200; round++ {
+		var ids []string
+		for i := 0; i < 20; i++ {
+			w := &lockedResponseWriter{header: http.Header{}}
+			r := httptest.NewRequest("GET", "/events", nil)
+			client, err := sseServer.AddClientWithOptions(w, r, []string{".status"}, sse.ClientOptions{})
+			if err != nil {
+				t.Fatalf("Failed to add client: %v", err)
+			}
+			ids = append(ids, client.ID)
+		}
+		for _, id := range ids {
+			sseServer.RemoveClient(id)
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	if count := sseServer.ClientCount(); count != 0 {
+		t.Errorf("Expected every client to be removed, got %d", count)
+	}
 }
@@ -0,0 +1,152 @@
+package store
+
+import (
+	"errors"
+
+	"github.com/piske-alex/go-sse/internal/query"
+)
+
+// The helpers in this file implement copy-on-write updates of JSON-like trees.
+// Only the maps and slices on the path from the root to the changed value are
+// copied; every other subtree is shared between the old and the new version, so
+// a snapshot handed to a reader never changes underneath it.
+
+// errWildcardWrite is returned when a wildcard is used in a write path
+var errWildcardWrite = errors.New("wildcards not supported in write operations")
+
+// parsePath parses a JQ-style path and drops the root segment
+func parsePath(path string) ([]query.PathSegment, error) {
+	segments, err := query.NewParser().Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	return segments[1:], nil
+}
+
+// cowSet returns a copy of node with value stored at the path described by segments.
+// Missing intermediate objects are created; a missing array is not, so an index in a
+// path cannot make the store allocate an array of that size.
+func cowSet(node interface{}, segments []query.PathSegment, value interface{}) (interface{}, error) {
+	if len(segments) == 0 {
+		return value, nil
+	}
+
+	segment := segments[0]
+	rest := segments[1:]
+
+	switch segment.Type {
+	case query.Property:
+		mapData, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, ErrPathNotFound
+		}
+
+		child, exists := mapData[segment.Value]
+		if !exists && len(rest) > 0 {
+			// Create missing intermediate objects
+			if rest[0].Type != query.Property {
+				return nil, ErrPathNotFound
+			}
+			child = map[string]interface{}{}
+		}
+
+		newChild, err := cowSet(child, rest, value)
+		if err != nil {
+			return nil, err
+		}
+
+		copied := copyMap(mapData, 1)
+		copied[segment.Value] = newChild
+		return copied, nil
+
+	case query.Index:
+		sliceData, ok := node.([]interface{})
+		if !ok || segment.Index < 0 || segment.Index >= len(sliceData) {
+			return nil, ErrPathNotFound
+		}
+
+		newChild, err := cowSet(sliceData[segment.Index], rest, value)
+		if err != nil {
+			return nil, err
+		}
+
+		copied := append([]interface{}(nil), sliceData...)
+		copied[segment.Index] = newChild
+		return copied, nil
+
+	case query.Wildcard:
+		return nil, errWildcardWrite
+
+	default:
+		return nil, query.ErrInvalidPath
+	}
+}
+
+// cowDelete returns a copy of node with the value at segments removed.
+// Array elements are set to nil rather than removed, matching query.Matcher.Delete.
+func cowDelete(node interface{}, segments []query.PathSegment) (interface{}, error) {
+	segment := segments[0]
+	rest := segments[1:]
+
+	switch segment.Type {
+	case query.Property:
+		mapData, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, ErrPathNotFound
+		}
+
+		child, exists := mapData[segment.Value]
+		if !exists {
+			return nil, ErrPathNotFound
+		}
+
+		if len(rest) == 0 {
+			copied := copyMap(mapData, 0)
+			delete(copied, segment.Value)
+			return copied, nil
+		}
+
+		newChild, err := cowDelete(child, rest)
+		if err != nil {
+			return nil, err
+		}
+
+		copied := copyMap(mapData, 0)
+		copied[segment.Value] = newChild
+		return copied, nil
+
+	case query.Index:
+		sliceData, ok := node.([]interface{})
+		if !ok || segment.Index < 0 || segment.Index >= len(sliceData) {
+			return nil, ErrPathNotFound
+		}
+
+		var newChild interface{}
+		if len(rest) > 0 {
+			var err error
+			newChild, err = cowDelete(sliceData[segment.Index], rest)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		copied := append([]interface{}(nil), sliceData...)
+		copied[segment.Index] = newChild
+		return copied, nil
+
+	case query.Wildcard:
+		return nil, errWildcardWrite
+
+	default:
+		return nil, query.ErrInvalidPath
+	}
+}
+
+// copyMap returns a shallow copy of m with room for extra additional keys
+func copyMap(m map[string]interface{}, extra int) map[string]interface{} {
+	copied := make(map[string]interface{}, len(m)+extra)
+	for k, v := range m {
+		copied[k] = v
+	}
+	return copied
+}
@@ -2,10 +2,10 @@ package store
 
 import (
 	"fmt"
-	"log"
 	"os"
 	"strings"
 
+	"github.com/piske-alex/go-sse/internal/logging"
 	"github.com/piske-alex/go-sse/internal/query"
 )
 
@@ -46,26 +46,57 @@ type StoreInterface interface {
 	FindMatches(path string) ([]query.MatchResult, error)
 }
 
+// MongoConfig holds the MongoDB connection and the location of the store in it
+type MongoConfig struct {
+	URI               string // Complete connection URI, built from the fields below when empty
+	Host              string
+	Port              string
+	User              string
+	Password          string
+	AuthDB            string
+	Database          string
+	Collection        string
+	DocumentID        string
+	UseCollectionRoot bool // Store the data as the documents of the collection instead of one document
+}
+
+// MongoConfigFromEnv reads the MongoDB settings from the MONGO_* environment variables
+func MongoConfigFromEnv() MongoConfig {
+	useCollectionRoot := os.Getenv("MONGO_USE_COLLECTION_ROOT")
+	return MongoConfig{
+		URI:               os.Getenv("MONGO_URI"),
+		Host:              os.Getenv("MONGO_HOST"),
+		Port:              os.Getenv("MONGO_PORT"),
+		User:              os.Getenv("MONGO_USER"),
+		Password:          os.Getenv("MONGO_PASSWORD"),
+		AuthDB:            os.Getenv("MONGO_AUTH_DB"),
+		Database:          os.Getenv("MONGO_DB_NAME"),
+		Collection:        os.Getenv("MONGO_COLLECTION"),
+		DocumentID:        os.Getenv("MONGO_DOCUMENT_ID"),
+		UseCollectionRoot: useCollectionRoot == "true" || useCollectionRoot == "1",
+	}
+}
+
 // BuildMongoURI constructs a MongoDB connection URI from individual components or uses a complete URI
-func BuildMongoURI() string {
+func BuildMongoURI(config MongoConfig) string {
 	// Check if a complete URI is provided
-	uri := os.Getenv("MONGO_URI")
+	uri := config.URI
 	if uri != "" {
 		// If URI already contains credentials, use it directly
 		if strings.Contains(uri, "@") {
-			log.Println("Using fully configured MongoDB URI from MONGO_URI")
+			logging.Infof("Using fully configured MongoDB URI")
 			return uri
 		}
 		
 		// If URI doesn't contain credentials, check for separate username/password
-		user := os.Getenv("MONGO_USER")
-		pass := os.Getenv("MONGO_PASSWORD")
+		user := config.User
+		pass := config.Password
 		
 		if user != "" && pass != "" {
 			// Extract the protocol and host parts
 			parts := strings.SplitN(uri, "://", 2)
 			if len(parts) != 2 {
-				log.Println("MONGO_URI format not recognized, using as-is")
+				logging.Warnf("MongoDB URI format not recognized, using as-is")
 				return uri
 			}
 			
@@ -74,21 +105,21 @@ func BuildMongoURI() string {
 			
 			// Construct URI with credentials
 			uri = fmt.Sprintf("%s://%s:%s@%s", protocol, user, pass, host)
-			log.Println("Built MongoDB URI with credentials from MONGO_USER and MONGO_PASSWORD")
+			logging.Infof("Built MongoDB URI with credentials from the configured user and password")
 			return uri
 		}
 		
 		// No credentials provided, use URI as-is
-		log.Println("Using MongoDB URI without authentication")
+		logging.Infof("Using MongoDB URI without authentication")
 		return uri
 	}
 	
 	// No URI provided, build one from individual components
-	host := os.Getenv("MONGO_HOST")
-	port := os.Getenv("MONGO_PORT")
-	user := os.Getenv("MONGO_USER")
-	pass := os.Getenv("MONGO_PASSWORD")
-	auth := os.Getenv("MONGO_AUTH_DB")
+	host := config.Host
+	port := config.Port
+	user := config.User
+	pass := config.Password
+	auth := config.AuthDB
 	
 	// Set defaults
 	if host == "" {
@@ -108,55 +139,72 @@ func BuildMongoURI() string {
 		// With authentication
 		uri = fmt.Sprintf("mongodb://%s:%s@%s:%s/?authSource=%s", 
 			user, pass, host, port, auth)
-		log.Println("Built MongoDB URI with credentials from individual components")
+		logging.Infof("Built MongoDB URI with credentials from individual components")
 	} else {
 		// Without authentication
 		uri = fmt.Sprintf("mongodb://%s:%s", host, port)
-		log.Println("Built MongoDB URI without authentication from individual components")
+		logging.Infof("Built MongoDB URI without authentication from individual components")
 	}
 	
 	return uri
 }
 
-// CreateStore creates a store of the specified type
-func CreateStore(storeType StoreType) (Store, error) {
+// CreateStore creates a store of the specified type, retaining revisions as history allows.
+// The MongoDB settings are only used by the mongo type.
+func CreateStore(storeType StoreType, mongoConfig MongoConfig, history HistoryConfig) (Store, error) {
 	switch storeType {
 	case MemoryStore:
-		return NewStore(), nil
+		kvStore := NewStore()
+		kvStore.EnableHistory(history)
+		return kvStore, nil
 
 	case MongoStoreType:
-		// Build the MongoDB URI with proper authentication
-		uri := BuildMongoURI()
+		uri, dbName, collectionName, documentID := mongoConfig.location()
 
-		dbName := os.Getenv("MONGO_DB_NAME")
-		if dbName == "" {
-			dbName = "test"
+		mongoStore, err := NewMongoStore(uri, dbName, collectionName, documentID)
+		if err != nil {
+			return nil, err
 		}
 
-		collectionName := os.Getenv("MONGO_COLLECTION")
-		if collectionName == "" {
-			collectionName = "sse"
+		// Record revisions in a capped history collection
+		if err := mongoStore.EnableHistory(history); err != nil {
+			logging.Warnf("history disabled: %v", err)
 		}
 
-		// Check for the MONGO_USE_COLLECTION_ROOT environment variable
-		// If it's set to "true", we'll use the collection as the root instead of a document
-		useCollectionRoot := os.Getenv("MONGO_USE_COLLECTION_ROOT")
-		documentID := os.Getenv("MONGO_DOCUMENT_ID")
-
-		// Empty documentID or "collection" means use collection as root
-		if useCollectionRoot == "true" || useCollectionRoot == "1" {
-			log.Println("Using MongoDB collection as root path (collection-based document store)")
-			documentID = "collection" // Special value to trigger collection mode
-		} else if documentID == "" {
-			documentID = "latest" // Default document ID
-			log.Println("Using document-based MongoDB store with document ID:", documentID)
-		} else {
-			log.Println("Using document-based MongoDB store with document ID:", documentID)
-		}
-
-		return NewMongoStore(uri, dbName, collectionName, documentID)
+		return mongoStore, nil
 
 	default:
 		return nil, fmt.Errorf("unknown store type: %s", storeType)
 	}
 }
+
+// location returns the connection URI and the database, collection and document of
+// the store, with their defaults
+func (c MongoConfig) location() (uri, dbName, collectionName, documentID string) {
+	// Build the MongoDB URI with proper authentication
+	uri = BuildMongoURI(c)
+
+	dbName = c.Database
+	if dbName == "" {
+		dbName = "test"
+	}
+
+	collectionName = c.Collection
+	if collectionName == "" {
+		collectionName = "sse"
+	}
+
+	// Empty documentID or "collection" means use collection as root
+	documentID = c.DocumentID
+	if c.UseCollectionRoot {
+		logging.Infof("Using MongoDB collection as root path (collection-based document store)")
+		documentID = "collection" // Special value to trigger collection mode
+	} else if documentID == "" {
+		documentID = "latest" // Default document ID
+		logging.Infof("Using document-based MongoDB store with document ID: %s", documentID)
+	} else {
+		logging.Infof("Using document-based MongoDB store with document ID: %s", documentID)
+	}
+
+	return uri, dbName, collectionName, documentID
+}
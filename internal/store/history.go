@@ -0,0 +1,188 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/piske-alex/go-sse/internal/query"
+)
+
+// ErrHistoryDisabled is returned by history queries when the store does not record revisions
+var ErrHistoryDisabled = errors.New("history is not enabled for this store")
+
+// ErrRevisionNotFound is returned when a point in time is older than the retained history
+var ErrRevisionNotFound = errors.New("revision is not available in the retained history")
+
+// Revision describes a single recorded write to the store
+type Revision struct {
+	Revision uint64      `json:"revision" bson:"revision"`
+	Time     time.Time   `json:"time" bson:"time"`
+	Op       string      `json:"op" bson:"op"`
+	Path     string      `json:"path" bson:"path"`
+	OldValue interface{} `json:"old_value" bson:"old_value"`
+	NewValue interface{} `json:"new_value" bson:"new_value"`
+	// Created is true when the path did not exist before the write
+	Created bool `json:"created,omitempty" bson:"created,omitempty"`
+	// Removed is true when the path no longer exists after the write
+	Removed bool `json:"removed,omitempty" bson:"removed,omitempty"`
+}
+
+// Revision operations
+const (
+	OpInitialize = "initialize"
+	OpSet        = "set"
+	OpDelete     = "delete"
+	OpExpire     = "expire"
+)
+
+// HistoryConfig bounds how many revisions a store retains. History is disabled when neither limit is set.
+type HistoryConfig struct {
+	// MaxRevisions is the maximum number of revisions kept; 0 keeps revisions regardless of count
+	MaxRevisions int
+	// MaxAge drops revisions older than this; 0 keeps revisions regardless of age
+	MaxAge time.Duration
+}
+
+// Enabled reports whether the config records any history
+func (c HistoryConfig) Enabled() bool {
+	return c.MaxRevisions > 0 || c.MaxAge > 0
+}
+
+// HistoryConfigFromEnv reads HISTORY_MAX_REVISIONS and HISTORY_MAX_AGE (e.g. "1h"); history is disabled unless one is set
+func HistoryConfigFromEnv() HistoryConfig {
+	config := HistoryConfig{}
+
+	if value := os.Getenv("HISTORY_MAX_REVISIONS"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			config.MaxRevisions = n
+		}
+	}
+
+	if value := os.Getenv("HISTORY_MAX_AGE"); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+			config.MaxAge = d
+		}
+	}
+
+	return config
+}
+
+// PointInTime selects a state of the store by revision number or by timestamp
+type PointInTime struct {
+	Revision uint64
+	Time     time.Time
+}
+
+// ParsePointInTime parses an `at` parameter: a revision number or an RFC 3339 timestamp
+func ParsePointInTime(value string) (PointInTime, error) {
+	if revision, err := strconv.ParseUint(value, 10, 64); err == nil {
+		return PointInTime{Revision: revision}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return PointInTime{}, errors.New("at must be a revision number or an RFC 3339 timestamp")
+	}
+
+	return PointInTime{Time: t}, nil
+}
+
+// isPathWithin reports whether path equals base or lies below it
+func isPathWithin(path, base string) bool {
+	if base == "" || base == "." {
+		return true
+	}
+	return path == base || strings.HasPrefix(path, base+".") || strings.HasPrefix(path, base+"[")
+}
+
+// pathsOverlap reports whether a write to one path can change the value at the other
+func pathsOverlap(a, b string) bool {
+	return isPathWithin(a, b) || isPathWithin(b, a)
+}
+
+// relativePath returns path relative to base as a JQ-style path (e.g. ".b" or ".[0]")
+func relativePath(path, base string) string {
+	if base == "" || base == "." {
+		return path
+	}
+
+	rest := strings.TrimPrefix(path, base)
+	if rest == "" {
+		return "."
+	}
+	if strings.HasPrefix(rest, "[") {
+		return "." + rest
+	}
+	return rest
+}
+
+// lookupPath returns the value at path inside data and whether it exists
+func lookupPath(data interface{}, path string) (interface{}, bool) {
+	value, err := query.NewMatcher().Get(data, path)
+	if err != nil {
+		return nil, false
+	}
+	return value, true
+}
+
+// narrowRevision rewrites a revision recorded at an ancestor of path so that its
+// values are taken at path. It reports false when the write left path unchanged.
+func narrowRevision(rev Revision, path string) (Revision, bool) {
+	if rev.Path == path || !isPathWithin(path, rev.Path) {
+		return rev, true
+	}
+
+	rel := relativePath(path, rev.Path)
+
+	var oldValue, newValue interface{}
+	var oldExists, newExists bool
+	if !rev.Created {
+		oldValue, oldExists = lookupPath(rev.OldValue, rel)
+	}
+	if !rev.Removed {
+		newValue, newExists = lookupPath(rev.NewValue, rel)
+	}
+
+	if oldExists == newExists && reflect.DeepEqual(oldValue, newValue) {
+		return rev, false
+	}
+
+	rev.OldValue, rev.Created = oldValue, !oldExists
+	rev.NewValue, rev.Removed = newValue, !newExists
+	return rev, true
+}
+
+// undoRevision reverts the effect of rev on value, the value found at path after rev was applied.
+// It returns the value at path before rev and whether it existed.
+func undoRevision(value interface{}, exists bool, path string, rev Revision) (interface{}, bool) {
+	// The write replaced an ancestor (or the path itself), so the old value holds the answer
+	if isPathWithin(path, rev.Path) {
+		if rev.Created {
+			return nil, false
+		}
+		return lookupPath(rev.OldValue, relativePath(path, rev.Path))
+	}
+
+	// The write changed something below path; put the old value back into a copy
+	rel := relativePath(rev.Path, path)
+	segments, err := parsePath(rel)
+	if err != nil || !exists {
+		return value, exists
+	}
+
+	var reverted interface{}
+	if rev.Created {
+		reverted, err = cowDelete(value, segments)
+	} else {
+		reverted, err = cowSet(value, segments, rev.OldValue)
+	}
+	if err != nil {
+		return value, exists
+	}
+
+	return reverted, true
+}
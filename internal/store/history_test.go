@@ -0,0 +1,302 @@
+package store_test
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/piske-alex/go-sse/internal/store"
+)
+
+// runHistoryScenario applies a fixed sequence of writes and checks time-travel reads and history listings
+func runHistoryScenario(t *testing.T, s store.Store) {
+	t.Helper()
+
+	writes := []func() error{
+		func() error {
+			return s.Initialize(map[string]interface{}{
+				"data": map[string]interface{}{
+					"positions": []interface{}{
+						map[string]interface{}{"id": "pos1", "amount": float64(100)},
+					},
+					"config": map[string]interface{}{"max": float64(1)},
+				},
+			})
+		},
+		func() error { return s.Set(".data.positions[0].amount", float64(150)) },
+		func() error { return s.Set(".data.config.max", float64(2)) },
+		func() error {
+			return s.Set(".data.positions", []interface{}{
+				map[string]interface{}{"id": "pos2", "amount": float64(5)},
+			})
+		},
+		func() error { return s.Delete(".data.config") },
+	}
+	for i, write := range writes {
+		if err := write(); err != nil {
+			t.Fatalf("Write %d failed: %v", i+1, err)
+		}
+	}
+
+	all, err := s.History(".", 0)
+	if err != nil {
+		t.Fatalf("Failed to read history: %v", err)
+	}
+	if len(all) != len(writes) {
+		t.Fatalf("Expected %d revisions, got %d", len(writes), len(all))
+	}
+	rev := func(i int) uint64 { return all[i-1].Revision }
+
+	tests := []struct {
+		name     string
+		path     string
+		at       store.PointInTime
+		expected interface{}
+		err      error
+	}{
+		{
+			name: "initial positions",
+			path: ".data.positions",
+			at:   store.PointInTime{Revision: rev(1)},
+			expected: []interface{}{
+				map[string]interface{}{"id": "pos1", "amount": float64(100)},
+			},
+		},
+		{
+			name: "positions after nested update",
+			path: ".data.positions",
+			at:   store.PointInTime{Revision: rev(2)},
+			expected: []interface{}{
+				map[string]interface{}{"id": "pos1", "amount": float64(150)},
+			},
+		},
+		{
+			name:     "leaf below a later replacement",
+			path:     ".data.positions[0].amount",
+			at:       store.PointInTime{Revision: rev(3)},
+			expected: float64(150),
+		},
+		{
+			name:     "object before deletion",
+			path:     ".data.config",
+			at:       store.PointInTime{Revision: rev(4)},
+			expected: map[string]interface{}{"max": float64(2)},
+		},
+		{
+			name: "deleted object",
+			path: ".data.config",
+			at:   store.PointInTime{Revision: rev(5)},
+			err:  store.ErrPathNotFound,
+		},
+		{
+			name: "by timestamp",
+			path: ".data.positions",
+			at:   store.PointInTime{Time: all[1].Time},
+			expected: []interface{}{
+				map[string]interface{}{"id": "pos1", "amount": float64(150)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := s.GetAt(tt.path, tt.at)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("Expected error %v, got %v (value %v)", tt.err, err, value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetAt failed: %v", err)
+			}
+			if got := normalize(t, value); !reflect.DeepEqual(got, normalize(t, tt.expected)) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	// The config change does not touch positions and the deletion is elsewhere
+	positions, err := s.History(".data.positions", 0)
+	if err != nil {
+		t.Fatalf("Failed to read history: %v", err)
+	}
+	var revisions []uint64
+	for _, r := range positions {
+		revisions = append(revisions, r.Revision)
+	}
+	if want := []uint64{rev(1), rev(2), rev(4)}; !reflect.DeepEqual(revisions, want) {
+		t.Fatalf("Expected revisions %v, got %v", want, revisions)
+	}
+
+	// The initialization is reported at the queried path
+	if !positions[0].Created || positions[0].Op != store.OpInitialize {
+		t.Errorf("Expected first revision to create the path, got %+v", positions[0])
+	}
+	if positions[1].Path != ".data.positions[0].amount" || positions[1].OldValue != float64(100) || positions[1].NewValue != float64(150) {
+		t.Errorf("Unexpected nested revision %+v", positions[1])
+	}
+
+	latest, err := s.History(".data.positions", 1)
+	if err != nil {
+		t.Fatalf("Failed to read history: %v", err)
+	}
+	if len(latest) != 1 || latest[0].Revision != rev(4) {
+		t.Errorf("Expected only revision %d with limit 1, got %+v", rev(4), latest)
+	}
+
+	deleted, err := s.History(".data.config", 0)
+	if err != nil {
+		t.Fatalf("Failed to read history: %v", err)
+	}
+	if last := deleted[len(deleted)-1]; last.Op != store.OpDelete || !last.Removed {
+		t.Errorf("Expected the last config revision to be a removal, got %+v", last)
+	}
+}
+
+func TestKVStore_History(t *testing.T) {
+	s := store.NewStore()
+	s.EnableHistory(store.HistoryConfig{MaxRevisions: 100})
+	runHistoryScenario(t, s)
+}
+
+func TestKVStore_HistoryDisabled(t *testing.T) {
+	s := store.NewStore()
+	s.Set(".a", "b")
+
+	if _, err := s.GetAt(".a", store.PointInTime{Revision: 1}); !errors.Is(err, store.ErrHistoryDisabled) {
+		t.Errorf("Expected ErrHistoryDisabled, got %v", err)
+	}
+	if _, err := s.History(".a", 0); !errors.Is(err, store.ErrHistoryDisabled) {
+		t.Errorf("Expected ErrHistoryDisabled, got %v", err)
+	}
+}
+
+func TestCreateStore_HistoryDisabledByDefault(t *testing.T) {
+	t.Setenv("HISTORY_MAX_REVISIONS", "")
+	t.Setenv("HISTORY_MAX_AGE", "")
+	s, err := store.CreateStore(store.MemoryStore, store.MongoConfig{}, store.HistoryConfigFromEnv())
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	s.Set(".a", "b")
+
+	if _, err := s.(*store.KVStore).History(".a", 0); !errors.Is(err, store.ErrHistoryDisabled) {
+		t.Errorf("Expected history to be disabled by default, got %v", err)
+	}
+}
+
+func TestKVStore_HistoryBoundedByCount(t *testing.T) {
+	s := store.NewStore()
+	s.EnableHistory(store.HistoryConfig{MaxRevisions: 2})
+
+	for i := 1; i <= 4; i++ {
+		s.Set(".counter", float64(i))
+	}
+
+	revisions, _ := s.History(".counter", 0)
+	if len(revisions) != 2 || revisions[0].Revision != 3 {
+		t.Fatalf("Expected revisions 3 and 4 to be retained, got %+v", revisions)
+	}
+
+	// Revision 2 is still known as the state before the oldest retained write
+	if value, err := s.GetAt(".counter", store.PointInTime{Revision: 2}); err != nil || value != float64(2) {
+		t.Errorf("Expected 2 at revision 2, got %v (%v)", value, err)
+	}
+	if _, err := s.GetAt(".counter", store.PointInTime{Revision: 1}); !errors.Is(err, store.ErrRevisionNotFound) {
+		t.Errorf("Expected ErrRevisionNotFound for a pruned revision, got %v", err)
+	}
+}
+
+func TestKVStore_HistoryBoundedByAge(t *testing.T) {
+	s := store.NewStore()
+	s.EnableHistory(store.HistoryConfig{MaxRevisions: 100, MaxAge: 10 * time.Millisecond})
+
+	before := time.Now()
+	s.Set(".counter", float64(1))
+	time.Sleep(20 * time.Millisecond)
+
+	revisions, _ := s.History(".counter", 0)
+	if len(revisions) != 0 {
+		t.Fatalf("Expected expired revisions to be dropped, got %+v", revisions)
+	}
+
+	// Nothing changed since the expired write, so the current value is still known
+	if value, err := s.GetAt(".counter", store.PointInTime{Time: time.Now()}); err != nil || value != float64(1) {
+		t.Errorf("Expected 1 now, got %v (%v)", value, err)
+	}
+	if _, err := s.GetAt(".counter", store.PointInTime{Time: before}); !errors.Is(err, store.ErrRevisionNotFound) {
+		t.Errorf("Expected ErrRevisionNotFound before the expired write, got %v", err)
+	}
+}
+
+func TestKVStore_HistoryBoundedByAgeOnly(t *testing.T) {
+	config := store.HistoryConfig{MaxAge: time.Hour}
+	if !config.Enabled() {
+		t.Fatal("Expected an age limit alone to enable history")
+	}
+
+	s := store.NewStore()
+	s.EnableHistory(config)
+	for i := 1; i <= 3; i++ {
+		s.Set(".counter", float64(i))
+	}
+
+	// Without a count limit every revision within the age limit is retained
+	revisions, err := s.History(".counter", 0)
+	if err != nil || len(revisions) != 3 || revisions[0].Revision != 1 {
+		t.Fatalf("Expected revisions 1 to 3 to be retained, got %+v (%v)", revisions, err)
+	}
+	if value, err := s.GetAt(".counter", store.PointInTime{Revision: 1}); err != nil || value != float64(1) {
+		t.Errorf("Expected 1 at revision 1, got %v (%v)", value, err)
+	}
+
+	// The age limit still drops old revisions
+	s.EnableHistory(store.HistoryConfig{MaxAge: 10 * time.Millisecond})
+	time.Sleep(20 * time.Millisecond)
+	s.Set(".counter", float64(4))
+	revisions, _ = s.History(".counter", 0)
+	if len(revisions) != 1 || revisions[0].Revision != 4 {
+		t.Errorf("Expected only revision 4 to be retained, got %+v", revisions)
+	}
+}
+
+func TestParsePointInTime(t *testing.T) {
+	at, err := store.ParsePointInTime("42")
+	if err != nil || at.Revision != 42 || !at.Time.IsZero() {
+		t.Errorf("Expected revision 42, got %+v (%v)", at, err)
+	}
+
+	at, err = store.ParsePointInTime("2024-05-01T12:00:00Z")
+	if err != nil || !at.Time.Equal(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected timestamp, got %+v (%v)", at, err)
+	}
+
+	if _, err := store.ParsePointInTime("yesterday"); err == nil {
+		t.Error("Expected an error for an invalid point in time")
+	}
+}
+
+func TestMongoStore_History(t *testing.T) {
+	skipIfNoMongo(t)
+
+	mongouri := os.Getenv("MONGO_URI")
+	if mongouri == "" {
+		mongouri = "mongodb://localhost:27017"
+	}
+
+	suffix := time.Now().Format("20060102150405")
+	s, err := store.NewMongoStore(mongouri, "gosse_test", "history_test_"+suffix, "history")
+	if err != nil {
+		t.Fatalf("Failed to create MongoDB store: %v", err)
+	}
+	defer s.Disconnect()
+
+	if err := s.EnableHistory(store.HistoryConfig{MaxRevisions: 100}); err != nil {
+		t.Fatalf("Failed to enable history: %v", err)
+	}
+
+	runHistoryScenario(t, s)
+}
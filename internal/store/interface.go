@@ -1,9 +1,12 @@
 package store
 
 import (
+	"context"
 	"errors"
+	"time"
 
 	"github.com/piske-alex/go-sse/internal/query"
+	"github.com/piske-alex/go-sse/internal/schema"
 )
 
 // ErrPathNotFound is returned when a path cannot be found in the store
@@ -23,9 +26,19 @@ type Store interface {
 	// Set updates a value at the given path
 	Set(path string, value interface{}) error
 
+	// SetWithTTL updates a value at the given path and deletes it once ttl has elapsed
+	SetWithTTL(path string, value interface{}, ttl time.Duration) error
+
+	// SetExpiryListener sets a callback called with the path and last value of each expired key
+	SetExpiryListener(listener func(path string, value interface{}))
+
 	// SetFromJSON updates a value at the given path from JSON
 	SetFromJSON(path string, jsonData []byte) error
 
+	// Apply performs an atomic operation such as append or increment on the value at path
+	// and returns the changes it made to individual elements
+	Apply(path string, op Operation) ([]Change, error)
+
 	// Delete removes a value at the given path
 	Delete(path string) error
 
@@ -34,7 +47,22 @@ type Store interface {
 
 	// FindMatches finds all values matching a path expression
 	FindMatches(path string) ([]query.MatchResult, error)
+
+	// ForEachKey calls fn for every top-level key in the store, stopping at the first error
+	ForEachKey(fn func(key string, value interface{}) error) error
+
+	// Schemas returns the registry of JSON Schemas that Set, SetFromJSON and Initialize validate against
+	Schemas() *schema.Registry
+
+	// GetAt retrieves a value by path as it was at a revision or time in the retained history
+	GetAt(path string, at PointInTime) (interface{}, error)
+
+	// History lists the retained writes that touched path, oldest first
+	History(path string, limit int) ([]Revision, error)
 	
+	// Ping checks that the store backend is reachable
+	Ping(ctx context.Context) error
+
 	// DisplayStoreInfo displays information about the store contents
 	DisplayStoreInfo() error
 }
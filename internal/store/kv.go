@@ -1,35 +1,103 @@
 package store
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
-	
+	"sync/atomic"
+	"time"
+
+	"github.com/piske-alex/go-sse/internal/logging"
 	"github.com/piske-alex/go-sse/internal/query"
+	"github.com/piske-alex/go-sse/internal/schema"
 )
 
-// KVStore represents an in-memory key-value store with concurrency safety
+// KVStore represents an in-memory key-value store with concurrency safety.
+//
+// The tree is treated as immutable: every write copies the maps and slices on
+// the path it changes, shares everything else with the previous version and
+// atomically swaps in the new root. Readers load the current root and never take
+// a lock, so values returned by Get, FindMatches and Snapshot stay consistent
+// after the call returns but must not be modified by the caller.
 type KVStore struct {
-	data map[string]interface{}
-	mux  sync.RWMutex
+	root atomic.Pointer[map[string]interface{}]
+	// writeMux serializes writers so concurrent copy-on-write updates are not lost
+	writeMux sync.Mutex
+	// revision counts writes; guarded by writeMux
+	revision uint64
+
+	// historyMux guards the fields below
+	historyMux    sync.Mutex
+	historyConfig HistoryConfig
+	// history holds retained revisions, oldest first. Because roots are immutable
+	// each entry keeps the whole tree before and after the write for the cost of
+	// the copied path only.
+	history []kvRevision
+	// base is the revision and time from which the state before history[0] is known
+	baseRevision uint64
+	baseTime     time.Time
+
+	// ttls indexes the entries of expiries by path; both are guarded by writeMux
+	ttls           map[string]*ttlEntry
+	expiries       ttlHeap
+	expiryTimer    *time.Timer
+	expiryListener func(path string, value interface{})
+
+	// schemas validates writes to the paths they are registered for
+	schemas *schema.Registry
+}
+
+// kvRevision is a retained write together with the roots it switched between
+type kvRevision struct {
+	revision uint64
+	time     time.Time
+	op       string
+	path     string
+	before   map[string]interface{}
+	after    map[string]interface{}
 }
 
 // NewStore creates a new empty KV store
 func NewStore() *KVStore {
-	return &KVStore{
-		data: make(map[string]interface{}),
+	s := &KVStore{
+		baseTime: time.Now(),
+		ttls:     make(map[string]*ttlEntry),
+		schemas:  schema.NewRegistry(),
 	}
+	s.swap(make(map[string]interface{}))
+	return s
 }
 
-// Initialize sets the initial data for the store
+// Snapshot returns the current root of the store as an immutable snapshot
+func (s *KVStore) Snapshot() map[string]interface{} {
+	return *s.root.Load()
+}
+
+// swap publishes a new root for readers
+func (s *KVStore) swap(data map[string]interface{}) {
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+	s.root.Store(&data)
+}
+
+// Initialize sets the initial data for the store.
+// The store takes ownership of data; the caller must not modify it afterwards.
 func (s *KVStore) Initialize(data map[string]interface{}) error {
-	s.mux.Lock()
-	defer s.mux.Unlock()
-	s.data = data
+	s.writeMux.Lock()
+	defer s.writeMux.Unlock()
+	if err := validateWrite(s.schemas, ".", resolveInRoot(data)); err != nil {
+		return err
+	}
+	before := s.Snapshot()
+	s.swap(data)
+	s.recordRevision(OpInitialize, ".", before)
+	s.clearTTLs(".")
 	return nil
 }
 
@@ -46,9 +114,11 @@ func (s *KVStore) InitializeFromJSON(jsonData []byte) error {
 
 // Get retrieves a value by path
 func (s *KVStore) Get(path string) (interface{}, error) {
-	s.mux.RLock()
-	defer s.mux.RUnlock()
+	return s.getFrom(s.Snapshot(), path)
+}
 
+// getFrom retrieves a value by path from a snapshot of the store
+func (s *KVStore) getFrom(data map[string]interface{}, path string) (interface{}, error) {
 	// Extract key-value conditions from path if present
 	var cleanPath string = path
 	var keyValueConditions []string
@@ -70,7 +140,7 @@ func (s *KVStore) Get(path string) (interface{}, error) {
 			
 			// Clean the path by removing the conditions
 			cleanPath = re.ReplaceAllString(path, "")
-			log.Printf("Path with key-value condition detected. Original path: %s, Clean path: %s, Conditions: %v", 
+			logging.Debugf("Path with key-value condition detected. Original path: %s, Clean path: %s, Conditions: %v", 
 				path, cleanPath, keyValueConditions)
 		}
 	}
@@ -81,17 +151,17 @@ func (s *KVStore) Get(path string) (interface{}, error) {
 		parts := strings.Split(cleanPath, ".")
 		if len(parts) > 1 {
 			targetField := parts[len(parts)-1]
-			log.Printf("Special case handling for data.%s path", targetField)
+			logging.Debugf("Special case handling for data.%s path", targetField)
 			
 			// Try to get the specific field from data
-			if dataMap, ok := s.data["data"].(map[string]interface{}); ok {
+			if dataMap, ok := data["data"].(map[string]interface{}); ok {
 				if fieldValue, exists := dataMap[targetField]; exists {
-					log.Printf("Found %s in data map", targetField)
+					logging.Debugf("Found %s in data map", targetField)
 					
 					// Apply key-value filtering if needed
 					if len(keyValueConditions) > 0 {
 						fieldValue = s.applyKeyValueFiltering(fieldValue, keyValueConditions)
-						log.Printf("Applied key-value filtering to %s", targetField)
+						logging.Debugf("Applied key-value filtering to %s", targetField)
 					}
 					
 					return fieldValue, nil
@@ -102,11 +172,11 @@ func (s *KVStore) Get(path string) (interface{}, error) {
 
 	// If path is empty or ".", return the entire store
 	if cleanPath == "" || cleanPath == "." {
-		return s.data, nil
+		return data, nil
 	}
 
 	// Parse the path and navigate the store
-	result, err := s.getValueByPath(s.data, cleanPath)
+	result, err := s.getValueByPath(data, cleanPath)
 	if err != nil {
 		return nil, err
 	}
@@ -114,17 +184,26 @@ func (s *KVStore) Get(path string) (interface{}, error) {
 	// Apply key-value filtering if needed
 	if len(keyValueConditions) > 0 {
 		result = s.applyKeyValueFiltering(result, keyValueConditions)
-		log.Printf("Applied key-value filtering to result")
+		logging.Debugf("Applied key-value filtering to result")
 	}
 
 	return result, nil
 }
 
-// Set updates a value at the given path
+// Set updates a value at the given path, clearing any TTL on it
 func (s *KVStore) Set(path string, value interface{}) error {
-	s.mux.Lock()
-	defer s.mux.Unlock()
+	s.writeMux.Lock()
+	defer s.writeMux.Unlock()
 
+	if err := s.set(path, value); err != nil {
+		return err
+	}
+	s.clearTTLs(path)
+	return nil
+}
+
+// set writes value at path and records the revision. The caller must hold writeMux.
+func (s *KVStore) set(path string, value interface{}) error {
 	// If path is empty or ".", replace the entire store
 	if path == "" || path == "." {
 		// Ensure value is a map
@@ -132,12 +211,22 @@ func (s *KVStore) Set(path string, value interface{}) error {
 		if !ok {
 			return errors.New("value must be a map when setting root")
 		}
-		s.data = valMap
+		if err := validateWrite(s.schemas, ".", resolveInRoot(valMap)); err != nil {
+			return err
+		}
+		before := s.Snapshot()
+		s.swap(valMap)
+		s.recordRevision(OpSet, ".", before)
 		return nil
 	}
 
 	// Update the value at the specified path
-	return s.setValueByPath(s.data, path, value)
+	before := s.Snapshot()
+	if err := s.setValueByPath(path, value); err != nil {
+		return err
+	}
+	s.recordRevision(OpSet, path, before)
+	return nil
 }
 
 // SetFromJSON updates a value at the given path from JSON
@@ -153,25 +242,191 @@ func (s *KVStore) SetFromJSON(path string, jsonData []byte) error {
 
 // Delete removes a value at the given path
 func (s *KVStore) Delete(path string) error {
-	s.mux.Lock()
-	defer s.mux.Unlock()
+	s.writeMux.Lock()
+	defer s.writeMux.Unlock()
 
 	// If path is empty or ".", reset the entire store
 	if path == "" || path == "." {
-		s.data = make(map[string]interface{})
+		before := s.Snapshot()
+		s.swap(make(map[string]interface{}))
+		s.recordRevision(OpDelete, ".", before)
+		s.clearTTLs(".")
 		return nil
 	}
 
 	// Delete the value at the specified path
-	return s.deleteByPath(s.data, path)
+	before := s.Snapshot()
+	if err := s.deleteByPath(path); err != nil {
+		return err
+	}
+	s.recordRevision(OpDelete, path, before)
+	s.clearTTLs(path)
+	return nil
 }
 
 // ToJSON serializes the entire store to JSON
 func (s *KVStore) ToJSON() ([]byte, error) {
-	s.mux.RLock()
-	defer s.mux.RUnlock()
+	return json.Marshal(s.Snapshot())
+}
+
+// ForEachKey calls fn for every top-level key in a snapshot of the store.
+// No lock is held, so fn may call back into the store.
+func (s *KVStore) ForEachKey(fn func(key string, value interface{}) error) error {
+	for key, value := range s.Snapshot() {
+		if err := fn(key, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Schemas returns the registry of JSON Schemas that writes are validated against
+func (s *KVStore) Schemas() *schema.Registry {
+	return s.schemas
+}
+
+// EnableHistory starts retaining revisions within the limits of config.
+// A config with neither limit set disables history and drops retained revisions.
+func (s *KVStore) EnableHistory(config HistoryConfig) {
+	s.historyMux.Lock()
+	defer s.historyMux.Unlock()
+
+	s.historyConfig = config
+	if !config.Enabled() {
+		s.history = nil
+	}
+	s.pruneHistory(time.Now())
+}
+
+// recordRevision retains the write that replaced before with the current root. The caller must hold writeMux.
+func (s *KVStore) recordRevision(op, path string, before map[string]interface{}) {
+	s.revision++
+	now := time.Now()
+
+	s.historyMux.Lock()
+	defer s.historyMux.Unlock()
+
+	if !s.historyConfig.Enabled() {
+		s.baseRevision, s.baseTime = s.revision, now
+		return
+	}
+
+	s.history = append(s.history, kvRevision{
+		revision: s.revision,
+		time:     now,
+		op:       op,
+		path:     path,
+		before:   before,
+		after:    s.Snapshot(),
+	})
+	s.pruneHistory(now)
+}
+
+// pruneHistory drops revisions beyond the configured count or age. The caller must hold historyMux.
+func (s *KVStore) pruneHistory(now time.Time) {
+	drop := 0
+	if s.historyConfig.MaxRevisions > 0 && len(s.history) > s.historyConfig.MaxRevisions {
+		drop = len(s.history) - s.historyConfig.MaxRevisions
+	}
+	if s.historyConfig.MaxAge > 0 {
+		cutoff := now.Add(-s.historyConfig.MaxAge)
+		for drop < len(s.history) && s.history[drop].time.Before(cutoff) {
+			drop++
+		}
+	}
+	if drop == 0 {
+		return
+	}
+
+	last := s.history[drop-1]
+	s.baseRevision, s.baseTime = last.revision, last.time
+
+	// Copy the survivors so dropped roots can be garbage collected
+	s.history = append([]kvRevision(nil), s.history[drop:]...)
+}
+
+// GetAt retrieves a value by path as it was at a point in the retained history
+func (s *KVStore) GetAt(path string, at PointInTime) (interface{}, error) {
+	data, err := s.snapshotAt(at)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.getFrom(data, path)
+}
+
+// snapshotAt returns the root that was current at the given point in time
+func (s *KVStore) snapshotAt(at PointInTime) (map[string]interface{}, error) {
+	s.historyMux.Lock()
+	defer s.historyMux.Unlock()
+
+	if !s.historyConfig.Enabled() {
+		return nil, ErrHistoryDisabled
+	}
+	s.pruneHistory(time.Now())
+
+	// Find the last retained write at or before the requested point
+	n := sort.Search(len(s.history), func(i int) bool {
+		if at.Time.IsZero() {
+			return s.history[i].revision > at.Revision
+		}
+		return s.history[i].time.After(at.Time)
+	})
+	if n > 0 {
+		return s.history[n-1].after, nil
+	}
+
+	// The point is before every retained write; the state before the oldest one is
+	// only known back to the last write that was dropped
+	if at.Time.IsZero() && at.Revision < s.baseRevision || !at.Time.IsZero() && at.Time.Before(s.baseTime) {
+		return nil, ErrRevisionNotFound
+	}
+	if len(s.history) == 0 {
+		return s.Snapshot(), nil
+	}
+	return s.history[0].before, nil
+}
 
-	return json.Marshal(s.data)
+// History lists the retained writes that touched path, oldest first.
+// When limit is positive only the most recent limit revisions are returned.
+func (s *KVStore) History(path string, limit int) ([]Revision, error) {
+	s.historyMux.Lock()
+	defer s.historyMux.Unlock()
+
+	if !s.historyConfig.Enabled() {
+		return nil, ErrHistoryDisabled
+	}
+	s.pruneHistory(time.Now())
+
+	var revisions []Revision
+	for _, entry := range s.history {
+		if !pathsOverlap(entry.path, path) {
+			continue
+		}
+
+		oldValue, oldExists := lookupPath(entry.before, entry.path)
+		newValue, newExists := lookupPath(entry.after, entry.path)
+		rev, changed := narrowRevision(Revision{
+			Revision: entry.revision,
+			Time:     entry.time,
+			Op:       entry.op,
+			Path:     entry.path,
+			OldValue: oldValue,
+			NewValue: newValue,
+			Created:  !oldExists,
+			Removed:  !newExists,
+		}, path)
+		if changed {
+			revisions = append(revisions, rev)
+		}
+	}
+
+	if limit > 0 && len(revisions) > limit {
+		revisions = revisions[len(revisions)-limit:]
+	}
+
+	return revisions, nil
 }
 
 // getValueByPath navigates the map using the provided path and returns the value
@@ -191,47 +446,49 @@ func (s *KVStore) getValueByPath(data map[string]interface{}, path string) (inte
 	return result, nil
 }
 
-// setValueByPath updates a value at the specified path
-func (s *KVStore) setValueByPath(data map[string]interface{}, path string, value interface{}) error {
-	// Create a matcher
-	matcher := query.NewMatcher()
-	
-	// Set the value at the path
-	err := matcher.Set(data, path, value)
+// setValueByPath writes a new root with value stored at path. The caller must hold writeMux.
+func (s *KVStore) setValueByPath(path string, value interface{}) error {
+	segments, err := parsePath(path)
 	if err != nil {
-		if err == query.ErrPathNotFound {
-			return ErrPathNotFound
-		}
 		return err
 	}
-	
+
+	newRoot, err := cowSet(s.Snapshot(), segments, value)
+	if err != nil {
+		return err
+	}
+
+	// Check the subtrees the new root would change before publishing it
+	if err := validateWrite(s.schemas, path, resolveInRoot(newRoot)); err != nil {
+		return err
+	}
+
+	s.swap(newRoot.(map[string]interface{}))
 	return nil
 }
 
-// deleteByPath removes a value at the specified path
-func (s *KVStore) deleteByPath(data map[string]interface{}, path string) error {
-	// Create a matcher
-	matcher := query.NewMatcher()
-	
-	// Delete the value at the path
-	err := matcher.Delete(data, path)
+// deleteByPath writes a new root with the value at path removed. The caller must hold writeMux.
+func (s *KVStore) deleteByPath(path string) error {
+	segments, err := parsePath(path)
 	if err != nil {
-		if err == query.ErrPathNotFound {
-			return ErrPathNotFound
-		}
 		return err
 	}
-	
+
+	newRoot, err := cowDelete(s.Snapshot(), segments)
+	if err != nil {
+		return err
+	}
+
+	s.swap(newRoot.(map[string]interface{}))
 	return nil
 }
 
 // FindMatches finds all values matching a path expression
 func (s *KVStore) FindMatches(path string) ([]query.MatchResult, error) {
-	s.mux.RLock()
-	defer s.mux.RUnlock()
-	
+	data := s.Snapshot()
+
 	// Log input for debugging
-	log.Printf("KVStore.FindMatches called with path: %s", path)
+	logging.Debugf("KVStore.FindMatches called with path: %s", path)
 	
 	// Extract key-value conditions from path if present
 	var cleanPath string = path
@@ -254,7 +511,7 @@ func (s *KVStore) FindMatches(path string) ([]query.MatchResult, error) {
 			
 			// Clean the path by removing the conditions
 			cleanPath = re.ReplaceAllString(path, "")
-			log.Printf("Path with key-value condition detected in FindMatches. Original path: %s, Clean path: %s, Conditions: %v", 
+			logging.Debugf("Path with key-value condition detected in FindMatches. Original path: %s, Clean path: %s, Conditions: %v", 
 				path, cleanPath, keyValueConditions)
 		}
 	}
@@ -268,14 +525,14 @@ func (s *KVStore) FindMatches(path string) ([]query.MatchResult, error) {
 			var result []query.MatchResult
 			
 			// First try getting the field from within "data"
-			if data, ok := s.data["data"].(map[string]interface{}); ok {
-				if fieldValue, ok := data[targetField]; ok {
-					log.Printf("Found %s at data.%s direct path", targetField, targetField)
+			if dataMap, ok := data["data"].(map[string]interface{}); ok {
+				if fieldValue, ok := dataMap[targetField]; ok {
+					logging.Debugf("Found %s at data.%s direct path", targetField, targetField)
 					
 					// Apply key-value filtering if needed
 					if len(keyValueConditions) > 0 {
 						fieldValue = s.applyKeyValueFiltering(fieldValue, keyValueConditions)
-						log.Printf("Applied key-value filtering to %s in FindMatches", targetField)
+						logging.Debugf("Applied key-value filtering to %s in FindMatches", targetField)
 					}
 					
 					result = append(result, query.MatchResult{
@@ -292,9 +549,9 @@ func (s *KVStore) FindMatches(path string) ([]query.MatchResult, error) {
 	matcher := query.NewMatcher()
 	
 	// Find matches
-	results, err := matcher.Match(s.data, cleanPath)
+	results, err := matcher.Match(data, cleanPath)
 	if err != nil {
-		log.Printf("Matcher.Match error: %v", err)
+		logging.Debugf("Matcher.Match error: %v", err)
 		return nil, err
 	}
 	
@@ -317,33 +574,37 @@ func (s *KVStore) FindMatches(path string) ([]query.MatchResult, error) {
 		}
 		
 		results = filteredResults
-		log.Printf("Applied key-value filtering to %d matches", len(results))
+		logging.Debugf("Applied key-value filtering to %d matches", len(results))
 	}
 	
-	log.Printf("Found %d matches for path %s", len(results), path)
+	logging.Debugf("Found %d matches for path %s", len(results), path)
 	return results, nil
 }
 
+// Ping always succeeds, the in-memory store has no backend to reach
+func (s *KVStore) Ping(ctx context.Context) error {
+	return nil
+}
+
 // DisplayStoreInfo displays the contents of the in-memory store
 func (s *KVStore) DisplayStoreInfo() error {
-	s.mux.RLock()
-	defer s.mux.RUnlock()
-	
-	log.Println("====== In-Memory Store Information ======")
+	data := s.Snapshot()
+
+	logging.Infof("====== In-Memory Store Information ======")
 	
 	// Check if store is empty
-	if len(s.data) == 0 {
-		log.Println("Store is empty")
-		log.Println("Collections: 0")
-		log.Println("Documents: 0")
-		log.Println("=====================================")
+	if len(data) == 0 {
+		logging.Infof("Store is empty")
+		logging.Infof("Collections: 0")
+		logging.Infof("Documents: 0")
+		logging.Infof("=====================================")
 		return nil
 	}
 	
 	// Convert data to JSON for nice display
-	jsonData, err := json.MarshalIndent(s.data, "", "  ")
+	jsonData, err := json.MarshalIndent(data, "", "  ")
 	if err != nil {
-		log.Printf("Error marshaling store data: %v", err)
+		logging.Errorf("Error marshaling store data: %v", err)
 		return err
 	}
 	
@@ -356,39 +617,39 @@ func (s *KVStore) DisplayStoreInfo() error {
 	collectionDetails := make(map[string]int)
 
 	// Show stats about the store
-	log.Printf("Store size: %.2f KB", dataSizeKB)
-	log.Printf("Top-level keys: %d", len(s.data))
+	logging.Infof("Store size: %.2f KB", dataSizeKB)
+	logging.Infof("Top-level keys: %d", len(data))
 	
 	// List all top-level keys and identify collections
-	log.Println("Top-level structure:")
-	for key, value := range s.data {
+	logging.Infof("Top-level structure:")
+	for key, value := range data {
 		// For map values, consider them as collections
 		if mapValue, ok := value.(map[string]interface{}); ok {
 			collections++
 			numDocs := len(mapValue)
 			documents += numDocs
 			collectionDetails[key] = numDocs
-			log.Printf("  %s: collection with %d documents", key, numDocs)
+			logging.Infof("  %s: collection with %d documents", key, numDocs)
 			
 			// Sample documents in this collection
 			if numDocs > 0 {
 				i := 0
 				for docKey, docValue := range mapValue {
 					if i >= 3 { // Only show first 3 documents
-						log.Printf("    ... and %d more documents", numDocs-3)
+						logging.Infof("    ... and %d more documents", numDocs-3)
 						break
 					}
 					
 					// Convert document to JSON for display
 					docJson, err := json.Marshal(docValue)
 					if err != nil {
-						log.Printf("    %s: [error marshaling]", docKey)
+						logging.Infof("    %s: [error marshaling]", docKey)
 					} else {
 						docStr := string(docJson)
 						if len(docStr) > 100 {
 							docStr = docStr[:100] + "... (truncated)"
 						}
-						log.Printf("    %s: %s", docKey, docStr)
+						logging.Infof("    %s: %s", docKey, docStr)
 					}
 					i++
 				}
@@ -399,7 +660,7 @@ func (s *KVStore) DisplayStoreInfo() error {
 			numDocs := len(sliceValue)
 			documents += numDocs
 			collectionDetails[key] = numDocs
-			log.Printf("  %s: array collection with %d documents", key, numDocs)
+			logging.Infof("  %s: array collection with %d documents", key, numDocs)
 			
 			// Sample documents in this collection
 			if numDocs > 0 {
@@ -407,43 +668,43 @@ func (s *KVStore) DisplayStoreInfo() error {
 					// Convert document to JSON for display
 					docJson, err := json.Marshal(sliceValue[i])
 					if err != nil {
-						log.Printf("    [%d]: [error marshaling]", i)
+						logging.Infof("    [%d]: [error marshaling]", i)
 					} else {
 						docStr := string(docJson)
 						if len(docStr) > 100 {
 							docStr = docStr[:100] + "... (truncated)"
 						}
-						log.Printf("    [%d]: %s", i, docStr)
+						logging.Infof("    [%d]: %s", i, docStr)
 					}
 				}
 				if numDocs > 3 {
-					log.Printf("    ... and %d more documents", numDocs-3)
+					logging.Infof("    ... and %d more documents", numDocs-3)
 				}
 			}
 		} else {
 			// For other values, show the type (these are not collections)
-			log.Printf("  %s: %T value", key, value)
+			logging.Infof("  %s: %T value", key, value)
 		}
 	}
 	
 	// Show collection summary
-	log.Printf("Collections found: %d", collections)
-	log.Printf("Total documents: %d", documents)
-	log.Println("Collection details:")
+	logging.Infof("Collections found: %d", collections)
+	logging.Infof("Total documents: %d", documents)
+	logging.Infof("Collection details:")
 	if len(collectionDetails) == 0 {
-		log.Println("  No collections found")
+		logging.Infof("  No collections found")
 	} else {
 		for coll, count := range collectionDetails {
-			log.Printf("  %s: %d documents", coll, count)
+			logging.Infof("  %s: %d documents", coll, count)
 		}
 	}
 	
 	// Show the full data if it's not too large
 	if dataSizeKB < 25 {
-		log.Println("Full store contents:")
-		log.Println(string(jsonData))
+		logging.Infof("Full store contents:")
+		logging.Infof("%s", jsonData)
 	} else {
-		log.Printf("Store contents too large to display (%.2f KB). Showing sample:", dataSizeKB)
+		logging.Infof("Store contents too large to display (%.2f KB). Showing sample:", dataSizeKB)
 		// Sample the first 20 lines of the JSON
 		lines := strings.Split(string(jsonData), "\n")
 		sampleSize := 20
@@ -451,12 +712,12 @@ func (s *KVStore) DisplayStoreInfo() error {
 			sampleSize = len(lines)
 		}
 		for i := 0; i < sampleSize; i++ {
-			log.Println(lines[i])
+			logging.Infof("%s", lines[i])
 		}
-		log.Printf("... (truncated, %.2f KB total)", dataSizeKB)
+		logging.Infof("... (truncated, %.2f KB total)", dataSizeKB)
 	}
 	
-	log.Println("=====================================")
+	logging.Infof("=====================================")
 	return nil
 }
 
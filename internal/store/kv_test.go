@@ -0,0 +1,186 @@
+package store_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/piske-alex/go-sse/internal/store"
+)
+
+func TestKVStore_SetSharesUnchangedSubtrees(t *testing.T) {
+	kvStore := store.NewStore()
+	kvStore.Initialize(map[string]interface{}{
+		"data": map[string]interface{}{
+			"positions": []interface{}{
+				map[string]interface{}{"id": "pos1", "trader": "abc"},
+			},
+			"config": map[string]interface{}{"maxUsers": float64(100)},
+		},
+	})
+
+	before := kvStore.Snapshot()
+
+	if err := kvStore.Set(".data.positions[0].trader", "xyz"); err != nil {
+		t.Fatalf("Failed to set value: %v", err)
+	}
+
+	after := kvStore.Snapshot()
+
+	// The old snapshot must not see the write
+	oldTrader := before["data"].(map[string]interface{})["positions"].([]interface{})[0].(map[string]interface{})["trader"]
+	if oldTrader != "abc" {
+		t.Errorf("Expected old snapshot to keep trader abc, got %v", oldTrader)
+	}
+
+	newTrader, err := kvStore.Get(".data.positions[0].trader")
+	if err != nil {
+		t.Fatalf("Failed to get value: %v", err)
+	}
+	if newTrader != "xyz" {
+		t.Errorf("Expected trader xyz, got %v", newTrader)
+	}
+
+	// Untouched subtrees are shared between versions rather than copied
+	oldConfig := before["data"].(map[string]interface{})["config"].(map[string]interface{})
+	newConfig := after["data"].(map[string]interface{})["config"].(map[string]interface{})
+	oldConfig["probe"] = true
+	if _, shared := newConfig["probe"]; !shared {
+		t.Errorf("Expected untouched subtree to be shared between snapshots")
+	}
+}
+
+func TestKVStore_DeleteKeepsSnapshots(t *testing.T) {
+	kvStore := store.NewStore()
+	kvStore.Initialize(map[string]interface{}{
+		"users": map[string]interface{}{"alice": "online", "bob": "offline"},
+	})
+
+	before := kvStore.Snapshot()
+
+	if err := kvStore.Delete(".users.bob"); err != nil {
+		t.Fatalf("Failed to delete value: %v", err)
+	}
+
+	if _, err := kvStore.Get(".users.bob"); err != store.ErrPathNotFound {
+		t.Errorf("Expected ErrPathNotFound after delete, got %v", err)
+	}
+	if _, exists := before["users"].(map[string]interface{})["bob"]; !exists {
+		t.Errorf("Expected old snapshot to keep deleted key")
+	}
+
+	if err := kvStore.Delete(".users.carol"); err != store.ErrPathNotFound {
+		t.Errorf("Expected ErrPathNotFound for missing key, got %v", err)
+	}
+}
+
+func TestKVStore_SetMissingArray(t *testing.T) {
+	kvStore := store.NewStore()
+	kvStore.Initialize(map[string]interface{}{"items": []interface{}{"a"}})
+
+	// An index cannot create an array, whatever its size
+	for _, path := range []string{".x[2000000000]", ".x[0]", ".a.b[2].c", ".items[1]"} {
+		if err := kvStore.Set(path, "value"); err != store.ErrPathNotFound {
+			t.Errorf("Expected ErrPathNotFound for %s, got %v", path, err)
+		}
+	}
+	if _, err := kvStore.Get(".x"); err != store.ErrPathNotFound {
+		t.Errorf("Expected a rejected write to leave the store unchanged, got %v", err)
+	}
+
+	// Missing objects are still created
+	if err := kvStore.Set(".a.b.c", "value"); err != nil {
+		t.Errorf("Expected missing objects to be created, got %v", err)
+	}
+}
+
+// TestKVStore_ConcurrentReadersAndWriters is meant to be run with -race
+func TestKVStore_ConcurrentReadersAndWriters(t *testing.T) {
+	kvStore := store.NewStore()
+	kvStore.Initialize(map[string]interface{}{
+		"data": map[string]interface{}{
+			"positions": []interface{}{
+				map[string]interface{}{"id": "pos0", "amount": float64(0)},
+				map[string]interface{}{"id": "pos1", "amount": float64(0)},
+			},
+		},
+	})
+
+	const writers = 4
+	const readers = 8
+	const iterations = 500
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers+readers)
+
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				path := fmt.Sprintf(".data.positions[%d].amount", i%2)
+				if err := kvStore.Set(path, float64(i)); err != nil {
+					errs <- err
+					return
+				}
+				if err := kvStore.Set(fmt.Sprintf(".data.writer%d", w), float64(i)); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(w)
+	}
+
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				// Read the live value and encode it after the call returned,
+				// the way BroadcastEvent and HandleStoreQuery do
+				value, err := kvStore.Get(".data.positions")
+				if err != nil {
+					errs <- err
+					return
+				}
+				if _, err := json.Marshal(value); err != nil {
+					errs <- err
+					return
+				}
+
+				// A snapshot must encode identically no matter how many writes happen in between
+				snapshot := kvStore.Snapshot()
+				first, _ := json.Marshal(snapshot)
+				second, _ := json.Marshal(snapshot)
+				if string(first) != string(second) {
+					errs <- fmt.Errorf("snapshot changed while being read")
+					return
+				}
+
+				if err := kvStore.ForEachKey(func(string, interface{}) error { return nil }); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	// Every writer's last write must have survived
+	for w := 0; w < writers; w++ {
+		value, err := kvStore.Get(fmt.Sprintf(".data.writer%d", w))
+		if err != nil {
+			t.Fatalf("Failed to get writer value: %v", err)
+		}
+		if value != float64(iterations-1) {
+			t.Errorf("Expected writer%d to be %d, got %v", w, iterations-1, value)
+		}
+	}
+}
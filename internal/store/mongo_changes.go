@@ -0,0 +1,492 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/piske-alex/go-sse/internal/logging"
+	"github.com/piske-alex/go-sse/internal/query"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// changeStreamMinBackoff is the delay before the first reconnection attempt
+	changeStreamMinBackoff = 500 * time.Millisecond
+	// changeStreamMaxBackoff caps the delay between reconnection attempts
+	changeStreamMaxBackoff = 30 * time.Second
+	// resumeTokenInterval is how often the position in the change stream is persisted
+	resumeTokenInterval = time.Second
+	// resumeTokenPrefix prefixes the _id of the document holding a store's resume token
+	resumeTokenPrefix = "change_stream:"
+)
+
+// MongoDB error codes that end a change stream for good
+const (
+	errCodeChangeStreamHistoryLost = 286
+	errCodeChangeStreamFatal       = 280
+	errCodeChangeStreamUnsupported = 40573
+)
+
+// Change stream states reported by ChangeStreamStatus
+const (
+	ChangeStreamStopped     = "stopped"     // No listener is registered or the store is disconnected
+	ChangeStreamConnecting  = "connecting"  // Opening the stream
+	ChangeStreamRunning     = "running"     // Receiving events
+	ChangeStreamRetrying    = "retrying"    // Waiting to reconnect after an error
+	ChangeStreamUnsupported = "unsupported" // The server has no change streams, e.g. a standalone mongod
+)
+
+// ChangeStreamStatus describes the health of a MongoStore's change stream
+type ChangeStreamStatus struct {
+	State       string     `json:"state"`
+	Mode        string     `json:"mode"`
+	Resumed     bool       `json:"resumed"` // The stream continued from a persisted resume token
+	Restarts    int        `json:"restarts"`
+	LastEventAt *time.Time `json:"last_event_at,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+// resumeTokenDocument persists the position of a change stream in the "<collection>_meta" collection
+type resumeTokenDocument struct {
+	ID    string   `bson:"_id"`
+	Token bson.Raw `bson:"token"`
+}
+
+// SetChangeListener sets a callback function that will be called when the data changes.
+// Registering the first listener starts the change stream, which then reconnects with
+// backoff on errors and resumes after the last event it handled, including across restarts.
+func (s *MongoStore) SetChangeListener(listener func(path string, value interface{})) {
+	s.changeMux.Lock()
+	defer s.changeMux.Unlock()
+
+	s.changeListener = listener
+	if listener != nil && s.changeStream.State == "" {
+		s.changeStream.State = ChangeStreamConnecting
+		s.changeDone.Add(1)
+		go s.watchChanges()
+	}
+}
+
+// ChangeStreamStatus returns the current health of the change stream
+func (s *MongoStore) ChangeStreamStatus() ChangeStreamStatus {
+	s.changeMux.Lock()
+	defer s.changeMux.Unlock()
+
+	status := s.changeStream
+	if status.State == "" {
+		status.State = ChangeStreamStopped
+	}
+	status.Mode = s.mode()
+	return status
+}
+
+// ReportsWrites reports whether the change stream delivers the store's own writes to the
+// change listener, so that callers must not broadcast them a second time. It becomes true
+// once the stream first runs: from then on, a stream that restarts resumes after the last
+// event it handled. It is false when the deployment does not support change streams.
+func (s *MongoStore) ReportsWrites() bool {
+	s.changeMux.Lock()
+	defer s.changeMux.Unlock()
+	return s.reportsWrites
+}
+
+// mode names the store's root mode for logs and status reports
+func (s *MongoStore) mode() string {
+	if s.useCollection {
+		return "collection"
+	}
+	return "document"
+}
+
+// updateChangeStream modifies the change stream status under its lock
+func (s *MongoStore) updateChangeStream(update func(status *ChangeStreamStatus)) {
+	s.changeMux.Lock()
+	defer s.changeMux.Unlock()
+	update(&s.changeStream)
+}
+
+// watchChanges runs the change stream until the store is disconnected, reconnecting with
+// exponential backoff. The backoff resets once a stream has delivered events.
+func (s *MongoStore) watchChanges() {
+	defer s.changeDone.Done()
+	backoff := changeStreamMinBackoff
+
+	for {
+		delivered, err := s.runChangeStream()
+		if s.context.Err() != nil {
+			s.updateChangeStream(func(status *ChangeStreamStatus) { status.State = ChangeStreamStopped })
+			return
+		}
+
+		var serverErr mongo.ServerError
+		if errors.As(err, &serverErr) && serverErr.HasErrorCode(errCodeChangeStreamUnsupported) {
+			logging.Warnf("MongoDB change streams are not supported by this deployment; external writes will not be broadcast: %v", err)
+			s.updateChangeStream(func(status *ChangeStreamStatus) {
+				now := time.Now()
+				status.State = ChangeStreamUnsupported
+				status.LastError, status.LastErrorAt = err.Error(), &now
+			})
+			return
+		}
+
+		if delivered {
+			backoff = changeStreamMinBackoff
+		}
+		if err == nil {
+			err = errors.New("change stream closed")
+		}
+
+		logging.Warnf("Change stream error, reconnecting in %s: %v", backoff, err)
+		s.updateChangeStream(func(status *ChangeStreamStatus) {
+			now := time.Now()
+			status.State = ChangeStreamRetrying
+			status.Restarts++
+			status.LastError, status.LastErrorAt = err.Error(), &now
+		})
+
+		select {
+		case <-s.context.Done():
+			s.updateChangeStream(func(status *ChangeStreamStatus) { status.State = ChangeStreamStopped })
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > changeStreamMaxBackoff {
+			backoff = changeStreamMaxBackoff
+		}
+	}
+}
+
+// runChangeStream opens the change stream and handles events until it fails.
+// It reports whether any event was handled.
+func (s *MongoStore) runChangeStream() (bool, error) {
+	s.updateChangeStream(func(status *ChangeStreamStatus) { status.State = ChangeStreamConnecting })
+
+	// Create a pipeline that filters for document changes
+	var pipeline mongo.Pipeline
+	if s.useCollection {
+		// In collection mode, watch all document changes in the collection
+		pipeline = mongo.Pipeline{
+			bson.D{
+				{Key: "$match", Value: bson.D{
+					{Key: "operationType", Value: bson.D{
+						{Key: "$in", Value: bson.A{"update", "replace", "insert", "delete"}},
+					}},
+				}},
+			},
+		}
+	} else {
+		// In document mode, watch only our specific document
+		pipeline = mongo.Pipeline{
+			bson.D{
+				{Key: "$match", Value: bson.D{
+					{Key: "operationType", Value: bson.D{
+						{Key: "$in", Value: bson.A{"update", "replace", "insert", "delete"}},
+					}},
+					{Key: "documentKey._id", Value: s.documentID},
+				}},
+			},
+		}
+	}
+
+	// Updates are reported from their update description, and inserts and replacements
+	// carry the full document anyway, so the document is never looked up
+	opts := options.ChangeStream()
+
+	// Continue after the last event handled by a previous stream
+	token, err := s.loadResumeToken()
+	if err != nil {
+		logging.Errorf("Error loading change stream resume token: %v", err)
+	}
+	if token != nil {
+		opts.SetResumeAfter(token)
+	}
+
+	changeStream, err := s.collection.Watch(s.context, pipeline, opts)
+	if err != nil {
+		var serverErr mongo.ServerError
+		if token != nil && errors.As(err, &serverErr) &&
+			(serverErr.HasErrorCode(errCodeChangeStreamHistoryLost) || serverErr.HasErrorCode(errCodeChangeStreamFatal)) {
+			// The oplog no longer reaches back to the token; start from now on the next attempt
+			logging.Warnf("Change stream resume token expired, events written meanwhile were missed: %v", err)
+			s.clearResumeToken()
+		}
+		return false, err
+	}
+	defer changeStream.Close(context.Background())
+
+	logging.Infof("MongoDB change stream set up for %s mode", s.mode())
+
+	// Record the starting point so events written before the first one is handled survive a restart
+	if token == nil {
+		s.saveResumeToken(changeStream.ResumeToken())
+	}
+
+	s.changeMux.Lock()
+	s.changeStream.State = ChangeStreamRunning
+	s.changeStream.Resumed = token != nil
+	s.reportsWrites = true
+	s.changeMux.Unlock()
+
+	// Persist the position reached when the stream stops for any reason
+	delivered := false
+	lastSaved := time.Now()
+	defer func() {
+		if delivered {
+			s.saveResumeToken(changeStream.ResumeToken())
+		}
+	}()
+
+	// Process change events
+	for changeStream.Next(s.context) {
+		// Decode the change event
+		var changeEvent bson.M
+		if err := changeStream.Decode(&changeEvent); err != nil {
+			logging.Errorf("Error decoding change event: %v", err)
+			continue
+		}
+
+		s.handleChangeEvent(changeEvent)
+		delivered = true
+
+		now := time.Now()
+		s.updateChangeStream(func(status *ChangeStreamStatus) { status.LastEventAt = &now })
+		if now.Sub(lastSaved) >= resumeTokenInterval {
+			s.saveResumeToken(changeStream.ResumeToken())
+			lastSaved = now
+		}
+	}
+
+	return delivered, changeStream.Err()
+}
+
+// handleChangeEvent notifies the change listener of a change event
+func (s *MongoStore) handleChangeEvent(changeEvent bson.M) {
+	s.changeMux.Lock()
+	listener := s.changeListener
+	s.changeMux.Unlock()
+	if listener == nil {
+		return
+	}
+
+	operationType, _ := changeEvent["operationType"].(string)
+
+	// Get the document ID, which is the first segment of the paths in collection mode
+	var docID string
+	if documentKey, ok := changeEvent["documentKey"].(bson.M); ok {
+		if id, ok := documentKey["_id"]; ok {
+			docID = fmt.Sprintf("%v", id)
+		}
+	}
+
+	if s.useCollection && docID == "" {
+		return // Skip if no document ID
+	}
+
+	switch operationType {
+	case "update":
+		// Report each changed path rather than the whole document
+		description, ok := changeEvent["updateDescription"].(bson.M)
+		if !ok {
+			return
+		}
+		for _, entry := range s.updateEntries(docID, description) {
+			listener(entry.Path, entry.Value)
+		}
+		return
+
+	case "delete":
+		// For delete operations, notify with null value. Deleting the store's
+		// document in document mode removes the whole store.
+		if s.useCollection {
+			listener(query.PropertyPath(docID), nil)
+		} else {
+			listener(".", nil)
+		}
+		return
+	}
+
+	// Inserts and replacements carry the whole document
+	fullDocument, ok := changeEvent["fullDocument"].(bson.M)
+	if !ok {
+		return
+	}
+
+	if s.useCollection {
+		// Notify with the full document
+		listener(query.PropertyPath(docID), normalizeValue(fullDocument))
+		return
+	}
+
+	// Document mode - extract data field from our document
+	dataMap, ok := normalizeValue(fullDocument["data"]).(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	// Notify the change listener
+	listener(".", dataMap)
+}
+
+// updateEntries converts the update description of a change event into the changed
+// paths and their new values. Removed fields have a nil value. Paths are JQ-style;
+// in collection mode their first segment is the document ID, e.g. ".alice.status".
+func (s *MongoStore) updateEntries(docID string, description bson.M) []Entry {
+	var entries []Entry
+
+	// Arrays shortened by $pop, $pull or $set are reported with their remaining elements
+	if truncated, ok := description["truncatedArrays"].(bson.A); ok {
+		for _, item := range truncated {
+			array, ok := item.(bson.M)
+			if !ok {
+				continue
+			}
+			field, _ := array["field"].(string)
+			path, ok := s.changedPath(docID, field)
+			if !ok {
+				continue
+			}
+
+			value, exists, err := s.lookupChanged(path)
+			if err != nil {
+				logging.Errorf("Error reading truncated array %s: %v", path, err)
+				continue
+			}
+			if exists {
+				entries = append(entries, Entry{Path: path, Value: value})
+			}
+		}
+	}
+
+	if updated, ok := description["updatedFields"].(bson.M); ok {
+		fields := make([]string, 0, len(updated))
+		for field := range updated {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+
+		for _, field := range fields {
+			if path, ok := s.changedPath(docID, field); ok {
+				entries = append(entries, Entry{Path: path, Value: normalizeValue(updated[field])})
+			}
+		}
+	}
+
+	if removed, ok := description["removedFields"].(bson.A); ok {
+		for _, item := range removed {
+			field, _ := item.(string)
+			if path, ok := s.changedPath(docID, field); ok {
+				entries = append(entries, Entry{Path: path, Value: nil})
+			}
+		}
+	}
+
+	return entries
+}
+
+// changedPath converts a dotted MongoDB field name from a change event to a store path,
+// e.g. "data.a.b.3" to ".a.b[3]", or "status" of document "alice" to ".alice.status" in
+// collection mode. Numeric components are taken to be array indexes.
+// It reports false for fields outside the store's data.
+func (s *MongoStore) changedPath(docID, field string) (string, bool) {
+	if field == "" {
+		return "", false
+	}
+
+	parts := strings.Split(field, ".")
+	if !s.useCollection {
+		if parts[0] != "data" {
+			return "", false
+		}
+		parts = parts[1:]
+	}
+
+	var b strings.Builder
+	if s.useCollection {
+		b.WriteString(query.PropertyPath(docID))
+	}
+	for _, part := range parts {
+		if _, err := strconv.Atoi(part); err == nil {
+			b.WriteString("[" + part + "]")
+		} else {
+			b.WriteString(query.PropertyPath(part))
+		}
+	}
+
+	if b.Len() == 0 {
+		return ".", true
+	}
+	return b.String(), true
+}
+
+// lookupChanged reads the current value at a path reported by the change stream
+func (s *MongoStore) lookupChanged(path string) (interface{}, bool, error) {
+	ctx, cancel := context.WithTimeout(s.context, 5*time.Second)
+	defer cancel()
+	return s.currentValue(ctx, path)
+}
+
+// resumeTokenID is the _id of the document holding the store's resume token
+func (s *MongoStore) resumeTokenID() string {
+	if s.useCollection {
+		return resumeTokenPrefix + s.collection.Name()
+	}
+	return resumeTokenPrefix + s.collection.Name() + ":" + s.documentID
+}
+
+// loadResumeToken returns the persisted resume token, or nil when there is none
+func (s *MongoStore) loadResumeToken() (bson.Raw, error) {
+	ctx, cancel := context.WithTimeout(s.context, 5*time.Second)
+	defer cancel()
+
+	var doc resumeTokenDocument
+	err := s.meta.FindOne(ctx, bson.M{"_id": s.resumeTokenID()}).Decode(&doc)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return doc.Token, nil
+}
+
+// saveResumeToken persists the position of the change stream.
+// Failures are logged because the stream itself is unaffected.
+func (s *MongoStore) saveResumeToken(token bson.Raw) {
+	if token == nil {
+		return
+	}
+
+	// The store may be shutting down, so do not derive from its context
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := s.meta.ReplaceOne(
+		ctx,
+		bson.M{"_id": s.resumeTokenID()},
+		resumeTokenDocument{ID: s.resumeTokenID(), Token: token},
+		options.Replace().SetUpsert(true),
+	)
+	if err != nil {
+		logging.Errorf("Error saving change stream resume token: %v", err)
+	}
+}
+
+// clearResumeToken forgets the persisted position of the change stream
+func (s *MongoStore) clearResumeToken() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := s.meta.DeleteOne(ctx, bson.M{"_id": s.resumeTokenID()}); err != nil {
+		logging.Errorf("Error clearing change stream resume token: %v", err)
+	}
+}
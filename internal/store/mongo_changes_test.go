@@ -0,0 +1,250 @@
+package store_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/piske-alex/go-sse/internal/store"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// changeRecorder collects change notifications from a MongoDB store
+type changeRecorder struct {
+	changes chan store.Entry
+}
+
+func newChangeRecorder(s *store.MongoStore) *changeRecorder {
+	r := &changeRecorder{changes: make(chan store.Entry, 100)}
+	s.SetChangeListener(func(path string, value interface{}) {
+		r.changes <- store.Entry{Path: path, Value: value}
+	})
+	return r
+}
+
+// waitFor returns the first change that satisfies match or fails after timeout
+func (r *changeRecorder) waitFor(t *testing.T, timeout time.Duration, match func(store.Entry) bool) store.Entry {
+	t.Helper()
+	deadline := time.After(timeout)
+	for {
+		select {
+		case entry := <-r.changes:
+			if match(entry) {
+				return entry
+			}
+		case <-deadline:
+			t.Fatal("Timed out waiting for change event")
+			return store.Entry{}
+		}
+	}
+}
+
+// waitForChangeStream waits until the store's change stream runs, skipping the test
+// when the deployment does not support change streams
+func waitForChangeStream(t *testing.T, s *store.MongoStore) store.ChangeStreamStatus {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		status := s.ChangeStreamStatus()
+		switch status.State {
+		case store.ChangeStreamRunning:
+			return status
+		case store.ChangeStreamUnsupported:
+			t.Skip("MongoDB deployment does not support change streams, skipping test")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("Change stream did not start: %+v", s.ChangeStreamStatus())
+	return store.ChangeStreamStatus{}
+}
+
+// externalCollection connects a separate client to write to MongoDB behind the store's back
+func externalCollection(t *testing.T, mongouri, collectionName string) *mongo.Collection {
+	t.Helper()
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(mongouri))
+	if err != nil {
+		t.Fatalf("Failed to connect to MongoDB: %v", err)
+	}
+	t.Cleanup(func() { client.Disconnect(context.Background()) })
+	return client.Database("gosse_test").Collection(collectionName)
+}
+
+func TestMongoStore_ChangeStreamResumes(t *testing.T) {
+	skipIfNoMongo(t)
+
+	mongouri := os.Getenv("MONGO_URI")
+	if mongouri == "" {
+		mongouri = "mongodb://localhost:27017"
+	}
+
+	documentID := "changes_" + time.Now().Format("20060102150405")
+	s, err := store.NewMongoStore(mongouri, "gosse_test", "store_test", documentID)
+	if err != nil {
+		t.Fatalf("Failed to create MongoDB store: %v", err)
+	}
+
+	if status := s.ChangeStreamStatus(); status.State != store.ChangeStreamStopped {
+		t.Errorf("Expected the stream to wait for a listener, got %+v", status)
+	}
+
+	recorder := newChangeRecorder(s)
+	waitForChangeStream(t, s)
+
+	if err := s.Initialize(map[string]interface{}{"count": 1}); err != nil {
+		t.Fatalf("Failed to initialize store: %v", err)
+	}
+
+	// Writes made directly to MongoDB reach the listener
+	external := externalCollection(t, mongouri, "store_test")
+	ctx := context.Background()
+	if _, err := external.UpdateOne(ctx, bson.M{"_id": documentID}, bson.M{"$set": bson.M{"data.count": 2}}); err != nil {
+		t.Fatalf("Failed to write externally: %v", err)
+	}
+	recorder.waitFor(t, 5*time.Second, func(e store.Entry) bool {
+		return e.Path == ".count" && e.Value == float64(2)
+	})
+
+	// Changes made while the store is down are delivered after a restart
+	s.Disconnect()
+	if _, err := external.UpdateOne(ctx, bson.M{"_id": documentID}, bson.M{"$set": bson.M{"data.count": 3}}); err != nil {
+		t.Fatalf("Failed to write externally: %v", err)
+	}
+
+	restarted, err := store.NewMongoStore(mongouri, "gosse_test", "store_test", documentID)
+	if err != nil {
+		t.Fatalf("Failed to create MongoDB store: %v", err)
+	}
+	defer restarted.Disconnect()
+
+	recorder = newChangeRecorder(restarted)
+	if status := waitForChangeStream(t, restarted); !status.Resumed {
+		t.Errorf("Expected the stream to resume from the saved token, got %+v", status)
+	}
+	recorder.waitFor(t, 5*time.Second, func(e store.Entry) bool {
+		return e.Path == ".count" && e.Value == float64(3)
+	})
+}
+
+func TestMongoStore_ChangeStreamCollectionMode(t *testing.T) {
+	skipIfNoMongo(t)
+
+	mongouri := os.Getenv("MONGO_URI")
+	if mongouri == "" {
+		mongouri = "mongodb://localhost:27017"
+	}
+
+	collectionName := "changes_" + time.Now().Format("20060102150405")
+	s, err := store.NewMongoStore(mongouri, "gosse_test", collectionName, "")
+	if err != nil {
+		t.Fatalf("Failed to create MongoDB store: %v", err)
+	}
+	defer s.Disconnect()
+
+	recorder := newChangeRecorder(s)
+	if status := waitForChangeStream(t, s); status.Mode != "collection" {
+		t.Errorf("Expected collection mode, got %+v", status)
+	}
+
+	external := externalCollection(t, mongouri, collectionName)
+	if _, err := external.InsertOne(context.Background(), bson.M{"_id": "alice", "status": "online"}); err != nil {
+		t.Fatalf("Failed to write externally: %v", err)
+	}
+	recorder.waitFor(t, 5*time.Second, func(e store.Entry) bool { return e.Path == ".alice" })
+
+	// Updates are reported at the changed field below the document
+	if _, err := external.UpdateOne(context.Background(), bson.M{"_id": "alice"}, bson.M{"$set": bson.M{"status": "away"}}); err != nil {
+		t.Fatalf("Failed to update externally: %v", err)
+	}
+	entry := recorder.waitFor(t, 5*time.Second, func(e store.Entry) bool { return e.Path == ".alice.status" && e.Value == "away" })
+
+	// Event paths can be read and written back through the store
+	if value, err := s.Get(entry.Path); err != nil || value != "away" {
+		t.Errorf("Expected to read away at %s, got %v %v", entry.Path, value, err)
+	}
+	if _, err := external.InsertOne(context.Background(), bson.M{"_id": "user-1", "status": "online"}); err != nil {
+		t.Fatalf("Failed to write externally: %v", err)
+	}
+	entry = recorder.waitFor(t, 5*time.Second, func(e store.Entry) bool { return e.Path == `."user-1"` })
+	if err := s.Set(entry.Path+".status", "away"); err != nil {
+		t.Fatalf("Failed to write back at %s: %v", entry.Path, err)
+	}
+	recorder.waitFor(t, 5*time.Second, func(e store.Entry) bool { return e.Path == `."user-1".status` && e.Value == "away" })
+	if value, err := s.Get(`."user-1".status`); err != nil || value != "away" {
+		t.Errorf("Expected to read away, got %v %v", value, err)
+	}
+
+	if _, err := external.DeleteOne(context.Background(), bson.M{"_id": "alice"}); err != nil {
+		t.Fatalf("Failed to delete externally: %v", err)
+	}
+	recorder.waitFor(t, 5*time.Second, func(e store.Entry) bool { return e.Path == ".alice" && e.Value == nil })
+}
+
+func TestMongoStore_ChangeStreamFineGrained(t *testing.T) {
+	skipIfNoMongo(t)
+
+	mongouri := os.Getenv("MONGO_URI")
+	if mongouri == "" {
+		mongouri = "mongodb://localhost:27017"
+	}
+
+	documentID := "fine_" + time.Now().Format("20060102150405")
+	s, err := store.NewMongoStore(mongouri, "gosse_test", "store_test", documentID)
+	if err != nil {
+		t.Fatalf("Failed to create MongoDB store: %v", err)
+	}
+	defer s.Disconnect()
+
+	recorder := newChangeRecorder(s)
+	waitForChangeStream(t, s)
+
+	err = s.Initialize(map[string]interface{}{
+		"a":     map[string]interface{}{"b": []interface{}{"x", "y", "z"}},
+		"extra": true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to initialize store: %v", err)
+	}
+	recorder.waitFor(t, 5*time.Second, func(e store.Entry) bool { return e.Path == "." })
+
+	external := externalCollection(t, mongouri, "store_test")
+	ctx := context.Background()
+	filter := bson.M{"_id": documentID}
+
+	// A nested array element
+	if _, err := external.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"data.a.b.1": "Y"}}); err != nil {
+		t.Fatalf("Failed to update externally: %v", err)
+	}
+	recorder.waitFor(t, 5*time.Second, func(e store.Entry) bool { return e.Path == ".a.b[1]" && e.Value == "Y" })
+
+	// A removed field is reported with a nil value
+	if _, err := external.UpdateOne(ctx, filter, bson.M{"$unset": bson.M{"data.extra": ""}}); err != nil {
+		t.Fatalf("Failed to update externally: %v", err)
+	}
+	recorder.waitFor(t, 5*time.Second, func(e store.Entry) bool { return e.Path == ".extra" && e.Value == nil })
+
+	// A shortened array is reported with its remaining elements
+	if _, err := external.UpdateOne(ctx, filter, bson.M{"$pop": bson.M{"data.a.b": 1}}); err != nil {
+		t.Fatalf("Failed to update externally: %v", err)
+	}
+	recorder.waitFor(t, 5*time.Second, func(e store.Entry) bool {
+		array, ok := e.Value.([]interface{})
+		return e.Path == ".a.b" && ok && len(array) == 2
+	})
+
+	// Deleting the document, through the store or directly, deletes the root
+	if err := s.Delete("."); err != nil {
+		t.Fatalf("Failed to delete store: %v", err)
+	}
+	recorder.waitFor(t, 5*time.Second, func(e store.Entry) bool { return e.Path == "." && e.Value == nil })
+
+	if err := s.Initialize(map[string]interface{}{"a": true}); err != nil {
+		t.Fatalf("Failed to initialize store: %v", err)
+	}
+	if _, err := external.DeleteOne(ctx, filter); err != nil {
+		t.Fatalf("Failed to delete externally: %v", err)
+	}
+	recorder.waitFor(t, 5*time.Second, func(e store.Entry) bool { return e.Path == "." && e.Value == nil })
+}
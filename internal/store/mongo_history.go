@@ -0,0 +1,315 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/piske-alex/go-sse/internal/logging"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoHistoryBytes is the size limit of the capped history collection
+const mongoHistoryBytes = 256 << 20
+
+// revisionCounterPrefix prefixes the _id of the document holding a store's last revision number
+const revisionCounterPrefix = "history_revision:"
+
+// mongoRevision is a Revision as stored in the history collection, which stores sharing a collection also share
+type mongoRevision struct {
+	Revision `bson:",inline"`
+	Document string `bson:"document"`
+}
+
+// capturedValue is the value at a path read before a write
+type capturedValue struct {
+	value  interface{}
+	exists bool
+}
+
+// EnableHistory records revisions in a capped collection named "<collection>_history".
+// MaxRevisions, when set, caps the collection; MaxAge is applied when history is read, because
+// documents cannot be removed from a capped collection.
+func (s *MongoStore) EnableHistory(config HistoryConfig) error {
+	if !config.Enabled() {
+		s.historyConfig = config
+		s.history = nil
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	name := s.collection.Name() + "_history"
+	opts := options.CreateCollection().
+		SetCapped(true).
+		SetSizeInBytes(mongoHistoryBytes)
+	if config.MaxRevisions > 0 {
+		opts.SetMaxDocuments(int64(config.MaxRevisions))
+	}
+
+	err := s.database.CreateCollection(ctx, name, opts)
+	if err != nil {
+		var cmdErr mongo.CommandError
+		if !errors.As(err, &cmdErr) || cmdErr.Name != "NamespaceExists" {
+			return fmt.Errorf("failed to create history collection: %w", err)
+		}
+		logging.Infof("Using existing history collection '%s'", name)
+	}
+
+	s.historyConfig = config
+	s.history = s.database.Collection(name, mapDocumentsOption())
+	return nil
+}
+
+// mapDocumentsOption decodes nested documents as maps so values convert cleanly to JSON
+func mapDocumentsOption() *options.CollectionOptions {
+	return options.Collection().SetBSONOptions(&options.BSONOptions{DefaultDocumentM: true})
+}
+
+// currentValue reads the value at path straight from MongoDB, normalized to JSON types
+func (s *MongoStore) currentValue(ctx context.Context, path string) (interface{}, bool, error) {
+	if s.useCollection {
+		if path == "" || path == "." {
+			data, err := s.ToJSON()
+			if err != nil {
+				return nil, false, err
+			}
+			var root map[string]interface{}
+			if err := json.Unmarshal(data, &root); err != nil {
+				return nil, false, err
+			}
+			return root, true, nil
+		}
+
+		// The first segment is the document ID
+		value, err := findInCollection(ctx, s.mapped, path)
+		if err != nil {
+			if err == ErrPathNotFound {
+				return nil, false, nil
+			}
+			return nil, false, err
+		}
+		return value, true, nil
+	}
+
+	var doc Document
+	err := s.mapped.FindOne(ctx, bson.M{"_id": s.documentID}).Decode(&doc)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			if path == "" || path == "." {
+				return map[string]interface{}{}, true, nil
+			}
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	if doc.Data == nil {
+		doc.Data = map[string]interface{}{}
+	}
+	value, exists := lookupPath(normalizeValue(doc.Data), path)
+	return value, exists, nil
+}
+
+// captureRevision reads the value a write is about to replace, or returns nil when history is disabled
+func (s *MongoStore) captureRevision(path string) *capturedValue {
+	if s.history == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	value, exists, err := s.currentValue(ctx, path)
+	if err != nil {
+		logging.Errorf("Error reading %s for history: %v", path, err)
+		return nil
+	}
+
+	return &capturedValue{value: value, exists: exists}
+}
+
+// recordRevision appends a completed write to the history collection.
+// Failures are logged rather than returned because the write itself has already succeeded.
+func (s *MongoStore) recordRevision(op, path string, before *capturedValue, value interface{}, removed bool) {
+	if s.history == nil || before == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Allocate the next revision number
+	var counter struct {
+		Seq uint64 `bson:"seq"`
+	}
+	err := s.meta.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": revisionCounterPrefix + s.documentID},
+		bson.M{"$inc": bson.M{"seq": 1}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	if err != nil {
+		logging.Errorf("Error allocating history revision: %v", err)
+		return
+	}
+
+	rev := mongoRevision{
+		Revision: Revision{
+			Revision: counter.Seq,
+			Time:     time.Now().UTC(),
+			Op:       op,
+			Path:     path,
+			OldValue: before.value,
+			NewValue: normalizeValue(value),
+			Created:  !before.exists,
+			Removed:  removed,
+		},
+		Document: s.documentID,
+	}
+	if _, err := s.history.InsertOne(ctx, rev); err != nil {
+		logging.Errorf("Error recording history for %s: %v", path, err)
+	}
+}
+
+// findRevisions returns this store's retained revisions matching filter in the given revision order
+func (s *MongoStore) findRevisions(ctx context.Context, filter bson.M, order int, limit int64) ([]Revision, error) {
+	conditions := bson.A{filter, bson.M{"document": s.documentID}}
+	if s.historyConfig.MaxAge > 0 {
+		conditions = append(conditions, bson.M{"time": bson.M{"$gte": time.Now().Add(-s.historyConfig.MaxAge)}})
+	}
+	filter = bson.M{"$and": conditions}
+
+	opts := options.Find().SetSort(bson.D{{Key: "revision", Value: order}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	cursor, err := s.history.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var revisions []Revision
+	for cursor.Next(ctx) {
+		var rev Revision
+		if err := cursor.Decode(&rev); err != nil {
+			return nil, err
+		}
+		rev.OldValue = normalizeValue(rev.OldValue)
+		rev.NewValue = normalizeValue(rev.NewValue)
+		revisions = append(revisions, rev)
+	}
+
+	return revisions, cursor.Err()
+}
+
+// GetAt retrieves a value by path as it was at a point in the retained history.
+// It starts from the current value and undoes newer revisions that touched path.
+func (s *MongoStore) GetAt(path string, at PointInTime) (interface{}, error) {
+	if s.history == nil {
+		return nil, ErrHistoryDisabled
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Resolve a timestamp to the last revision written at or before it
+	revision := at.Revision
+	if !at.Time.IsZero() {
+		latest, err := s.findRevisions(ctx, bson.M{"time": bson.M{"$lte": at.Time}}, -1, 1)
+		if err != nil {
+			return nil, err
+		}
+		if len(latest) == 0 {
+			return nil, ErrRevisionNotFound
+		}
+		revision = latest[0].Revision
+	}
+
+	// The history must reach back to the revision right after the requested one
+	oldest, err := s.findRevisions(ctx, bson.M{}, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(oldest) > 0 && revision+1 < oldest[0].Revision {
+		return nil, ErrRevisionNotFound
+	}
+
+	value, exists, err := s.currentValue(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	newer, err := s.findRevisions(ctx, bson.M{"revision": bson.M{"$gt": revision}}, -1, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, rev := range newer {
+		if pathsOverlap(rev.Path, path) {
+			value, exists = undoRevision(value, exists, path, rev)
+		}
+	}
+
+	if !exists {
+		return nil, ErrPathNotFound
+	}
+	return value, nil
+}
+
+// History lists the retained writes that touched path, oldest first.
+// When limit is positive only the most recent limit revisions are returned.
+func (s *MongoStore) History(path string, limit int) ([]Revision, error) {
+	if s.history == nil {
+		return nil, ErrHistoryDisabled
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	all, err := s.findRevisions(ctx, bson.M{}, 1, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var revisions []Revision
+	for _, rev := range all {
+		if !pathsOverlap(rev.Path, path) {
+			continue
+		}
+		if narrowed, changed := narrowRevision(rev, path); changed {
+			revisions = append(revisions, narrowed)
+		}
+	}
+
+	if limit > 0 && len(revisions) > limit {
+		revisions = revisions[len(revisions)-limit:]
+	}
+
+	return revisions, nil
+}
+
+// normalizeValue converts BSON documents and arrays into plain JSON maps and slices
+func normalizeValue(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+
+	var normalized interface{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return value
+	}
+
+	return normalized
+}
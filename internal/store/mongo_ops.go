@@ -0,0 +1,247 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxOperationAttempts bounds the retries of operations made of several conditional updates
+const maxOperationAttempts = 3
+
+// Apply performs op on the value at path with a single MongoDB update operator
+// ($push, $pull, $inc or $set), so concurrent operations from any instance never
+// lose each other's writes. Remove predicates use MongoDB query equality, and an
+// object passed as the value to remove is treated as a where predicate.
+func (s *MongoStore) Apply(path string, op Operation) ([]Change, error) {
+	if path == "" || path == "." {
+		return nil, errRootOperation
+	}
+	if err := validateOperation(op); err != nil {
+		return nil, err
+	}
+
+	target, err := s.mongoPathFor(path)
+	if err != nil {
+		return nil, err
+	}
+	if target.field == "" {
+		return nil, invalidOperation("path %s addresses a whole document", path)
+	}
+	filter, field := target.elementFilter(), target.field
+
+	// $pull matches objects as queries, so describe the removal the same way
+	if op.Op == OpRemove && op.Where == nil {
+		if where, ok := toStringMap(op.Value); ok {
+			op.Where = where
+		}
+	}
+
+	if err := s.validateApply(path, op); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var before capturedValue
+	switch op.Op {
+	case OpUpsert:
+		before, err = s.applyUpsert(ctx, filter, field, path, op)
+	case OpToggle:
+		before, err = s.applyToggle(ctx, filter, field, path)
+	default:
+		before, err = s.applyUpdate(ctx, filter, field, path, op)
+	}
+	if err != nil {
+		return nil, operationError(path, op, err)
+	}
+
+	// The update applied to exactly the value it returned, so replaying it gives the changes
+	value, changes, err := applyOperation(before.value, before.exists, path, op)
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) > 0 {
+		s.recordRevision(string(op.Op), path, &before, value, false)
+	}
+	return changes, nil
+}
+
+// applyUpdate performs the operations that map onto a single update operator
+func (s *MongoStore) applyUpdate(ctx context.Context, filter bson.M, field, path string, op Operation) (capturedValue, error) {
+	var update bson.M
+	upsert := true
+
+	switch op.Op {
+	case OpAppend:
+		update = bson.M{"$push": bson.M{field: op.Value}}
+
+	case OpPrepend, OpInsert:
+		index := 0
+		if op.Op == OpInsert {
+			index = op.Index
+		}
+		update = bson.M{"$push": bson.M{field: bson.M{"$each": bson.A{op.Value}, "$position": index}}}
+
+		// $push clamps the position, so require the element before it to exist
+		if index > 0 {
+			filter = withCondition(filter, fmt.Sprintf("%s.%d", field, index-1), bson.M{"$exists": true})
+			upsert = false
+		}
+
+	case OpRemove:
+		var condition interface{} = op.Value
+		if op.Where != nil {
+			condition = bson.M(op.Where)
+		}
+		update = bson.M{"$pull": bson.M{field: condition}}
+		upsert = false
+
+	case OpIncrement, OpDecrement:
+		amount, _ := incrementAmount(op)
+		update = bson.M{"$inc": bson.M{field: amount}}
+	}
+
+	before, err := s.findAndUpdate(ctx, filter, update, upsert, path)
+	if err == mongo.ErrNoDocuments {
+		if op.Op == OpInsert {
+			return before, invalidOperation("index %d is out of range for the array at %s", op.Index, path)
+		}
+		// Nothing to remove from a missing document
+		return before, nil
+	}
+	return before, err
+}
+
+// applyUpsert replaces the first element whose key field matches, or appends the element.
+// The append is guarded against a matching element added in between and retried if one was.
+func (s *MongoStore) applyUpsert(ctx context.Context, filter bson.M, field, path string, op Operation) (capturedValue, error) {
+	keyValue, _ := upsertKey(op)
+	keyField := field + "." + op.Key
+
+	var err error
+	for attempt := 0; attempt < maxOperationAttempts; attempt++ {
+		var before capturedValue
+		before, err = s.findAndUpdate(ctx, withCondition(filter, keyField, keyValue),
+			bson.M{"$set": bson.M{field + ".$": op.Value}}, false, path)
+		if err != mongo.ErrNoDocuments {
+			return before, err
+		}
+
+		before, err = s.findAndUpdate(ctx, withCondition(filter, keyField, bson.M{"$ne": keyValue}),
+			bson.M{"$push": bson.M{field: op.Value}}, true, path)
+		if !mongo.IsDuplicateKeyError(err) {
+			return before, err
+		}
+	}
+	return capturedValue{}, err
+}
+
+// applyToggle negates a boolean. Update operators cannot negate a value, so the
+// update is conditional on the current value and retried if it changed in between.
+func (s *MongoStore) applyToggle(ctx context.Context, filter bson.M, field, path string) (capturedValue, error) {
+	var err error
+	for attempt := 0; attempt < maxOperationAttempts; attempt++ {
+		var before capturedValue
+		before, err = s.findAndUpdate(ctx, withCondition(filter, field, true),
+			bson.M{"$set": bson.M{field: false}}, false, path)
+		if err != mongo.ErrNoDocuments {
+			return before, err
+		}
+
+		// A missing or null value toggles to true
+		before, err = s.findAndUpdate(ctx, withCondition(filter, field, bson.M{"$in": bson.A{false, nil}}),
+			bson.M{"$set": bson.M{field: true}}, true, path)
+		if !mongo.IsDuplicateKeyError(err) {
+			return before, err
+		}
+	}
+	return capturedValue{}, err
+}
+
+// findAndUpdate applies update to the document matched by filter and returns the value
+// at path before the update. An upsert that creates the document returns a missing value.
+func (s *MongoStore) findAndUpdate(ctx context.Context, filter bson.M, update interface{}, upsert bool, path string) (capturedValue, error) {
+	opts := options.FindOneAndUpdate().
+		SetReturnDocument(options.Before).
+		SetUpsert(upsert)
+
+	var doc bson.M
+	err := s.mapped.FindOneAndUpdate(ctx, filter, update, opts).Decode(&doc)
+	if err != nil {
+		if err == mongo.ErrNoDocuments && upsert {
+			return capturedValue{}, nil
+		}
+		return capturedValue{}, err
+	}
+
+	value, exists := s.valueInDocument(doc, path)
+	return capturedValue{value: value, exists: exists}, nil
+}
+
+// validateApply checks the result of op against the registered schemas it touches
+func (s *MongoStore) validateApply(path string, op Operation) error {
+	overlaps := false
+	for _, schemaPath := range s.schemas.Paths() {
+		if pathsOverlap(schemaPath, path) {
+			overlaps = true
+			break
+		}
+	}
+	if !overlaps {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	current, exists, err := s.currentValue(ctx, path)
+	if err != nil {
+		return err
+	}
+	value, _, err := applyOperation(current, exists, path, op)
+	if err != nil {
+		return err
+	}
+	return s.validateSet(path, value)
+}
+
+// valueInDocument returns the value at path inside a document decoded from the data collection
+func (s *MongoStore) valueInDocument(doc bson.M, path string) (interface{}, bool) {
+	if s.useCollection {
+		_, rest, _ := strings.Cut(strings.TrimPrefix(path, "."), ".")
+		return lookupPath(normalizeValue(doc), "."+rest)
+	}
+
+	data, ok := doc["data"]
+	if !ok || data == nil {
+		return nil, false
+	}
+	return lookupPath(normalizeValue(data), path)
+}
+
+// withCondition returns a copy of filter with an extra condition on field
+func withCondition(filter bson.M, field string, condition interface{}) bson.M {
+	result := make(bson.M, len(filter)+1)
+	for key, value := range filter {
+		result[key] = value
+	}
+	result[field] = condition
+	return result
+}
+
+// operationError reports MongoDB type mismatches as invalid operations
+func operationError(path string, op Operation, err error) error {
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) && (serverErr.HasErrorCode(2) || serverErr.HasErrorCode(14) || mongo.IsDuplicateKeyError(err)) {
+		return invalidOperation("%s does not apply to the value at %s: %v", op.Op, path, err)
+	}
+	return err
+}
@@ -5,12 +5,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/piske-alex/go-sse/internal/logging"
 	"github.com/piske-alex/go-sse/internal/query"
+	"github.com/piske-alex/go-sse/internal/schema"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -32,7 +34,19 @@ type MongoStore struct {
 	useCollection  bool      // When true, collection is root path and documentID is ignored
 	context        context.Context
 	cancelFunc     context.CancelFunc
+	changeMux      sync.Mutex
 	changeListener func(path string, value interface{})
+	changeStream   ChangeStreamStatus
+	reportsWrites  bool           // The change stream has started and will deliver every later write
+	changeDone     sync.WaitGroup // Tracks the change stream so Disconnect can let it save its position
+	historyConfig  HistoryConfig
+	history        *mongo.Collection // Capped collection of revisions, nil when history is disabled
+	mapped         *mongo.Collection // The data collection, decoding nested documents as maps
+	meta           *mongo.Collection // Holds the revision counter and the change stream resume token
+	ttl            *mongo.Collection // Expiry times of paths written with a TTL
+	expiryListener func(path string, value interface{})
+	schemas        *schema.Registry
+	ownsClient     bool // Disconnect closes the client; false for stores sharing a namespace client
 }
 
 // NewMongoStore creates a new MongoDB-backed store
@@ -55,6 +69,14 @@ func NewMongoStore(uri, dbName, collectionName, documentID string) (*MongoStore,
 		return nil, err
 	}
 
+	store := newMongoStoreWithClient(client, dbName, collectionName, documentID)
+	store.ownsClient = true
+	return store, nil
+}
+
+// newMongoStoreWithClient creates a MongoDB-backed store on an existing connection.
+// The store does not disconnect the client unless ownsClient is set.
+func newMongoStoreWithClient(client *mongo.Client, dbName, collectionName, documentID string) *MongoStore {
 	// Create a background context for the store
 	bgCtx, bgCancel := context.WithCancel(context.Background())
 
@@ -66,6 +88,10 @@ func NewMongoStore(uri, dbName, collectionName, documentID string) (*MongoStore,
 		client:        client,
 		database:      client.Database(dbName),
 		collection:    client.Database(dbName).Collection(collectionName),
+		mapped:        client.Database(dbName).Collection(collectionName, mapDocumentsOption()),
+		meta:          client.Database(dbName).Collection(collectionName + "_meta"),
+		ttl:           client.Database(dbName).Collection(collectionName + "_ttl"),
+		schemas:       schema.NewRegistry(),
 		documentID:    documentID,
 		useCollection: useCollection,
 		context:       bgCtx,
@@ -74,155 +100,41 @@ func NewMongoStore(uri, dbName, collectionName, documentID string) (*MongoStore,
 
 	// Log the mode we're running in
 	if useCollection {
-		log.Printf("MongoDB store initialized with collection '%s' as root path", collectionName)
+		logging.Infof("MongoDB store initialized with collection '%s' as root path", collectionName)
 	} else {
-		log.Printf("MongoDB store initialized with document ID '%s' as root path", documentID)
-	}
-
-	// Set up the change stream listener (only for document mode)
-	if !useCollection {
-		go store.setupChangeStream()
-	}
-
-	return store, nil
-}
-
-// setupChangeStream creates a MongoDB change stream to listen for updates
-func (s *MongoStore) setupChangeStream() {
-	// Skip if no change listener is set
-	if s.changeListener == nil {
-		return
+		logging.Infof("MongoDB store initialized with document ID '%s' as root path", documentID)
 	}
 
-	// Create a pipeline that filters for document changes
-	var pipeline mongo.Pipeline
-	
-	if s.useCollection {
-		// In collection mode, watch all document changes in the collection
-		pipeline = mongo.Pipeline{
-			bson.D{
-				{"$match", bson.D{
-					{"operationType", bson.D{
-						{"$in", bson.A{"update", "replace", "insert", "delete"}},
-					}},
-				}},
-			},
-		}
-	} else {
-		// In document mode, watch only our specific document
-		pipeline = mongo.Pipeline{
-			bson.D{
-				{"$match", bson.D{
-					{"operationType", bson.D{
-						{"$in", bson.A{"update", "replace", "insert"}},
-					}},
-					{"documentKey._id", s.documentID},
-				}},
-			},
-		}
-	}
+	// Expire paths written with a TTL
+	go store.sweepExpired()
 
-	// Create options with full document return
-	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	// The change stream starts once a change listener is registered
 
-	// Start the change stream
-	changeStream, err := s.collection.Watch(s.context, pipeline, opts)
-	if err != nil {
-		log.Printf("Error setting up change stream: %v", err)
-		return
-	}
-	defer changeStream.Close(s.context)
-
-	log.Printf("MongoDB change stream set up for %s mode", 
-		map[bool]string{true: "collection", false: "document"}[s.useCollection])
-
-	// Process change events
-	for changeStream.Next(s.context) {
-		// Decode the change event
-		var changeEvent bson.M
-		if err := changeStream.Decode(&changeEvent); err != nil {
-			log.Printf("Error decoding change event: %v", err)
-			continue
-		}
-
-		// Handle changes based on store mode
-		if s.useCollection {
-			// Collection mode - get document ID and report change for that document
-			operationType, _ := changeEvent["operationType"].(string)
-			
-			// Get the document ID
-			var docID string
-			if documentKey, ok := changeEvent["documentKey"].(bson.M); ok {
-				if id, ok := documentKey["_id"]; ok {
-					docID = fmt.Sprintf("%v", id)
-				}
-			}
-			
-			if docID == "" {
-				continue // Skip if no document ID
-			}
-			
-			if operationType == "delete" {
-				// For delete operations, notify with null value
-				if s.changeListener != nil {
-					s.changeListener(docID, nil)
-				}
-				continue
-			}
-			
-			// For other operations, get the full document
-			fullDocument, ok := changeEvent["fullDocument"].(bson.M)
-			if !ok {
-				continue
-			}
-			
-			// Notify with the full document
-			if s.changeListener != nil {
-				s.changeListener(docID, fullDocument)
-			}
-		} else {
-			// Document mode - extract data field from our document
-			fullDocument, ok := changeEvent["fullDocument"].(bson.M)
-			if !ok {
-				continue
-			}
-
-			// Extract the data field
-			data, ok := fullDocument["data"].(bson.M)
-			if !ok {
-				continue
-			}
-
-			// Convert to map[string]interface{}
-			jsonData, err := json.Marshal(data)
-			if err != nil {
-				continue
-			}
+	return store
+}
 
-			var dataMap map[string]interface{}
-			if err := json.Unmarshal(jsonData, &dataMap); err != nil {
-				continue
-			}
+// Schemas returns the registry of JSON Schemas that writes are validated against
+func (s *MongoStore) Schemas() *schema.Registry {
+	return s.schemas
+}
 
-			// Notify the change listener
-			if s.changeListener != nil {
-				s.changeListener(".", dataMap)
-			}
-		}
+// Initialize sets the initial data for the store
+func (s *MongoStore) Initialize(data map[string]interface{}) error {
+	if err := validateWrite(s.schemas, ".", resolveInRoot(data)); err != nil {
+		return err
 	}
 
-	if err := changeStream.Err(); err != nil {
-		log.Printf("Change stream error: %v", err)
+	before := s.captureRevision(".")
+	if err := s.initialize(data); err != nil {
+		return err
 	}
+	s.recordRevision(OpInitialize, ".", before, data, false)
+	s.clearTTLs(".")
+	return nil
 }
 
-// SetChangeListener sets a callback function that will be called when the data changes
-func (s *MongoStore) SetChangeListener(listener func(path string, value interface{})) {
-	s.changeListener = listener
-}
-
-// Initialize sets the initial data for the store
-func (s *MongoStore) Initialize(data map[string]interface{}) error {
+// initialize replaces the store document without recording history
+func (s *MongoStore) initialize(data map[string]interface{}) error {
 	// Create a context with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -282,71 +194,46 @@ func (s *MongoStore) Get(path string) (interface{}, error) {
 			
 			// Clean the path by removing the conditions
 			cleanPath = re.ReplaceAllString(path, "")
-			log.Printf("Path with key-value condition detected. Original path: %s, Clean path: %s, Conditions: %v", 
+			logging.Debugf("Path with key-value condition detected. Original path: %s, Clean path: %s, Conditions: %v", 
 				path, cleanPath, keyValueConditions)
 		}
 	}
 
-	// Special handling for .data.X paths
-	if strings.HasPrefix(cleanPath, ".data.") || strings.HasPrefix(cleanPath, "data.") {
+	// Special handling for .data.X paths. In collection mode they address the document "data".
+	if !s.useCollection && (strings.HasPrefix(cleanPath, ".data.") || strings.HasPrefix(cleanPath, "data.")) {
 		// Get the target field (like "positions", "offers", etc.)
 		parts := strings.Split(cleanPath, ".")
 		if len(parts) > 1 {
 			targetField := parts[len(parts)-1]
-			log.Printf("Special case handling for data.%s path", targetField)
+			logging.Debugf("Special case handling for data.%s path", targetField)
 			
 			// Create a projection to get only the targeted field
 			projection := bson.M{fmt.Sprintf("data.%s", targetField): 1}
 			
-			var result bson.M
-			if s.useCollection {
-				err := s.collection.FindOne(ctx, bson.M{}, options.FindOne().SetProjection(projection)).Decode(&result)
-				if err != nil {
-					log.Printf("Error getting %s: %v", targetField, err)
-					return nil, err
-				}
-				
-				// Extract just the targeted field
-				if data, ok := result["data"].(bson.M); ok {
-					if fieldValue, ok := data[targetField]; ok {
-						log.Printf("Successfully extracted %s", targetField)
-						
-						// Apply key-value filtering if needed
-						if len(keyValueConditions) > 0 {
-							fieldValue = s.applyKeyValueFiltering(fieldValue, keyValueConditions)
-							log.Printf("Applied key-value filtering to %s", targetField)
-						}
-						
-						return fieldValue, nil
-					}
-				}
-			} else {
-				// In document mode
-				var doc Document
-				err := s.collection.FindOne(
-					ctx, 
-					bson.M{"_id": s.documentID}, 
-					options.FindOne().SetProjection(projection),
-				).Decode(&doc)
-				
-				if err != nil {
-					log.Printf("Error getting %s: %v", targetField, err)
-					return nil, err
-				}
-				
-				// Extract targeted field from the document
-				if doc.Data != nil {
-					if fieldValue, ok := doc.Data[targetField]; ok {
-						log.Printf("Successfully extracted %s from document", targetField)
-						
-						// Apply key-value filtering if needed
-						if len(keyValueConditions) > 0 {
-							fieldValue = s.applyKeyValueFiltering(fieldValue, keyValueConditions)
-							log.Printf("Applied key-value filtering to %s", targetField)
-						}
-						
-						return fieldValue, nil
+			var doc Document
+			err := s.collection.FindOne(
+				ctx, 
+				bson.M{"_id": s.documentID}, 
+				options.FindOne().SetProjection(projection),
+			).Decode(&doc)
+			
+			if err != nil {
+				logging.Errorf("Error getting %s: %v", targetField, err)
+				return nil, err
+			}
+			
+			// Extract targeted field from the document
+			if doc.Data != nil {
+				if fieldValue, ok := doc.Data[targetField]; ok {
+					logging.Debugf("Successfully extracted %s from document", targetField)
+					
+					// Apply key-value filtering if needed
+					if len(keyValueConditions) > 0 {
+						fieldValue = s.applyKeyValueFiltering(fieldValue, keyValueConditions)
+						logging.Debugf("Applied key-value filtering to %s", targetField)
 					}
+					
+					return fieldValue, nil
 				}
 			}
 		}
@@ -382,71 +269,18 @@ func (s *MongoStore) Get(path string) (interface{}, error) {
 			return resultMap, nil
 		}
 		
-		// Check if path refers to a specific document ID
-		// Try simple ID lookup first (root document names)
-		var doc bson.M
-		err := s.collection.FindOne(ctx, bson.M{"_id": cleanPath}).Decode(&doc)
-		if err == nil {
-			return doc, nil
+		// The first segment of the path names the document
+		result, err := findInCollection(ctx, s.collection, cleanPath)
+		if err != nil {
+			return nil, err
 		}
-		
-		// If not direct ID, try to parse the path for nested document access
-		parts := strings.Split(cleanPath, ".")
-		if len(parts) > 0 {
-			// First part might be document ID, rest is path within document
-			docID := parts[0]
-			var doc bson.M
-			err := s.collection.FindOne(ctx, bson.M{"_id": docID}).Decode(&doc)
-			if err == nil {
-				// If only document ID, return whole document
-				if len(parts) == 1 {
-					return doc, nil
-				}
-				
-				// Otherwise, navigate nested path
-				subPath := strings.Join(parts[1:], ".")
-				matcher := query.NewMatcher()
-				result, err := matcher.Get(doc, subPath)
-				if err != nil {
-					if err == query.ErrPathNotFound {
-						return nil, ErrPathNotFound
-					}
-					return nil, err
-				}
-				return result, nil
-			}
-			
-			// If docID lookup failed, try query with path as filter
-			filter := bson.M{}
-			// Try standard MongoDB dot notation query
-			cursor, err := s.collection.Find(ctx, filter)
-			if err != nil {
-				return nil, err
-			}
-			defer cursor.Close(ctx)
-			
-			var results []bson.M
-			if err := cursor.All(ctx, &results); err != nil {
-				return nil, err
-			}
-			
-			if len(results) == 0 {
-				return nil, ErrPathNotFound
-			}
-			
-			// For collection paths, always return as a map by ID
-			resultMap := make(map[string]interface{})
-			for _, doc := range results {
-				if id, ok := doc["_id"]; ok {
-					idStr := fmt.Sprintf("%v", id)
-					resultMap[idStr] = doc
-				}
-			}
-			
-			return resultMap, nil
+
+		// Apply key-value filtering if needed
+		if len(keyValueConditions) > 0 {
+			result = s.applyKeyValueFiltering(result, keyValueConditions)
 		}
-		
-		return nil, ErrPathNotFound
+
+		return result, nil
 	} else {
 		// Document mode - original implementation
 		// Get the document
@@ -459,14 +293,17 @@ func (s *MongoStore) Get(path string) (interface{}, error) {
 			return nil, err
 		}
 
+		// Convert BSON arrays and numbers to the types JSON decoding produces
+		data, _ := normalizeValue(doc.Data).(map[string]interface{})
+
 		// If path is empty or ".", return the entire data
 		if cleanPath == "" || cleanPath == "." {
-			return doc.Data, nil
+			return data, nil
 		}
 
 		// Parse the path and navigate the data
 		matcher := query.NewMatcher()
-		result, err := matcher.Get(doc.Data, cleanPath)
+		result, err := matcher.Get(data, cleanPath)
 		if err != nil {
 			if err == query.ErrPathNotFound {
 				return nil, ErrPathNotFound
@@ -485,7 +322,7 @@ func (s *MongoStore) Get(path string) (interface{}, error) {
 
 // applyKeyValueFiltering filters data based on key-value conditions
 func (s *MongoStore) applyKeyValueFiltering(data interface{}, keyValueConditions []string) interface{} {
-	log.Printf("Applying key-value filtering with conditions: %v", keyValueConditions)
+	logging.Debugf("Applying key-value filtering with conditions: %v", keyValueConditions)
 	
 	// If there are no conditions, return the data as is
 	if len(keyValueConditions) == 0 {
@@ -513,7 +350,7 @@ func (s *MongoStore) applyKeyValueFiltering(data interface{}, keyValueConditions
 	
 	// Case 1: BSON Array (common in MongoDB responses)
 	if bsonArray, ok := data.(bson.A); ok {
-		log.Printf("Filtering BSON array data with %d items", len(bsonArray))
+		logging.Debugf("Filtering BSON array data with %d items", len(bsonArray))
 		var filteredArray []interface{}
 		
 		for _, item := range bsonArray {
@@ -541,13 +378,13 @@ func (s *MongoStore) applyKeyValueFiltering(data interface{}, keyValueConditions
 			}
 		}
 		
-		log.Printf("Filtered BSON array from %d to %d items", len(bsonArray), len(filteredArray))
+		logging.Debugf("Filtered BSON array from %d to %d items", len(bsonArray), len(filteredArray))
 		return filteredArray
 	}
 	
 	// Case 2: Go Array
 	if array, ok := data.([]interface{}); ok {
-		log.Printf("Filtering Go array data with %d items", len(array))
+		logging.Debugf("Filtering Go array data with %d items", len(array))
 		var filteredArray []interface{}
 		
 		for _, item := range array {
@@ -587,13 +424,13 @@ func (s *MongoStore) applyKeyValueFiltering(data interface{}, keyValueConditions
 			}
 		}
 		
-		log.Printf("Filtered Go array from %d to %d items", len(array), len(filteredArray))
+		logging.Debugf("Filtered Go array from %d to %d items", len(array), len(filteredArray))
 		return filteredArray
 	}
 	
 	// Case 3: BSON Map (common in MongoDB responses)
 	if bsonMap, ok := data.(bson.M); ok {
-		log.Printf("Checking BSON map data with keys: %v", getMapKeys(bsonMap))
+		logging.Debugf("Checking BSON map data with keys: %v", getMapKeys(bsonMap))
 		
 		// Check if this map matches all conditions
 		allMatch := true
@@ -615,7 +452,7 @@ func (s *MongoStore) applyKeyValueFiltering(data interface{}, keyValueConditions
 		if allMatch {
 			return bsonMap
 		} else {
-			log.Printf("BSON map did not match all conditions")
+			logging.Debugf("BSON map did not match all conditions")
 			return bson.M{}
 		}
 	}
@@ -627,7 +464,7 @@ func (s *MongoStore) applyKeyValueFiltering(data interface{}, keyValueConditions
 		for k := range goMap {
 			mapKeys = append(mapKeys, k)
 		}
-		log.Printf("Checking Go map data with keys: %v", mapKeys)
+		logging.Debugf("Checking Go map data with keys: %v", mapKeys)
 		
 		// Check if this map matches all conditions
 		allMatch := true
@@ -649,18 +486,74 @@ func (s *MongoStore) applyKeyValueFiltering(data interface{}, keyValueConditions
 		if allMatch {
 			return goMap
 		} else {
-			log.Printf("Go map did not match all conditions")
+			logging.Debugf("Go map did not match all conditions")
 			return map[string]interface{}{}
 		}
 	}
 	
 	// Unsupported data type, return as is
-	log.Printf("Unsupported data type for filtering: %T", data)
+	logging.Debugf("Unsupported data type for filtering: %T", data)
 	return data
 }
 
 // Set updates a value at the given path
 func (s *MongoStore) Set(path string, value interface{}) error {
+	if err := s.validateSet(path, value); err != nil {
+		return err
+	}
+
+	before := s.captureRevision(path)
+	if err := s.setValue(path, value); err != nil {
+		return err
+	}
+	s.recordRevision(OpSet, path, before, value, false)
+	s.clearTTLs(path)
+	return nil
+}
+
+// validateSet checks a write against the registered schemas it touches.
+// Schemas registered above path are checked against their current subtree with value applied.
+func (s *MongoStore) validateSet(path string, value interface{}) error {
+	var written interface{}
+	normalized := false
+
+	return validateWrite(s.schemas, path, func(schemaPath string) (interface{}, bool, error) {
+		if !normalized {
+			written, normalized = normalizeValue(value), true
+		}
+
+		// The write replaces the schema path or a parent of it
+		if isPathWithin(schemaPath, path) {
+			v, exists := lookupPath(written, relativePath(schemaPath, path))
+			return v, exists, nil
+		}
+
+		// The write lands inside the subtree covered by the schema
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		current, exists, err := s.currentValue(ctx, schemaPath)
+		if err != nil {
+			return nil, false, err
+		}
+		if !exists {
+			current = map[string]interface{}{}
+		}
+
+		segments, err := parsePath(relativePath(path, schemaPath))
+		if err != nil {
+			return nil, false, err
+		}
+		updated, err := cowSet(current, segments, written)
+		if err != nil {
+			return nil, false, err
+		}
+		return updated, true, nil
+	})
+}
+
+// setValue updates a value at the given path without recording history
+func (s *MongoStore) setValue(path string, value interface{}) error {
 	// Create a context with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -711,71 +604,59 @@ func (s *MongoStore) Set(path string, value interface{}) error {
 			return nil
 		}
 		
-		// Check if path refers to a document (no dot)
-		if !strings.Contains(path, ".") {
-			// Path is document ID
+		// The first segment of the path names the document
+		target, err := s.mongoPathFor(path)
+		if err != nil {
+			return err
+		}
+		docID := target.filter["_id"]
+
+		// Check if path refers to a whole document
+		if target.field == "" {
 			docMap, ok := value.(map[string]interface{})
 			if !ok {
 				// Wrap non-map values
 				docMap = map[string]interface{}{
-					"_id":   path, 
+					"_id":   docID, 
 					"value": value,
 				}
 			} else {
 				// Ensure document has _id field
-				docMap["_id"] = path
+				docMap["_id"] = docID
 			}
 			
 			// Upsert the document
 			_, err := s.collection.ReplaceOne(
 				ctx,
-				bson.M{"_id": path},
+				bson.M{"_id": docID},
 				docMap,
 				options.Replace().SetUpsert(true),
 			)
 			return err
 		}
 		
-		// Handle dot notation - document.field.subfield
-		parts := strings.Split(path, ".")
-		if len(parts) > 1 {
-			docID := parts[0]
-			subPath := strings.Join(parts[1:], ".")
-			
-			// Get current document
-			var doc bson.M
-			err := s.collection.FindOne(ctx, bson.M{"_id": docID}).Decode(&doc)
-			if err != nil {
-				if err == mongo.ErrNoDocuments {
-					// Create new document with this path
-					newDoc := bson.M{"_id": docID}
-					
-					// Create nested structure following the path
-					current := newDoc
-					for _, part := range parts[1:len(parts)-1] {
-						current[part] = bson.M{}
-						current = current[part].(bson.M)
-					}
-					
-					// Set the value at the final path
-					current[parts[len(parts)-1]] = value
-					
-					// Insert the document
-					_, err := s.collection.InsertOne(ctx, newDoc)
-					return err
-				}
-				return err
-			}
-			
-			// Document exists, update field
-			updateDoc := bson.M{"$set": bson.M{subPath: value}}
-			_, err = s.collection.UpdateOne(ctx, bson.M{"_id": docID}, updateDoc)
+		// Set the field in place, creating the document if needed. Like the in-memory
+		// store, a write through a missing array element or a non-object fails.
+		applied, err := s.setField(ctx, path, value)
+		if err != nil {
 			return err
 		}
-		
-		return errors.New("invalid path format")
+		if !applied {
+			return ErrPathNotFound
+		}
+		return nil
 	} else {
-		// Document mode - original implementation
+		// Document mode
+		// Write the path in place when MongoDB can express it, so concurrent writes to
+		// different paths do not overwrite each other
+		if path != "" && path != "." {
+			applied, err := s.setField(ctx, path, value)
+			if err != nil || applied {
+				return err
+			}
+		}
+
+		// Otherwise replace the whole document
 		// First, get the document
 		var doc Document
 		err := s.collection.FindOne(ctx, bson.M{"_id": s.documentID}).Decode(&doc)
@@ -851,6 +732,17 @@ func (s *MongoStore) SetFromJSON(path string, jsonData []byte) error {
 
 // Delete removes a value at the given path
 func (s *MongoStore) Delete(path string) error {
+	before := s.captureRevision(path)
+	if err := s.deleteValue(path); err != nil {
+		return err
+	}
+	s.recordRevision(OpDelete, path, before, nil, true)
+	s.clearTTLs(path)
+	return nil
+}
+
+// deleteValue removes a value at the given path without recording history
+func (s *MongoStore) deleteValue(path string) error {
 	// Create a context with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -865,26 +757,21 @@ func (s *MongoStore) Delete(path string) error {
 			return err
 		}
 		
-		// Check if path refers to a document (no dot)
-		if !strings.Contains(path, ".") {
-			// Delete document by ID
-			_, err := s.collection.DeleteOne(ctx, bson.M{"_id": path})
+		// The first segment of the path names the document
+		target, err := s.mongoPathFor(path)
+		if err != nil {
 			return err
 		}
-		
-		// Handle dot notation - document.field.subfield
-		parts := strings.Split(path, ".")
-		if len(parts) > 1 {
-			docID := parts[0]
-			subPath := strings.Join(parts[1:], ".")
-			
-			// Unset the field
-			updateDoc := bson.M{"$unset": bson.M{subPath: ""}}
-			_, err := s.collection.UpdateOne(ctx, bson.M{"_id": docID}, updateDoc)
+
+		// Check if path refers to a whole document
+		if target.field == "" {
+			_, err := s.collection.DeleteOne(ctx, target.filter)
 			return err
 		}
 		
-		return errors.New("invalid path format")
+		// Unset the field
+		_, err = s.unsetField(ctx, path)
+		return err
 	} else {
 		// Document mode - original implementation
 		// If path is empty or ".", delete the entire document
@@ -893,10 +780,16 @@ func (s *MongoStore) Delete(path string) error {
 			return err
 		}
 
+		// Remove the path in place when MongoDB can express it
+		applied, err := s.unsetField(ctx, path)
+		if err != nil || applied {
+			return err
+		}
+
 		// Otherwise, update the document by removing the value at the specified path
 		// First, get the current document
 		var doc Document
-		err := s.collection.FindOne(ctx, bson.M{"_id": s.documentID}).Decode(&doc)
+		err = s.collection.FindOne(ctx, bson.M{"_id": s.documentID}).Decode(&doc)
 		if err != nil {
 			if err == mongo.ErrNoDocuments {
 				// Document doesn't exist, nothing to delete
@@ -973,6 +866,62 @@ func (s *MongoStore) ToJSON() ([]byte, error) {
 	}
 }
 
+// ForEachKey calls fn for every top-level key in the store.
+// In collection mode each document is a key, without its _id, and is decoded from the
+// cursor one at a time.
+func (s *MongoStore) ForEachKey(fn func(key string, value interface{}) error) error {
+	if s.useCollection {
+		cursor, err := s.collection.Find(s.context, bson.M{})
+		if err != nil {
+			return err
+		}
+		defer cursor.Close(s.context)
+
+		for cursor.Next(s.context) {
+			var doc bson.M
+			if err := cursor.Decode(&doc); err != nil {
+				return err
+			}
+
+			id, ok := doc["_id"]
+			if !ok {
+				continue
+			}
+
+			// The ID is the key, and Set restores it when the document is written back
+			value, _ := normalizeValue(doc).(map[string]interface{})
+			delete(value, "_id")
+
+			if err := fn(fmt.Sprintf("%v", id), value); err != nil {
+				return err
+			}
+		}
+
+		return cursor.Err()
+	}
+
+	// Document mode - the whole tree lives in a single document
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var doc Document
+	err := s.collection.FindOne(ctx, bson.M{"_id": s.documentID}).Decode(&doc)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		return err
+	}
+
+	for key, value := range doc.Data {
+		if err := fn(key, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // FindMatches finds all values matching a path expression
 func (s *MongoStore) FindMatches(path string) ([]query.MatchResult, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -999,19 +948,19 @@ func (s *MongoStore) FindMatches(path string) ([]query.MatchResult, error) {
 			
 			// Clean the path by removing the conditions
 			cleanPath = re.ReplaceAllString(path, "")
-			log.Printf("Path with key-value condition detected in FindMatches. Original path: %s, Clean path: %s, Conditions: %v", 
+			logging.Debugf("Path with key-value condition detected in FindMatches. Original path: %s, Clean path: %s, Conditions: %v", 
 				path, cleanPath, keyValueConditions)
 		}
 	}
 
 	if s.useCollection {
 		// Log the incoming path for debugging
-		log.Printf("MongoStore.FindMatches called with path: %s", path)
+		logging.Debugf("MongoStore.FindMatches called with path: %s", path)
 		
 		// Clean up the path
 		cleanPathForMongo := strings.TrimPrefix(cleanPath, ".data.")
 		cleanPathForMongo = strings.TrimPrefix(cleanPathForMongo, "data.")
-		log.Printf("Cleaned path: %s", cleanPathForMongo)
+		logging.Debugf("Cleaned path: %s", cleanPathForMongo)
 
 		// Create a projection to get only the specific field
 		projection := bson.M{
@@ -1027,29 +976,29 @@ func (s *MongoStore) FindMatches(path string) ([]query.MatchResult, error) {
 
 		if err != nil {
 			if err == mongo.ErrNoDocuments {
-				log.Printf("No documents found for path: %s", path)
+				logging.Debugf("No documents found for path: %s", path)
 				return []query.MatchResult{}, nil
 			}
-			log.Printf("Error finding documents for path %s: %v", path, err)
+			logging.Errorf("Error finding documents for path %s: %v", path, err)
 			return nil, err
 		}
 
-		log.Printf("FindMatches result: %+v", result)
+		logging.Debugf("FindMatches result: %+v", result)
 		
 		// Extract just the positions value
 		for key, doc := range result {
-			log.Printf("Found document with key %s", key)
+			logging.Debugf("Found document with key %s", key)
 			if docMap, ok := doc.(bson.M); ok {
-				log.Printf("Document is a map with keys: %v", getMapKeys(docMap))
+				logging.Debugf("Document is a map with keys: %v", getMapKeys(docMap))
 				if data, ok := docMap["data"].(bson.M); ok {
-					log.Printf("Document has data field with keys: %v", getMapKeys(data))
+					logging.Debugf("Document has data field with keys: %v", getMapKeys(data))
 					if value, ok := data[cleanPathForMongo]; ok {
-						log.Printf("Found value for path %s", cleanPathForMongo)
+						logging.Debugf("Found value for path %s", cleanPathForMongo)
 						
 						// Apply key-value filtering if needed
 						if len(keyValueConditions) > 0 {
 							value = s.applyKeyValueFiltering(value, keyValueConditions)
-							log.Printf("Applied key-value filtering to %s in FindMatches", cleanPathForMongo)
+							logging.Debugf("Applied key-value filtering to %s in FindMatches", cleanPathForMongo)
 						}
 						
 						return []query.MatchResult{
@@ -1066,37 +1015,37 @@ func (s *MongoStore) FindMatches(path string) ([]query.MatchResult, error) {
 						found := true
 						
 						for i, key := range nestedKeys {
-							log.Printf("Looking for nested key %s at level %d", key, i)
+							logging.Debugf("Looking for nested key %s at level %d", key, i)
 							if i == len(nestedKeys)-1 {
 								// Last key, should be the value we want
 								if val, exists := currentMap[key]; exists {
 									currentValue = val
-									log.Printf("Found final nested value at key %s", key)
+									logging.Debugf("Found final nested value at key %s", key)
 								} else {
 									found = false
-									log.Printf("Final key %s not found", key)
+									logging.Debugf("Final key %s not found", key)
 									break
 								}
 							} else {
 								// Not the last key, should be another map
 								if nextMap, exists := currentMap[key].(bson.M); exists {
 									currentMap = nextMap
-									log.Printf("Found nested map at key %s with keys: %v", key, getMapKeys(nextMap))
+									logging.Debugf("Found nested map at key %s with keys: %v", key, getMapKeys(nextMap))
 								} else {
 									found = false
-									log.Printf("Nested key %s not found or not a map", key)
+									logging.Debugf("Nested key %s not found or not a map", key)
 									break
 								}
 							}
 						}
 						
 						if found && currentValue != nil {
-							log.Printf("Found value through nested path traversal")
+							logging.Debugf("Found value through nested path traversal")
 							
 							// Apply key-value filtering if needed
 							if len(keyValueConditions) > 0 {
 								currentValue = s.applyKeyValueFiltering(currentValue, keyValueConditions)
-								log.Printf("Applied key-value filtering to nested value in FindMatches")
+								logging.Debugf("Applied key-value filtering to nested value in FindMatches")
 							}
 							
 							return []query.MatchResult{
@@ -1111,7 +1060,7 @@ func (s *MongoStore) FindMatches(path string) ([]query.MatchResult, error) {
 			}
 		}
 
-		log.Printf("No matches found after processing document")
+		logging.Debugf("No matches found after processing document")
 		return []query.MatchResult{}, nil
 	} else {
 		// Document mode - original implementation
@@ -1154,7 +1103,7 @@ func (s *MongoStore) FindMatches(path string) ([]query.MatchResult, error) {
 			}
 			
 			results = filteredResults
-			log.Printf("Applied key-value filtering to %d matches", len(results))
+			logging.Debugf("Applied key-value filtering to %d matches", len(results))
 		}
 		
 		return results, nil
@@ -1174,6 +1123,14 @@ func getMapKeys(m bson.M) []string {
 func (s *MongoStore) Disconnect() error {
 	// Cancel the background context
 	s.cancelFunc()
+
+	// Let the change stream persist its resume token before the client goes away
+	s.changeDone.Wait()
+
+	// The client is shared with other namespaces
+	if !s.ownsClient {
+		return nil
+	}
 	
 	// Create a context with timeout for disconnection
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -1183,34 +1140,39 @@ func (s *MongoStore) Disconnect() error {
 	return s.client.Disconnect(ctx)
 }
 
+// Ping checks that the MongoDB primary is reachable
+func (s *MongoStore) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx, readpref.Primary())
+}
+
 // DisplayStoreInfo lists all databases, collections, and documents at startup for debugging
 func (s *MongoStore) DisplayStoreInfo() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	// Display connected MongoDB server info
-	serverStatus, err := s.database.RunCommand(ctx, bson.D{{"serverStatus", 1}}).DecodeBytes()
+	serverStatus, err := s.database.RunCommand(ctx, bson.D{{Key: "serverStatus", Value: 1}}).DecodeBytes()
 	if err != nil {
-		log.Printf("Error getting server status: %v", err)
+		logging.Errorf("Error getting server status: %v", err)
 	} else {
 		version, err := serverStatus.LookupErr("version")
 		if err == nil {
-			log.Printf("Connected to MongoDB server version: %s", version.StringValue())
+			logging.Infof("Connected to MongoDB server version: %s", version.StringValue())
 		}
 		
 		host, err := serverStatus.LookupErr("host")
 		if err == nil {
-			log.Printf("MongoDB server host: %s", host.StringValue())
+			logging.Infof("MongoDB server host: %s", host.StringValue())
 		}
 	}
 
-	log.Println("====== MongoDB Information ======")
+	logging.Infof("====== MongoDB Information ======")
 	
 	// Report the mode
 	if s.useCollection {
-		log.Println("Store Mode: Collection is root (each document in collection is root level)")
+		logging.Infof("Store Mode: Collection is root (each document in collection is root level)")
 	} else {
-		log.Printf("Store Mode: Document is root (ID: %s)", s.documentID)
+		logging.Infof("Store Mode: Document is root (ID: %s)", s.documentID)
 	}
 
 	// List databases
@@ -1226,14 +1188,14 @@ func (s *MongoStore) DisplayStoreInfo() error {
 	dbDocumentCountMap := make(map[string]int64)
 
 	// Loop through databases to gather statistics
-	log.Printf("Found %d databases:", len(databases))
+	logging.Infof("Found %d databases:", len(databases))
 	for _, dbName := range databases {
 		db := s.client.Database(dbName)
 		
 		// List collections in this database
 		collections, err := db.ListCollectionNames(ctx, bson.M{})
 		if err != nil {
-			log.Printf("  Database: %s (error listing collections: %v)", dbName, err)
+			logging.Infof("  Database: %s (error listing collections: %v)", dbName, err)
 			continue
 		}
 
@@ -1241,7 +1203,7 @@ func (s *MongoStore) DisplayStoreInfo() error {
 		dbCollectionMap[dbName] = collections
 		totalCollections += len(collections)
 		
-		log.Printf("  Database: %s (%d collections)", dbName, len(collections))
+		logging.Infof("  Database: %s (%d collections)", dbName, len(collections))
 		
 		// Count documents in each collection
 		var dbDocCount int64 = 0
@@ -1251,14 +1213,14 @@ func (s *MongoStore) DisplayStoreInfo() error {
 			// Count documents
 			count, err := coll.CountDocuments(ctx, bson.M{})
 			if err != nil {
-				log.Printf("    Collection: %s (error counting documents: %v)", collName, err)
+				logging.Infof("    Collection: %s (error counting documents: %v)", collName, err)
 				continue
 			}
 			
 			dbDocCount += count
 			totalDocuments += int(count)
 			
-			log.Printf("    Collection: %s (%d documents)", collName, count)
+			logging.Infof("    Collection: %s (%d documents)", collName, count)
 		}
 		
 		// Store total document count for this database
@@ -1266,7 +1228,7 @@ func (s *MongoStore) DisplayStoreInfo() error {
 		
 		// Only show detailed information for the db we're using
 		if dbName == s.database.Name() {
-			log.Printf("  > Current database: %s (total documents: %d)", dbName, dbDocCount)
+			logging.Infof("  > Current database: %s (total documents: %d)", dbName, dbDocCount)
 			
 			for _, collName := range collections {
 				coll := db.Collection(collName)
@@ -1279,12 +1241,12 @@ func (s *MongoStore) DisplayStoreInfo() error {
 				
 				// Only show details for our collection
 				if collName == s.collection.Name() {
-					log.Printf("    > Current collection: %s (%d documents)", collName, count)
+					logging.Infof("    > Current collection: %s (%d documents)", collName, count)
 					
 					// List documents (limit to first 10)
 					cursor, err := coll.Find(ctx, bson.M{}, options.Find().SetLimit(10))
 					if err != nil {
-						log.Printf("      Error listing documents: %v", err)
+						logging.Errorf("      Error listing documents: %v", err)
 						continue
 					}
 					defer cursor.Close(ctx)
@@ -1294,11 +1256,11 @@ func (s *MongoStore) DisplayStoreInfo() error {
 						// Display root documents
 						var documents []bson.M
 						if err := cursor.All(ctx, &documents); err != nil {
-							log.Printf("      Error decoding documents: %v", err)
+							logging.Errorf("      Error decoding documents: %v", err)
 							continue
 						}
 						
-						log.Printf("      Documents in %s (showing up to 10):", collName)
+						logging.Infof("      Documents in %s (showing up to 10):", collName)
 						for i, doc := range documents {
 							var id interface{} = "unknown"
 							if val, ok := doc["_id"]; ok {
@@ -1308,7 +1270,7 @@ func (s *MongoStore) DisplayStoreInfo() error {
 							// Convert document data to JSON for display
 							jsonData, err := json.MarshalIndent(doc, "        ", "  ")
 							if err != nil {
-								log.Printf("        Document %d (ID: %v) (error marshaling: %v)", i+1, id, err)
+								logging.Infof("        Document %d (ID: %v) (error marshaling: %v)", i+1, id, err)
 								continue
 							}
 							
@@ -1321,27 +1283,27 @@ func (s *MongoStore) DisplayStoreInfo() error {
 							// Count fields
 							fieldCount := len(doc)
 							
-							log.Printf("        Document %d (ID: %v, Fields: %d): %s", 
+							logging.Infof("        Document %d (ID: %v, Fields: %d): %s", 
 								i+1, id, fieldCount, jsonStr)
 						}
 						
 						if count > 10 {
-							log.Printf("        ... and %d more documents", count-10)
+							logging.Infof("        ... and %d more documents", count-10)
 						}
 					} else {
 						// Original document mode display
 						var documents []Document
 						if err := cursor.All(ctx, &documents); err != nil {
-							log.Printf("      Error decoding documents: %v", err)
+							logging.Errorf("      Error decoding documents: %v", err)
 							continue
 						}
 						
-						log.Printf("      Documents in %s (showing up to 10):", collName)
+						logging.Infof("      Documents in %s (showing up to 10):", collName)
 						for i, doc := range documents {
 							// Convert document data to JSON for display
 							jsonData, err := json.MarshalIndent(doc, "        ", "  ")
 							if err != nil {
-								log.Printf("        Document %d (ID: %s) (error marshaling: %v)", i+1, doc.ID, err)
+								logging.Infof("        Document %d (ID: %s) (error marshaling: %v)", i+1, doc.ID, err)
 								continue
 							}
 							
@@ -1351,11 +1313,11 @@ func (s *MongoStore) DisplayStoreInfo() error {
 								jsonStr = jsonStr[:500] + "... (truncated)"
 							}
 							
-							log.Printf("        Document %d (ID: %s): %s", i+1, doc.ID, jsonStr)
+							logging.Infof("        Document %d (ID: %s): %s", i+1, doc.ID, jsonStr)
 						}
 						
 						if count > 10 {
-							log.Printf("        ... and %d more documents", count-10)
+							logging.Infof("        ... and %d more documents", count-10)
 						}
 					}
 				} else {
@@ -1374,7 +1336,7 @@ func (s *MongoStore) DisplayStoreInfo() error {
 										if len(jsonStr) > 200 {
 											jsonStr = jsonStr[:200] + "... (truncated)"
 										}
-										log.Printf("      Sample document: %s", jsonStr)
+										logging.Infof("      Sample document: %s", jsonStr)
 									}
 								}
 							}
@@ -1386,19 +1348,19 @@ func (s *MongoStore) DisplayStoreInfo() error {
 	}
 	
 	// Print collection statistics summary
-	log.Println("\n===== MongoDB Statistics Summary =====")
-	log.Printf("Total Databases: %d", len(databases))
-	log.Printf("Total Collections: %d", totalCollections)
-	log.Printf("Total Documents: %d", totalDocuments)
-	log.Printf("Current Database: %s", s.database.Name())
-	log.Printf("Current Collection: %s", s.collection.Name())
+	logging.Infof("\n===== MongoDB Statistics Summary =====")
+	logging.Infof("Total Databases: %d", len(databases))
+	logging.Infof("Total Collections: %d", totalCollections)
+	logging.Infof("Total Documents: %d", totalDocuments)
+	logging.Infof("Current Database: %s", s.database.Name())
+	logging.Infof("Current Collection: %s", s.collection.Name())
 	
 	// Display info based on mode
 	if s.useCollection {
 		// Collection mode - get collection summary
 		count, err := s.collection.CountDocuments(ctx, bson.M{})
 		if err == nil {
-			log.Printf("Current Collection Document Count: %d", count)
+			logging.Infof("Current Collection Document Count: %d", count)
 		}
 		
 		// Get stats about document sizes (sample a few documents)
@@ -1421,7 +1383,7 @@ func (s *MongoStore) DisplayStoreInfo() error {
 			
 			if docsCount > 0 {
 				avgSize := float64(totalSize) / float64(docsCount)
-				log.Printf("Average Document Size (from sample): %.2f KB", avgSize/1024.0)
+				logging.Infof("Average Document Size (from sample): %.2f KB", avgSize/1024.0)
 			}
 		}
 	} else {
@@ -1433,20 +1395,20 @@ func (s *MongoStore) DisplayStoreInfo() error {
 			jsonData, err := json.Marshal(doc.Data)
 			if err == nil {
 				dataSizeKB := float64(len(jsonData)) / 1024.0
-				log.Printf("Current Document (ID: %s) Size: %.2f KB", s.documentID, dataSizeKB)
+				logging.Infof("Current Document (ID: %s) Size: %.2f KB", s.documentID, dataSizeKB)
 				
 				// Count top-level keys
 				if doc.Data != nil {
-					log.Printf("Current Document Top-level Keys: %d", len(doc.Data))
+					logging.Infof("Current Document Top-level Keys: %d", len(doc.Data))
 				}
 			}
 		} else if err == mongo.ErrNoDocuments {
-			log.Printf("Current Document (ID: %s) does not exist yet", s.documentID)
+			logging.Infof("Current Document (ID: %s) does not exist yet", s.documentID)
 		} else {
-			log.Printf("Error retrieving current document: %v", err)
+			logging.Errorf("Error retrieving current document: %v", err)
 		}
 	}
 	
-	log.Println("================================")
+	logging.Infof("================================")
 	return nil
 }
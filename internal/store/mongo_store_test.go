@@ -3,7 +3,9 @@ package store_test
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
@@ -147,7 +149,7 @@ func TestMongoStore_SetAndGet(t *testing.T) {
 
 	// Set a value
 	path := ".users[0].status"
-	value := "online"
+	var value interface{} = "online"
 	err = store.Set(path, value)
 	if err != nil {
 		t.Fatalf("Failed to set value: %v", err)
@@ -341,3 +343,103 @@ func TestMongoStore_LargeDocument(t *testing.T) {
 
 	t.Logf("Large document size: %d bytes (%d KB)", len(jsonData), len(jsonData)/1024)
 }
+
+func TestMongoStore_PartialUpdates(t *testing.T) {
+	skipIfNoMongo(t)
+
+	// Create a test MongoDB store
+	mongouri := os.Getenv("MONGO_URI")
+	if mongouri == "" {
+		mongouri = "mongodb://localhost:27017"
+	}
+
+	documentID := "partial_" + time.Now().Format("20060102150405")
+	s, err := store.NewMongoStore(mongouri, "gosse_test", "store_test", documentID)
+	if err != nil {
+		t.Fatalf("Failed to create MongoDB store: %v", err)
+	}
+	defer s.Disconnect()
+
+	err = s.Initialize(map[string]interface{}{
+		"a":    map[string]interface{}{"b": []interface{}{map[string]interface{}{"c": 1}, map[string]interface{}{"c": 2}}},
+		"list": []interface{}{1, 2},
+		"name": "test",
+	})
+	if err != nil {
+		t.Fatalf("Failed to initialize store: %v", err)
+	}
+
+	// Nested writes through array elements are applied in place
+	if err := s.Set(".a.b[1].c", 5); err != nil {
+		t.Fatalf("Failed to set nested value: %v", err)
+	}
+	if value, _ := s.Get(".a.b[1].c"); value != float64(5) {
+		t.Errorf("Expected 5, got %v", value)
+	}
+	if value, _ := s.Get(".a.b[0].c"); value != float64(1) {
+		t.Errorf("Expected sibling element to be unchanged, got %v", value)
+	}
+
+	// Missing objects are created, missing array elements are not
+	if err := s.Set(".fresh.nested", "x"); err != nil {
+		t.Fatalf("Failed to set new path: %v", err)
+	}
+	if value, _ := s.Get(".fresh.nested"); value != "x" {
+		t.Errorf("Expected x, got %v", value)
+	}
+	if err := s.Set(".list[5]", 9); err == nil {
+		t.Error("Expected an error setting an index beyond the array")
+	}
+	if list, _ := s.Get(".list"); len(list.([]interface{})) != 2 {
+		t.Errorf("Expected the array to keep its length, got %v", list)
+	}
+
+	// Writes that create arrays fall back to replacing the document
+	if err := s.Set(".created[0]", "y"); err != nil {
+		t.Fatalf("Failed to set path creating an array: %v", err)
+	}
+	if value, _ := s.Get(".created[0]"); value != "y" {
+		t.Errorf("Expected y, got %v", value)
+	}
+
+	// Writes through a value that is not an object fail as before
+	if err := s.Set(".name.first", "z"); err == nil {
+		t.Error("Expected an error setting a field of a string")
+	}
+
+	// Deleting an element sets it to null, deleting a field removes it
+	if err := s.Delete(".a.b[0]"); err != nil {
+		t.Fatalf("Failed to delete element: %v", err)
+	}
+	if b, _ := s.Get(".a.b"); len(b.([]interface{})) != 2 || b.([]interface{})[0] != nil {
+		t.Errorf("Expected first element to be null, got %v", b)
+	}
+	if err := s.Delete(".fresh"); err != nil {
+		t.Fatalf("Failed to delete field: %v", err)
+	}
+	if _, err := s.Get(".fresh"); err == nil {
+		t.Error("Expected deleted field to be gone")
+	}
+
+	// Concurrent writes to different paths do not overwrite each other
+	const writers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := s.Set(fmt.Sprintf(".counters.k%d", i), i); err != nil {
+				t.Errorf("Failed to set counter %d: %v", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	counters, err := s.Get(".counters")
+	if err != nil {
+		t.Fatalf("Failed to get counters: %v", err)
+	}
+	if m, ok := counters.(map[string]interface{}); !ok || len(m) != writers {
+		t.Errorf("Expected %d counters, got %v", writers, counters)
+	}
+}
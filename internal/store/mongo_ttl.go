@@ -0,0 +1,131 @@
+package store
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"github.com/piske-alex/go-sse/internal/logging"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ttlSweepInterval is how often the MongoDB store looks for expired paths
+const ttlSweepInterval = time.Second
+
+// mongoTTL is an expiry record in the "<collection>_ttl" collection
+type mongoTTL struct {
+	Document  string    `bson:"document"`
+	Path      string    `bson:"path"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+// SetWithTTL updates a value at the given path and deletes it once ttl has elapsed.
+// Expiry records live in a separate collection, so they survive restarts and every
+// instance sharing the database sweeps them; each record is claimed by exactly one sweeper.
+func (s *MongoStore) SetWithTTL(path string, value interface{}, ttl time.Duration) error {
+	if err := validateTTL(path, ttl); err != nil {
+		return err
+	}
+
+	if err := s.Set(path, value); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := s.ttl.UpdateOne(
+		ctx,
+		bson.M{"document": s.documentID, "path": path},
+		bson.M{"$set": bson.M{"expires_at": time.Now().Add(ttl)}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// SetExpiryListener sets a callback that is called with the path and last value of each expired key
+func (s *MongoStore) SetExpiryListener(listener func(path string, value interface{})) {
+	s.expiryListener = listener
+}
+
+// clearTTLs cancels the expiry of path and everything below it
+func (s *MongoStore) clearTTLs(path string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"document": s.documentID}
+	if path != "" && path != "." {
+		filter["path"] = bson.M{"$regex": "^" + regexp.QuoteMeta(path) + `($|[.\[])`}
+	}
+
+	if _, err := s.ttl.DeleteMany(ctx, filter); err != nil {
+		logging.Errorf("Error clearing TTLs under %s: %v", path, err)
+	}
+}
+
+// sweepExpired periodically expires paths until the store is disconnected
+func (s *MongoStore) sweepExpired() {
+	ctx, cancel := context.WithTimeout(s.context, 5*time.Second)
+	_, err := s.ttl.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "document", Value: 1}, {Key: "path", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "document", Value: 1}, {Key: "expires_at", Value: 1}}},
+	})
+	cancel()
+	if err != nil {
+		logging.Errorf("Error creating TTL indexes: %v", err)
+	}
+
+	ticker := time.NewTicker(ttlSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.context.Done():
+			return
+		case <-ticker.C:
+			s.expireDue()
+		}
+	}
+}
+
+// expireDue deletes every path whose TTL has elapsed and notifies the expiry listener
+func (s *MongoStore) expireDue() {
+	ctx, cancel := context.WithTimeout(s.context, 5*time.Second)
+	defer cancel()
+
+	for {
+		// Claim one due record; deleting it first means only one instance expires it
+		var record mongoTTL
+		err := s.ttl.FindOneAndDelete(ctx, bson.M{
+			"document":   s.documentID,
+			"expires_at": bson.M{"$lte": time.Now()},
+		}).Decode(&record)
+		if err != nil {
+			if err != mongo.ErrNoDocuments && s.context.Err() == nil {
+				logging.Errorf("Error reading expired paths: %v", err)
+			}
+			return
+		}
+
+		value, exists, err := s.currentValue(ctx, record.Path)
+		if err != nil {
+			logging.Errorf("Error reading %s before expiry: %v", record.Path, err)
+			continue
+		}
+		if !exists {
+			continue
+		}
+
+		if err := s.deleteValue(record.Path); err != nil {
+			logging.Errorf("Error expiring %s: %v", record.Path, err)
+			continue
+		}
+		s.recordRevision(OpExpire, record.Path, &capturedValue{value: value, exists: true}, nil, true)
+
+		if s.expiryListener != nil {
+			s.expiryListener(record.Path, value)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/piske-alex/go-sse/internal/query"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// errPathNotViable is the MongoDB error code for updates through a value that is not a document
+const errPathNotViable = 28
+
+// mongoPath is a store path translated into MongoDB's dotted notation
+type mongoPath struct {
+	filter   bson.M   // Selects the document holding the path
+	field    string   // Dotted field name within the document, e.g. "data.a.b.0.c"; empty for a whole document
+	elements []string // Dotted names of the array elements the path indexes, e.g. "data.a.b.0"
+}
+
+// mongoPathFor translates a JQ-style store path. In document mode the path lives under
+// the document's "data" field; in collection mode the first segment names the document.
+func (s *MongoStore) mongoPathFor(path string) (mongoPath, error) {
+	segments, err := parsePath(path)
+	if err != nil {
+		return mongoPath{}, err
+	}
+
+	docID := s.documentID
+	var parts, elements []string
+	if !s.useCollection {
+		parts = append(parts, "data")
+	}
+
+	for i, segment := range segments {
+		switch segment.Type {
+		case query.Property:
+			// Document IDs are not field names, so only need to be non-empty
+			if s.useCollection && i == 0 && segment.Value != "" {
+				docID = segment.Value
+				continue
+			}
+			if segment.Value == "" || strings.HasPrefix(segment.Value, "$") || strings.Contains(segment.Value, ".") {
+				return mongoPath{}, fmt.Errorf("invalid field name %q in path %s", segment.Value, path)
+			}
+			parts = append(parts, segment.Value)
+
+		case query.Index:
+			if s.useCollection && i == 0 {
+				return mongoPath{}, fmt.Errorf("path %s must start with a document ID", path)
+			}
+			parts = append(parts, strconv.Itoa(segment.Index))
+			elements = append(elements, strings.Join(parts, "."))
+
+		default:
+			return mongoPath{}, errWildcardWrite
+		}
+	}
+
+	return mongoPath{
+		filter:   bson.M{"_id": docID},
+		field:    strings.Join(parts, "."),
+		elements: elements,
+	}, nil
+}
+
+// elementFilter returns the document filter extended to require every indexed array
+// element to exist. MongoDB would otherwise pad arrays with nulls or create objects
+// with numeric keys, where the store reports the path as not found.
+func (p mongoPath) elementFilter() bson.M {
+	filter := make(bson.M, len(p.filter)+2*len(p.elements))
+	for key, value := range p.filter {
+		filter[key] = value
+	}
+	for _, element := range p.elements {
+		parent := element[:strings.LastIndex(element, ".")]
+		filter[parent] = bson.M{"$type": "array"}
+		filter[element] = bson.M{"$exists": true}
+	}
+	return filter
+}
+
+// setField writes value at path with a single atomic $set.
+// It reports false, without error, when the write has to fall back to replacing
+// the document: the path creates an array, indexes a missing element, or passes
+// through a value that is not a document.
+func (s *MongoStore) setField(ctx context.Context, path string, value interface{}) (bool, error) {
+	target, err := s.mongoPathFor(path)
+	if err != nil {
+		return false, nil
+	}
+
+	// An upserted document holds no arrays, so only upsert when none has to exist
+	opts := options.Update().SetUpsert(len(target.elements) == 0)
+
+	result, err := s.collection.UpdateOne(ctx, target.elementFilter(), bson.M{"$set": bson.M{target.field: value}}, opts)
+	if err != nil {
+		if isPathNotViable(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return result.MatchedCount > 0 || result.UpsertedCount > 0, nil
+}
+
+// unsetField removes the value at path with a single atomic $unset.
+// Like query.Matcher.Delete, removing an array element sets it to null. It reports
+// false, without error, when the path cannot be expressed as a MongoDB field.
+func (s *MongoStore) unsetField(ctx context.Context, path string) (bool, error) {
+	target, err := s.mongoPathFor(path)
+	if err != nil {
+		return false, nil
+	}
+
+	_, err = s.collection.UpdateOne(ctx, target.filter, bson.M{"$unset": bson.M{target.field: ""}})
+	if err != nil {
+		if isPathNotViable(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// isPathNotViable reports whether err is MongoDB refusing to update through a non-document value
+func isPathNotViable(err error) bool {
+	var serverErr mongo.ServerError
+	return errors.As(err, &serverErr) && serverErr.HasErrorCode(errPathNotViable)
+}
+
+// findInCollection reads the value at a collection-mode path from the document named
+// by its first segment. It returns ErrPathNotFound when the document or path is missing.
+func findInCollection(ctx context.Context, collection *mongo.Collection, path string) (interface{}, error) {
+	segments, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) == 0 || segments[0].Type != query.Property {
+		return nil, fmt.Errorf("path %s must start with a document ID", path)
+	}
+
+	var doc bson.M
+	err = collection.FindOne(ctx, bson.M{"_id": segments[0].Value}).Decode(&doc)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrPathNotFound
+		}
+		return nil, err
+	}
+
+	// Navigate the whole path from a root holding only this document
+	root := map[string]interface{}{segments[0].Value: normalizeValue(doc)}
+	value, err := query.NewMatcher().Get(root, path)
+	if err == query.ErrPathNotFound {
+		return nil, ErrPathNotFound
+	}
+	return value, err
+}
@@ -0,0 +1,96 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/piske-alex/go-sse/internal/logging"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// ErrInvalidNamespace is returned for namespace names that cannot be used as store identifiers
+var ErrInvalidNamespace = errors.New("namespace names must be 1 to 64 letters, digits, '-' or '_'")
+
+// namespacePattern matches valid namespace names, which are safe in URLs, document IDs and collection names
+var namespacePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// ValidateNamespace checks that name can be used as a namespace
+func ValidateNamespace(name string) error {
+	if !namespacePattern.MatchString(name) {
+		return ErrInvalidNamespace
+	}
+	return nil
+}
+
+// NamespaceFactory creates the store backing a namespace
+type NamespaceFactory func(name string) (Store, error)
+
+// NewNamespaceFactory returns a factory for namespace stores of the given type, and a
+// function that releases resources shared by them once every namespace is shut down.
+// Memory namespaces are independent KVStores. MongoDB namespaces share one connection;
+// each is stored in the document "ns:<name>" of the configured collection or, when the
+// collection is the root, in the collection "<collection>_ns_<name>".
+func NewNamespaceFactory(storeType StoreType, mongoConfig MongoConfig, history HistoryConfig) (NamespaceFactory, func() error, error) {
+	switch storeType {
+	case MemoryStore:
+		factory := func(name string) (Store, error) {
+			if err := ValidateNamespace(name); err != nil {
+				return nil, err
+			}
+			kvStore := NewStore()
+			kvStore.EnableHistory(history)
+			return kvStore, nil
+		}
+		return factory, func() error { return nil }, nil
+
+	case MongoStoreType:
+		uri, dbName, collectionName, documentID := mongoConfig.location()
+		useCollection := documentID == "" || documentID == "collection"
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := client.Ping(ctx, readpref.Primary()); err != nil {
+			client.Disconnect(ctx)
+			return nil, nil, err
+		}
+
+		factory := func(name string) (Store, error) {
+			if err := ValidateNamespace(name); err != nil {
+				return nil, err
+			}
+
+			var mongoStore *MongoStore
+			if useCollection {
+				mongoStore = newMongoStoreWithClient(client, dbName, collectionName+"_ns_"+name, "collection")
+			} else {
+				mongoStore = newMongoStoreWithClient(client, dbName, collectionName, "ns:"+name)
+			}
+
+			// Record revisions in a capped history collection
+			if err := mongoStore.EnableHistory(history); err != nil {
+				logging.Warnf("history disabled for namespace %s: %v", name, err)
+			}
+			return mongoStore, nil
+		}
+
+		closer := func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			return client.Disconnect(ctx)
+		}
+		return factory, closer, nil
+
+	default:
+		return nil, nil, fmt.Errorf("unknown store type: %s", storeType)
+	}
+}
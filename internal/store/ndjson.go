@@ -0,0 +1,98 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/piske-alex/go-sse/internal/query"
+)
+
+// Entry is a single line of an NDJSON export or import stream
+type Entry struct {
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+// ExportGranularity controls how the store is split into NDJSON lines
+type ExportGranularity string
+
+const (
+	// ExportByKey writes one line per top-level key
+	ExportByKey ExportGranularity = "key"
+	// ExportByLeaf writes one line per leaf value; arrays are treated as leaves
+	ExportByLeaf ExportGranularity = "leaf"
+)
+
+// ExportNDJSON streams the contents of the store to w, one Entry per line.
+// Keys that are not plain words are quoted in the paths, e.g. ."user-1".
+// It returns the number of lines written.
+func ExportNDJSON(s Store, w io.Writer, granularity ExportGranularity) (int, error) {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+
+	count := 0
+	emit := func(path string, value interface{}) error {
+		if err := encoder.Encode(Entry{Path: path, Value: value}); err != nil {
+			return err
+		}
+		count++
+		return nil
+	}
+
+	err := s.ForEachKey(func(key string, value interface{}) error {
+		path := query.PropertyPath(key)
+		if granularity != ExportByLeaf {
+			return emit(path, value)
+		}
+		return walkLeaves(path, value, emit)
+	})
+
+	return count, err
+}
+
+// walkLeaves calls emit for every leaf below value. Objects are descended into;
+// everything else, including arrays and empty objects, is emitted as a single leaf.
+func walkLeaves(path string, value interface{}, emit func(string, interface{}) error) error {
+	mapValue, ok := value.(map[string]interface{})
+	if !ok || len(mapValue) == 0 {
+		return emit(path, value)
+	}
+
+	for key, child := range mapValue {
+		if err := walkLeaves(path+query.PropertyPath(key), child, emit); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ImportNDJSON reads Entry lines from r and applies each one to the store with
+// Set as soon as it is decoded. It returns the number of lines applied; on
+// error, the lines before the failing one have already been written.
+func ImportNDJSON(s Store, r io.Reader) (int, error) {
+	decoder := json.NewDecoder(r)
+
+	count := 0
+	for {
+		var entry Entry
+		err := decoder.Decode(&entry)
+		if errors.Is(err, io.EOF) {
+			return count, nil
+		}
+		if err != nil {
+			return count, fmt.Errorf("line %d: %w", count+1, err)
+		}
+
+		if entry.Path == "" {
+			return count, fmt.Errorf("line %d: missing path", count+1)
+		}
+
+		if err := s.Set(entry.Path, entry.Value); err != nil {
+			return count, fmt.Errorf("line %d (%q): %w", count+1, entry.Path, err)
+		}
+		count++
+	}
+}
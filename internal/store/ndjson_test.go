@@ -0,0 +1,258 @@
+package store_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/piske-alex/go-sse/internal/query"
+	"github.com/piske-alex/go-sse/internal/store"
+)
+
+// ndjsonTestData returns a fresh copy of the document used by the round-trip tests
+func ndjsonTestData() map[string]interface{} {
+	return map[string]interface{}{
+		"data": map[string]interface{}{
+			"positions": []interface{}{
+				map[string]interface{}{"id": "pos1", "trader": "abc", "amount": float64(100)},
+				map[string]interface{}{"id": "pos2", "trader": "xyz", "amount": float64(200)},
+			},
+			"config": map[string]interface{}{
+				"maxUsers": float64(100),
+				"limits":   map[string]interface{}{"daily": float64(5)},
+				"empty":    map[string]interface{}{},
+			},
+		},
+		"version": "1.2.0",
+	}
+}
+
+// normalize round-trips a value through JSON so stores with different native types compare equal
+func normalize(t *testing.T, value interface{}) interface{} {
+	t.Helper()
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		t.Fatalf("Failed to marshal value: %v", err)
+	}
+
+	var out interface{}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		t.Fatalf("Failed to unmarshal value: %v", err)
+	}
+	return out
+}
+
+// assertRoundTrip exports src, imports the stream into dst and compares the results
+func assertRoundTrip(t *testing.T, src, dst store.Store, granularity store.ExportGranularity) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	written, err := store.ExportNDJSON(src, &buf, granularity)
+	if err != nil {
+		t.Fatalf("Failed to export store: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != written {
+		t.Fatalf("Expected %d lines, got %d", written, len(lines))
+	}
+
+	applied, err := store.ImportNDJSON(dst, &buf)
+	if err != nil {
+		t.Fatalf("Failed to import store: %v", err)
+	}
+	if applied != written {
+		t.Fatalf("Expected %d lines applied, got %d", written, applied)
+	}
+
+	want, err := src.Get(".")
+	if err != nil {
+		t.Fatalf("Failed to get source data: %v", err)
+	}
+	got, err := dst.Get(".")
+	if err != nil {
+		t.Fatalf("Failed to get imported data: %v", err)
+	}
+
+	if !reflect.DeepEqual(normalize(t, want), normalize(t, got)) {
+		t.Errorf("Round trip mismatch:\nwant %v\ngot  %v", normalize(t, want), normalize(t, got))
+	}
+}
+
+func TestNDJSON_RoundTripKVStore(t *testing.T) {
+	tests := []struct {
+		name          string
+		granularity   store.ExportGranularity
+		expectedLines int
+	}{
+		{name: "by key", granularity: store.ExportByKey, expectedLines: 2},
+		{name: "by leaf", granularity: store.ExportByLeaf, expectedLines: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := store.NewStore()
+			src.Initialize(ndjsonTestData())
+
+			var buf bytes.Buffer
+			written, err := store.ExportNDJSON(src, &buf, tt.granularity)
+			if err != nil {
+				t.Fatalf("Failed to export store: %v", err)
+			}
+			if written != tt.expectedLines {
+				t.Errorf("Expected %d lines, got %d", tt.expectedLines, written)
+			}
+
+			assertRoundTrip(t, src, store.NewStore(), tt.granularity)
+		})
+	}
+}
+
+func TestNDJSON_RoundTripQuotedKeys(t *testing.T) {
+	data := map[string]interface{}{
+		"user-1":     map[string]interface{}{"status": "online", "last.seen": "today"},
+		"a.b":        float64(1),
+		"say \"hi\"": map[string]interface{}{"to world": true},
+	}
+
+	for _, granularity := range []store.ExportGranularity{store.ExportByKey, store.ExportByLeaf} {
+		t.Run(string(granularity), func(t *testing.T) {
+			src := store.NewStore()
+			src.Initialize(data)
+
+			var buf bytes.Buffer
+			if _, err := store.ExportNDJSON(src, &buf, granularity); err != nil {
+				t.Fatalf("Failed to export store: %v", err)
+			}
+			if granularity == store.ExportByLeaf && !strings.Contains(buf.String(), `".\"user-1\".\"last.seen\""`) {
+				t.Errorf("Expected quoted path segments, got %s", buf.String())
+			}
+
+			assertRoundTrip(t, src, store.NewStore(), granularity)
+		})
+	}
+}
+
+func TestNDJSON_ImportErrors(t *testing.T) {
+	tests := []struct {
+		name            string
+		input           string
+		expectedApplied int
+	}{
+		{
+			name:            "invalid json",
+			input:           `{"path": ".a", "value": 1}` + "\n" + `{"path": ".b", "value": `,
+			expectedApplied: 1,
+		},
+		{
+			name:            "missing path",
+			input:           `{"value": 1}`,
+			expectedApplied: 0,
+		},
+		{
+			name:            "invalid path",
+			input:           `{"path": "a", "value": 1}`,
+			expectedApplied: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kvStore := store.NewStore()
+
+			applied, err := store.ImportNDJSON(kvStore, strings.NewReader(tt.input))
+			if err == nil {
+				t.Fatalf("Expected error, got nil")
+			}
+			if applied != tt.expectedApplied {
+				t.Errorf("Expected %d lines applied, got %d", tt.expectedApplied, applied)
+			}
+		})
+	}
+}
+
+func TestNDJSON_RoundTripMongoStore(t *testing.T) {
+	skipIfNoMongo(t)
+
+	mongouri := os.Getenv("MONGO_URI")
+	if mongouri == "" {
+		mongouri = "mongodb://localhost:27017"
+	}
+
+	suffix := time.Now().Format("20060102150405")
+
+	src, err := store.NewMongoStore(mongouri, "gosse_test", "store_test", "ndjson_src_"+suffix)
+	if err != nil {
+		t.Fatalf("Failed to create MongoDB store: %v", err)
+	}
+	defer src.Disconnect()
+
+	dst, err := store.NewMongoStore(mongouri, "gosse_test", "store_test", "ndjson_dst_"+suffix)
+	if err != nil {
+		t.Fatalf("Failed to create MongoDB store: %v", err)
+	}
+	defer dst.Disconnect()
+
+	if err := src.Initialize(ndjsonTestData()); err != nil {
+		t.Fatalf("Failed to initialize store: %v", err)
+	}
+
+	for _, granularity := range []store.ExportGranularity{store.ExportByKey, store.ExportByLeaf} {
+		if err := dst.Initialize(map[string]interface{}{}); err != nil {
+			t.Fatalf("Failed to reset store: %v", err)
+		}
+		assertRoundTrip(t, src, dst, granularity)
+	}
+
+	// Export from MongoDB into memory to check the backends agree
+	assertRoundTrip(t, src, store.NewStore(), store.ExportByKey)
+}
+
+func TestNDJSON_RoundTripMongoCollectionMode(t *testing.T) {
+	skipIfNoMongo(t)
+
+	mongouri := os.Getenv("MONGO_URI")
+	if mongouri == "" {
+		mongouri = "mongodb://localhost:27017"
+	}
+
+	suffix := time.Now().Format("20060102150405")
+
+	src, err := store.NewMongoStore(mongouri, "gosse_test", "ndjson_src_"+suffix, "")
+	if err != nil {
+		t.Fatalf("Failed to create MongoDB store: %v", err)
+	}
+	defer src.Disconnect()
+
+	dst, err := store.NewMongoStore(mongouri, "gosse_test", "ndjson_dst_"+suffix, "")
+	if err != nil {
+		t.Fatalf("Failed to create MongoDB store: %v", err)
+	}
+	defer dst.Disconnect()
+
+	// Each top-level key is a document, including IDs that need quoting
+	for key, value := range map[string]interface{}{
+		"alice":  map[string]interface{}{"status": "online", "profile": map[string]interface{}{"age": float64(30)}},
+		"user-1": map[string]interface{}{"tags": []interface{}{"a", "b"}},
+	} {
+		if err := src.Set(query.PropertyPath(key), value); err != nil {
+			t.Fatalf("Failed to set document %s: %v", key, err)
+		}
+	}
+
+	for _, granularity := range []store.ExportGranularity{store.ExportByKey, store.ExportByLeaf} {
+		if err := dst.Set(".", map[string]interface{}{}); err != nil {
+			t.Fatalf("Failed to reset store: %v", err)
+		}
+		assertRoundTrip(t, src, dst, granularity)
+	}
+
+	if value, err := dst.Get(`."user-1".tags[1]`); err != nil || value != "b" {
+		t.Errorf("Expected the imported element b, got %v %v", value, err)
+	}
+}
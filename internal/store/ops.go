@@ -0,0 +1,373 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ErrInvalidOperation is returned when an operation is malformed or does not fit the value at its path
+var ErrInvalidOperation = errors.New("invalid operation")
+
+// errRootOperation is returned when an operation targets the root of the store
+var errRootOperation = fmt.Errorf("%w: operations are not supported at the root path", ErrInvalidOperation)
+
+// OperationType names an atomic operation
+type OperationType string
+
+const (
+	// OpAppend adds Value to the end of an array
+	OpAppend OperationType = "append"
+	// OpPrepend adds Value to the start of an array
+	OpPrepend OperationType = "prepend"
+	// OpInsert adds Value to an array at Index
+	OpInsert OperationType = "insert"
+	// OpRemove removes the array elements matching Where, or equal to Value
+	OpRemove OperationType = "remove"
+	// OpUpsert replaces the array element whose Key field equals Value's, or appends Value
+	OpUpsert OperationType = "upsert"
+	// OpIncrement adds Value (default 1) to a number
+	OpIncrement OperationType = "increment"
+	// OpDecrement subtracts Value (default 1) from a number
+	OpDecrement OperationType = "decrement"
+	// OpToggle negates a boolean
+	OpToggle OperationType = "toggle"
+)
+
+// Operation is an atomic modification of the value at a path.
+// Missing arrays, numbers and booleans start out empty, zero and false.
+type Operation struct {
+	Op    OperationType          `json:"op"`
+	Value interface{}            `json:"value,omitempty"`
+	Index int                    `json:"index,omitempty"`
+	Where map[string]interface{} `json:"where,omitempty"`
+	Key   string                 `json:"key,omitempty"`
+}
+
+// Change describes the effect of an operation on a single element or value
+type Change struct {
+	Op OperationType `json:"op"`
+	// Path addresses the changed element, e.g. ".data.positions[3]", or the changed value
+	Path string `json:"path"`
+	// Value is the new element or value; for removals it is the element that was removed
+	Value interface{} `json:"value"`
+	// OldValue is the element replaced by an upsert or the value before an increment or toggle
+	OldValue interface{} `json:"old_value,omitempty"`
+}
+
+// invalidOperation wraps ErrInvalidOperation with details
+func invalidOperation(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidOperation, fmt.Sprintf(format, args...))
+}
+
+// elementPath returns the path of an array element
+func elementPath(path string, index int) string {
+	return fmt.Sprintf("%s[%d]", path, index)
+}
+
+// Apply performs op on the value at path atomically and returns the element-level changes.
+// Pending expiries of path are kept.
+func (s *KVStore) Apply(path string, op Operation) ([]Change, error) {
+	if path == "" || path == "." {
+		return nil, errRootOperation
+	}
+
+	s.writeMux.Lock()
+	defer s.writeMux.Unlock()
+
+	before := s.Snapshot()
+	current, exists := lookupPath(before, path)
+	value, changes, err := applyOperation(current, exists, path, op)
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	if err := s.setValueByPath(path, value); err != nil {
+		return nil, err
+	}
+	s.recordRevision(string(op.Op), path, before)
+	return changes, nil
+}
+
+// validateOperation checks the arguments of op without looking at the value it applies to
+func validateOperation(op Operation) error {
+	switch op.Op {
+	case OpAppend, OpPrepend, OpToggle:
+		return nil
+
+	case OpInsert:
+		if op.Index < 0 {
+			return invalidOperation("index must not be negative")
+		}
+		return nil
+
+	case OpRemove:
+		if op.Where == nil && op.Value == nil {
+			return invalidOperation("remove needs a where predicate or a value")
+		}
+		for key := range op.Where {
+			if strings.HasPrefix(key, "$") {
+				return invalidOperation("where field %q must not start with '$'", key)
+			}
+		}
+		return nil
+
+	case OpUpsert:
+		_, err := upsertKey(op)
+		return err
+
+	case OpIncrement, OpDecrement:
+		_, err := incrementAmount(op)
+		return err
+	}
+
+	return invalidOperation("unknown operation %q", op.Op)
+}
+
+// applyOperation computes the result of op on current, the value at path.
+// It never modifies current and returns the new value and the element-level changes.
+// Removals are reported from the highest index down so they can be replayed in order.
+func applyOperation(current interface{}, exists bool, path string, op Operation) (interface{}, []Change, error) {
+	if err := validateOperation(op); err != nil {
+		return nil, nil, err
+	}
+
+	switch op.Op {
+	case OpAppend, OpPrepend, OpInsert, OpRemove, OpUpsert:
+		array, err := arrayOperand(current, exists)
+		if err != nil {
+			return nil, nil, err
+		}
+		return applyArrayOperation(array, path, op)
+
+	case OpIncrement, OpDecrement:
+		number := 0.0
+		if exists && current != nil {
+			n, ok := toFloat(current)
+			if !ok {
+				return nil, nil, invalidOperation("value at %s is not a number", path)
+			}
+			number = n
+		}
+
+		amount, _ := incrementAmount(op)
+		result := number + amount
+		return result, []Change{{Op: op.Op, Path: path, Value: result, OldValue: number}}, nil
+
+	case OpToggle:
+		flag := false
+		if exists && current != nil {
+			b, ok := current.(bool)
+			if !ok {
+				return nil, nil, invalidOperation("value at %s is not a boolean", path)
+			}
+			flag = b
+		}
+		return !flag, []Change{{Op: op.Op, Path: path, Value: !flag, OldValue: flag}}, nil
+
+	}
+
+	return nil, nil, invalidOperation("unknown operation %q", op.Op)
+}
+
+// applyArrayOperation computes the result of an array operation on a copy of array
+func applyArrayOperation(array []interface{}, path string, op Operation) (interface{}, []Change, error) {
+	switch op.Op {
+	case OpAppend:
+		result := append(append(make([]interface{}, 0, len(array)+1), array...), op.Value)
+		return result, []Change{{Op: op.Op, Path: elementPath(path, len(array)), Value: op.Value}}, nil
+
+	case OpPrepend:
+		return insertAt(array, 0, path, op)
+
+	case OpInsert:
+		if op.Index > len(array) {
+			return nil, nil, invalidOperation("index %d is out of range for an array of length %d", op.Index, len(array))
+		}
+		return insertAt(array, op.Index, path, op)
+
+	case OpRemove:
+		result := make([]interface{}, 0, len(array))
+		var changes []Change
+		for i := len(array) - 1; i >= 0; i-- {
+			if matchesRemoval(array[i], op) {
+				changes = append(changes, Change{Op: op.Op, Path: elementPath(path, i), Value: array[i]})
+			}
+		}
+		for _, element := range array {
+			if !matchesRemoval(element, op) {
+				result = append(result, element)
+			}
+		}
+		return result, changes, nil
+
+	case OpUpsert:
+		keyValue, _ := upsertKey(op)
+
+		for i, element := range array {
+			if m, ok := toStringMap(element); ok && valuesEqual(m[op.Key], keyValue) {
+				result := append([]interface{}(nil), array...)
+				result[i] = op.Value
+				return result, []Change{{Op: op.Op, Path: elementPath(path, i), Value: op.Value, OldValue: element}}, nil
+			}
+		}
+
+		result := append(append(make([]interface{}, 0, len(array)+1), array...), op.Value)
+		return result, []Change{{Op: op.Op, Path: elementPath(path, len(array)), Value: op.Value}}, nil
+	}
+
+	return nil, nil, invalidOperation("unknown operation %q", op.Op)
+}
+
+// insertAt returns a copy of array with op.Value inserted at index
+func insertAt(array []interface{}, index int, path string, op Operation) (interface{}, []Change, error) {
+	result := make([]interface{}, 0, len(array)+1)
+	result = append(result, array[:index]...)
+	result = append(result, op.Value)
+	result = append(result, array[index:]...)
+	return result, []Change{{Op: op.Op, Path: elementPath(path, index), Value: op.Value}}, nil
+}
+
+// arrayOperand returns the array an array operation works on
+func arrayOperand(current interface{}, exists bool) ([]interface{}, error) {
+	if !exists || current == nil {
+		return nil, nil
+	}
+
+	// Values decoded from BSON use a named slice type
+	if v := reflect.ValueOf(current); v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Interface {
+		array := make([]interface{}, v.Len())
+		for i := range array {
+			array[i] = v.Index(i).Interface()
+		}
+		return array, nil
+	}
+
+	return nil, invalidOperation("value is not an array")
+}
+
+// upsertKey validates an upsert and returns the key value of the new element
+func upsertKey(op Operation) (interface{}, error) {
+	if op.Key == "" {
+		return nil, invalidOperation("upsert needs a key field")
+	}
+
+	element, ok := op.Value.(map[string]interface{})
+	if !ok {
+		return nil, invalidOperation("upsert value must be an object")
+	}
+
+	keyValue, ok := element[op.Key]
+	if !ok {
+		return nil, invalidOperation("upsert value has no %q field", op.Key)
+	}
+
+	return keyValue, nil
+}
+
+// incrementAmount returns the signed amount an increment or decrement adds
+func incrementAmount(op Operation) (float64, error) {
+	amount := 1.0
+	if op.Value != nil {
+		n, ok := toFloat(op.Value)
+		if !ok {
+			return 0, invalidOperation("%s amount must be a number", op.Op)
+		}
+		amount = n
+	}
+
+	if op.Op == OpDecrement {
+		amount = -amount
+	}
+	return amount, nil
+}
+
+// matchesRemoval reports whether element is selected by a remove operation.
+// With a where predicate, every field in it must equal the element's field.
+func matchesRemoval(element interface{}, op Operation) bool {
+	if op.Where == nil {
+		return valuesEqual(element, op.Value)
+	}
+
+	m, ok := toStringMap(element)
+	if !ok {
+		return false
+	}
+	for key, expected := range op.Where {
+		actual, exists := m[key]
+		if !exists || !valuesEqual(actual, expected) {
+			return false
+		}
+	}
+	return true
+}
+
+// toStringMap returns element as a map, accepting named map types decoded from BSON
+func toStringMap(element interface{}) (map[string]interface{}, bool) {
+	if m, ok := element.(map[string]interface{}); ok {
+		return m, true
+	}
+
+	v := reflect.ValueOf(element)
+	if v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String || v.Type().Elem().Kind() != reflect.Interface {
+		return nil, false
+	}
+
+	m := make(map[string]interface{}, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		m[iter.Key().String()] = iter.Value().Interface()
+	}
+	return m, true
+}
+
+// valuesEqual compares values, treating numbers of different Go types as equal when their values are
+func valuesEqual(a, b interface{}) bool {
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		return ok && x == y
+	}
+
+	switch a.(type) {
+	case string, bool, nil:
+		return a == b
+	}
+
+	// Containers may differ only in their Go types, e.g. BSON documents versus maps
+	return reflect.DeepEqual(a, b) || reflect.DeepEqual(normalizeValue(a), normalizeValue(b))
+}
+
+// toFloat converts any Go number to float64
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+	return 0, false
+}
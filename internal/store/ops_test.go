@@ -0,0 +1,277 @@
+package store_test
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/piske-alex/go-sse/internal/store"
+)
+
+// runOperationScenario applies a sequence of operations and checks the changes each reports
+func runOperationScenario(t *testing.T, s store.Store) {
+	t.Helper()
+
+	err := s.Initialize(map[string]interface{}{
+		"data": map[string]interface{}{
+			"positions": []interface{}{
+				map[string]interface{}{"id": "a", "qty": float64(1)},
+				map[string]interface{}{"id": "b", "qty": float64(2)},
+			},
+			"tags":  []interface{}{"x"},
+			"count": float64(5),
+			"live":  false,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to initialize store: %v", err)
+	}
+
+	steps := []struct {
+		name string
+		path string
+		op   store.Operation
+		want []store.Change
+	}{
+		{"append", ".data.tags", store.Operation{Op: store.OpAppend, Value: "y"},
+			[]store.Change{{Op: store.OpAppend, Path: ".data.tags[1]", Value: "y"}}},
+		{"prepend", ".data.tags", store.Operation{Op: store.OpPrepend, Value: "w"},
+			[]store.Change{{Op: store.OpPrepend, Path: ".data.tags[0]", Value: "w"}}},
+		{"insert", ".data.tags", store.Operation{Op: store.OpInsert, Index: 2, Value: "z"},
+			[]store.Change{{Op: store.OpInsert, Path: ".data.tags[2]", Value: "z"}}},
+		{"remove value", ".data.tags", store.Operation{Op: store.OpRemove, Value: "x"},
+			[]store.Change{{Op: store.OpRemove, Path: ".data.tags[1]", Value: "x"}}},
+		{"remove nothing", ".data.tags", store.Operation{Op: store.OpRemove, Value: "missing"}, nil},
+		{"upsert existing", ".data.positions", store.Operation{Op: store.OpUpsert, Key: "id", Value: map[string]interface{}{"id": "b", "qty": float64(3)}},
+			[]store.Change{{
+				Op:       store.OpUpsert,
+				Path:     ".data.positions[1]",
+				Value:    map[string]interface{}{"id": "b", "qty": float64(3)},
+				OldValue: map[string]interface{}{"id": "b", "qty": float64(2)},
+			}}},
+		{"upsert new", ".data.positions", store.Operation{Op: store.OpUpsert, Key: "id", Value: map[string]interface{}{"id": "c", "qty": float64(1)}},
+			[]store.Change{{Op: store.OpUpsert, Path: ".data.positions[2]", Value: map[string]interface{}{"id": "c", "qty": float64(1)}}}},
+		{"remove where", ".data.positions", store.Operation{Op: store.OpRemove, Where: map[string]interface{}{"id": "a"}},
+			[]store.Change{{Op: store.OpRemove, Path: ".data.positions[0]", Value: map[string]interface{}{"id": "a", "qty": float64(1)}}}},
+		{"increment", ".data.count", store.Operation{Op: store.OpIncrement, Value: float64(2)},
+			[]store.Change{{Op: store.OpIncrement, Path: ".data.count", Value: float64(7), OldValue: float64(5)}}},
+		{"decrement", ".data.count", store.Operation{Op: store.OpDecrement},
+			[]store.Change{{Op: store.OpDecrement, Path: ".data.count", Value: float64(6), OldValue: float64(7)}}},
+		{"increment missing", ".data.visits", store.Operation{Op: store.OpIncrement},
+			[]store.Change{{Op: store.OpIncrement, Path: ".data.visits", Value: float64(1), OldValue: float64(0)}}},
+		{"toggle", ".data.live", store.Operation{Op: store.OpToggle},
+			[]store.Change{{Op: store.OpToggle, Path: ".data.live", Value: true, OldValue: false}}},
+	}
+
+	for _, step := range steps {
+		changes, err := s.Apply(step.path, step.op)
+		if err != nil {
+			t.Fatalf("%s: failed to apply operation: %v", step.name, err)
+		}
+		if !reflect.DeepEqual(changes, step.want) {
+			t.Errorf("%s: expected changes %+v, got %+v", step.name, step.want, changes)
+		}
+	}
+
+	tags, err := s.Get(".data.tags")
+	if err != nil {
+		t.Fatalf("Failed to get tags: %v", err)
+	}
+	if want := []interface{}{"w", "z", "y"}; !reflect.DeepEqual(tags, want) {
+		t.Errorf("Expected tags %v, got %v", want, tags)
+	}
+
+	// Operations that do not fit the value are rejected
+	invalid := []struct {
+		name string
+		path string
+		op   store.Operation
+	}{
+		{"insert out of range", ".data.tags", store.Operation{Op: store.OpInsert, Index: 9, Value: "q"}},
+		{"increment array", ".data.tags", store.Operation{Op: store.OpIncrement}},
+		{"append to number", ".data.count", store.Operation{Op: store.OpAppend, Value: "q"}},
+		{"root", ".", store.Operation{Op: store.OpAppend, Value: "q"}},
+	}
+	for _, step := range invalid {
+		if _, err := s.Apply(step.path, step.op); !errors.Is(err, store.ErrInvalidOperation) {
+			t.Errorf("%s: expected ErrInvalidOperation, got %v", step.name, err)
+		}
+	}
+}
+
+func TestKVStore_Apply(t *testing.T) {
+	runOperationScenario(t, store.NewStore())
+}
+
+func TestKVStore_ApplyInvalidArguments(t *testing.T) {
+	s := store.NewStore()
+
+	ops := []store.Operation{
+		{Op: "shuffle"},
+		{Op: store.OpInsert, Index: -1, Value: "x"},
+		{Op: store.OpRemove},
+		{Op: store.OpRemove, Where: map[string]interface{}{"$where": "true"}},
+		{Op: store.OpUpsert, Value: map[string]interface{}{"id": "a"}},
+		{Op: store.OpUpsert, Key: "id", Value: "a"},
+		{Op: store.OpUpsert, Key: "id", Value: map[string]interface{}{"name": "a"}},
+		{Op: store.OpIncrement, Value: "one"},
+	}
+	for _, op := range ops {
+		if _, err := s.Apply(".items", op); !errors.Is(err, store.ErrInvalidOperation) {
+			t.Errorf("Expected ErrInvalidOperation for %+v, got %v", op, err)
+		}
+	}
+}
+
+func TestKVStore_ApplyConcurrent(t *testing.T) {
+	s := store.NewStore()
+
+	const workers = 50
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s.Apply(".counter", store.Operation{Op: store.OpIncrement})
+			s.Apply(".events", store.Operation{Op: store.OpAppend, Value: float64(i)})
+		}(i)
+	}
+	wg.Wait()
+
+	counter, _ := s.Get(".counter")
+	if counter != float64(workers) {
+		t.Errorf("Expected counter %d, got %v", workers, counter)
+	}
+	events, _ := s.Get(".events")
+	if array, ok := events.([]interface{}); !ok || len(array) != workers {
+		t.Errorf("Expected %d events, got %v", workers, events)
+	}
+}
+
+func TestKVStore_ApplyRecordsHistory(t *testing.T) {
+	s := store.NewStore()
+	s.EnableHistory(store.HistoryConfig{MaxRevisions: 10})
+
+	s.Apply(".counter", store.Operation{Op: store.OpIncrement})
+	s.Apply(".counter", store.Operation{Op: store.OpIncrement})
+
+	revisions, err := s.History(".counter", 0)
+	if err != nil {
+		t.Fatalf("Failed to read history: %v", err)
+	}
+	if len(revisions) != 2 || revisions[1].Op != string(store.OpIncrement) || revisions[1].NewValue != float64(2) {
+		t.Errorf("Unexpected revisions %+v", revisions)
+	}
+}
+
+func TestMongoStore_Apply(t *testing.T) {
+	skipIfNoMongo(t)
+
+	mongouri := os.Getenv("MONGO_URI")
+	if mongouri == "" {
+		mongouri = "mongodb://localhost:27017"
+	}
+
+	suffix := time.Now().Format("20060102150405")
+	s, err := store.NewMongoStore(mongouri, "gosse_test", "store_test", "ops_"+suffix)
+	if err != nil {
+		t.Fatalf("Failed to create MongoDB store: %v", err)
+	}
+	defer s.Disconnect()
+
+	runOperationScenario(t, s)
+}
+
+func TestMongoStore_ApplyCollectionMode(t *testing.T) {
+	skipIfNoMongo(t)
+
+	mongouri := os.Getenv("MONGO_URI")
+	if mongouri == "" {
+		mongouri = "mongodb://localhost:27017"
+	}
+
+	collectionName := "ops_" + time.Now().Format("20060102150405")
+	s, err := store.NewMongoStore(mongouri, "gosse_test", collectionName, "")
+	if err != nil {
+		t.Fatalf("Failed to create MongoDB store: %v", err)
+	}
+	defer s.Disconnect()
+
+	recorder := newChangeRecorder(s)
+	waitForChangeStream(t, s)
+
+	// Operations and change events address documents the same way, by a leading dot
+	if err := s.Set(".alice", map[string]interface{}{"tags": []interface{}{"x"}, "visits": float64(1)}); err != nil {
+		t.Fatalf("Failed to set document: %v", err)
+	}
+
+	changes, err := s.Apply(".alice.tags", store.Operation{Op: store.OpAppend, Value: "y"})
+	if err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	if want := []store.Change{{Op: store.OpAppend, Path: ".alice.tags[1]", Value: "y"}}; !reflect.DeepEqual(changes, want) {
+		t.Errorf("Expected changes %+v, got %+v", want, changes)
+	}
+	// Depending on the server version, MongoDB reports the new element or the whole array
+	recorder.waitFor(t, 5*time.Second, func(e store.Entry) bool { return strings.HasPrefix(e.Path, ".alice.tags") })
+
+	changes, err = s.Apply(".alice.visits", store.Operation{Op: store.OpIncrement})
+	if err != nil {
+		t.Fatalf("Failed to increment: %v", err)
+	}
+	if len(changes) != 1 || changes[0].Path != ".alice.visits" {
+		t.Errorf("Unexpected changes %+v", changes)
+	}
+	recorder.waitFor(t, 5*time.Second, func(e store.Entry) bool { return e.Path == ".alice.visits" && e.Value == float64(2) })
+
+	// Paths without the leading dot are rejected
+	if _, err := s.Apply("alice.visits", store.Operation{Op: store.OpIncrement}); err == nil {
+		t.Error("Expected an error for a path without a leading dot")
+	}
+	if err := s.Set("alice.visits", float64(5)); err == nil {
+		t.Error("Expected an error for a set without a leading dot")
+	}
+
+	// Get, Set and Delete take the same paths as Apply
+	if value, err := s.Get(".alice.visits"); err != nil || value != float64(2) {
+		t.Errorf("Expected 2 visits, got %v %v", value, err)
+	}
+	if err := s.Set(".alice.status", "online"); err != nil {
+		t.Fatalf("Failed to set field: %v", err)
+	}
+	if err := s.Set(`."bob-1".status`, "away"); err != nil {
+		t.Fatalf("Failed to set field of a new document: %v", err)
+	}
+	if value, err := s.Get(`."bob-1".status`); err != nil || value != "away" {
+		t.Errorf("Expected status away, got %v %v", value, err)
+	}
+	if err := s.Set(".alice.tags[5]", "z"); err != store.ErrPathNotFound {
+		t.Errorf("Expected ErrPathNotFound for a missing element, got %v", err)
+	}
+
+	if err := s.Delete(".alice.tags"); err != nil {
+		t.Fatalf("Failed to delete field: %v", err)
+	}
+	if _, err := s.Get(".alice.tags"); err != store.ErrPathNotFound {
+		t.Errorf("Expected ErrPathNotFound after delete, got %v", err)
+	}
+	if err := s.Delete(".alice"); err != nil {
+		t.Fatalf("Failed to delete document: %v", err)
+	}
+	if _, err := s.Get(".alice"); err != store.ErrPathNotFound {
+		t.Errorf("Expected ErrPathNotFound for a deleted document, got %v", err)
+	}
+
+	// No document was written under an empty ID
+	root, err := s.Get(".")
+	if err != nil {
+		t.Fatalf("Failed to get collection: %v", err)
+	}
+	if docs, ok := root.(map[string]interface{}); !ok || len(docs) != 1 || docs["bob-1"] == nil {
+		t.Errorf("Expected only the document bob-1, got %v", root)
+	}
+}
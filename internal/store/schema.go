@@ -0,0 +1,36 @@
+package store
+
+import "github.com/piske-alex/go-sse/internal/schema"
+
+// validateWrite checks a write to path against every registered schema whose path it touches.
+// resolve returns the value a schema path will hold once the write is applied; schema paths
+// that will not exist are skipped.
+func validateWrite(registry *schema.Registry, path string, resolve func(schemaPath string) (interface{}, bool, error)) error {
+	for _, schemaPath := range registry.Paths() {
+		if !pathsOverlap(schemaPath, path) {
+			continue
+		}
+
+		value, exists, err := resolve(schemaPath)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+
+		if err := registry.Validate(schemaPath, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resolveInRoot returns a resolver that looks schema paths up in a prospective root
+func resolveInRoot(root interface{}) func(schemaPath string) (interface{}, bool, error) {
+	return func(schemaPath string) (interface{}, bool, error) {
+		value, exists := lookupPath(root, schemaPath)
+		return value, exists, nil
+	}
+}
@@ -0,0 +1,70 @@
+package store_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/piske-alex/go-sse/internal/schema"
+	"github.com/piske-alex/go-sse/internal/store"
+)
+
+func TestKVStore_SchemaValidation(t *testing.T) {
+	s := store.NewStore()
+	s.Initialize(map[string]interface{}{
+		"data": map[string]interface{}{
+			"positions": []interface{}{
+				map[string]interface{}{"id": "pos1", "amount": float64(10)},
+			},
+		},
+	})
+
+	err := s.Schemas().Register(".data.positions", []byte(`{
+		"type": "array",
+		"items": {"type": "object", "properties": {"amount": {"type": "number"}}}
+	}`))
+	if err != nil {
+		t.Fatalf("Failed to register schema: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		write   func() error
+		invalid bool
+	}{
+		{"set covered path", func() error { return s.Set(".data.positions", "oops") }, true},
+		{"set inside covered path", func() error { return s.Set(".data.positions[0].amount", "ten") }, true},
+		{"set parent of covered path", func() error {
+			return s.Set(".data", map[string]interface{}{"positions": map[string]interface{}{}})
+		}, true},
+		{"set from JSON", func() error { return s.SetFromJSON(".data.positions", []byte(`{"a": 1}`)) }, true},
+		{"initialize", func() error {
+			return s.Initialize(map[string]interface{}{"data": map[string]interface{}{"positions": 5}})
+		}, true},
+		{"valid nested write", func() error { return s.Set(".data.positions[0].amount", float64(20)) }, false},
+		{"parent without covered path", func() error {
+			return s.Set(".data", map[string]interface{}{"config": true})
+		}, false},
+		{"unrelated path", func() error { return s.Set(".other", "anything") }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, _ := s.Get(".")
+			err := tt.write()
+
+			var validationErr *schema.ValidationError
+			if tt.invalid {
+				if !errors.As(err, &validationErr) {
+					t.Fatalf("Expected a schema violation, got %v", err)
+				}
+				// Rejected writes leave the store untouched
+				if after, _ := s.Get("."); !reflect.DeepEqual(before, after) {
+					t.Errorf("Expected rejected write to leave the store unchanged")
+				}
+			} else if err != nil {
+				t.Fatalf("Expected write to succeed, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package store
+
+import (
+	"container/heap"
+	"errors"
+	"time"
+
+	"github.com/piske-alex/go-sse/internal/logging"
+)
+
+// errRootTTL is returned when a TTL is requested for the root of the store
+var errRootTTL = errors.New("ttl is not supported at the root path")
+
+// ttlEntry is a path scheduled to expire
+type ttlEntry struct {
+	path      string
+	expiresAt time.Time
+	index     int // position in the heap, maintained by ttlHeap
+}
+
+// ttlHeap is a min-heap of entries ordered by expiry time
+type ttlHeap []*ttlEntry
+
+func (h ttlHeap) Len() int           { return len(h) }
+func (h ttlHeap) Less(i, j int) bool { return h[i].expiresAt.Before(h[j].expiresAt) }
+
+func (h ttlHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *ttlHeap) Push(x interface{}) {
+	entry := x.(*ttlEntry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+
+func (h *ttlHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	entry := old[n-1]
+	old[n-1] = nil
+	entry.index = -1
+	*h = old[:n-1]
+	return entry
+}
+
+// validateTTL checks that a TTL can be applied to path
+func validateTTL(path string, ttl time.Duration) error {
+	if path == "" || path == "." {
+		return errRootTTL
+	}
+	if ttl <= 0 {
+		return errors.New("ttl must be positive")
+	}
+	return nil
+}
+
+// SetWithTTL updates a value at the given path and deletes it once ttl has elapsed.
+// A later write to the path or one of its parents cancels the expiry.
+func (s *KVStore) SetWithTTL(path string, value interface{}, ttl time.Duration) error {
+	if err := validateTTL(path, ttl); err != nil {
+		return err
+	}
+
+	s.writeMux.Lock()
+	defer s.writeMux.Unlock()
+
+	if err := s.set(path, value); err != nil {
+		return err
+	}
+	s.clearTTLs(path)
+
+	entry := &ttlEntry{path: path, expiresAt: time.Now().Add(ttl)}
+	heap.Push(&s.expiries, entry)
+	s.ttls[path] = entry
+	s.scheduleExpiry()
+
+	return nil
+}
+
+// SetExpiryListener sets a callback that is called with the path and last value of each expired key
+func (s *KVStore) SetExpiryListener(listener func(path string, value interface{})) {
+	s.writeMux.Lock()
+	defer s.writeMux.Unlock()
+	s.expiryListener = listener
+}
+
+// clearTTLs cancels the expiry of path and everything below it. The caller must hold writeMux.
+func (s *KVStore) clearTTLs(path string) {
+	for ttlPath, entry := range s.ttls {
+		if isPathWithin(ttlPath, path) {
+			heap.Remove(&s.expiries, entry.index)
+			delete(s.ttls, ttlPath)
+		}
+	}
+}
+
+// scheduleExpiry arms the timer for the earliest expiry. The caller must hold writeMux.
+func (s *KVStore) scheduleExpiry() {
+	if len(s.expiries) == 0 {
+		if s.expiryTimer != nil {
+			s.expiryTimer.Stop()
+		}
+		return
+	}
+
+	wait := time.Until(s.expiries[0].expiresAt)
+	if s.expiryTimer == nil {
+		s.expiryTimer = time.AfterFunc(wait, s.expireDue)
+	} else {
+		s.expiryTimer.Reset(wait)
+	}
+}
+
+// expireDue deletes every path whose TTL has elapsed and notifies the expiry listener
+func (s *KVStore) expireDue() {
+	s.writeMux.Lock()
+
+	var expired []Entry
+	now := time.Now()
+	for len(s.expiries) > 0 && !s.expiries[0].expiresAt.After(now) {
+		entry := heap.Pop(&s.expiries).(*ttlEntry)
+		delete(s.ttls, entry.path)
+
+		before := s.Snapshot()
+		value, exists := lookupPath(before, entry.path)
+		if !exists {
+			continue
+		}
+
+		if err := s.deleteByPath(entry.path); err != nil {
+			logging.Errorf("Error expiring %s: %v", entry.path, err)
+			continue
+		}
+		s.recordRevision(OpExpire, entry.path, before)
+		expired = append(expired, Entry{Path: entry.path, Value: value})
+	}
+
+	s.scheduleExpiry()
+	listener := s.expiryListener
+	s.writeMux.Unlock()
+
+	// Notify outside the lock so the listener can read the store
+	if listener != nil {
+		for _, entry := range expired {
+			listener(entry.Path, entry.Value)
+		}
+	}
+}
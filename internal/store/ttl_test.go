@@ -0,0 +1,130 @@
+package store_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/piske-alex/go-sse/internal/store"
+)
+
+// expiryRecorder collects expiry notifications from a store
+type expiryRecorder struct {
+	expired chan store.Entry
+}
+
+func newExpiryRecorder(s store.Store) *expiryRecorder {
+	r := &expiryRecorder{expired: make(chan store.Entry, 10)}
+	s.SetExpiryListener(func(path string, value interface{}) {
+		r.expired <- store.Entry{Path: path, Value: value}
+	})
+	return r
+}
+
+// wait returns the next expiry or fails after timeout
+func (r *expiryRecorder) wait(t *testing.T, timeout time.Duration) store.Entry {
+	t.Helper()
+	select {
+	case entry := <-r.expired:
+		return entry
+	case <-time.After(timeout):
+		t.Fatal("Timed out waiting for expiry")
+		return store.Entry{}
+	}
+}
+
+func TestKVStore_SetWithTTL(t *testing.T) {
+	s := store.NewStore()
+	recorder := newExpiryRecorder(s)
+
+	s.SetWithTTL(".presence.bob", "online", 40*time.Millisecond)
+	s.SetWithTTL(".presence.alice", "online", 10*time.Millisecond)
+
+	// Expiries arrive in deadline order
+	if entry := recorder.wait(t, time.Second); entry.Path != ".presence.alice" || entry.Value != "online" {
+		t.Errorf("Expected alice to expire first, got %+v", entry)
+	}
+	if entry := recorder.wait(t, time.Second); entry.Path != ".presence.bob" {
+		t.Errorf("Expected bob to expire second, got %+v", entry)
+	}
+
+	if _, err := s.Get(".presence.alice"); !errors.Is(err, store.ErrPathNotFound) {
+		t.Errorf("Expected expired key to be deleted, got %v", err)
+	}
+}
+
+func TestKVStore_WriteCancelsTTL(t *testing.T) {
+	s := store.NewStore()
+	recorder := newExpiryRecorder(s)
+
+	// A plain write to the key cancels its expiry
+	s.SetWithTTL(".locks.a", "worker-1", 10*time.Millisecond)
+	s.Set(".locks.a", "worker-2")
+
+	// Replacing a parent cancels the expiry of everything below it
+	s.SetWithTTL(".sessions.x.token", "abc", 10*time.Millisecond)
+	s.Set(".sessions", map[string]interface{}{"y": "def"})
+
+	// Writing below a key keeps its expiry
+	s.SetWithTTL(".presence.carol", map[string]interface{}{"status": "online"}, 20*time.Millisecond)
+	s.Set(".presence.carol.status", "away")
+
+	if entry := recorder.wait(t, time.Second); entry.Path != ".presence.carol" {
+		t.Fatalf("Expected only carol to expire, got %+v", entry)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	select {
+	case entry := <-recorder.expired:
+		t.Errorf("Unexpected expiry %+v", entry)
+	default:
+	}
+
+	if value, err := s.Get(".locks.a"); err != nil || value != "worker-2" {
+		t.Errorf("Expected lock to survive, got %v (%v)", value, err)
+	}
+}
+
+func TestKVStore_SetWithTTLErrors(t *testing.T) {
+	s := store.NewStore()
+
+	if err := s.SetWithTTL(".", map[string]interface{}{}, time.Second); err == nil {
+		t.Error("Expected an error for a TTL on the root")
+	}
+	if err := s.SetWithTTL(".a", "b", 0); err == nil {
+		t.Error("Expected an error for a zero TTL")
+	}
+}
+
+func TestMongoStore_SetWithTTL(t *testing.T) {
+	skipIfNoMongo(t)
+
+	mongouri := os.Getenv("MONGO_URI")
+	if mongouri == "" {
+		mongouri = "mongodb://localhost:27017"
+	}
+
+	suffix := time.Now().Format("20060102150405")
+	s, err := store.NewMongoStore(mongouri, "gosse_test", "store_test", "ttl_"+suffix)
+	if err != nil {
+		t.Fatalf("Failed to create MongoDB store: %v", err)
+	}
+	defer s.Disconnect()
+
+	recorder := newExpiryRecorder(s)
+
+	if err := s.Initialize(map[string]interface{}{}); err != nil {
+		t.Fatalf("Failed to initialize store: %v", err)
+	}
+	if err := s.SetWithTTL(".presence.alice", "online", 100*time.Millisecond); err != nil {
+		t.Fatalf("Failed to set value with TTL: %v", err)
+	}
+
+	if entry := recorder.wait(t, 5*time.Second); entry.Path != ".presence.alice" || entry.Value != "online" {
+		t.Errorf("Unexpected expiry %+v", entry)
+	}
+	if _, err := s.Get(".presence.alice"); err == nil {
+		t.Error("Expected expired key to be deleted")
+	}
+}
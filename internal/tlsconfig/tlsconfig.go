@@ -0,0 +1,182 @@
+// Package tlsconfig builds the server's TLS configuration and reloads its certificate without a restart.
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/piske-alex/go-sse/internal/logging"
+)
+
+// Config describes the TLS settings of the server
+type Config struct {
+	CertFile     string             // PEM certificate chain
+	KeyFile      string             // PEM private key
+	MinVersion   uint16             // Lowest accepted TLS version
+	ClientCAFile string             // PEM CA bundle for client certificates, empty to disable mTLS
+	ClientAuth   tls.ClientAuthType // Client certificate policy when ClientCAFile is set
+}
+
+// NewConfig builds the TLS settings from the certificate and key files, the CA bundle
+// for client certificates, the minimum version ("1.2" or "1.3") and the client
+// certificate policy ("require" or "optional"). Empty values use the defaults.
+// It reports false when neither the certificate nor the key is set.
+func NewConfig(certFile, keyFile, clientCAFile, minVersion, clientAuth string) (Config, bool, error) {
+	config := Config{
+		CertFile:     certFile,
+		KeyFile:      keyFile,
+		MinVersion:   tls.VersionTLS12,
+		ClientCAFile: clientCAFile,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+
+	if config.CertFile == "" && config.KeyFile == "" {
+		return config, false, nil
+	}
+	if config.CertFile == "" || config.KeyFile == "" {
+		return config, false, errors.New("the TLS certificate and key files must be set together")
+	}
+
+	switch minVersion {
+	case "", "1.2":
+	case "1.3":
+		config.MinVersion = tls.VersionTLS13
+	default:
+		return config, false, fmt.Errorf("unsupported TLS minimum version %q, use 1.2 or 1.3", minVersion)
+	}
+
+	switch strings.ToLower(clientAuth) {
+	case "", "require":
+	case "optional":
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	default:
+		return config, false, fmt.Errorf("unsupported TLS client auth %q, use require or optional", clientAuth)
+	}
+
+	return config, true, nil
+}
+
+// CertReloader serves a certificate that can be replaced while the server runs.
+// Handshakes after a reload use the new certificate; established connections,
+// including open SSE streams, keep the one they negotiated.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	modTimes [2]time.Time
+}
+
+// NewCertReloader loads the certificate and key
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the certificate and key again. On error the current certificate is kept.
+func (r *CertReloader) Reload() error {
+	modTimes, err := r.fileModTimes()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.modTimes = modTimes
+	return nil
+}
+
+// GetCertificate returns the current certificate, for use as tls.Config.GetCertificate
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Watch reloads the certificate whenever the certificate or key file changes,
+// checking every interval until ctx is done
+func (r *CertReloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			modTimes, err := r.fileModTimes()
+			if err != nil {
+				logging.Warnf("cannot check TLS certificate files: %v", err)
+				continue
+			}
+
+			r.mu.RLock()
+			changed := modTimes != r.modTimes
+			r.mu.RUnlock()
+			if !changed {
+				continue
+			}
+
+			if err := r.Reload(); err != nil {
+				// The files may be mid-write; the next check retries
+				logging.Warnf("keeping the current TLS certificate: %v", err)
+				continue
+			}
+			logging.Infof("Reloaded TLS certificate after a file change")
+		}
+	}
+}
+
+// fileModTimes returns the modification times of the certificate and key files
+func (r *CertReloader) fileModTimes() ([2]time.Time, error) {
+	var modTimes [2]time.Time
+	for i, name := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return modTimes, err
+		}
+		modTimes[i] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+// TLSConfig returns a server TLS configuration serving the reloader's certificate.
+// HTTP/2 is offered first, so many SSE streams can share one connection.
+func (c Config) TLSConfig(reloader *CertReloader) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:     c.MinVersion,
+		GetCertificate: reloader.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+
+	if c.ClientCAFile != "" {
+		pem, err := os.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", c.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = c.ClientAuth
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,279 @@
+package tlsconfig_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/piske-alex/go-sse/internal/tlsconfig"
+)
+
+// testCA issues certificates for the tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a PEM certificate and key for a server or client
+func (ca *testCA) issue(t *testing.T, serial int64, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: fmt.Sprintf("cert %d", serial)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeServerCert writes a server certificate and key to dir
+func (ca *testCA) writeServerCert(t *testing.T, dir string, serial int64) (string, string) {
+	t.Helper()
+	certPEM, keyPEM := ca.issue(t, serial, x509.ExtKeyUsageServerAuth)
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	return certFile, keyFile
+}
+
+// serve starts an HTTPS server with config and returns its address
+func serve(t *testing.T, config *tls.Config, handler http.Handler) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	srv := &http.Server{Handler: handler, TLSConfig: config}
+	go srv.ServeTLS(listener, "", "")
+	t.Cleanup(func() { srv.Close() })
+	return "https://" + listener.Addr().String()
+}
+
+// newClient returns an HTTP/2 capable client trusting ca, presenting certificates if given
+func newClient(ca *testCA, certificates ...tls.Certificate) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: ca.pool, Certificates: certificates},
+		ForceAttemptHTTP2: true,
+	}}
+}
+
+func TestCertReloader_HTTP2AndReload(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certFile, keyFile := ca.writeServerCert(t, dir, 10)
+
+	reloader, err := tlsconfig.NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Failed to load certificate: %v", err)
+	}
+	config, err := tlsconfig.Config{MinVersion: tls.VersionTLS12}.TLSConfig(reloader)
+	if err != nil {
+		t.Fatalf("Failed to build TLS config: %v", err)
+	}
+
+	// A handler that streams like an SSE connection until the client goes away
+	addr := serve(t, config, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/events" {
+			return
+		}
+		for i := 0; ; i++ {
+			fmt.Fprintf(w, "data: %d\n\n", i)
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	defer stopWatching()
+	go reloader.Watch(watchCtx, 10*time.Millisecond)
+
+	// An open stream negotiated over HTTP/2
+	streamClient := newClient(ca)
+	req, _ := http.NewRequestWithContext(ctx, "GET", addr+"/events", nil)
+	stream, err := streamClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	defer stream.Body.Close()
+	if stream.ProtoMajor != 2 {
+		t.Errorf("Expected HTTP/2, got %s", stream.Proto)
+	}
+	if serial := stream.TLS.PeerCertificates[0].SerialNumber.Int64(); serial != 10 {
+		t.Errorf("Expected certificate 10, got %d", serial)
+	}
+	lines := bufio.NewScanner(stream.Body)
+	lines.Scan()
+
+	// Replacing the files is picked up by the watcher
+	time.Sleep(20 * time.Millisecond)
+	ca.writeServerCert(t, dir, 11)
+	future := time.Now().Add(time.Second)
+	os.Chtimes(certFile, future, future)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		resp, err := newClient(ca).Get(addr + "/")
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.TLS.PeerCertificates[0].SerialNumber.Int64() == 11 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the new certificate")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The stream opened before the reload keeps flowing
+	for i := 0; i < 3; i++ {
+		if !lines.Scan() {
+			t.Fatalf("Stream ended after the reload: %v", lines.Err())
+		}
+	}
+
+	// A broken file keeps the current certificate
+	os.WriteFile(certFile, []byte("not a certificate"), 0o600)
+	if err := reloader.Reload(); err == nil {
+		t.Error("Expected an error reloading an invalid certificate")
+	}
+	cert, _ := reloader.GetCertificate(nil)
+	if leaf, _ := x509.ParseCertificate(cert.Certificate[0]); leaf.SerialNumber.Int64() != 11 {
+		t.Errorf("Expected the previous certificate to be kept, got %d", leaf.SerialNumber.Int64())
+	}
+}
+
+func TestConfig_ClientCertificates(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certFile, keyFile := ca.writeServerCert(t, dir, 20)
+	caFile := filepath.Join(dir, "ca.crt")
+	os.WriteFile(caFile, ca.pem, 0o600)
+
+	reloader, err := tlsconfig.NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Failed to load certificate: %v", err)
+	}
+	config, err := tlsconfig.Config{
+		MinVersion:   tls.VersionTLS12,
+		ClientCAFile: caFile,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}.TLSConfig(reloader)
+	if err != nil {
+		t.Fatalf("Failed to build TLS config: %v", err)
+	}
+	addr := serve(t, config, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	if _, err := newClient(ca).Get(addr); err == nil {
+		t.Error("Expected a request without a client certificate to fail")
+	}
+
+	certPEM, keyPEM := ca.issue(t, 21, x509.ExtKeyUsageClientAuth)
+	clientCert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("Failed to load client certificate: %v", err)
+	}
+	resp, err := newClient(ca, clientCert).Get(addr)
+	if err != nil {
+		t.Fatalf("Expected a request with a client certificate to succeed: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestNewConfig(t *testing.T) {
+	if _, enabled, err := tlsconfig.NewConfig("", "", "", "", ""); enabled || err != nil {
+		t.Errorf("Expected TLS to be disabled, got %v %v", enabled, err)
+	}
+
+	if _, _, err := tlsconfig.NewConfig("server.crt", "", "", "", ""); err == nil {
+		t.Error("Expected an error for a certificate without a key")
+	}
+
+	config, enabled, err := tlsconfig.NewConfig("server.crt", "server.key", "ca.crt", "", "")
+	if !enabled || err != nil {
+		t.Fatalf("Expected TLS to be enabled, got %v %v", enabled, err)
+	}
+	if config.MinVersion != tls.VersionTLS12 || config.ClientAuth != tls.RequireAndVerifyClientCert || config.ClientCAFile != "ca.crt" {
+		t.Errorf("Expected the defaults, got %+v", config)
+	}
+
+	config, _, err = tlsconfig.NewConfig("server.crt", "server.key", "", "1.3", "optional")
+	if err != nil {
+		t.Fatalf("Expected a valid config, got %v", err)
+	}
+	if config.MinVersion != tls.VersionTLS13 || config.ClientAuth != tls.VerifyClientCertIfGiven {
+		t.Errorf("Unexpected config %+v", config)
+	}
+
+	if _, _, err := tlsconfig.NewConfig("server.crt", "server.key", "", "1.0", ""); err == nil {
+		t.Error("Expected an error for TLS 1.0")
+	}
+	if _, _, err := tlsconfig.NewConfig("server.crt", "server.key", "", "", "sometimes"); err == nil {
+		t.Error("Expected an error for an unknown client auth policy")
+	}
+}
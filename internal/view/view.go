@@ -0,0 +1,495 @@
+// Package view maintains named views computed from store data and kept up to date as the store changes.
+package view
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/piske-alex/go-sse/internal/logging"
+	"github.com/piske-alex/go-sse/internal/query"
+	"github.com/piske-alex/go-sse/internal/store"
+)
+
+var (
+	// ErrInvalidName is returned for view names that cannot be used in URLs
+	ErrInvalidName = errors.New("view names must be 1 to 64 letters, digits, '-' or '_'")
+
+	// ErrInvalidDefinition is returned for definitions that cannot be computed
+	ErrInvalidDefinition = errors.New("invalid view definition")
+)
+
+// namePattern matches valid view names
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Source reads the store data that views are computed from
+type Source interface {
+	Get(path string) (interface{}, error)
+}
+
+// Definition describes how a view is computed from the store.
+//
+// From selects the source values with a path expression that may contain [*] wildcards.
+// Where keeps the source values whose fields equal the given values. Select projects each
+// remaining value into an object; the value is used as is when Select is empty. The view
+// is an array of results when From contains a wildcard, and a single result otherwise.
+type Definition struct {
+	From   string                 `json:"from"`
+	Where  map[string]interface{} `json:"where,omitempty"`
+	Select map[string]Field       `json:"select,omitempty"`
+}
+
+// Field is a projected field: a path within the source value, or a join with other store data
+type Field struct {
+	Path string
+	Join *Join
+}
+
+// Join looks up the first value selected by From whose fields equal the values at the On paths
+// of the source value, for example {"from": ".data.offers[*]", "on": {"id": ".offerId"}, "select": ".price"}.
+// Select is a path within the joined value; the whole value is used when it is empty.
+type Join struct {
+	From   string            `json:"from"`
+	On     map[string]string `json:"on"`
+	Select string            `json:"select,omitempty"`
+}
+
+// UnmarshalJSON accepts a path string or a join object
+func (f *Field) UnmarshalJSON(data []byte) error {
+	var path string
+	if err := json.Unmarshal(data, &path); err == nil {
+		*f = Field{Path: path}
+		return nil
+	}
+
+	var join Join
+	if err := json.Unmarshal(data, &join); err != nil {
+		return fmt.Errorf("a selected field must be a path or a join: %w", err)
+	}
+	*f = Field{Join: &join}
+	return nil
+}
+
+// MarshalJSON writes the field in the form it was defined
+func (f Field) MarshalJSON() ([]byte, error) {
+	if f.Join != nil {
+		return json.Marshal(f.Join)
+	}
+	return json.Marshal(f.Path)
+}
+
+// View is the materialized state of a registered view
+type View struct {
+	Name       string      `json:"name"`
+	Definition Definition  `json:"definition"`
+	Value      interface{} `json:"value"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+}
+
+// entry is a registered view with the store paths it depends on
+type entry struct {
+	view View
+	// sources are the path prefixes whose changes can affect the view
+	sources []string
+}
+
+// Registry holds the registered views of a store and recomputes them when their sources change.
+// It is safe for concurrent use.
+type Registry struct {
+	mu      sync.RWMutex
+	source  Source
+	matcher *query.Matcher
+	views   map[string]*entry
+}
+
+// NewRegistry creates an empty view registry reading from source
+func NewRegistry(source Source) *Registry {
+	return &Registry{
+		source:  source,
+		matcher: query.NewMatcher(),
+		views:   make(map[string]*entry),
+	}
+}
+
+// ValidateName checks that name can be used as a view name
+func ValidateName(name string) error {
+	if !namePattern.MatchString(name) {
+		return ErrInvalidName
+	}
+	return nil
+}
+
+// Register validates and computes a view, replacing any view with the same name
+func (r *Registry) Register(name string, definition Definition) (View, error) {
+	if err := ValidateName(name); err != nil {
+		return View{}, err
+	}
+	sources, err := r.compile(definition)
+	if err != nil {
+		return View{}, err
+	}
+
+	// Compare with the types store values are read as
+	if len(definition.Where) > 0 {
+		where, err := toJSONValue(definition.Where)
+		if err != nil {
+			return View{}, fmt.Errorf("%w: where: %v", ErrInvalidDefinition, err)
+		}
+		definition.Where = where.(map[string]interface{})
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	value, err := r.compute(definition)
+	if err != nil {
+		return View{}, err
+	}
+
+	e := &entry{
+		view: View{
+			Name:       name,
+			Definition: definition,
+			Value:      value,
+			UpdatedAt:  time.Now(),
+		},
+		sources: sources,
+	}
+	r.views[name] = e
+	return e.view, nil
+}
+
+// Remove unregisters a view and reports whether one was registered
+func (r *Registry) Remove(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, ok := r.views[name]
+	delete(r.views, name)
+	return ok
+}
+
+// Get returns the current state of a view
+func (r *Registry) Get(name string) (View, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	e, ok := r.views[name]
+	if !ok {
+		return View{}, false
+	}
+	return e.view, true
+}
+
+// All returns every registered view sorted by name
+func (r *Registry) All() []View {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	views := make([]View, 0, len(r.views))
+	for _, e := range r.views {
+		views = append(views, e.view)
+	}
+	sort.Slice(views, func(i, j int) bool { return views[i].Name < views[j].Name })
+	return views
+}
+
+// Refresh recomputes the views whose sources overlap the changed path and returns
+// the views whose value changed. Views that do not read the path are not recomputed.
+func (r *Registry) Refresh(path string) []View {
+	if !strings.HasPrefix(path, ".") {
+		path = "." + path
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var changed []View
+	for _, e := range r.views {
+		if !e.dependsOn(path) {
+			continue
+		}
+
+		value, err := r.compute(e.view.Definition)
+		if err != nil {
+			// Keep serving the last value until the sources can be read again
+			logging.Errorf("Error refreshing view %s: %v", e.view.Name, err)
+			continue
+		}
+		if reflect.DeepEqual(value, e.view.Value) {
+			continue
+		}
+
+		e.view.Value = value
+		e.view.UpdatedAt = time.Now()
+		changed = append(changed, e.view)
+	}
+
+	sort.Slice(changed, func(i, j int) bool { return changed[i].Name < changed[j].Name })
+	return changed
+}
+
+// dependsOn reports whether a change at path can affect the view
+func (e *entry) dependsOn(path string) bool {
+	for _, source := range e.sources {
+		if pathsOverlap(source, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// pathsOverlap reports whether one path equals or contains the other
+func pathsOverlap(a, b string) bool {
+	if a == b || a == "." || b == "." {
+		return true
+	}
+	return isWithin(a, b) || isWithin(b, a)
+}
+
+// isWithin reports whether path is below parent
+func isWithin(path, parent string) bool {
+	return strings.HasPrefix(path, parent+".") || strings.HasPrefix(path, parent+"[")
+}
+
+// compile checks the paths of a definition and returns the path prefixes it reads
+func (r *Registry) compile(definition Definition) ([]string, error) {
+	if definition.From == "" {
+		return nil, fmt.Errorf("%w: from is required", ErrInvalidDefinition)
+	}
+
+	expressions := []string{definition.From}
+	for name, field := range definition.Select {
+		if field.Join == nil {
+			if err := checkPath(field.Path); err != nil {
+				return nil, fmt.Errorf("%w: select %s: %v", ErrInvalidDefinition, name, err)
+			}
+			continue
+		}
+
+		if field.Join.From == "" || len(field.Join.On) == 0 {
+			return nil, fmt.Errorf("%w: select %s: a join needs from and on", ErrInvalidDefinition, name)
+		}
+		for _, path := range field.Join.On {
+			if err := checkPath(path); err != nil {
+				return nil, fmt.Errorf("%w: select %s: %v", ErrInvalidDefinition, name, err)
+			}
+		}
+		if field.Join.Select != "" {
+			if err := checkPath(field.Join.Select); err != nil {
+				return nil, fmt.Errorf("%w: select %s: %v", ErrInvalidDefinition, name, err)
+			}
+		}
+		expressions = append(expressions, field.Join.From)
+	}
+
+	sources := make([]string, 0, len(expressions))
+	for _, expression := range expressions {
+		if _, err := query.NewParser().Parse(expression); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidDefinition, expression, err)
+		}
+
+		// Any change at or below the part before the first wildcard can affect the selection
+		source := expression
+		if i := strings.Index(source, "[*]"); i >= 0 {
+			source = source[:i]
+		}
+		if source == "" {
+			source = "."
+		}
+		sources = append(sources, source)
+	}
+	return sources, nil
+}
+
+// checkPath checks a path within a value, which may not contain wildcards
+func checkPath(path string) error {
+	if strings.Contains(path, "[*]") {
+		return errors.New("wildcards are only allowed in from")
+	}
+	_, err := query.NewParser().Parse(path)
+	return err
+}
+
+// compute evaluates a definition against the current store data
+func (r *Registry) compute(definition Definition) (interface{}, error) {
+	selections := make(map[string][]interface{})
+	selectValues := func(expression string) ([]interface{}, error) {
+		if values, ok := selections[expression]; ok {
+			return values, nil
+		}
+		values, err := r.selectValues(expression)
+		if err != nil {
+			return nil, err
+		}
+		selections[expression] = values
+		return values, nil
+	}
+
+	values, err := selectValues(definition.From)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []interface{}{}
+	for _, value := range values {
+		if !matchesWhere(value, definition.Where) {
+			continue
+		}
+
+		if len(definition.Select) == 0 {
+			results = append(results, value)
+			continue
+		}
+
+		projected := make(map[string]interface{}, len(definition.Select))
+		for name, field := range definition.Select {
+			if field.Join == nil {
+				projected[name] = r.lookup(value, field.Path)
+				continue
+			}
+
+			candidates, err := selectValues(field.Join.From)
+			if err != nil {
+				return nil, err
+			}
+			projected[name] = r.join(value, field.Join, candidates)
+		}
+		results = append(results, projected)
+	}
+
+	if strings.Contains(definition.From, "[*]") {
+		return results, nil
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+	return results[0], nil
+}
+
+// selectValues returns the values selected by a path expression, in document order.
+// Only the top-level key the expression starts with is read from the store.
+func (r *Registry) selectValues(expression string) ([]interface{}, error) {
+	root, rest := splitRoot(expression)
+
+	data, err := r.source.Get(root)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	// Work on plain JSON values so views never share memory with the store
+	data, err = toJSONValue(data)
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := r.matcher.Match(data, rest)
+	if err != nil {
+		if err == query.ErrPathNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	values := make([]interface{}, 0, len(matches))
+	for _, match := range matches {
+		values = append(values, match.Value)
+	}
+	return values, nil
+}
+
+// splitRoot splits an expression into its top-level key and the path below it
+func splitRoot(expression string) (string, string) {
+	if expression == "" || expression == "." || strings.HasPrefix(expression, "[") {
+		return ".", "." + strings.TrimPrefix(expression, ".")
+	}
+
+	end := strings.IndexAny(expression[1:], ".[")
+	if end < 0 {
+		return expression, "."
+	}
+	end++
+	return expression[:end], "." + strings.TrimPrefix(expression[end:], ".")
+}
+
+// isNotFound reports whether a store error means the path does not exist
+func isNotFound(err error) bool {
+	return errors.Is(err, store.ErrPathNotFound) || errors.Is(err, query.ErrPathNotFound)
+}
+
+// lookup returns the value at a path within value, or nil when it is missing
+func (r *Registry) lookup(value interface{}, path string) interface{} {
+	if path == "" || path == "." {
+		return value
+	}
+	result, err := r.matcher.Get(value, path)
+	if err != nil {
+		return nil
+	}
+	return result
+}
+
+// join returns the selected part of the first candidate matching the join condition
+func (r *Registry) join(value interface{}, join *Join, candidates []interface{}) interface{} {
+	for _, candidate := range candidates {
+		fields, ok := candidate.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		matched := true
+		for field, path := range join.On {
+			expected := r.lookup(value, path)
+			if actual, exists := fields[field]; !exists || expected == nil || !reflect.DeepEqual(actual, expected) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return r.lookup(candidate, join.Select)
+		}
+	}
+	return nil
+}
+
+// matchesWhere reports whether value has every field in where with an equal value
+func matchesWhere(value interface{}, where map[string]interface{}) bool {
+	if len(where) == 0 {
+		return true
+	}
+
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	for field, expected := range where {
+		actual, exists := fields[field]
+		if !exists || !reflect.DeepEqual(actual, expected) {
+			return false
+		}
+	}
+	return true
+}
+
+// toJSONValue converts value to the types produced by encoding/json
+func toJSONValue(value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
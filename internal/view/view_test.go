@@ -0,0 +1,152 @@
+package view_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/piske-alex/go-sse/internal/store"
+	"github.com/piske-alex/go-sse/internal/view"
+)
+
+// countingSource counts the store reads made by a registry
+type countingSource struct {
+	store.Store
+	reads int
+}
+
+func (s *countingSource) Get(path string) (interface{}, error) {
+	s.reads++
+	return s.Store.Get(path)
+}
+
+func newTestStore(t *testing.T) *store.KVStore {
+	t.Helper()
+	kvStore := store.NewStore()
+	err := kvStore.Initialize(map[string]interface{}{
+		"data": map[string]interface{}{
+			"positions": []interface{}{
+				map[string]interface{}{"id": "p1", "offerId": "o1", "qty": 2, "status": "open"},
+				map[string]interface{}{"id": "p2", "offerId": "o2", "qty": 5, "status": "closed"},
+				map[string]interface{}{"id": "p3", "offerId": "o2", "qty": 1, "status": "open"},
+			},
+			"offers": []interface{}{
+				map[string]interface{}{"id": "o1", "price": 10.5},
+				map[string]interface{}{"id": "o2", "price": 7},
+			},
+		},
+		"settings": map[string]interface{}{"currency": "EUR"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to initialize store: %v", err)
+	}
+	return kvStore
+}
+
+func TestRegistry_Compute(t *testing.T) {
+	registry := view.NewRegistry(newTestStore(t))
+
+	// Positions enriched with offer prices
+	v, err := registry.Register("open_positions", view.Definition{
+		From:  ".data.positions[*]",
+		Where: map[string]interface{}{"status": "open"},
+		Select: map[string]view.Field{
+			"id":    {Path: ".id"},
+			"qty":   {Path: ".qty"},
+			"price": {Join: &view.Join{From: ".data.offers[*]", On: map[string]string{"id": ".offerId"}, Select: ".price"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to register view: %v", err)
+	}
+
+	expected := []interface{}{
+		map[string]interface{}{"id": "p1", "qty": float64(2), "price": 10.5},
+		map[string]interface{}{"id": "p3", "qty": float64(1), "price": float64(7)},
+	}
+	if !reflect.DeepEqual(v.Value, expected) {
+		t.Errorf("Expected %v, got %v", expected, v.Value)
+	}
+
+	// A view without a wildcard is a single value
+	v, err = registry.Register("currency", view.Definition{From: ".settings", Select: map[string]view.Field{"code": {Path: ".currency"}}})
+	if err != nil {
+		t.Fatalf("Failed to register view: %v", err)
+	}
+	if !reflect.DeepEqual(v.Value, map[string]interface{}{"code": "EUR"}) {
+		t.Errorf("Unexpected single value %v", v.Value)
+	}
+
+	// Missing sources give an empty view
+	v, err = registry.Register("missing", view.Definition{From: ".nothing[*]"})
+	if err != nil {
+		t.Fatalf("Failed to register view: %v", err)
+	}
+	if !reflect.DeepEqual(v.Value, []interface{}{}) {
+		t.Errorf("Expected an empty view, got %v", v.Value)
+	}
+}
+
+func TestRegistry_Refresh(t *testing.T) {
+	kvStore := newTestStore(t)
+	source := &countingSource{Store: kvStore}
+	registry := view.NewRegistry(source)
+
+	_, err := registry.Register("quantities", view.Definition{
+		From:   ".data.positions[*]",
+		Select: map[string]view.Field{"qty": {Path: ".qty"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to register view: %v", err)
+	}
+
+	// Changes outside the sources do not recompute the view
+	reads := source.reads
+	kvStore.Set(".settings.currency", "USD")
+	if changed := registry.Refresh(".settings.currency"); len(changed) != 0 || source.reads != reads {
+		t.Errorf("Expected no recomputation, got %v after %d reads", changed, source.reads-reads)
+	}
+
+	// Changes to a projected field update the view
+	kvStore.Set(".data.positions[1].qty", 6)
+	changed := registry.Refresh(".data.positions[1].qty")
+	if len(changed) != 1 || changed[0].Name != "quantities" {
+		t.Fatalf("Expected the view to change, got %v", changed)
+	}
+	if qty := changed[0].Value.([]interface{})[1].(map[string]interface{})["qty"]; qty != float64(6) {
+		t.Errorf("Expected the new quantity, got %v", qty)
+	}
+
+	// Changes to fields the view does not select leave it unchanged
+	kvStore.Set(".data.positions[1].status", "open")
+	if changed := registry.Refresh(".data.positions[1].status"); len(changed) != 0 {
+		t.Errorf("Expected an unchanged view, got %v", changed)
+	}
+
+	// The materialized value is served without reading the store
+	reads = source.reads
+	if v, ok := registry.Get("quantities"); !ok || len(v.Value.([]interface{})) != 3 || source.reads != reads {
+		t.Errorf("Unexpected view %v after %d reads", v, source.reads-reads)
+	}
+}
+
+func TestRegistry_InvalidDefinitions(t *testing.T) {
+	registry := view.NewRegistry(store.NewStore())
+
+	tests := []struct {
+		name       string
+		definition view.Definition
+		err        error
+	}{
+		{"bad name!", view.Definition{From: ".data"}, view.ErrInvalidName},
+		{"no_from", view.Definition{}, view.ErrInvalidDefinition},
+		{"bad_path", view.Definition{From: "data"}, view.ErrInvalidDefinition},
+		{"wildcard_select", view.Definition{From: ".data", Select: map[string]view.Field{"x": {Path: ".a[*]"}}}, view.ErrInvalidDefinition},
+		{"join_without_on", view.Definition{From: ".data", Select: map[string]view.Field{"x": {Join: &view.Join{From: ".offers[*]"}}}}, view.ErrInvalidDefinition},
+	}
+	for _, tt := range tests {
+		if _, err := registry.Register(tt.name, tt.definition); !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.err, err)
+		}
+	}
+}
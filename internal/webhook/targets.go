@@ -0,0 +1,77 @@
+package webhook
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// errPrivateTarget is returned when a delivery would connect to a private address
+var errPrivateTarget = errors.New("refusing to connect to a private address")
+
+// internalPrefixes are the ranges refused besides those the netip predicates cover:
+// "this network" and the shared address space, where some clouds serve metadata
+var internalPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+}
+
+// privateAddr reports whether addr is loopback, private, link-local (which includes
+// the 169.254.169.254 metadata address), unspecified, multicast or otherwise internal
+func privateAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() || addr.IsUnspecified() {
+		return true
+	}
+	for _, prefix := range internalPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// privateHost reports whether the host of a webhook URL is known to be private
+// without resolving it. Names are checked again when a delivery connects.
+func privateHost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	addr, err := netip.ParseAddr(host)
+	return err == nil && privateAddr(addr)
+}
+
+// newClient returns the HTTP client of the deliveries. Unless private targets are
+// allowed it checks every address it connects to after the name is resolved, so
+// redirects and names resolving to private addresses are refused as well.
+func newClient(options Options) *http.Client {
+	if options.AllowPrivateTargets {
+		return &http.Client{Timeout: options.Timeout}
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil || privateAddr(addr) {
+				return errPrivateTarget
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: options.Timeout, Transport: transport}
+}
@@ -0,0 +1,452 @@
+// Package webhook delivers store changes to HTTP endpoints as signed JSON requests.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/piske-alex/go-sse/internal/logging"
+	"github.com/piske-alex/go-sse/internal/query"
+)
+
+const (
+	// SignatureHeader carries the hex HMAC-SHA256 of the request body, prefixed with "sha256="
+	SignatureHeader = "X-GoSSE-Signature"
+	// EventHeader carries the event type of the change
+	EventHeader = "X-GoSSE-Event"
+	// DeliveryHeader carries the delivery ID, which stays the same across retries
+	DeliveryHeader = "X-GoSSE-Delivery"
+
+	// queueSize bounds the deliveries waiting for each webhook
+	queueSize = 1000
+	// maxDeadLetters bounds the failed deliveries kept for each webhook
+	maxDeadLetters = 100
+)
+
+var (
+	// ErrNotFound is returned for unknown webhook IDs
+	ErrNotFound = errors.New("webhook not found")
+
+	// ErrInvalidWebhook is returned for webhooks that cannot be registered
+	ErrInvalidWebhook = errors.New("invalid webhook")
+)
+
+// Options configures delivery retries
+type Options struct {
+	MaxAttempts    int           // Attempts per delivery before it is dead-lettered
+	InitialBackoff time.Duration // Delay before the first retry, doubled after each failure
+	MaxBackoff     time.Duration // Upper bound of the delay between retries
+	Timeout        time.Duration // Timeout of each delivery request
+
+	// AllowPrivateTargets allows deliveries to loopback, private, link-local and other
+	// internal addresses, which are refused by default so that webhooks cannot reach
+	// services behind the server such as cloud metadata endpoints
+	AllowPrivateTargets bool
+}
+
+// DefaultOptions returns the delivery options used when nothing is configured
+func DefaultOptions() Options {
+	return Options{
+		MaxAttempts:    5,
+		InitialBackoff: time.Second,
+		MaxBackoff:     time.Minute,
+		Timeout:        10 * time.Second,
+	}
+}
+
+// OptionsFromEnv reads the delivery options from the environment
+func OptionsFromEnv() Options {
+	options := DefaultOptions()
+
+	if value := os.Getenv("WEBHOOK_MAX_ATTEMPTS"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			options.MaxAttempts = n
+		}
+	}
+
+	durations := map[string]*time.Duration{
+		"WEBHOOK_INITIAL_BACKOFF": &options.InitialBackoff,
+		"WEBHOOK_MAX_BACKOFF":     &options.MaxBackoff,
+		"WEBHOOK_TIMEOUT":         &options.Timeout,
+	}
+	for name, target := range durations {
+		if value := os.Getenv(name); value != "" {
+			if d, err := time.ParseDuration(value); err == nil && d > 0 {
+				*target = d
+			}
+		}
+	}
+
+	if value := os.Getenv("WEBHOOK_ALLOW_PRIVATE_TARGETS"); value != "" {
+		if allow, err := strconv.ParseBool(value); err == nil {
+			options.AllowPrivateTargets = allow
+		}
+	}
+
+	return options
+}
+
+// Webhook is a registered subscription
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Filter    string    `json:"filter"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Status summarizes the deliveries of a webhook
+type Status struct {
+	Delivered           int64      `json:"delivered"`
+	Failed              int64      `json:"failed"`
+	Pending             int        `json:"pending"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastAttemptAt       *time.Time `json:"last_attempt_at,omitempty"`
+	LastSuccessAt       *time.Time `json:"last_success_at,omitempty"`
+	LastStatusCode      int        `json:"last_status_code,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+	DeadLetters         int        `json:"dead_letters"`
+}
+
+// Event is the JSON body of a delivery
+type Event struct {
+	ID      string      `json:"id"`
+	Webhook string      `json:"webhook"`
+	Event   string      `json:"event"`
+	Path    string      `json:"path"`
+	Value   interface{} `json:"value"`
+	Time    int64       `json:"time"`
+}
+
+// DeadLetter is a delivery that failed every attempt
+type DeadLetter struct {
+	Event    Event     `json:"event"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// subscription is a registered webhook with its delivery queue and status
+type subscription struct {
+	webhook     Webhook
+	secret      []byte
+	filter      *query.Filter
+	queue       chan Event
+	cancel      context.CancelFunc
+	done        chan struct{}
+	mu          sync.Mutex
+	status      Status
+	deadLetters []DeadLetter
+}
+
+// Manager holds webhook subscriptions and delivers matching changes to them.
+// Each webhook has its own queue, so deliveries to one endpoint are made in order
+// and a slow endpoint does not hold up the others. It is safe for concurrent use.
+type Manager struct {
+	options       Options
+	client        *http.Client
+	mu            sync.RWMutex
+	subscriptions map[string]*subscription
+}
+
+// NewManager creates a manager with no webhooks
+func NewManager(options Options) *Manager {
+	return &Manager{
+		options:       options,
+		client:        newClient(options),
+		subscriptions: make(map[string]*subscription),
+	}
+}
+
+// Create registers a webhook that receives the changes matching filter, signed with secret
+func (m *Manager) Create(endpoint, filter, secret string) (Webhook, error) {
+	parsed, err := url.Parse(endpoint)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return Webhook{}, fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidWebhook)
+	}
+	if !m.options.AllowPrivateTargets && privateHost(parsed.Hostname()) {
+		return Webhook{}, fmt.Errorf("%w: url must not point to a private address", ErrInvalidWebhook)
+	}
+	if secret == "" {
+		return Webhook{}, fmt.Errorf("%w: secret is required", ErrInvalidWebhook)
+	}
+	if filter == "" {
+		filter = "."
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sub := &subscription{
+		webhook: Webhook{
+			ID:        uuid.New().String(),
+			URL:       endpoint,
+			Filter:    filter,
+			CreatedAt: time.Now(),
+		},
+		secret: []byte(secret),
+		filter: query.NewFilter(filter),
+		queue:  make(chan Event, queueSize),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	m.mu.Lock()
+	m.subscriptions[sub.webhook.ID] = sub
+	m.mu.Unlock()
+
+	go m.deliver(ctx, sub)
+
+	logging.Infof("Registered webhook %s for %s with filter %s", sub.webhook.ID, endpoint, filter)
+	return sub.webhook, nil
+}
+
+// Get returns a webhook
+func (m *Manager) Get(id string) (Webhook, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sub, ok := m.subscriptions[id]
+	if !ok {
+		return Webhook{}, false
+	}
+	return sub.webhook, true
+}
+
+// List returns every webhook, oldest first
+func (m *Manager) List() []Webhook {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	webhooks := make([]Webhook, 0, len(m.subscriptions))
+	for _, sub := range m.subscriptions {
+		webhooks = append(webhooks, sub.webhook)
+	}
+	sort.Slice(webhooks, func(i, j int) bool { return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt) })
+	return webhooks
+}
+
+// Delete unregisters a webhook and drops its pending deliveries
+func (m *Manager) Delete(id string) error {
+	m.mu.Lock()
+	sub, ok := m.subscriptions[id]
+	delete(m.subscriptions, id)
+	m.mu.Unlock()
+
+	if !ok {
+		return ErrNotFound
+	}
+	sub.cancel()
+	<-sub.done
+	return nil
+}
+
+// Status returns the delivery status of a webhook
+func (m *Manager) Status(id string) (Status, error) {
+	sub, err := m.subscription(id)
+	if err != nil {
+		return Status{}, err
+	}
+
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	status := sub.status
+	status.Pending = len(sub.queue)
+	status.DeadLetters = len(sub.deadLetters)
+	return status, nil
+}
+
+// DeadLetters returns the deliveries of a webhook that failed every attempt, oldest first
+func (m *Manager) DeadLetters(id string) ([]DeadLetter, error) {
+	sub, err := m.subscription(id)
+	if err != nil {
+		return nil, err
+	}
+
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	return append([]DeadLetter{}, sub.deadLetters...), nil
+}
+
+// Notify queues a change for every webhook whose filter matches it
+func (m *Manager) Notify(path string, value interface{}, eventType string) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, sub := range m.subscriptions {
+		if !sub.filter.IsMatch(path, value) {
+			continue
+		}
+
+		event := Event{
+			ID:      uuid.New().String(),
+			Webhook: sub.webhook.ID,
+			Event:   eventType,
+			Path:    path,
+			Value:   value,
+			Time:    time.Now().UnixNano() / int64(time.Millisecond),
+		}
+
+		select {
+		case sub.queue <- event:
+		default:
+			// The endpoint is too far behind; keep the change for inspection instead of blocking writers
+			sub.deadLetter(DeadLetter{Event: event, Error: "delivery queue full", FailedAt: time.Now()})
+		}
+	}
+}
+
+// Close stops delivering to every webhook
+func (m *Manager) Close() {
+	m.mu.Lock()
+	subscriptions := m.subscriptions
+	m.subscriptions = make(map[string]*subscription)
+	m.mu.Unlock()
+
+	for _, sub := range subscriptions {
+		sub.cancel()
+		<-sub.done
+	}
+}
+
+// subscription returns a registered webhook
+func (m *Manager) subscription(id string) (*subscription, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sub, ok := m.subscriptions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return sub, nil
+}
+
+// deliver sends the queued events of a webhook one at a time until it is deleted
+func (m *Manager) deliver(ctx context.Context, sub *subscription) {
+	defer close(sub.done)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-sub.queue:
+			m.deliverWithRetries(ctx, sub, event)
+		}
+	}
+}
+
+// deliverWithRetries attempts a delivery with exponential backoff and dead-letters it
+// once every attempt has failed
+func (m *Manager) deliverWithRetries(ctx context.Context, sub *subscription, event Event) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		sub.deadLetter(DeadLetter{Event: event, Error: err.Error(), FailedAt: time.Now()})
+		return
+	}
+
+	backoff := m.options.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		statusCode, err := m.post(ctx, sub, event, body)
+		sub.recordAttempt(statusCode, err)
+		if err == nil {
+			return
+		}
+
+		if attempt >= m.options.MaxAttempts {
+			logging.Warnf("Webhook %s failed to deliver %s after %d attempts: %v", sub.webhook.ID, event.ID, attempt, err)
+			sub.deadLetter(DeadLetter{Event: event, Attempts: attempt, Error: err.Error(), FailedAt: time.Now()})
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > m.options.MaxBackoff {
+			backoff = m.options.MaxBackoff
+		}
+	}
+}
+
+// post sends one delivery attempt and fails unless the endpoint responds with a 2xx status
+func (m *Manager) post(ctx context.Context, sub *subscription, event Event, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event.Event)
+	req.Header.Set(DeliveryHeader, event.ID)
+	req.Header.Set(SignatureHeader, Sign(sub.secret, body))
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// recordAttempt updates the status after a delivery attempt
+func (sub *subscription) recordAttempt(statusCode int, err error) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	now := time.Now()
+	sub.status.LastAttemptAt = &now
+	sub.status.LastStatusCode = statusCode
+	if err != nil {
+		sub.status.ConsecutiveFailures++
+		sub.status.LastError = err.Error()
+		return
+	}
+
+	sub.status.Delivered++
+	sub.status.ConsecutiveFailures = 0
+	sub.status.LastSuccessAt = &now
+	sub.status.LastError = ""
+}
+
+// deadLetter keeps a failed delivery, dropping the oldest when the list is full
+func (sub *subscription) deadLetter(letter DeadLetter) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	sub.status.Failed++
+	sub.deadLetters = append(sub.deadLetters, letter)
+	if len(sub.deadLetters) > maxDeadLetters {
+		sub.deadLetters = sub.deadLetters[len(sub.deadLetters)-maxDeadLetters:]
+	}
+}
+
+// Sign returns the signature header value of body: "sha256=" and the hex HMAC-SHA256 with secret
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is the valid signature of body with secret
+func Verify(secret, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
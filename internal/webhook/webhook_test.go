@@ -0,0 +1,233 @@
+package webhook_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/piske-alex/go-sse/internal/webhook"
+)
+
+// testOptions retries quickly so failures are dead-lettered within the test, and
+// allows the loopback addresses the httptest receivers listen on
+var testOptions = webhook.Options{
+	MaxAttempts:         3,
+	InitialBackoff:      10 * time.Millisecond,
+	MaxBackoff:          20 * time.Millisecond,
+	Timeout:             time.Second,
+	AllowPrivateTargets: true,
+}
+
+// receiver records the deliveries made to an httptest server
+type receiver struct {
+	mu         sync.Mutex
+	events     []webhook.Event
+	signatures []string
+	bodies     [][]byte
+}
+
+func (rec *receiver) handle(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	var event webhook.Event
+	json.Unmarshal(body, &event)
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.events = append(rec.events, event)
+	rec.signatures = append(rec.signatures, r.Header.Get(webhook.SignatureHeader))
+	rec.bodies = append(rec.bodies, body)
+}
+
+func (rec *receiver) count() int {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return len(rec.events)
+}
+
+// waitFor polls until condition holds or fails after a second
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("Timed out waiting for deliveries")
+}
+
+func TestManager_DeliversSignedMatchingChanges(t *testing.T) {
+	rec := &receiver{}
+	server := httptest.NewServer(http.HandlerFunc(rec.handle))
+	defer server.Close()
+
+	manager := webhook.NewManager(testOptions)
+	defer manager.Close()
+
+	hook, err := manager.Create(server.URL, ".data.positions", "s3cret")
+	if err != nil {
+		t.Fatalf("Failed to create webhook: %v", err)
+	}
+
+	manager.Notify(".data.positions[0].qty", float64(3), "update")
+	manager.Notify(".data.offers", []interface{}{}, "update")
+	manager.Notify(".data.positions[1]", nil, "delete")
+
+	waitFor(t, func() bool { return rec.count() == 2 })
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.events[0].Path != ".data.positions[0].qty" || rec.events[0].Value != float64(3) || rec.events[0].Webhook != hook.ID {
+		t.Errorf("Unexpected first delivery %+v", rec.events[0])
+	}
+	if rec.events[1].Event != "delete" {
+		t.Errorf("Expected deliveries in order, got %+v", rec.events[1])
+	}
+	for i, body := range rec.bodies {
+		if !webhook.Verify([]byte("s3cret"), body, rec.signatures[i]) {
+			t.Errorf("Invalid signature %q for delivery %d", rec.signatures[i], i)
+		}
+	}
+
+	status, err := manager.Status(hook.ID)
+	if err != nil {
+		t.Fatalf("Failed to get status: %v", err)
+	}
+	if status.Delivered != 2 || status.Failed != 0 || status.LastStatusCode != http.StatusOK {
+		t.Errorf("Unexpected status %+v", status)
+	}
+}
+
+func TestManager_RetriesAndDeadLetters(t *testing.T) {
+	// The receiver fails the first attempt of every delivery
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	manager := webhook.NewManager(testOptions)
+	defer manager.Close()
+
+	hook, err := manager.Create(server.URL, ".", "s3cret")
+	if err != nil {
+		t.Fatalf("Failed to create webhook: %v", err)
+	}
+
+	manager.Notify(".count", float64(1), "update")
+	waitFor(t, func() bool {
+		status, _ := manager.Status(hook.ID)
+		return status.Delivered == 1
+	})
+	if got := atomic.LoadInt32(&attempts); got != 2 {
+		t.Errorf("Expected a retry after the failure, got %d attempts", got)
+	}
+
+	// Deliveries to an endpoint that keeps failing are dead-lettered
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	failingHook, err := manager.Create(failing.URL, ".count", "s3cret")
+	if err != nil {
+		t.Fatalf("Failed to create webhook: %v", err)
+	}
+
+	manager.Notify(".count", float64(2), "update")
+	waitFor(t, func() bool {
+		letters, _ := manager.DeadLetters(failingHook.ID)
+		return len(letters) == 1
+	})
+
+	letters, _ := manager.DeadLetters(failingHook.ID)
+	if letters[0].Attempts != testOptions.MaxAttempts || letters[0].Event.Value != float64(2) {
+		t.Errorf("Unexpected dead letter %+v", letters[0])
+	}
+	status, _ := manager.Status(failingHook.ID)
+	if status.Failed != 1 || status.ConsecutiveFailures != testOptions.MaxAttempts || status.LastStatusCode != http.StatusInternalServerError {
+		t.Errorf("Unexpected status %+v", status)
+	}
+}
+
+func TestManager_InvalidWebhooks(t *testing.T) {
+	manager := webhook.NewManager(testOptions)
+	defer manager.Close()
+
+	if _, err := manager.Create("ftp://example.com", ".", "s3cret"); !errors.Is(err, webhook.ErrInvalidWebhook) {
+		t.Errorf("Expected an invalid URL error, got %v", err)
+	}
+	if _, err := manager.Create("https://example.com/hook", ".", ""); !errors.Is(err, webhook.ErrInvalidWebhook) {
+		t.Errorf("Expected a missing secret error, got %v", err)
+	}
+	if err := manager.Delete("missing"); !errors.Is(err, webhook.ErrNotFound) {
+		t.Errorf("Expected a not found error, got %v", err)
+	}
+}
+
+func TestManager_RefusesPrivateTargets(t *testing.T) {
+	options := testOptions
+	options.AllowPrivateTargets = false
+	manager := webhook.NewManager(options)
+	defer manager.Close()
+
+	for _, target := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://localhost/hook",
+		"http://10.1.2.3/hook",
+		"http://192.168.0.10/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://100.100.100.200/hook",
+		"http://0.0.0.0/hook",
+		"http://[::1]/hook",
+		"http://[fd00:ec2::254]/hook",
+		"http://[::ffff:127.0.0.1]/hook",
+	} {
+		if _, err := manager.Create(target, ".", "s3cret"); !errors.Is(err, webhook.ErrInvalidWebhook) {
+			t.Errorf("Expected %s to be refused, got %v", target, err)
+		}
+	}
+
+	// Names are checked when a delivery connects, once they are resolved
+	rec := &receiver{}
+	server := httptest.NewServer(http.HandlerFunc(rec.handle))
+	defer server.Close()
+
+	host, err := os.Hostname()
+	if err != nil {
+		t.Skipf("No host name: %v", err)
+	}
+	addrs, err := net.LookupHost(host)
+	if err != nil || len(addrs) == 0 || addrs[0] != "127.0.0.1" {
+		t.Skipf("Host name %q does not resolve to the loopback address", host)
+	}
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	hook, err := manager.Create("http://"+net.JoinHostPort(host, port)+"/hook", ".", "s3cret")
+	if err != nil {
+		t.Fatalf("Failed to create webhook: %v", err)
+	}
+	manager.Notify(".count", float64(1), "update")
+
+	waitFor(t, func() bool {
+		status, _ := manager.Status(hook.ID)
+		return status.Failed == 1
+	})
+	if rec.count() != 0 {
+		t.Errorf("Expected no delivery to the loopback address, got %d", rec.count())
+	}
+	if status, _ := manager.Status(hook.ID); !strings.Contains(status.LastError, "private address") {
+		t.Errorf("Expected the private address to be reported, got %+v", status)
+	}
+}
@@ -0,0 +1,297 @@
+// Package client is a Go client for the go-sse REST API and event stream.
+//
+// A Client reads and writes the store over HTTP. Subscribe opens an event stream that
+// reconnects on its own and keeps a local mirror of the subscribed paths up to date.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotFound matches errors for store paths that do not exist
+var ErrNotFound = errors.New("not found")
+
+// Error is an error response from the server
+type Error struct {
+	StatusCode int           // HTTP status code
+	Type       string        // Error type, such as "query_failed" or "rate_limited"
+	Message    string        // Human readable description
+	RetryAfter time.Duration // Time to wait before retrying, from the Retry-After header
+}
+
+// Error describes the error response
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("go-sse: %d %s", e.StatusCode, e.Type)
+	}
+	return fmt.Sprintf("go-sse: %d %s: %s", e.StatusCode, e.Type, e.Message)
+}
+
+// Is reports whether the error is a 404, so that errors.Is(err, ErrNotFound) works
+func (e *Error) Is(target error) bool {
+	return target == ErrNotFound && e.StatusCode == http.StatusNotFound
+}
+
+// Match is a value found by FindMatches with its concrete path
+type Match struct {
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+// Client calls a go-sse server
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	header     http.Header
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used for requests. Event streams stay open
+// indefinitely, so it should not set a Timeout.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithHeader adds a header to every request, for example an Authorization header
+func WithHeader(key, value string) Option {
+	return func(c *Client) {
+		c.header.Add(key, value)
+	}
+}
+
+// WithNamespace sends every request to a namespace served under /ns/{name}
+func WithNamespace(name string) Option {
+	return func(c *Client) {
+		c.baseURL += "/ns/" + url.PathEscape(name)
+	}
+}
+
+// New creates a client for the server at baseURL, such as "http://localhost:8080"
+func New(baseURL string, options ...Option) (*Client, error) {
+	parsed, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server URL: %w", err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return nil, fmt.Errorf("invalid server URL %q: scheme must be http or https", baseURL)
+	}
+
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{},
+		header:     make(http.Header),
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c, nil
+}
+
+// Get decodes the value at path into v, which works like the target of json.Unmarshal
+func (c *Client) Get(ctx context.Context, path string, v interface{}) error {
+	resp, err := c.do(ctx, http.MethodGet, "/store", url.Values{"path": {path}}, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode value at %s: %w", path, err)
+	}
+	return nil
+}
+
+// Set replaces the value at path, creating missing parent objects
+func (c *Client) Set(ctx context.Context, path string, value interface{}) error {
+	return c.SetWithTTL(ctx, path, value, 0)
+}
+
+// SetWithTTL replaces the value at path and has the server delete it after ttl.
+// A ttl of zero keeps the value until it is changed.
+func (c *Client) SetWithTTL(ctx context.Context, path string, value interface{}, ttl time.Duration) error {
+	query := url.Values{"path": {path}}
+	if ttl > 0 {
+		query.Set("ttl", ttl.String())
+	}
+	return c.send(ctx, http.MethodPatch, "/store", query, value)
+}
+
+// Delete removes the value at path. Deleting "." empties the store.
+func (c *Client) Delete(ctx context.Context, path string) error {
+	resp, err := c.do(ctx, http.MethodDelete, "/store", url.Values{"path": {path}}, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Initialize replaces the whole store with data, which must encode to a JSON object
+func (c *Client) Initialize(ctx context.Context, data interface{}) error {
+	return c.send(ctx, http.MethodPost, "/store", nil, data)
+}
+
+// FindMatches returns the values matching a path pattern such as ".users[*].name"
+func (c *Client) FindMatches(ctx context.Context, pattern string) ([]Match, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/store", url.Values{"path": {pattern}, "pattern": {"true"}}, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var matches []Match
+	if err := json.NewDecoder(resp.Body).Decode(&matches); err != nil {
+		return nil, fmt.Errorf("failed to decode matches for %s: %w", pattern, err)
+	}
+	return matches, nil
+}
+
+// Export writes the store to w as newline-delimited JSON, one {"path", "value"} object
+// per line. granularity is "key" for one line per top-level key or "leaf" for one per leaf
+// value; empty means "key".
+func (c *Client) Export(ctx context.Context, w io.Writer, granularity string) error {
+	query := url.Values{"format": {"ndjson"}}
+	if granularity != "" {
+		query.Set("granularity", granularity)
+	}
+	resp, err := c.do(ctx, http.MethodGet, "/store/export", query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("failed to read export: %w", err)
+	}
+	return nil
+}
+
+// Import applies a newline-delimited JSON stream in the format written by Export and
+// returns the number of lines applied. With replace the store is emptied first.
+func (c *Client) Import(ctx context.Context, r io.Reader, replace bool) (int, error) {
+	var query url.Values
+	if replace {
+		query = url.Values{"replace": {"true"}}
+	}
+	req, err := c.newRequest(ctx, http.MethodPost, "/store/import", query, r)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	resp, err := c.doRequest(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Data struct {
+			Lines int `json:"lines"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return 0, fmt.Errorf("failed to decode import response: %w", err)
+	}
+	return body.Data.Lines, nil
+}
+
+// send encodes value as JSON and sends it, discarding the success response
+func (c *Client) send(ctx context.Context, method, endpoint string, query url.Values, value interface{}) error {
+	body, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode value: %w", err)
+	}
+
+	resp, err := c.do(ctx, method, endpoint, query, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+// newRequest builds a request to endpoint with the client's headers
+func (c *Client) newRequest(ctx context.Context, method, endpoint string, query url.Values, body io.Reader) (*http.Request, error) {
+	target := c.baseURL + endpoint
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range c.header {
+		req.Header[key] = append([]string(nil), values...)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// do sends a request and turns error responses into *Error. The caller closes the body.
+func (c *Client) do(ctx context.Context, method, endpoint string, query url.Values, body io.Reader) (*http.Response, error) {
+	req, err := c.newRequest(ctx, method, endpoint, query, body)
+	if err != nil {
+		return nil, err
+	}
+	return c.doRequest(req)
+}
+
+// doRequest sends req and turns error responses into *Error. The caller closes the body.
+func (c *Client) doRequest(req *http.Request) (*http.Response, error) {
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+	return resp, nil
+}
+
+// responseError reads the error from an unsuccessful response
+func responseError(resp *http.Response) *Error {
+	apiErr := &Error{
+		StatusCode: resp.StatusCode,
+		Type:       http.StatusText(resp.StatusCode),
+		RetryAfter: retryAfter(resp.Header.Get("Retry-After")),
+	}
+
+	var body struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err == nil && body.Error != "" {
+		apiErr.Type = body.Error
+		apiErr.Message = body.Message
+	}
+	return apiErr
+}
+
+// retryAfter parses a Retry-After header given in seconds
+func retryAfter(value string) time.Duration {
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
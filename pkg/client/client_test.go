@@ -0,0 +1,275 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/piske-alex/go-sse/internal/api"
+	"github.com/piske-alex/go-sse/internal/sse"
+	"github.com/piske-alex/go-sse/internal/store"
+	"github.com/piske-alex/go-sse/pkg/client"
+)
+
+// newServer starts the real router over an in-memory store
+func newServer(t *testing.T) (*httptest.Server, *sse.Server, *client.Client) {
+	t.Helper()
+	kvStore := store.NewStore()
+	sseServer := sse.NewServer(kvStore)
+	handler := api.NewHandler(kvStore, sseServer, api.DefaultHandlerOptions())
+	server := httptest.NewServer(api.SetupRouter(handler))
+	// Registered first so it runs after the subscriptions are closed
+	t.Cleanup(server.Close)
+	t.Cleanup(handler.Webhooks.Close)
+
+	c, err := client.New(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	return server, sseServer, c
+}
+
+// waitFor polls cond until it holds or the test times out
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// mirrored returns the mirrored value at path encoded as JSON, or "missing"
+func mirrored(sub *client.Subscription, path string) string {
+	value, ok := sub.Mirror().Get(path)
+	if !ok {
+		return "missing"
+	}
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
+
+func TestClient_Store(t *testing.T) {
+	_, _, c := newServer(t)
+	ctx := context.Background()
+
+	err := c.Initialize(ctx, map[string]interface{}{
+		"users": []map[string]interface{}{
+			{"name": "Alice", "status": "online"},
+			{"name": "Bob", "status": "away"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to initialize: %v", err)
+	}
+
+	// Values decode into typed targets
+	type user struct {
+		Name   string `json:"name"`
+		Status string `json:"status"`
+	}
+	var users []user
+	if err := c.Get(ctx, ".users", &users); err != nil {
+		t.Fatalf("Failed to get users: %v", err)
+	}
+	if len(users) != 2 || users[1].Name != "Bob" {
+		t.Errorf("Unexpected users %+v", users)
+	}
+
+	if err := c.Set(ctx, ".users[0].status", "away"); err != nil {
+		t.Fatalf("Failed to set: %v", err)
+	}
+	var status string
+	if err := c.Get(ctx, ".users[0].status", &status); err != nil || status != "away" {
+		t.Errorf("Expected the new status, got %q %v", status, err)
+	}
+
+	matches, err := c.FindMatches(ctx, ".users[*].name")
+	if err != nil {
+		t.Fatalf("Failed to find matches: %v", err)
+	}
+	if len(matches) != 2 || matches[0].Path != ".users[0].name" || matches[1].Value != "Bob" {
+		t.Errorf("Unexpected matches %+v", matches)
+	}
+
+	if err := c.Delete(ctx, ".users"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	err = c.Get(ctx, ".users", &users)
+	var apiErr *client.Error
+	if !errors.Is(err, client.ErrNotFound) || !errors.As(err, &apiErr) || apiErr.Type != "query_failed" {
+		t.Errorf("Expected a not found error, got %v", err)
+	}
+
+	// Writes the server rejects are returned as errors
+	if err := c.Initialize(ctx, []int{1, 2}); err == nil {
+		t.Error("Expected an error when initializing with an array")
+	}
+}
+
+func TestSubscribe_Mirror(t *testing.T) {
+	server, _, c := newServer(t)
+	ctx := context.Background()
+	c.Initialize(ctx, map[string]interface{}{
+		"orders": map[string]interface{}{"a": map[string]interface{}{"qty": 1}},
+		"users":  map[string]interface{}{"alice": "online"},
+	})
+
+	var (
+		mutex sync.Mutex
+		ids   []string
+	)
+	sub := c.Subscribe(ctx, client.SubscribeOptions{
+		Filters: []string{".orders"},
+		OnEvent: func(event client.Event) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			if event.ID != "" {
+				ids = append(ids, event.ID)
+			}
+		},
+	})
+	t.Cleanup(sub.Close)
+
+	// The mirror starts with the initial data of the subscribed paths only
+	waitFor(t, "initial data", func() bool { return mirrored(sub, ".orders.a.qty") == "1" })
+	if got := mirrored(sub, ".users"); got != "missing" {
+		t.Errorf("Expected unsubscribed paths to be missing, got %s", got)
+	}
+
+	// Updates, array operations and deletes are applied
+	c.Set(ctx, ".orders.b", map[string]interface{}{"items": []string{"x"}})
+	waitFor(t, "update", func() bool { return mirrored(sub, ".orders.b.items") == `["x"]` })
+
+	ops := []string{
+		`{"op":"append","value":"z"}`,
+		`{"op":"insert","index":1,"value":"y"}`,
+		`{"op":"remove","value":"x"}`,
+	}
+	for _, op := range ops {
+		resp, err := http.Post(server.URL+"/store/ops?path=.orders.b.items", "application/json", strings.NewReader(op))
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("Failed to apply %s: %v", op, err)
+		}
+		resp.Body.Close()
+	}
+	waitFor(t, "array operations", func() bool { return mirrored(sub, ".orders.b.items") == `["y","z"]` })
+
+	c.Delete(ctx, ".orders.a")
+	waitFor(t, "delete", func() bool { return mirrored(sub, ".orders.a") == "missing" })
+
+	mutex.Lock()
+	if len(ids) == 0 || sub.LastEventID() != ids[len(ids)-1] {
+		t.Errorf("Expected the last event ID to be tracked, got %q of %v", sub.LastEventID(), ids)
+	}
+	mutex.Unlock()
+
+	// Changing the filters refills the mirror
+	sub.SetFilters(".users")
+	waitFor(t, "new filters", func() bool { return mirrored(sub, ".users.alice") == `"online"` })
+	if got := mirrored(sub, ".orders"); got != "missing" {
+		t.Errorf("Expected the old filter to be dropped, got %s", got)
+	}
+	if filters := sub.Filters(); len(filters) != 1 || filters[0] != ".users" {
+		t.Errorf("Unexpected filters %v", filters)
+	}
+}
+
+func TestSubscribe_Reconnect(t *testing.T) {
+	_, sseServer, c := newServer(t)
+	ctx := context.Background()
+	c.Initialize(ctx, map[string]interface{}{"count": 1})
+
+	var (
+		mutex   sync.Mutex
+		resumed []bool
+		errs    int
+	)
+	sub := c.Subscribe(ctx, client.SubscribeOptions{
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 50 * time.Millisecond,
+		OnEvent: func(event client.Event) {
+			if event.Type != "connected" {
+				return
+			}
+			var data struct {
+				Resumed string `json:"resumed"`
+			}
+			json.Unmarshal(event.Data, &data)
+			mutex.Lock()
+			resumed = append(resumed, data.Resumed == "true")
+			mutex.Unlock()
+		},
+		OnError: func(error) {
+			mutex.Lock()
+			errs++
+			mutex.Unlock()
+		},
+	})
+	t.Cleanup(sub.Close)
+
+	<-sub.Connected()
+	c.Set(ctx, ".count", 2)
+	waitFor(t, "update", func() bool { return mirrored(sub, ".count") == "2" })
+
+	connections := func() int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(resumed)
+	}
+
+	// A dropped stream resumes from the last event without resending the data
+	sseServer.RemoveClient(sseServer.Clients()[0].ID)
+	waitFor(t, "reconnect", func() bool { return connections() == 2 })
+	mutex.Lock()
+	if !resumed[1] || errs != 1 {
+		t.Errorf("Expected one error and a resumed connection, got %v after %d errors", resumed, errs)
+	}
+	mutex.Unlock()
+	if got := mirrored(sub, ".count"); got != "2" {
+		t.Errorf("Expected the mirror to be kept, got %s", got)
+	}
+
+	// Events missed while disconnected are caught up with fresh initial data
+	waitFor(t, "registration", func() bool { return len(sseServer.Clients()) == 1 })
+	sseServer.RemoveClient(sseServer.Clients()[0].ID)
+	c.Set(ctx, ".count", 3)
+	waitFor(t, "catch up", func() bool { return mirrored(sub, ".count") == "3" })
+
+	// A disconnect event stops the subscription
+	waitFor(t, "registration", func() bool { return len(sseServer.Clients()) == 1 })
+	sseServer.DisconnectClient(sseServer.Clients()[0].ID, "maintenance")
+	if err := sub.Err(); !errors.Is(err, client.ErrDisconnected) || !strings.Contains(err.Error(), "maintenance") {
+		t.Errorf("Expected a disconnect error, got %v", err)
+	}
+}
+
+func TestSubscribe_Refused(t *testing.T) {
+	server, _, _ := newServer(t)
+
+	c, err := client.New(server.URL, client.WithNamespace("missing"))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	sub := c.Subscribe(context.Background(), client.SubscribeOptions{})
+	select {
+	case <-sub.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the subscription to stop")
+	}
+	if err := sub.Err(); !errors.Is(err, client.ErrNotFound) {
+		t.Errorf("Expected a not found error, got %v", err)
+	}
+
+	if _, err := client.New("localhost:8080"); err == nil {
+		t.Error("Expected an error for a URL without a scheme")
+	}
+}
@@ -0,0 +1,205 @@
+package client
+
+import (
+	"sync"
+
+	"github.com/piske-alex/go-sse/internal/query"
+)
+
+// Mirror is a local copy of the store paths a subscription receives, kept up to date
+// from its events. Values are shared between reads and must not be modified.
+type Mirror struct {
+	root   interface{}
+	mutex  sync.RWMutex
+	parser *query.Parser
+}
+
+// newMirror creates an empty mirror
+func newMirror() *Mirror {
+	return &Mirror{
+		root:   map[string]interface{}{},
+		parser: query.NewParser(),
+	}
+}
+
+// Get returns the mirrored value at path, and false when the path is not mirrored
+func (m *Mirror) Get(path string) (interface{}, bool) {
+	m.mutex.RLock()
+	root := m.root
+	m.mutex.RUnlock()
+
+	value, err := query.NewMatcher().Get(root, path)
+	if err != nil {
+		return nil, false
+	}
+	return value, true
+}
+
+// Snapshot returns the whole mirror
+func (m *Mirror) Snapshot() interface{} {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.root
+}
+
+// reset empties the mirror before it is filled again with initial data
+func (m *Mirror) reset() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.root = map[string]interface{}{}
+}
+
+// apply changes the mirror as described by a store event. Events of other
+// types, and those with paths the mirror cannot parse, are ignored.
+func (m *Mirror) apply(event Event) {
+	var edit func(container interface{}, last query.PathSegment) interface{}
+	switch event.Type {
+	case "initial_data", "update", "upsert", "increment", "decrement", "toggle":
+		edit = func(container interface{}, last query.PathSegment) interface{} {
+			return setElement(container, last, event.Value)
+		}
+	case "delete", "expire":
+		edit = deleteElement
+	case "append", "prepend", "insert":
+		edit = func(container interface{}, last query.PathSegment) interface{} {
+			return insertElement(container, last, event.Value)
+		}
+	case "remove":
+		edit = removeElement
+	default:
+		return
+	}
+
+	segments, err := m.parser.Parse(event.Path)
+	if err != nil {
+		return
+	}
+	// The first segment is the root
+	segments = segments[1:]
+	for _, segment := range segments {
+		if segment.Type == query.Wildcard {
+			return
+		}
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if len(segments) == 0 {
+		// Writes to the root replace the whole mirror
+		root, ok := event.Value.(map[string]interface{})
+		if !ok || event.Type == "delete" || event.Type == "expire" {
+			root = map[string]interface{}{}
+		}
+		m.root = root
+		return
+	}
+	m.root = modify(m.root, segments, edit)
+}
+
+// modify returns a copy of node in which edit has replaced the container of the last
+// segment. Missing or mistyped containers along the way are replaced by empty ones.
+func modify(node interface{}, segments []query.PathSegment, edit func(container interface{}, last query.PathSegment) interface{}) interface{} {
+	if len(segments) == 1 {
+		return edit(node, segments[0])
+	}
+
+	segment := segments[0]
+	switch segment.Type {
+	case query.Property:
+		copied := copyObject(node, 1)
+		copied[segment.Value] = modify(copied[segment.Value], segments[1:], edit)
+		return copied
+	case query.Index:
+		copied := copyArray(node, segment.Index+1)
+		copied[segment.Index] = modify(copied[segment.Index], segments[1:], edit)
+		return copied
+	}
+	return node
+}
+
+// setElement sets the property or array element of container named by last
+func setElement(container interface{}, last query.PathSegment, value interface{}) interface{} {
+	if last.Type == query.Property {
+		copied := copyObject(container, 1)
+		copied[last.Value] = value
+		return copied
+	}
+
+	copied := copyArray(container, last.Index+1)
+	copied[last.Index] = value
+	return copied
+}
+
+// deleteElement deletes a property, or clears an array element like the store does
+func deleteElement(container interface{}, last query.PathSegment) interface{} {
+	if last.Type == query.Property {
+		object, ok := container.(map[string]interface{})
+		if !ok {
+			return container
+		}
+		copied := copyObject(object, 0)
+		delete(copied, last.Value)
+		return copied
+	}
+
+	array, ok := container.([]interface{})
+	if !ok || last.Index >= len(array) {
+		return container
+	}
+	copied := copyArray(array, 0)
+	copied[last.Index] = nil
+	return copied
+}
+
+// insertElement inserts value into an array before the element at last.Index
+func insertElement(container interface{}, last query.PathSegment, value interface{}) interface{} {
+	if last.Type != query.Index {
+		return setElement(container, last, value)
+	}
+
+	array, _ := container.([]interface{})
+	index := last.Index
+	if index > len(array) {
+		index = len(array)
+	}
+
+	copied := make([]interface{}, 0, len(array)+1)
+	copied = append(copied, array[:index]...)
+	copied = append(copied, value)
+	return append(copied, array[index:]...)
+}
+
+// removeElement removes the array element at last.Index, shifting the ones after it
+func removeElement(container interface{}, last query.PathSegment) interface{} {
+	array, ok := container.([]interface{})
+	if !ok || last.Type != query.Index || last.Index >= len(array) {
+		return container
+	}
+
+	copied := make([]interface{}, 0, len(array)-1)
+	copied = append(copied, array[:last.Index]...)
+	return append(copied, array[last.Index+1:]...)
+}
+
+// copyObject returns a copy of node if it is an object, or a new object otherwise
+func copyObject(node interface{}, extra int) map[string]interface{} {
+	object, _ := node.(map[string]interface{})
+	copied := make(map[string]interface{}, len(object)+extra)
+	for key, value := range object {
+		copied[key] = value
+	}
+	return copied
+}
+
+// copyArray returns a copy of node if it is an array, or a new array otherwise,
+// padded with nil to at least length elements
+func copyArray(node interface{}, length int) []interface{} {
+	array, _ := node.([]interface{})
+	if length < len(array) {
+		length = len(array)
+	}
+	copied := make([]interface{}, length)
+	copy(copied, array)
+	return copied
+}
@@ -0,0 +1,399 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrDisconnected is returned by Subscription.Err when the server closed the stream
+// with a disconnect event, for example from the admin API. The subscription does not reconnect.
+var ErrDisconnected = errors.New("disconnected by the server")
+
+// errResync ends a stream so that it reconnects at once with fresh initial data
+var errResync = errors.New("resync requested")
+
+// Event is an event received on a subscription
+type Event struct {
+	ID    string          // Event ID, empty for events without one such as initial_data
+	Type  string          // Event type, such as "initial_data", "update" or "delete"
+	Path  string          // Store path the event is about
+	Value interface{}     // New value, or the removed value for deletes and removals
+	Time  time.Time       // When the server sent the event
+	Data  json.RawMessage // The event data as sent
+}
+
+// SubscribeOptions configures a subscription
+type SubscribeOptions struct {
+	Filters    []string      // Paths to subscribe to, such as ".users" or ".orders[*]"; all paths when empty
+	MinBackoff time.Duration // First reconnect delay, 500ms when zero
+	MaxBackoff time.Duration // Longest reconnect delay, 30s when zero
+
+	// OnEvent is called with every event, in order and after the mirror has applied it
+	OnEvent func(Event)
+	// OnError is called with the error that ended a connection before reconnecting
+	OnError func(error)
+}
+
+// Subscription is an event stream that reconnects with backoff and mirrors the subscribed paths
+type Subscription struct {
+	client  *Client
+	options SubscribeOptions
+	mirror  *Mirror
+
+	mutex        sync.Mutex
+	filters      []string
+	lastEventID  string
+	cancelStream context.CancelFunc // Ends the current connection
+	restart      bool               // Set when the current connection was ended to apply a change
+
+	connected     chan struct{}
+	connectedOnce sync.Once
+	cancel        context.CancelFunc
+	done          chan struct{}
+	err           error
+}
+
+// Subscribe opens an event stream in the background. It reconnects until ctx is
+// cancelled, Close is called or the server refuses the subscription.
+func (c *Client) Subscribe(ctx context.Context, options SubscribeOptions) *Subscription {
+	if options.MinBackoff <= 0 {
+		options.MinBackoff = 500 * time.Millisecond
+	}
+	if options.MaxBackoff < options.MinBackoff {
+		options.MaxBackoff = 30 * time.Second
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	s := &Subscription{
+		client:    c,
+		options:   options,
+		mirror:    newMirror(),
+		filters:   append([]string(nil), options.Filters...),
+		connected: make(chan struct{}),
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+	go s.run(ctx)
+	return s
+}
+
+// Mirror returns the local copy of the subscribed paths
+func (s *Subscription) Mirror() *Mirror {
+	return s.mirror
+}
+
+// Connected is closed once the first connection is established
+func (s *Subscription) Connected() <-chan struct{} {
+	return s.connected
+}
+
+// Done is closed when the subscription has stopped
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns why the subscription stopped: nil after Close, the context's error,
+// ErrDisconnected, or the *Error of a refused connection
+func (s *Subscription) Err() error {
+	<-s.done
+	return s.err
+}
+
+// Close stops the subscription and waits for it to end
+func (s *Subscription) Close() {
+	s.cancel()
+	<-s.done
+}
+
+// LastEventID returns the ID of the last event received, sent as Last-Event-ID on reconnect
+func (s *Subscription) LastEventID() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.lastEventID
+}
+
+// Filters returns the subscribed paths
+func (s *Subscription) Filters() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string(nil), s.filters...)
+}
+
+// SetFilters replaces the subscribed paths. The stream reconnects and the mirror is refilled.
+func (s *Subscription) SetFilters(filters ...string) {
+	s.mutex.Lock()
+	s.filters = append([]string(nil), filters...)
+	s.mutex.Unlock()
+	s.resync()
+}
+
+// AddFilter subscribes to another path
+func (s *Subscription) AddFilter(filter string) {
+	filters := s.Filters()
+	for _, existing := range filters {
+		if existing == filter {
+			return
+		}
+	}
+	s.SetFilters(append(filters, filter)...)
+}
+
+// RemoveFilter unsubscribes from a path
+func (s *Subscription) RemoveFilter(filter string) {
+	filters := s.Filters()
+	kept := filters[:0]
+	for _, existing := range filters {
+		if existing != filter {
+			kept = append(kept, existing)
+		}
+	}
+	if len(kept) != len(filters) {
+		s.SetFilters(kept...)
+	}
+}
+
+// resync ends the current connection so that the next one starts with fresh initial data
+func (s *Subscription) resync() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.lastEventID = ""
+	s.restart = true
+	if s.cancelStream != nil {
+		s.cancelStream()
+	}
+}
+
+// run connects and reconnects until the subscription stops
+func (s *Subscription) run(ctx context.Context) {
+	defer close(s.done)
+
+	attempt := 0
+	for {
+		streamCtx, cancel := context.WithCancel(ctx)
+		s.mutex.Lock()
+		s.cancelStream = cancel
+		s.restart = false
+		s.mutex.Unlock()
+
+		connected, serverDelay, err := s.stream(streamCtx)
+		cancel()
+
+		if ctx.Err() != nil {
+			if !errors.Is(ctx.Err(), context.Canceled) {
+				s.err = ctx.Err()
+			}
+			return
+		}
+
+		s.mutex.Lock()
+		restart := s.restart
+		s.mutex.Unlock()
+		if restart || errors.Is(err, errResync) {
+			attempt = 0
+			continue
+		}
+
+		if errors.Is(err, ErrDisconnected) || permanent(err) {
+			s.err = err
+			return
+		}
+		if s.options.OnError != nil {
+			if err == nil {
+				err = io.ErrUnexpectedEOF
+			}
+			s.options.OnError(err)
+		}
+
+		if connected {
+			attempt = 0
+		}
+		delay := s.backoff(attempt)
+		attempt++
+		if serverDelay > delay {
+			delay = serverDelay
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns the delay before reconnect attempt, doubling from MinBackoff up to
+// MaxBackoff with jitter so that clients of a restarted server spread out
+func (s *Subscription) backoff(attempt int) time.Duration {
+	delay := s.options.MaxBackoff
+	if attempt < 30 {
+		if d := s.options.MinBackoff << attempt; d < delay {
+			delay = d
+		}
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// permanent reports whether the server refused the subscription for a reason a retry cannot fix
+func permanent(err error) bool {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.StatusCode >= 400 && apiErr.StatusCode < 500 && apiErr.StatusCode != http.StatusTooManyRequests
+}
+
+// stream reads one connection until it ends. It reports whether the connection was
+// established and how long the server asked to wait before reconnecting.
+func (s *Subscription) stream(ctx context.Context) (connected bool, retry time.Duration, err error) {
+	s.mutex.Lock()
+	query := url.Values{}
+	if len(s.filters) > 0 {
+		query.Set("filter", strings.Join(s.filters, ","))
+	}
+	lastEventID := s.lastEventID
+	s.mutex.Unlock()
+
+	req, err := s.client.newRequest(ctx, http.MethodGet, "/events", query, nil)
+	if err != nil {
+		return false, 0, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	resp, err := s.client.httpClient.Do(req)
+	if err != nil {
+		return false, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		apiErr := responseError(resp)
+		return false, apiErr.RetryAfter, apiErr
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	var (
+		eventType string
+		eventID   string
+		data      strings.Builder
+		hasData   bool
+	)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, io.EOF) {
+				return connected, retry, nil
+			}
+			return connected, retry, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		// A blank line dispatches the event
+		if line == "" {
+			if eventType != "" || hasData {
+				isConnected, err := s.dispatch(eventType, eventID, data.String())
+				connected = connected || isConnected
+				if err != nil {
+					return connected, retry, err
+				}
+			}
+			eventType, eventID, hasData = "", "", false
+			data.Reset()
+			continue
+		}
+
+		// Lines starting with a colon are comments such as keep-alives
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			eventType = value
+		case "data":
+			if hasData {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+			hasData = true
+		case "id":
+			eventID = value
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms >= 0 {
+				retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+}
+
+// dispatch applies an event to the mirror and passes it on. It reports whether the
+// event established the connection, and returns an error when the stream must end.
+func (s *Subscription) dispatch(eventType, id, data string) (bool, error) {
+	if eventType == "" {
+		eventType = "message"
+	}
+	event := Event{ID: id, Type: eventType, Data: json.RawMessage(data)}
+
+	var payload struct {
+		Path    string      `json:"path"`
+		Value   interface{} `json:"value"`
+		Time    int64       `json:"time"`
+		Resumed string      `json:"resumed"`
+		Reason  string      `json:"reason"`
+	}
+	if err := json.Unmarshal([]byte(data), &payload); err == nil {
+		event.Path = payload.Path
+		event.Value = payload.Value
+		if payload.Time > 0 {
+			event.Time = time.UnixMilli(payload.Time)
+		}
+	}
+
+	connected := false
+	var err error
+	switch eventType {
+	case "connected":
+		// Without a resume the initial data that follows replaces the mirror
+		if payload.Resumed != "true" {
+			s.mirror.reset()
+		}
+		connected = true
+		s.connectedOnce.Do(func() { close(s.connected) })
+	case "init":
+		// The store was replaced, so fetch it again
+		err = errResync
+	case "disconnect":
+		err = fmt.Errorf("%w: %s", ErrDisconnected, payload.Reason)
+	default:
+		s.mirror.apply(event)
+	}
+
+	s.mutex.Lock()
+	if id != "" {
+		s.lastEventID = id
+	}
+	if errors.Is(err, errResync) {
+		s.lastEventID = ""
+	}
+	s.mutex.Unlock()
+
+	if s.options.OnEvent != nil {
+		s.options.OnEvent(event)
+	}
+	return connected, err
+}
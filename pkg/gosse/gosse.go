@@ -0,0 +1,292 @@
+// Package gosse embeds the go-sse store, query engine and event fan-out in another Go program.
+//
+//	server, err := gosse.New(gosse.WithPrefix("/realtime"))
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer server.Close()
+//	mux.Handle("/realtime/", server.Handler())
+//
+// The server serves the same routes as the standalone binary. Settings not given as
+// options are read from the environment variables the standalone server documents.
+package gosse
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/piske-alex/go-sse/internal/api"
+	"github.com/piske-alex/go-sse/internal/sse"
+	"github.com/piske-alex/go-sse/internal/store"
+	"github.com/piske-alex/go-sse/internal/webhook"
+)
+
+// AuthFunc authorizes a request. Requests for which it returns an error are refused
+// with 401 and the error as the message. Probes and CORS preflight requests are not checked.
+type AuthFunc func(r *http.Request) error
+
+// Option configures a Server
+type Option func(*options) error
+
+// Types of the settings of the options
+type (
+	CORSOptions    = api.CORSOptions  // Origins allowed to call the API from a browser
+	LimitOptions   = api.LimitOptions // Client identification and store rate limits
+	WebhookOptions = webhook.Options  // Delivery retries and allowed targets of webhooks
+)
+
+// options collects the settings of New
+type options struct {
+	store      Store
+	auth       AuthFunc
+	middleware []func(http.Handler) http.Handler
+	prefix     string
+	handler    api.HandlerOptions
+	maxClients int
+}
+
+// WithStore serves a store created by the host instead of a new in-memory store
+func WithStore(s Store) Option {
+	return func(o *options) error {
+		if s == nil {
+			return errors.New("store must not be nil")
+		}
+		o.store = s
+		return nil
+	}
+}
+
+// WithAuth checks every request with auth before it reaches the API
+func WithAuth(auth AuthFunc) Option {
+	return func(o *options) error {
+		o.auth = auth
+		return nil
+	}
+}
+
+// WithMiddleware wraps the API in middleware, the first one outermost. Middleware runs
+// before the auth hook, so it can for example put the caller's identity on the request.
+func WithMiddleware(middleware ...func(http.Handler) http.Handler) Option {
+	return func(o *options) error {
+		o.middleware = append(o.middleware, middleware...)
+		return nil
+	}
+}
+
+// WithLogger sends the server's logs to logger. The server logs through the standard
+// logger, so this changes its output, prefix and flags for the whole process.
+func WithLogger(logger *log.Logger) Option {
+	return func(o *options) error {
+		if logger == nil {
+			return errors.New("logger must not be nil")
+		}
+		log.SetOutput(logger.Writer())
+		log.SetPrefix(logger.Prefix())
+		log.SetFlags(logger.Flags())
+		return nil
+	}
+}
+
+// WithPrefix serves the routes under prefix, such as "/realtime", so that a host
+// router can mount Handler at that path
+func WithPrefix(prefix string) Option {
+	return func(o *options) error {
+		if !strings.HasPrefix(prefix, "/") || strings.HasSuffix(prefix, "/") {
+			return fmt.Errorf("prefix %q must start with / and must not end with /", prefix)
+		}
+		o.prefix = prefix
+		return nil
+	}
+}
+
+// WithAdminToken enables the admin API and webhooks with a bearer token, or disables
+// them when token is empty
+func WithAdminToken(token string) Option {
+	return func(o *options) error {
+		o.handler.AdminToken = token
+		return nil
+	}
+}
+
+// WithCORS sets the origins allowed to call the API from a browser
+func WithCORS(cors CORSOptions) Option {
+	return func(o *options) error {
+		if _, err := regexp.Compile(cors.AllowedOriginPattern); err != nil {
+			return fmt.Errorf("invalid origin pattern: %w", err)
+		}
+		o.handler.CORS = cors
+		return nil
+	}
+}
+
+// WithLimits sets how clients are identified and how fast they may use the store
+func WithLimits(limits LimitOptions) Option {
+	return func(o *options) error {
+		o.handler.Limits = limits
+		return nil
+	}
+}
+
+// WithWebhookOptions sets the delivery retries of webhooks and whether they may reach
+// private addresses
+func WithWebhookOptions(webhooks WebhookOptions) Option {
+	return func(o *options) error {
+		if webhooks.MaxAttempts <= 0 || webhooks.InitialBackoff <= 0 || webhooks.MaxBackoff <= 0 || webhooks.Timeout <= 0 {
+			return errors.New("webhook attempts, backoffs and timeout must be positive")
+		}
+		o.handler.Webhooks = webhooks
+		return nil
+	}
+}
+
+// WithMaxClients caps the number of connected SSE clients
+func WithMaxClients(n int) Option {
+	return func(o *options) error {
+		if n <= 0 {
+			return fmt.Errorf("max clients must be positive, got %d", n)
+		}
+		o.maxClients = n
+		return nil
+	}
+}
+
+// Server is an embedded go-sse server
+type Server struct {
+	store     Store
+	sseServer *sse.Server
+	api       *api.Handler
+	handler   http.Handler
+	closeOnce sync.Once
+}
+
+// New creates a server. It does not listen on its own: serve Handler from the host's HTTP server.
+func New(opts ...Option) (*Server, error) {
+	o := options{handler: api.HandlerOptionsFromEnv()}
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
+	if o.store == nil {
+		o.store = store.NewStore()
+	}
+
+	sseServer := sse.NewServer(o.store)
+	sseServer.SetOptions(sse.OptionsFromEnv())
+	limits := sse.LimitsFromEnv()
+	if o.maxClients > 0 {
+		limits.MaxClients = o.maxClients
+	}
+	sseServer.SetLimits(limits)
+
+	handler := api.NewHandler(o.store, sseServer, o.handler)
+
+	var h http.Handler = api.SetupRouter(handler)
+	if o.auth != nil {
+		h = authorize(h, o.auth, o.prefix)
+	}
+	for i := len(o.middleware) - 1; i >= 0; i-- {
+		h = o.middleware[i](h)
+	}
+	if o.prefix != "" {
+		router := chi.NewRouter()
+		router.Mount(o.prefix, h)
+		h = router
+	}
+
+	return &Server{
+		store:     o.store,
+		sseServer: sseServer,
+		api:       handler,
+		handler:   h,
+	}, nil
+}
+
+// Handler returns the HTTP handler serving the API and event stream
+func (s *Server) Handler() http.Handler {
+	return s.handler
+}
+
+// Store returns the store. Writes made directly to it are not broadcast, except by the
+// change stream of a MongoDB store; use Set and Delete, or call Broadcast after the write.
+func (s *Server) Store() Store {
+	return s.store
+}
+
+// Broadcast sends an event about path to the subscribed clients and webhooks.
+// eventType is usually "update" or "delete".
+func (s *Server) Broadcast(path string, value interface{}, eventType string) {
+	s.sseServer.BroadcastEvent(path, value, eventType)
+}
+
+// Set writes value at path and broadcasts an update event
+func (s *Server) Set(path string, value interface{}) error {
+	if err := s.store.Set(path, value); err != nil {
+		return err
+	}
+	updated, err := s.store.Get(path)
+	if err != nil {
+		return err
+	}
+	s.sseServer.BroadcastWrite(path, updated, "update")
+	return nil
+}
+
+// Delete removes the value at path and broadcasts a delete event
+func (s *Server) Delete(path string) error {
+	if err := s.store.Delete(path); err != nil {
+		return err
+	}
+	s.sseServer.BroadcastWrite(path, nil, "delete")
+	return nil
+}
+
+// Drain stops accepting SSE clients and closes the connected ones in waves, sending
+// each a shutdown event so it reconnects to another instance. Call Close afterwards.
+func (s *Server) Drain(ctx context.Context) {
+	s.sseServer.Drain(ctx, sse.DrainOptionsFromEnv())
+}
+
+// Close closes the SSE connections and stops webhook deliveries. A MongoDB store is disconnected.
+func (s *Server) Close() error {
+	s.closeOnce.Do(func() {
+		s.api.Webhooks.Close()
+		s.sseServer.Shutdown()
+	})
+	return nil
+}
+
+// authorize refuses requests that auth rejects, except probes and CORS preflight requests
+func authorize(next http.Handler, auth AuthFunc, prefix string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions || isProbe(strings.TrimPrefix(r.URL.Path, prefix)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if err := auth(r); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(api.ErrorResponse{
+				Error:   "unauthorized",
+				Code:    http.StatusUnauthorized,
+				Message: err.Error(),
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isProbe reports whether path is a health or readiness probe, which load balancers call without credentials
+func isProbe(path string) bool {
+	return path == "/health" || path == "/livez" || path == "/readyz"
+}
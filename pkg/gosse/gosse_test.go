@@ -0,0 +1,198 @@
+package gosse_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/piske-alex/go-sse/pkg/client"
+	"github.com/piske-alex/go-sse/pkg/gosse"
+)
+
+// waitFor polls cond until it holds or the test times out
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// mirrored returns the mirrored value at path encoded as JSON, or "missing"
+func mirrored(sub *client.Subscription, path string) string {
+	value, ok := sub.Mirror().Get(path)
+	if !ok {
+		return "missing"
+	}
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
+
+func TestServer_Embedded(t *testing.T) {
+	kvStore := gosse.NewMemoryStore()
+	kvStore.Set(".users", map[string]interface{}{"alice": "online"})
+
+	var middlewareCalls int
+	server, err := gosse.New(
+		gosse.WithStore(kvStore),
+		gosse.WithPrefix("/realtime"),
+		gosse.WithAuth(func(r *http.Request) error {
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				return errors.New("missing token")
+			}
+			return nil
+		}),
+		gosse.WithMiddleware(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				middlewareCalls++
+				next.ServeHTTP(w, r)
+			})
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	httpServer := httptest.NewServer(server.Handler())
+	// Registered first so it runs after the subscription is closed
+	t.Cleanup(httpServer.Close)
+	t.Cleanup(func() { server.Close() })
+
+	// Requests without credentials are refused, probes are not
+	resp, err := http.Get(httpServer.URL + "/realtime/store?path=.users")
+	if err != nil {
+		t.Fatalf("Failed to get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a token, got %d", resp.StatusCode)
+	}
+	resp, err = http.Get(httpServer.URL + "/realtime/health")
+	if err != nil {
+		t.Fatalf("Failed to get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the probe to be allowed, got %d", resp.StatusCode)
+	}
+	if middlewareCalls != 2 {
+		t.Errorf("Expected the middleware to run for every request, got %d calls", middlewareCalls)
+	}
+
+	// Routes outside the prefix are not served
+	resp, err = http.Get(httpServer.URL + "/health")
+	if err != nil {
+		t.Fatalf("Failed to get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 outside the prefix, got %d", resp.StatusCode)
+	}
+
+	c, err := client.New(httpServer.URL+"/realtime", client.WithHeader("Authorization", "Bearer secret"))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	ctx := context.Background()
+
+	// The host's store is served
+	var status string
+	if err := c.Get(ctx, ".users.alice", &status); err != nil || status != "online" {
+		t.Errorf("Expected the preloaded value, got %q %v", status, err)
+	}
+
+	sub := c.Subscribe(ctx, client.SubscribeOptions{Filters: []string{".users"}})
+	t.Cleanup(sub.Close)
+	waitFor(t, "initial data", func() bool { return mirrored(sub, ".users.alice") == `"online"` })
+
+	// Writes made by the host reach subscribers
+	if err := server.Set(".users.bob", "away"); err != nil {
+		t.Fatalf("Failed to set: %v", err)
+	}
+	waitFor(t, "update", func() bool { return mirrored(sub, ".users.bob") == `"away"` })
+
+	if err := server.Delete(".users.alice"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	waitFor(t, "delete", func() bool { return mirrored(sub, ".users.alice") == "missing" })
+
+	server.Store().Set(".users.carol", "online")
+	server.Broadcast(".users.carol", "online", "update")
+	waitFor(t, "broadcast", func() bool { return mirrored(sub, ".users.carol") == `"online"` })
+}
+
+func TestNew_InvalidOptions(t *testing.T) {
+	tests := []struct {
+		name   string
+		option gosse.Option
+	}{
+		{"nil store", gosse.WithStore(nil)},
+		{"relative prefix", gosse.WithPrefix("realtime")},
+		{"trailing slash", gosse.WithPrefix("/realtime/")},
+		{"zero clients", gosse.WithMaxClients(0)},
+		{"nil logger", gosse.WithLogger(nil)},
+		{"invalid origin pattern", gosse.WithCORS(gosse.CORSOptions{AllowedOriginPattern: "("})},
+		{"zero webhook attempts", gosse.WithWebhookOptions(gosse.WebhookOptions{})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := gosse.New(tt.option); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestNew_HandlerOptions(t *testing.T) {
+	server, err := gosse.New(
+		gosse.WithAdminToken("secret"),
+		gosse.WithCORS(gosse.CORSOptions{AllowedOrigins: []string{"https://app.example.com"}}),
+		gosse.WithLimits(gosse.LimitOptions{WriteRate: 1, WriteBurst: 1}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer server.Close()
+
+	request := func(method, target, body string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header = header
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, req)
+		return w
+	}
+
+	// The admin token protects webhooks
+	if w := request("GET", "/webhooks", "", http.Header{}); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without the admin token, got %d", w.Code)
+	}
+	if w := request("GET", "/webhooks", "", http.Header{"Authorization": {"Bearer secret"}}); w.Code != http.StatusOK {
+		t.Errorf("Expected the admin token to be accepted, got %d", w.Code)
+	}
+
+	// Only the configured origin is allowed
+	w := request("GET", "/health", "", http.Header{"Origin": {"https://app.example.com"}})
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("Expected the configured origin to be allowed, got %q", got)
+	}
+	w = request("GET", "/health", "", http.Header{"Origin": {"https://other.example.com"}})
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Expected other origins to be refused, got %q", got)
+	}
+
+	// Writes beyond the burst are limited
+	jsonBody := http.Header{"Content-Type": {"application/json"}}
+	if w := request("PATCH", "/store?path=.count", "1", jsonBody); w.Code != http.StatusOK {
+		t.Fatalf("Expected the first write to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := request("PATCH", "/store?path=.count", "2", jsonBody); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the second write to be limited, got %d", w.Code)
+	}
+}
@@ -0,0 +1,31 @@
+package gosse
+
+import (
+	"github.com/piske-alex/go-sse/internal/query"
+	"github.com/piske-alex/go-sse/internal/schema"
+	"github.com/piske-alex/go-sse/internal/store"
+)
+
+// Store is the key-value store behind the server. A custom implementation can wrap
+// the store returned by NewMemoryStore and change only the methods it needs.
+type Store = store.Store
+
+// Types used by the Store methods
+type (
+	MatchResult    = query.MatchResult // A value found by FindMatches with its path
+	Operation      = store.Operation   // An atomic operation such as append or increment
+	Change         = store.Change      // The effect of an operation on one element
+	Revision       = store.Revision    // A write retained in the store history
+	PointInTime    = store.PointInTime // A revision or time to read the history at
+	SchemaRegistry = schema.Registry   // The JSON Schemas writes are validated against
+)
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() Store {
+	return store.NewStore()
+}
+
+// NewMongoStore connects to a store kept in a MongoDB document
+func NewMongoStore(uri, database, collection, documentID string) (Store, error) {
+	return store.NewMongoStore(uri, database, collection, documentID)
+}